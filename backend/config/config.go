@@ -22,7 +22,71 @@ type Config struct {
 	JWTSecret      string `mapstructure:"JWT_SECRET"`
 	ServerPort     string `mapstructure:"SERVER_PORT"`
 	ClientOrigin   string `mapstructure:"CLIENT_ORIGIN"`
-	TokenExpiresIn int    `mapstructure:"TOKEN_EXPIRES_IN"`
+	TokenExpiresIn int    `mapstructure:"TOKEN_EXPIRES_IN"` // refresh token and session lifetime in minutes
+	// TrustedProxies lists the reverse proxies (IPs or CIDRs) whose X-Forwarded-For is believed when
+	// working out the client IP for sign-in throttling and view counting. Empty trusts none.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+	// AccessTokenExpiresIn is the access token lifetime in minutes
+	AccessTokenExpiresIn int `mapstructure:"ACCESS_TOKEN_EXPIRES_IN"`
+	// HotScoreInterval is how often, in minutes, the hot scores used for trending are recomputed
+	HotScoreInterval int `mapstructure:"HOT_SCORE_INTERVAL"`
+
+	// Uploads: STORAGE_DRIVER is "local" (files in UPLOAD_DIR served under UPLOAD_BASE_URL) or "s3"
+	StorageDriver   string `mapstructure:"STORAGE_DRIVER"`
+	UploadMaxSizeMB int    `mapstructure:"UPLOAD_MAX_SIZE_MB"`
+	UploadDir       string `mapstructure:"UPLOAD_DIR"`
+	UploadBaseURL   string `mapstructure:"UPLOAD_BASE_URL"`
+	S3Endpoint      string `mapstructure:"S3_ENDPOINT"`
+	S3Region        string `mapstructure:"S3_REGION"`
+	S3Bucket        string `mapstructure:"S3_BUCKET"`
+	S3AccessKey     string `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey     string `mapstructure:"S3_SECRET_KEY"`
+	S3PublicURL     string `mapstructure:"S3_PUBLIC_URL"`
+
+	// Mail: MAIL_DRIVER is "file" (messages written to MAIL_DIR) or "smtp"
+	MailDriver   string `mapstructure:"MAIL_DRIVER"`
+	MailDir      string `mapstructure:"MAIL_DIR"`
+	MailFrom     string `mapstructure:"MAIL_FROM"`
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+
+	// Student verification
+	CampusEmailDomains  []string `mapstructure:"CAMPUS_EMAIL_DOMAINS"`  // e.g. nhu.edu.cn; subdomains are accepted too
+	VerifiedOnlyActions []string `mapstructure:"VERIFIED_ONLY_ACTIONS"` // see the action names in routes.go
+
+	// LOGIN_ATTEMPT_STORE is "memory" or "redis"; use redis when running several instances
+	LoginAttemptStore string `mapstructure:"LOGIN_ATTEMPT_STORE"`
+	RedisAddr         string `mapstructure:"REDIS_ADDR"`
+	RedisPassword     string `mapstructure:"REDIS_PASSWORD"`
+	RedisDB           int    `mapstructure:"REDIS_DB"`
+
+	// Campus single sign-on through OpenID Connect; disabled while OIDC_ISSUER is empty.
+	// OIDC_REDIRECT_URL is the client page that posts the returned code and state to /auth/sso/callback,
+	// with credentials so that the cookie /auth/sso/login set in the browser comes along.
+	OIDCIssuer         string   `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID       string   `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret   string   `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL    string   `mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCScopes         []string `mapstructure:"OIDC_SCOPES"`
+	OIDCUsernameClaim  string   `mapstructure:"OIDC_USERNAME_CLAIM"`
+	OIDCEmailClaim     string   `mapstructure:"OIDC_EMAIL_CLAIM"`
+	OIDCNameClaim      string   `mapstructure:"OIDC_NAME_CLAIM"`
+	OIDCStudentIdClaim string   `mapstructure:"OIDC_STUDENT_ID_CLAIM"`
+
+	// Two-factor authentication: TWO_FACTOR_ISSUER names the site in authenticator apps, and
+	// TWO_FACTOR_REQUIRED_FOR_ADMINS makes admins set it up before they can sign in
+	TwoFactorIssuer            string `mapstructure:"TWO_FACTOR_ISSUER"`
+	TwoFactorRequiredForAdmins bool   `mapstructure:"TWO_FACTOR_REQUIRED_FOR_ADMINS"`
+
+	// Account deletion: a deleted account is kept for ACCOUNT_DELETION_GRACE_DAYS, during which signing in
+	// cancels it. ACCOUNT_DELETION_MODE is then "anonymize" (content stays under a placeholder) or "delete".
+	AccountDeletionGraceDays int    `mapstructure:"ACCOUNT_DELETION_GRACE_DAYS"`
+	AccountDeletionMode      string `mapstructure:"ACCOUNT_DELETION_MODE"`
+
+	// RolePermissions maps each role to its permission names (see models/permission.go); "*" grants all
+	RolePermissions map[string][]string `mapstructure:"ROLE_PERMISSIONS"`
 }
 
 var AppConfig Config
@@ -45,7 +109,34 @@ func LoadConfig() {
 	viper.SetDefault("JWT_SECRET", "your-secret-key")
 	viper.SetDefault("SERVER_PORT", "8080")
 	viper.SetDefault("CLIENT_ORIGIN", "http://localhost:3000")
+	viper.SetDefault("TRUSTED_PROXIES", []string{})
 	viper.SetDefault("TOKEN_EXPIRES_IN", 60*24*30) // 30 days
+	viper.SetDefault("ACCESS_TOKEN_EXPIRES_IN", 15)
+	viper.SetDefault("HOT_SCORE_INTERVAL", 10)
+	viper.SetDefault("STORAGE_DRIVER", "local")
+	viper.SetDefault("UPLOAD_MAX_SIZE_MB", 10)
+	viper.SetDefault("UPLOAD_DIR", "uploads")
+	viper.SetDefault("UPLOAD_BASE_URL", "/media")
+	viper.SetDefault("S3_REGION", "us-east-1")
+	viper.SetDefault("MAIL_DRIVER", "file")
+	viper.SetDefault("MAIL_DIR", "mail")
+	viper.SetDefault("MAIL_FROM", "NH Community <no-reply@nhcommunity.local>")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("CAMPUS_EMAIL_DOMAINS", []string{})
+	viper.SetDefault("VERIFIED_ONLY_ACTIONS", []string{})
+	viper.SetDefault("LOGIN_ATTEMPT_STORE", "memory")
+	viper.SetDefault("REDIS_ADDR", "localhost:6379")
+	viper.SetDefault("ROLE_PERMISSIONS", models.DefaultRolePermissions)
+	viper.SetDefault("TWO_FACTOR_ISSUER", "NH Community")
+	viper.SetDefault("TWO_FACTOR_REQUIRED_FOR_ADMINS", true)
+	viper.SetDefault("OIDC_REDIRECT_URL", "http://localhost:3000/sso/callback")
+	viper.SetDefault("OIDC_SCOPES", []string{"openid", "profile", "email"})
+	viper.SetDefault("OIDC_USERNAME_CLAIM", "preferred_username")
+	viper.SetDefault("OIDC_EMAIL_CLAIM", "email")
+	viper.SetDefault("OIDC_NAME_CLAIM", "name")
+	viper.SetDefault("OIDC_STUDENT_ID_CLAIM", "student_id")
+	viper.SetDefault("ACCOUNT_DELETION_GRACE_DAYS", 14)
+	viper.SetDefault("ACCOUNT_DELETION_MODE", models.AccountDeletionAnonymize)
 
 	// Try to read config file
 	err := viper.ReadInConfig()
@@ -212,16 +303,47 @@ func RunMigrations(db *gorm.DB) {
 		log.Println("Result: 'users' table DOES NOT EXIST before migration.")
 	}
 
+	// Accounts created before email verification existed are treated as verified
+	backfillEmailVerified := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+	// Messages stored before sequence numbers existed are numbered in the order they were sent
+	backfillMessageSeq := db.Migrator().HasTable(&models.Message{}) &&
+		!db.Migrator().HasColumn(&models.Message{}, "Seq")
+	// Existing members are replayed what was sent after they joined
+	backfillJoinedSeq := db.Migrator().HasTable(&models.ConversationParticipant{}) &&
+		!db.Migrator().HasColumn(&models.ConversationParticipant{}, "JoinedSeq")
+	// Follows made before follow times were recorded are dated to when both accounts existed
+	backfillFollowedAt := db.Migrator().HasTable(&models.UserFollow{}) &&
+		!db.Migrator().HasColumn(&models.UserFollow{}, "CreatedAt")
+
 	// First migrate base tables without foreign keys
 	log.Println("Step 1: Migrating base tables...")
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Partner{},
 		&models.Conversation{},
+		&models.Media{},
+		&models.Session{},
+		&models.ExternalIdentity{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate base tables: %v", err)
 	}
+	// 学号只在认证通过后写入，空字符串会与唯一索引冲突
+	if err := db.Exec("UPDATE users SET student_id = NULL WHERE student_id = ''").Error; err != nil {
+		log.Printf("Warning: Failed to clear empty student ids: %v", err)
+	}
+	// 早期注册时自行填写的学号未经认证，不应占用学号
+	if err := db.Exec("UPDATE users SET student_id = NULL WHERE student_id IS NOT NULL AND student_verified_at IS NULL").Error; err != nil {
+		log.Printf("Warning: Failed to clear unverified student ids: %v", err)
+	}
+	if backfillEmailVerified {
+		if err := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Printf("Warning: Failed to mark existing users as verified: %v", err)
+		}
+	}
 
 	// Then migrate tables with simpler foreign keys
 	log.Println("Step 2: Migrating tables with simpler foreign keys...")
@@ -235,6 +357,11 @@ func RunMigrations(db *gorm.DB) {
 		&models.Notification{},
 		&models.PartnerTag{},
 		&models.ConversationParticipant{},
+		&models.StudentVerification{},
+		&models.ModeratorScope{},
+		&models.UserBlock{},
+		&models.UserMute{},
+		&models.UserFollow{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate tables with simpler foreign keys: %v", err)
@@ -250,10 +377,38 @@ func RunMigrations(db *gorm.DB) {
 		&models.ConfessionLike{},
 		&models.ConfessionComment{},
 		&models.Message{},
+		&models.PostMedia{},
+		&models.MarketplaceMedia{},
+		&models.LostFoundMedia{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate tables with complex foreign keys: %v", err)
 	}
+	if backfillFollowedAt {
+		err := db.Exec("UPDATE user_follows uf JOIN users follower ON follower.id = uf.follower_id " +
+			"JOIN users followed ON followed.id = uf.following_id " +
+			"SET uf.created_at = GREATEST(follower.created_at, followed.created_at) WHERE uf.created_at IS NULL").Error
+		if err != nil {
+			log.Printf("Warning: Failed to date existing follows: %v", err)
+		}
+	}
+	if backfillMessageSeq {
+		err := db.Exec("UPDATE messages m JOIN (SELECT id, ROW_NUMBER() OVER (PARTITION BY conversation_id ORDER BY id) AS seq FROM messages) numbered " +
+			"ON numbered.id = m.id SET m.seq = numbered.seq").Error
+		if err == nil {
+			err = db.Exec("UPDATE conversations SET last_seq = (SELECT COALESCE(MAX(seq), 0) FROM messages WHERE messages.conversation_id = conversations.id)").Error
+		}
+		if err != nil {
+			log.Printf("Warning: Failed to number existing messages: %v", err)
+		}
+	}
+	if backfillJoinedSeq {
+		err := db.Exec("UPDATE conversation_participants cp SET cp.joined_seq = (SELECT COALESCE(MAX(m.seq), 0) FROM messages m " +
+			"WHERE m.conversation_id = cp.conversation_id AND m.created_at < cp.joined_at)").Error
+		if err != nil {
+			log.Printf("Warning: Failed to record when existing members joined: %v", err)
+		}
+	}
 
 	log.Println("Database migrations command completed.")
 
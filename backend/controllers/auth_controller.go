@@ -1,26 +1,35 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"nhcommunity/models"
+	"nhcommunity/repositories"
 	"nhcommunity/services"
 	"nhcommunity/utils"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // AuthController handles authentication endpoints
 type AuthController struct {
-	service services.UserService
-	db      *gorm.DB // Keep DB for now for token management
+	service   services.UserService
+	sessions  services.SessionService
+	accounts  services.AccountService
+	guard     services.LoginGuard
+	sso       services.SSOService
+	twoFactor services.TwoFactorService
 }
 
+// minLoginFailureTime is the least time a failed login takes, whatever the reason it failed
+const minLoginFailureTime = 500 * time.Millisecond
+
 // NewAuthController creates a new auth controller
-func NewAuthController(service services.UserService, db *gorm.DB) *AuthController {
-	return &AuthController{service: service, db: db}
+func NewAuthController(service services.UserService, sessions services.SessionService, accounts services.AccountService, guard services.LoginGuard, sso services.SSOService, twoFactor services.TwoFactorService) *AuthController {
+	return &AuthController{service: service, sessions: sessions, accounts: accounts, guard: guard, sso: sso, twoFactor: twoFactor}
 }
 
 // Register handles user registration
@@ -36,13 +45,12 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 	// 创建用户对象
 	user := &models.User{
-		Username:  req.Username,
-		Email:     strings.ToLower(req.Email),
-		Password:  req.Password,
-		FullName:  req.FullName,
-		StudentId: req.StudentId,
-		Role:      "user",
-		IsActive:  true,
+		Username: req.Username,
+		Email:    strings.ToLower(req.Email),
+		Password: req.Password,
+		FullName: req.FullName,
+		Role:     "user",
+		IsActive: true,
 	}
 
 	createdUser, err := ac.service.Register(user)
@@ -53,40 +61,19 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}
 	log.Printf("INFO: User registered successfully in service: %+v", createdUser)
 
-	// Generate tokens
-	accessToken, err := utils.GenerateToken(createdUser.ID, createdUser.Email, utils.AccessToken, createdUser.Role)
-	if err != nil {
-		log.Printf("ERROR: Failed to generate access token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
-		return
-	}
-
-	refreshToken, err := utils.GenerateToken(createdUser.ID, createdUser.Email, utils.RefreshToken, createdUser.Role)
-	if err != nil {
-		log.Printf("ERROR: Failed to generate refresh token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
-		return
-	}
-	log.Println("INFO: Tokens generated successfully with role:", createdUser.Role)
-
-	// Save refresh token to user
-	if err := ac.db.Model(&createdUser).Update("refresh_token", refreshToken).Error; err != nil {
-		log.Printf("ERROR: Failed to save refresh token: %v", err)
-		// This is not a fatal error for registration, but should be logged.
-		// We can decide if we want to return an error to the user here.
-	} else {
-		log.Println("INFO: Refresh token saved successfully")
+	// The account can sign in once the email address is verified
+	if err := ac.accounts.SendVerificationEmail(createdUser); err != nil {
+		// The user can ask for another email, so registration still succeeds
+		log.Printf("ERROR: Failed to send verification email: %v", err)
 	}
 
 	// Return response
 	log.Println("INFO: Sending successful response")
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
-		"message": "User registered successfully",
+		"message": "User registered successfully, please check your email to verify your account",
 		"data": gin.H{
-			"user":          createdUser.ToResponse(),
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
+			"user": createdUser.ToResponse(),
 		},
 	})
 	log.Println("INFO: Response sent")
@@ -100,47 +87,208 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	// 确定登录标识符（邮箱或用户名）
-	identifier := req.Username
+	// 登录标识符可以是邮箱或用户名
+	identifier := strings.TrimSpace(req.Username)
 	if strings.Contains(identifier, "@") {
-		// 如果是邮箱，直接使用
 		identifier = strings.ToLower(identifier)
-	} else {
-		// 如果是用户名，先查找用户以获取邮箱
-		user, err := ac.service.GetUserByUsername(identifier)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
-			return
-		}
-		identifier = user.Email
 	}
 
-	// 使用邮箱和密码登录
-	user, accessToken, refreshToken, err := ac.service.Login(identifier, req.Password)
+	if wait := ac.guard.Check(identifier, c.ClientIP()); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
+	// 失败的登录统一耗时和提示，避免泄露账号是否存在
+	started := time.Now()
+	user, err := ac.service.Login(identifier, req.Password)
 	if err != nil {
 		log.Printf("ERROR: Failed to login user: %v", err)
+		if errors.Is(err, models.ErrEmailNotVerified) {
+			// 密码正确，只是邮箱尚未验证
+			ac.guard.Success(identifier)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before logging in"})
+			return
+		}
+		if errors.Is(err, models.ErrAccountDisabled) {
+			ac.guard.Success(identifier)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			return
+		}
+		ac.guard.Failure(identifier, c.ClientIP())
+		time.Sleep(time.Until(started.Add(minLoginFailureTime)))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
+	ac.guard.Success(identifier)
+
+	ac.completeLogin(c, user)
+}
+
+// TwoFactorSetup creates the TOTP secret of an account that must set up two-factor authentication
+// to finish logging in
+func (ac *AuthController) TwoFactorSetup(c *gin.Context) {
+	var req models.TwoFactorTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.twoFactor.ParseChallenge(req.Token)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	setup, err := ac.twoFactor.Setup(user.ID)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": setup})
+}
+
+// TwoFactorVerify is the second login step: it exchanges the two-factor token of Login and an
+// authenticator or recovery code for a session. Accounts that just set up two-factor authentication
+// also receive their recovery codes.
+func (ac *AuthController) TwoFactorVerify(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.twoFactor.ParseChallenge(req.Token)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	// 与密码登录分开计数，验证码只有6位，必须限制尝试次数
+	identifier := twoFactorAttemptKey(user.ID)
+	if wait := ac.guard.Check(identifier, c.ClientIP()); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
 
-	// 检查是否需要生成包含角色的新令牌
-	if user.Role != "" {
-		// 生成包含角色信息的令牌
-		accessToken, err = utils.GenerateToken(user.ID, user.Email, utils.AccessToken, user.Role)
-		if err != nil {
-			log.Printf("ERROR: Failed to generate token with role: %v", err)
+	recoveryCodes, err := ac.twoFactor.CompleteLogin(user.ID, req.Code)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+			ac.guard.Failure(identifier, c.ClientIP())
 		}
+		respondTwoFactorError(c, err)
+		return
+	}
+	ac.guard.Success(identifier)
+
+	tokens, err := ac.sessions.Start(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		log.Printf("ERROR: Failed to start session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+
+	data := gin.H{
+		"user":          user.ToResponse(),
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	}
+	if recoveryCodes != nil {
+		data["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Login successful", "data": data})
+}
 
-		// 更新刷新令牌
-		refreshToken, err = utils.GenerateToken(user.ID, user.Email, utils.RefreshToken, user.Role)
-		if err == nil {
-			// 保存新的刷新令牌到数据库
-			user.RefreshToken = refreshToken
-			_, err = ac.service.UpdateCurrentUser(user.ID, &models.UpdateUserRequest{})
-			if err != nil {
-				log.Printf("ERROR: Failed to update refresh token: %v", err)
-			}
+// SSOLogin redirects the browser to the campus identity provider to sign in
+func (ac *AuthController) SSOLogin(c *gin.Context) {
+	if !ac.sso.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campus single sign-on is not enabled"})
+		return
+	}
+
+	authURL, binding, err := ac.sso.Begin()
+	if err != nil {
+		log.Printf("ERROR: Failed to start single sign-on: %v", err)
+		if errors.Is(err, models.ErrSSOBusy) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Campus sign-on is busy, please try again later"})
+			return
 		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Campus sign-on is unavailable, please try again later"})
+		return
+	}
+	setSSOCookie(c, binding, int(services.SSOLoginTimeout.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SSOCallback completes a campus sign-on with the code and state the identity provider returned
+// to the client, and signs the linked user in like Login does
+func (ac *AuthController) SSOCallback(c *gin.Context) {
+	var req models.SSOCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 缺少 cookie 时 binding 为空，Complete 会拒绝
+	binding, _ := c.Cookie(ssoCookieName)
+	setSSOCookie(c, "", -1)
+	user, err := ac.sso.Complete(req.Code, req.State, binding)
+	if err != nil {
+		log.Printf("ERROR: Failed to complete single sign-on: %v", err)
+		switch {
+		case errors.Is(err, models.ErrSSODisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Campus single sign-on is not enabled"})
+		case errors.Is(err, models.ErrInvalidSSOState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-on request expired, please try again"})
+		case errors.Is(err, models.ErrSSOMissingEmail):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Your campus account has no email address"})
+		case errors.Is(err, models.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		case errors.Is(err, repositories.ErrEmailExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists, please sign in with your password"})
+		case errors.Is(err, models.ErrSSOUnverifiedAccount):
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email exists but has not verified it. Reset its password through the emailed link, then sign in with your campus account again"})
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Campus sign-on failed"})
+		}
+		return
+	}
+
+	ac.completeLogin(c, user)
+}
+
+// ssoCookieName is the cookie that ties a sign-on to the browser that started it
+const ssoCookieName = "sso_binding"
+
+// setSSOCookie sets the sign-on cookie, or removes it when maxAge is negative. It is only sent to
+// the sign-on endpoints and is out of reach of scripts.
+func setSSOCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoCookieName, value, maxAge, "/api/v1/auth/sso", "", secure, true)
+}
+
+// completeLogin responds to a user who has just proven who they are. It opens a session and returns
+// its tokens, unless the account needs a second step, in which case only a two-factor token is returned.
+func (ac *AuthController) completeLogin(c *gin.Context, user *models.User) {
+	challenge, err := ac.twoFactor.Challenge(user)
+	if err != nil {
+		log.Printf("ERROR: Failed to check two-factor authentication: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Two-factor authentication required",
+			"data":    challenge,
+		})
+		return
+	}
+
+	tokens, err := ac.sessions.Start(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		log.Printf("ERROR: Failed to start session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -148,43 +296,47 @@ func (ac *AuthController) Login(c *gin.Context) {
 		"message": "Login successful",
 		"data": gin.H{
 			"user":          user.ToResponse(),
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
 		},
 	})
 }
 
-// RefreshToken refreshes an access token using a refresh token
+// RefreshToken exchanges a refresh token for a new access and refresh token.
+// The presented refresh token is spent; reusing it revokes the session.
 func (ac *AuthController) RefreshToken(c *gin.Context) {
-	// Extract refresh token from Authorization header or query parameter
-	refreshToken := c.GetHeader("Refresh-Token")
-	if refreshToken == "" {
-		refreshToken = c.Query("refresh_token")
-	}
-
-	if refreshToken == "" {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
 		return
 	}
 
-	// 使用刷新令牌获取新的访问令牌
-	accessToken, err := ac.service.RefreshToken(refreshToken)
+	tokens, err := ac.sessions.Refresh(req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		switch {
+		case errors.Is(err, models.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used, please log in again"})
+		case errors.Is(err, models.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		default:
+			log.Printf("ERROR: Failed to refresh token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
 		return
 	}
 
-	// Return the new access token
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Token refreshed successfully",
 		"data": gin.H{
-			"access_token": accessToken,
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
 		},
 	})
 }
 
-// Logout invalidates the user's refresh token
+// Logout ends the current session: the one of the given refresh token,
+// or otherwise the one the access token was issued for
 func (ac *AuthController) Logout(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("user_id")
@@ -193,8 +345,115 @@ func (ac *AuthController) Logout(c *gin.Context) {
 		return
 	}
 
-	// Clear refresh token
-	ac.db.Model(&models.User{}).Where("id = ?", userID).Update("refresh_token", "")
+	var req models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var err error
+	if req.RefreshToken != "" {
+		err = ac.sessions.Logout(userID.(uint), req.RefreshToken)
+	} else if value, ok := c.Get("claims"); ok {
+		if claims, ok := value.(*utils.JWTClaims); ok && claims.SessionID != "" {
+			err = ac.sessions.End(userID.(uint), claims.SessionID)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refresh token"})
+		} else if err.Error() == "permission denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Refresh token belongs to another user"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Logged out successfully"})
+}
+
+// LogoutAll ends every session of the current user, signing them out on all devices
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := ac.sessions.EndAll(userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Logged out on all devices"})
+}
+
+// VerifyEmail confirms the email address of the token's account
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.accounts.VerifyEmail(req.Token); err != nil {
+		if errors.Is(err, models.ErrInvalidAccountToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Email verified successfully"})
+}
+
+// ResendVerification sends another verification email.
+// The response is the same whether or not the address belongs to an account.
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ac.accounts.ResendVerification(strings.ToLower(req.Email))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "If the address belongs to an unverified account, a verification email has been sent"})
+}
+
+// ForgotPassword sends a password reset email.
+// The response is the same whether or not the address belongs to an account.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ac.accounts.ForgotPassword(strings.ToLower(req.Email))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "If the address belongs to an account, a password reset email has been sent"})
+}
+
+// ResetPassword sets a new password using the token from a reset email
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.accounts.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, models.ErrInvalidAccountToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+			return
+		}
+		log.Printf("ERROR: Failed to reset password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Password reset successfully, please log in again"})
 }
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/services"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// fakeLoginService accepts "alice" with "password", and knows "banned", a disabled account
+type fakeLoginService struct {
+	services.UserService
+}
+
+func (fakeLoginService) Login(identifier, password string) (*models.User, error) {
+	switch {
+	case password != "password" || (identifier != "alice" && identifier != "banned"):
+		return nil, errors.New("invalid credentials")
+	case identifier == "banned":
+		return nil, models.ErrAccountDisabled
+	}
+	return &models.User{ID: 1, Username: identifier}, nil
+}
+
+// postLogin sends a login request and returns the response and how long it took
+func postLogin(router *gin.Engine, username, password string) (*httptest.ResponseRecorder, time.Duration) {
+	body, _ := json.Marshal(models.LoginRequest{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	started := time.Now()
+	router.ServeHTTP(rec, req)
+	return rec, time.Since(started)
+}
+
+func newLoginRouter() *gin.Engine {
+	controller := NewAuthController(fakeLoginService{}, nil, nil, services.NewLoginGuard(repositories.NewMemoryLoginAttemptStore()), nil, nil)
+	router := gin.New()
+	router.POST("/login", controller.Login)
+	return router
+}
+
+// Failed logins must not tell apart unknown accounts from wrong passwords, by message or by timing
+func TestLoginFailuresAreUniform(t *testing.T) {
+	router := newLoginRouter()
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"unknown user", "nobody", "password"},
+		{"wrong password", "alice", "wrong"},
+		{"disabled account with wrong password", "banned", "wrong"},
+	}
+	var bodies []string
+	for _, tt := range tests {
+		rec, took := postLogin(router, tt.username, tt.password)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, http.StatusUnauthorized)
+		}
+		if took < minLoginFailureTime {
+			t.Errorf("%s: answered after %v, want at least %v", tt.name, took, minLoginFailureTime)
+		}
+		bodies = append(bodies, rec.Body.String())
+	}
+	for _, body := range bodies[1:] {
+		if body != bodies[0] {
+			t.Errorf("responses differ: %s and %s", bodies[0], body)
+		}
+	}
+}
+
+func TestLoginThrottled(t *testing.T) {
+	router := newLoginRouter()
+	for i := 0; i < 4; i++ {
+		postLogin(router, "Alice", "wrong")
+	}
+
+	// Even the right password is refused while the backoff lasts, whatever the case of the identifier
+	rec, _ := postLogin(router, "ALICE", "password")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("no Retry-After header")
+	}
+}
+
+func TestLoginDisabledAccount(t *testing.T) {
+	router := newLoginRouter()
+	rec, _ := postLogin(router, "banned", "password")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "Account is disabled") {
+		t.Fatalf("response = %d %s, want 403 Account is disabled", rec.Code, rec.Body.String())
+	}
+}
+
+// fakeTwoFactor challenges every login; the challenge token is "challenge" and the code "123456"
+type fakeTwoFactor struct {
+	services.TwoFactorService
+}
+
+func (fakeTwoFactor) Challenge(user *models.User) (*models.TwoFactorChallenge, error) {
+	return &models.TwoFactorChallenge{Required: true, Token: "challenge"}, nil
+}
+
+func (fakeTwoFactor) ParseChallenge(token string) (*models.User, error) {
+	if token != "challenge" {
+		return nil, models.ErrInvalidTwoFactorToken
+	}
+	return &models.User{ID: 1, Username: "alice"}, nil
+}
+
+func (fakeTwoFactor) CompleteLogin(userID uint, code string) ([]string, error) {
+	if code != "123456" {
+		return nil, models.ErrInvalidTwoFactorCode
+	}
+	return nil, nil
+}
+
+// countingSessions counts the sessions started
+type countingSessions struct {
+	services.SessionService
+	started int
+}
+
+func (s *countingSessions) Start(user *models.User, userAgent, ip string) (*models.TokenPair, error) {
+	s.started++
+	return &models.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	sessions := &countingSessions{}
+	controller := NewAuthController(fakeLoginService{}, sessions, nil, services.NewLoginGuard(repositories.NewMemoryLoginAttemptStore()), nil, fakeTwoFactor{})
+	router := gin.New()
+	router.POST("/login", controller.Login)
+	router.POST("/2fa", controller.TwoFactorVerify)
+	verify := func(token, code string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.TwoFactorLoginRequest{Token: token, Code: code})
+		req := httptest.NewRequest(http.MethodPost, "/2fa", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The password alone only yields the challenge
+	rec, _ := postLogin(router, "alice", "password")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"two_factor_token":"challenge"`) {
+		t.Fatalf("login response = %d %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "access_token") || sessions.started != 0 {
+		t.Fatal("tokens issued before the second step")
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		code       string
+		want       int
+		wantTokens bool
+	}{
+		{"wrong code", "challenge", "000000", http.StatusUnauthorized, false},
+		{"forged challenge", "forged", "123456", http.StatusUnauthorized, false},
+		{"right code", "challenge", "123456", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		started := sessions.started
+		rec := verify(tt.token, tt.code)
+		if rec.Code != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if got := sessions.started > started; got != tt.wantTokens || strings.Contains(rec.Body.String(), "access_token") != tt.wantTokens {
+			t.Fatalf("%s: tokens issued = %v, want %v", tt.name, got, tt.wantTokens)
+		}
+	}
+
+	// Guessing codes is throttled like passwords are
+	for i := 0; i < 4; i++ {
+		verify("challenge", "000000")
+	}
+	if rec := verify("challenge", "123456"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status after repeated wrong codes = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+// fakeSSO starts every sign-on with the binding "browser-secret" and completes the ones presenting it
+type fakeSSO struct {
+	services.SSOService
+	bindings []string
+}
+
+func (f *fakeSSO) Enabled() bool { return true }
+
+func (f *fakeSSO) Begin() (string, string, error) {
+	return "https://idp.example.com/authorize?state=s", "browser-secret", nil
+}
+
+func (f *fakeSSO) Complete(code, state, binding string) (*models.User, error) {
+	f.bindings = append(f.bindings, binding)
+	if binding != "browser-secret" {
+		return nil, models.ErrInvalidSSOState
+	}
+	return &models.User{ID: 1, Username: "alice"}, nil
+}
+
+func TestSSOBindsTheBrowser(t *testing.T) {
+	sso := &fakeSSO{}
+	controller := NewAuthController(nil, &countingSessions{}, nil, nil, sso, fakeTwoFactor{})
+	router := gin.New()
+	router.GET("/api/v1/auth/sso/login", controller.SSOLogin)
+	router.POST("/api/v1/auth/sso/callback", controller.SSOCallback)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/sso/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	cookie := cookies[0]
+	if cookie.Value != "browser-secret" || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode ||
+		cookie.Path != "/api/v1/auth/sso" || cookie.MaxAge != int(services.SSOLoginTimeout.Seconds()) {
+		t.Fatalf("cookie = %+v", cookie)
+	}
+
+	callback := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.SSOCallbackRequest{Code: "code", State: "s"})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sso/callback", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := callback(nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback without the cookie = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = callback(cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback = %d %s", rec.Code, rec.Body.String())
+	}
+	// the cookie is spent
+	if cleared := rec.Result().Cookies(); len(cleared) != 1 || cleared[0].Name != cookie.Name || cleared[0].MaxAge >= 0 {
+		t.Fatalf("cookies after callback = %v", cleared)
+	}
+	if len(sso.bindings) != 2 || sso.bindings[0] != "" || sso.bindings[1] != "browser-secret" {
+		t.Fatalf("bindings passed = %q", sso.bindings)
+	}
+}
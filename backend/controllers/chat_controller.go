@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"nhcommunity/models"
 	"nhcommunity/services"
 	"strconv"
 
@@ -42,6 +45,8 @@ func (cc *ChatController) GetConversations(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": conversations})
 }
 
+// GetMessages lists the messages of a conversation, newest first by offset, or with ?after_seq=
+// the messages after that sequence number, oldest first, so a client can fill a gap it detected
 func (cc *ChatController) GetMessages(c *gin.Context) {
 	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -49,11 +54,33 @@ func (cc *ChatController) GetMessages(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("user_id")
+
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > models.MaxPageLimit {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
 
-	messages, err := cc.service.GetMessages(uint(conversationID), limit, offset)
+	var messages []models.Message
+	if afterSeq, ok := c.GetQuery("after_seq"); ok {
+		seq, parseErr := strconv.ParseUint(afterSeq, 10, 64)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid after_seq"})
+			return
+		}
+		messages, err = cc.service.GetMessagesAfterSeq(uint(conversationID), userID.(uint), seq, limit)
+	} else {
+		messages, err = cc.service.GetMessages(uint(conversationID), userID.(uint), limit, offset)
+	}
 	if err != nil {
+		if errors.Is(err, models.ErrConversationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to retrieve messages"})
 		return
 	}
@@ -61,6 +88,38 @@ func (cc *ChatController) GetMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": messages})
 }
 
+// MarkRead moves the current user's read watermark in a conversation and sends a read receipt
+// to the senders of the messages that were read. Without a messageId everything is marked as read.
+func (cc *ChatController) MarkRead(c *gin.Context) {
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid conversation ID"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	var req models.MarkReadPayload
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid request body"})
+			return
+		}
+	}
+
+	receipt, senderIDs, err := cc.service.MarkRead(uint(conversationID), userID.(uint), req.MessageID)
+	if err != nil {
+		if errors.Is(err, models.ErrConversationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to mark conversation as read"})
+		return
+	}
+	cc.hub.SendReadReceipt(receipt, senderIDs)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": receipt})
+}
+
 func (cc *ChatController) CreateChatSession(c *gin.Context) {
 	var req struct {
 		UserID uint `json:"userId" binding:"required"`
@@ -80,6 +139,10 @@ func (cc *ChatController) CreateChatSession(c *gin.Context) {
 
 	convo, err := cc.service.GetOrCreateConversation(currentUser, req.UserID)
 	if err != nil {
+		if errors.Is(err, models.ErrUserBlocked) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to create or find conversation"})
 		return
 	}
@@ -91,3 +154,134 @@ func (cc *ChatController) CreateChatSession(c *gin.Context) {
 		},
 	})
 }
+
+// CreateGroup creates a named group conversation with the current user as its owner
+func (cc *ChatController) CreateGroup(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	convo, err := cc.service.CreateGroup(userID.(uint), &req)
+	if err != nil {
+		respondGroupError(c, err, "Failed to create group")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": convo})
+}
+
+// UpdateGroup renames a group conversation; only its owner and admins may do so
+func (cc *ChatController) UpdateGroup(c *gin.Context) {
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid conversation ID"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	var req models.UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	if err := cc.service.RenameGroup(uint(conversationID), userID.(uint), req.Name); err != nil {
+		respondGroupError(c, err, "Failed to update group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Group updated"})
+}
+
+// AddMembers adds users to a group conversation
+func (cc *ChatController) AddMembers(c *gin.Context) {
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid conversation ID"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	var req models.AddMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	if err := cc.service.AddMembers(uint(conversationID), userID.(uint), req.UserIDs); err != nil {
+		respondGroupError(c, err, "Failed to add members")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Members added"})
+}
+
+// RemoveMember removes a user from a group conversation. Removing yourself leaves the group.
+func (cc *ChatController) RemoveMember(c *gin.Context) {
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid conversation ID"})
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid user ID"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	if err := cc.service.RemoveMember(uint(conversationID), userID.(uint), uint(memberID)); err != nil {
+		respondGroupError(c, err, "Failed to remove member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Member removed"})
+}
+
+// UpdateMemberRole changes the role of a group member; only the owner may do so
+func (cc *ChatController) UpdateMemberRole(c *gin.Context) {
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid conversation ID"})
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid user ID"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	var req models.UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	if err := cc.service.UpdateMemberRole(uint(conversationID), userID.(uint), uint(memberID), req.Role); err != nil {
+		respondGroupError(c, err, "Failed to update member role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Member role updated"})
+}
+
+// respondGroupError maps the errors of group conversation actions to status codes
+func respondGroupError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrConversationNotFound), err.Error() == "user not found":
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+	case errors.Is(err, models.ErrNotGroupConversation), errors.Is(err, models.ErrGroupFull),
+		errors.Is(err, models.ErrInvalidConversationRole):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+	case errors.Is(err, models.ErrUserBlocked), err.Error() == "permission denied":
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": err.Error()})
+	default:
+		log.Printf("ChatController: %s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": message})
+	}
+}
@@ -0,0 +1,688 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/services"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// fakeChatRepo keeps conversations in memory. Methods the tests do not need are left to the embedded
+// interface, so calling them panics.
+type fakeChatRepo struct {
+	repositories.ChatRepository
+
+	mu       sync.Mutex
+	types    map[uint]string                                  // conversation type by conversation
+	members  map[uint]map[uint]models.ConversationParticipant // current members by conversation
+	messages map[uint][]models.Message                        // messages by conversation, in seq order
+}
+
+func newFakeChatRepo() *fakeChatRepo {
+	return &fakeChatRepo{
+		types:    make(map[uint]string),
+		members:  make(map[uint]map[uint]models.ConversationParticipant),
+		messages: make(map[uint][]models.Message),
+	}
+}
+
+// join adds users to a conversation, which is a group unless it is created with exactly two members
+func (r *fakeChatRepo) join(conversationID uint, userIDs ...uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.members[conversationID] == nil {
+		r.members[conversationID] = make(map[uint]models.ConversationParticipant)
+		r.types[conversationID] = models.ConversationGroup
+		if len(userIDs) == 2 {
+			r.types[conversationID] = models.ConversationDirect
+		}
+	}
+	for _, userID := range userIDs {
+		r.members[conversationID][userID] = models.ConversationParticipant{
+			ConversationID: conversationID,
+			UserID:         userID,
+			Role:           models.ConversationRoleMember,
+			JoinedSeq:      uint64(len(r.messages[conversationID])),
+		}
+	}
+}
+
+func (r *fakeChatRepo) leave(conversationID, userID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.members[conversationID], userID)
+}
+
+func (r *fakeChatRepo) send(conversationID, senderID uint, content string) {
+	r.CreateMessage(&models.Message{ConversationID: conversationID, SenderID: senderID, Content: content})
+}
+
+// count returns how many messages are stored in the conversation
+func (r *fakeChatRepo) count(conversationID uint) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.messages[conversationID])
+}
+
+func (r *fakeChatRepo) GetConversationByID(conversationID uint) (*models.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members, ok := r.members[conversationID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	conversation := &models.Conversation{ID: conversationID, Type: r.types[conversationID]}
+	for userID, member := range members {
+		conversation.Participants = append(conversation.Participants, models.User{ID: userID})
+		conversation.Members = append(conversation.Members, member)
+	}
+	return conversation, nil
+}
+
+func (r *fakeChatRepo) FindConversationBetweenUsers(userID1, userID2 uint) (*models.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for conversationID, members := range r.members {
+		_, ok1 := members[userID1]
+		_, ok2 := members[userID2]
+		if r.types[conversationID] == models.ConversationDirect && ok1 && ok2 {
+			return &models.Conversation{ID: conversationID, Type: models.ConversationDirect}, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeChatRepo) IsParticipant(conversationID, userID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.members[conversationID][userID]
+	return ok, nil
+}
+
+func (r *fakeChatRepo) FindParticipant(conversationID, userID uint) (*models.ConversationParticipant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	member, ok := r.members[conversationID][userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &member, nil
+}
+
+func (r *fakeChatRepo) GetParticipantIDs(conversationID uint) ([]uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var userIDs []uint
+	for userID := range r.members[conversationID] {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+func (r *fakeChatRepo) CreateMessage(message *models.Message) (*models.Message, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := r.messages[message.ConversationID]
+	if message.ClientMessageID != nil {
+		for _, existing := range messages {
+			if existing.SenderID == message.SenderID && existing.ClientMessageID != nil && *existing.ClientMessageID == *message.ClientMessageID {
+				return &existing, false, nil
+			}
+		}
+	}
+	message.ID = uint(1000*message.ConversationID) + uint(len(messages)) + 1
+	message.Seq = uint64(len(messages)) + 1
+	message.CreatedAt = time.Now()
+	r.messages[message.ConversationID] = append(messages, *message)
+	return message, true, nil
+}
+
+func (r *fakeChatRepo) MarkRead(conversationID, userID, messageID uint) (previous, current uint, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	member, ok := r.members[conversationID][userID]
+	if !ok {
+		return 0, 0, gorm.ErrRecordNotFound
+	}
+	var latest uint
+	for _, message := range r.messages[conversationID] {
+		latest = max(latest, message.ID)
+	}
+	target := latest
+	if messageID != 0 && messageID < latest {
+		target = messageID
+	}
+	previous = member.LastReadMessageID
+	member.LastReadMessageID = max(previous, target)
+	r.members[conversationID][userID] = member
+	return previous, member.LastReadMessageID, nil
+}
+
+func (r *fakeChatRepo) FindSenderIDs(conversationID, afterID, uptoID, userID uint) ([]uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := map[uint]bool{userID: true}
+	var senderIDs []uint
+	for _, message := range r.messages[conversationID] {
+		if message.ID > afterID && message.ID <= uptoID && !seen[message.SenderID] {
+			seen[message.SenderID] = true
+			senderIDs = append(senderIDs, message.SenderID)
+		}
+	}
+	return senderIDs, nil
+}
+
+func (r *fakeChatRepo) GetMessagesByConversationID(conversationID uint, afterSeq uint64, limit, offset int) ([]models.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var page []models.Message
+	messages := r.messages[conversationID]
+	for i := len(messages) - 1 - offset; i >= 0 && messages[i].Seq > afterSeq && len(page) < limit; i-- {
+		page = append(page, messages[i])
+	}
+	return page, nil
+}
+
+func (r *fakeChatRepo) GetMessagesAfterSeq(conversationID uint, afterSeq uint64, limit int) ([]models.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var page []models.Message
+	for _, message := range r.messages[conversationID] {
+		if message.Seq > afterSeq && len(page) < limit {
+			page = append(page, message)
+		}
+	}
+	return page, nil
+}
+
+func (r *fakeChatRepo) GetConversationSeqs(userID uint) ([]models.SyncCursor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var cursors []models.SyncCursor
+	for conversationID, members := range r.members {
+		if member, ok := members[userID]; ok {
+			cursors = append(cursors, models.SyncCursor{
+				ConversationID: conversationID,
+				LastSeq:        uint64(len(r.messages[conversationID])),
+				JoinedSeq:      member.JoinedSeq,
+			})
+		}
+	}
+	sort.Slice(cursors, func(i, j int) bool { return cursors[i].ConversationID < cursors[j].ConversationID })
+	return cursors, nil
+}
+
+// noBlocks is a block list in which nobody has blocked anybody
+type noBlocks struct {
+	repositories.BlockRepository
+}
+
+func (noBlocks) IsBlocked(userID, otherID uint) (bool, error) { return false, nil }
+
+// discardNotifications drops the notifications of new messages
+type discardNotifications struct {
+	services.NotificationService
+}
+
+func (discardNotifications) Notify(notification *models.Notification) error     { return nil }
+func (discardNotifications) NotifyOnce(notification *models.Notification) error { return nil }
+
+// newChatRouter serves the message and websocket routes of a real chat service; the X-User header
+// stands in for the user the auth middleware would set
+func newChatRouter(repo repositories.ChatRepository) *gin.Engine {
+	hub := services.NewHub()
+	go hub.Run()
+	controller := NewChatController(services.NewChatService(nil, repo, noBlocks{}, discardNotifications{}), hub)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseUint(c.GetHeader("X-User"), 10, 64)
+		c.Set("user_id", uint(userID))
+	})
+	router.GET("/ws/chat", controller.ServeWs)
+	router.GET("/conversations/:id/messages", controller.GetMessages)
+	return router
+}
+
+func getMessages(router *gin.Engine, userID uint, conversationID uint, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/conversations/%d/messages?%s", conversationID, query), nil)
+	req.Header.Set("X-User", strconv.FormatUint(uint64(userID), 10))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// chatSocket is a websocket connection of one user to the chat
+type chatSocket struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialChat(t *testing.T, server *httptest.Server, userID uint) *chatSocket {
+	t.Helper()
+	header := http.Header{"X-User": []string{strconv.FormatUint(uint64(userID), 10)}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/chat", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	socket := &chatSocket{t: t, conn: conn}
+	// The answer to a sync shows the connection is registered with the hub, so it receives what is sent next
+	socket.write(models.WSTypeSync, models.SyncPayload{})
+	socket.read(models.WSTypeSync, &models.SyncResult{})
+	return socket
+}
+
+func (s *chatSocket) write(frameType string, payload interface{}) {
+	s.t.Helper()
+	if err := s.conn.WriteJSON(models.WebsocketMessage{Type: frameType, Payload: payload}); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// read returns the payload of the next frame of the given type, skipping frames of other types
+func (s *chatSocket) read(frameType string, payload interface{}) {
+	s.t.Helper()
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !s.frame(frameType, payload) {
+	}
+}
+
+// next returns the payload of the next frame, which must be of the given type
+func (s *chatSocket) next(frameType string, payload interface{}) {
+	s.t.Helper()
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if !s.frame(frameType, payload) {
+		s.t.Fatalf("the next frame is not %s", frameType)
+	}
+}
+
+// frame reads one frame and reports whether it is of the given type, decoding its payload if so
+func (s *chatSocket) frame(frameType string, payload interface{}) bool {
+	s.t.Helper()
+	var frame struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := s.conn.ReadJSON(&frame); err != nil {
+		s.t.Fatalf("waiting for %s: %v", frameType, err)
+	}
+	if frame.Type != frameType {
+		return false
+	}
+	if err := json.Unmarshal(frame.Payload, payload); err != nil {
+		s.t.Fatal(err)
+	}
+	return true
+}
+
+// Conversations of other users must look exactly like conversations that do not exist, whether they are
+// paged through over REST or asked for in a sync frame
+func TestConversationsHiddenFromNonMembers(t *testing.T) {
+	const alice, bob, carol, mallory = 1, 2, 3, 4
+	repo := newFakeChatRepo()
+	// 1 is a direct conversation of alice and bob, 2 a group carol left, 3 a direct conversation of bob and carol
+	repo.join(1, alice, bob)
+	repo.join(2, alice, bob, carol)
+	repo.join(3, bob, carol)
+	for _, message := range []struct {
+		conversationID, senderID uint
+	}{{1, alice}, {1, bob}, {1, alice}, {2, carol}, {2, alice}, {3, bob}} {
+		repo.send(message.conversationID, message.senderID, "hello")
+	}
+	repo.leave(2, carol)
+
+	router := newChatRouter(repo)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	const probedIDs = 8
+
+	notFound := getMessages(router, alice, probedIDs+1, "limit=2").Body.String()
+	if !strings.Contains(notFound, models.ErrConversationNotFound.Error()) {
+		t.Fatalf("missing conversation answered %s", notFound)
+	}
+	// pages are the requests made for every conversation, with how many of its messages they return
+	pages := []struct {
+		query string
+		count func(messages int) int
+	}{
+		{"limit=2&offset=0", func(n int) int { return min(n, 2) }},
+		{"limit=2&offset=2", func(n int) int { return max(min(n-2, 2), 0) }},
+		{"after_seq=0", func(n int) int { return n }},
+		{"after_seq=1", func(n int) int { return n - 1 }},
+	}
+	tests := []struct {
+		name   string
+		userID uint
+		// visible are the conversations the user can read, with their number of messages
+		visible map[uint]int
+	}{
+		{"stranger", mallory, map[uint]int{}},
+		{"participant", alice, map[uint]int{1: 3, 2: 2}},
+		{"participant who left", carol, map[uint]int{3: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The stranger walks through the IDs one by one, as someone enumerating conversations would
+			for id := uint(1); id <= probedIDs; id++ {
+				messages, visible := tt.visible[id]
+				for _, page := range pages {
+					rec := getMessages(router, tt.userID, id, page.query)
+					if !visible {
+						if rec.Code != http.StatusNotFound || rec.Body.String() != notFound {
+							t.Fatalf("conversation %d?%s = %d %s, want the response for a missing one: %s",
+								id, page.query, rec.Code, rec.Body.String(), notFound)
+						}
+						continue
+					}
+					var body struct {
+						Data []models.Message `json:"data"`
+					}
+					if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusOK || err != nil {
+						t.Fatalf("conversation %d?%s = %d %s", id, page.query, rec.Code, rec.Body.String())
+					}
+					if want := page.count(messages); len(body.Data) != want {
+						t.Fatalf("conversation %d?%s returned %d messages, want %d", id, page.query, len(body.Data), want)
+					}
+				}
+			}
+
+			socket := dialChat(t, server, tt.userID)
+			cursors := make([]models.SyncCursor, 0, probedIDs)
+			for id := uint(1); id <= probedIDs; id++ {
+				cursors = append(cursors, models.SyncCursor{ConversationID: id})
+			}
+			socket.write(models.WSTypeSync, models.SyncPayload{Cursors: cursors})
+			var result models.SyncResult
+			socket.read(models.WSTypeSync, &result)
+			synced := map[uint]int{}
+			for _, conversation := range result.Conversations {
+				synced[conversation.ConversationID] = len(conversation.Messages)
+			}
+			if fmt.Sprint(synced) != fmt.Sprint(tt.visible) {
+				t.Fatalf("sync returned %v, want %v", synced, tt.visible)
+			}
+		})
+	}
+}
+
+// chatMessage is how a message is sent over the websocket and how it arrives at the other members
+type chatMessage struct {
+	name           string
+	conversationID uint
+	incoming       string
+	frame          func(socket *chatSocket, clientMessageID, content string)
+}
+
+// chatMessages sends alice's messages to bob in the direct conversation 1 and to the group 2
+var chatMessages = []chatMessage{
+	{
+		name:           "private",
+		conversationID: 1,
+		incoming:       models.WSTypeIncomingPrivateMessage,
+		frame: func(socket *chatSocket, clientMessageID, content string) {
+			socket.write(models.WSTypePrivateMessage, models.PrivateMessagePayload{RecipientID: 2, Content: content, ClientMessageID: clientMessageID})
+		},
+	},
+	{
+		name:           "group",
+		conversationID: 2,
+		incoming:       models.WSTypeIncomingGroupMessage,
+		frame: func(socket *chatSocket, clientMessageID, content string) {
+			socket.write(models.WSTypeGroupMessage, models.GroupMessagePayload{ConversationID: 2, Content: content, ClientMessageID: clientMessageID})
+		},
+	},
+}
+
+// newMessagingRepo holds the direct conversation 1 of alice (1) and bob (2) and their group 2 with carol (3)
+func newMessagingRepo() *fakeChatRepo {
+	repo := newFakeChatRepo()
+	repo.join(1, 1, 2)
+	repo.join(2, 1, 2, 3)
+	return repo
+}
+
+// A retransmitted message is acknowledged again, but neither stored nor delivered a second time
+func TestMessageRetransmission(t *testing.T) {
+	for _, kind := range chatMessages {
+		t.Run(kind.name, func(t *testing.T) {
+			repo := newMessagingRepo()
+			server := httptest.NewServer(newChatRouter(repo))
+			defer server.Close()
+			sender, otherDevice, recipient := dialChat(t, server, 1), dialChat(t, server, 1), dialChat(t, server, 2)
+
+			var first, retransmitted, next models.MessageAck
+			kind.frame(sender, "m1", "first")
+			sender.read(models.WSTypeAck, &first)
+			kind.frame(sender, "m1", "first")
+			sender.read(models.WSTypeAck, &retransmitted)
+			kind.frame(sender, "m2", "second")
+			sender.read(models.WSTypeAck, &next)
+
+			if first.Error != "" || first.MessageID == 0 || retransmitted.MessageID != first.MessageID || retransmitted.Seq != first.Seq {
+				t.Fatalf("acks = %+v and %+v, want the same ack for the retransmission", first, retransmitted)
+			}
+			if next.MessageID == first.MessageID || next.Seq != first.Seq+1 {
+				t.Fatalf("ack of the next message = %+v, after %+v", next, first)
+			}
+			if got := repo.count(kind.conversationID); got != 2 {
+				t.Fatalf("%d messages stored, want 2", got)
+			}
+			// The recipient and the sender's other device get each message once, in order
+			for _, socket := range []*chatSocket{recipient, otherDevice} {
+				for _, want := range []string{"m1", "m2"} {
+					var message models.Message
+					socket.read(kind.incoming, &message)
+					if message.ClientMessageID == nil || *message.ClientMessageID != want {
+						t.Fatalf("received %+v, want %s", message, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// The connection a message was sent from gets the ack, and the sender's other connections get the message
+func TestSenderEcho(t *testing.T) {
+	for _, kind := range chatMessages {
+		t.Run(kind.name, func(t *testing.T) {
+			server := httptest.NewServer(newChatRouter(newMessagingRepo()))
+			defer server.Close()
+			origin, otherDevice, recipient := dialChat(t, server, 1), dialChat(t, server, 1), dialChat(t, server, 2)
+
+			kind.frame(origin, "m1", "hello")
+			var ack models.MessageAck
+			origin.next(models.WSTypeAck, &ack)
+			var echo models.Message
+			otherDevice.next(kind.incoming, &echo)
+			if ack.Error != "" || echo.ID != ack.MessageID || echo.Content != "hello" {
+				t.Fatalf("ack = %+v, echo = %+v", ack, echo)
+			}
+
+			// Had the message been echoed to the origin too, it would arrive before bob's reply
+			recipient.write(models.WSTypePrivateMessage, models.PrivateMessagePayload{RecipientID: 1, Content: "reply"})
+			var reply models.Message
+			origin.next(models.WSTypeIncomingPrivateMessage, &reply)
+			if reply.Content != "reply" {
+				t.Fatalf("origin received %+v, want the reply", reply)
+			}
+		})
+	}
+}
+
+// The same client message ID may be used in different conversations
+func TestClientMessageIDPerConversation(t *testing.T) {
+	repo := newMessagingRepo()
+	server := httptest.NewServer(newChatRouter(repo))
+	defer server.Close()
+	sender := dialChat(t, server, 1)
+
+	seen := map[uint]bool{}
+	for _, kind := range chatMessages {
+		var ack models.MessageAck
+		kind.frame(sender, "m1", kind.name)
+		sender.read(models.WSTypeAck, &ack)
+		if ack.Error != "" || ack.ConversationID != kind.conversationID || seen[ack.MessageID] {
+			t.Fatalf("%s: ack = %+v", kind.name, ack)
+		}
+		seen[ack.MessageID] = true
+		if got := repo.count(kind.conversationID); got != 1 {
+			t.Fatalf("%s: %d messages stored, want 1", kind.name, got)
+		}
+	}
+}
+
+func TestClientMessageIDValidation(t *testing.T) {
+	tests := []struct {
+		name            string
+		clientMessageID string
+		wantError       string
+	}{
+		{"none", "", ""},
+		{"longest", strings.Repeat("x", models.MaxClientMessageIDLength), ""},
+		{"too long", strings.Repeat("x", models.MaxClientMessageIDLength+1), models.ErrClientMessageIDTooLong.Error()},
+	}
+	for _, kind := range chatMessages {
+		for _, tt := range tests {
+			t.Run(kind.name+"/"+tt.name, func(t *testing.T) {
+				repo := newMessagingRepo()
+				server := httptest.NewServer(newChatRouter(repo))
+				defer server.Close()
+				sender, recipient := dialChat(t, server, 1), dialChat(t, server, 2)
+
+				var ack models.MessageAck
+				kind.frame(sender, tt.clientMessageID, "hello")
+				sender.read(models.WSTypeAck, &ack)
+				if ack.Error != tt.wantError || ack.ClientMessageID != tt.clientMessageID {
+					t.Fatalf("ack = %+v, want error %q", ack, tt.wantError)
+				}
+				stored := 0
+				if tt.wantError == "" {
+					stored = 1
+				}
+				if got := repo.count(kind.conversationID); got != stored {
+					t.Fatalf("%d messages stored, want %d", got, stored)
+				}
+
+				// A rejected message never reaches the recipient: the next thing they get is the following message
+				kind.frame(sender, "next", "next")
+				sender.read(models.WSTypeAck, &ack)
+				var message models.Message
+				recipient.read(kind.incoming, &message)
+				if wantContent := map[bool]string{true: "hello", false: "next"}[stored == 1]; message.Content != wantContent {
+					t.Fatalf("recipient got %q, want %q", message.Content, wantContent)
+				}
+			})
+		}
+	}
+}
+
+func seqPtr(seq uint64) *uint64 { return &seq }
+
+// A member who joins a group is not replayed what was said before, neither over REST nor in a sync.
+// Paging back through the history stops at the join point too.
+func TestReplayStartsAtJoin(t *testing.T) {
+	const alice, dave = 1, 4
+	repo := newMessagingRepo()
+	for i := 0; i < 3; i++ {
+		repo.send(2, alice, "before")
+	}
+	repo.join(2, dave)
+	repo.send(2, alice, "after")
+	router := newChatRouter(repo)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	seqs := func(messages []models.Message) string {
+		var seqs []string
+		for _, message := range messages {
+			seqs = append(seqs, strconv.FormatUint(message.Seq, 10))
+		}
+		return strings.Join(seqs, ",")
+	}
+	tests := []struct {
+		name   string
+		userID uint
+		// afterSeq is the cursor the client sends, or nil for none
+		afterSeq *uint64
+		want     string
+	}{
+		{"new member from the start", dave, nil, "4"},
+		{"new member from before joining", dave, seqPtr(1), "4"},
+		{"new member from joining", dave, seqPtr(3), "4"},
+		{"new member up to date", dave, seqPtr(4), ""},
+		{"earlier member from the start", alice, nil, "1,2,3,4"},
+		{"earlier member from a cursor", alice, seqPtr(2), "3,4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, cursors := "after_seq=0", []models.SyncCursor{}
+			if tt.afterSeq != nil {
+				query = fmt.Sprintf("after_seq=%d", *tt.afterSeq)
+				cursors = append(cursors, models.SyncCursor{ConversationID: 2, LastSeq: *tt.afterSeq})
+			}
+
+			rec := getMessages(router, tt.userID, 2, query)
+			var body struct {
+				Data []models.Message `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusOK || err != nil {
+				t.Fatalf("?%s = %d %s", query, rec.Code, rec.Body.String())
+			}
+			if got := seqs(body.Data); got != tt.want {
+				t.Fatalf("?%s returned seqs %q, want %q", query, got, tt.want)
+			}
+
+			socket := dialChat(t, server, tt.userID)
+			socket.write(models.WSTypeSync, models.SyncPayload{Cursors: cursors})
+			var result models.SyncResult
+			socket.read(models.WSTypeSync, &result)
+			var got string
+			for _, conversation := range result.Conversations {
+				if conversation.ConversationID == 2 {
+					got = seqs(conversation.Messages)
+				}
+			}
+			if got != tt.want {
+				t.Fatalf("sync returned seqs %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name   string
+		userID uint
+		query  string
+		want   string
+	}{
+		{"new member's newest page", dave, "limit=2", "4"},
+		{"new member's older page", dave, "limit=2&offset=1", ""},
+		{"earlier member's newest page", alice, "limit=2", "4,3"},
+		{"earlier member's older page", alice, "limit=2&offset=2", "2,1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getMessages(router, tt.userID, 2, tt.query)
+			var body struct {
+				Data []models.Message `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusOK || err != nil {
+				t.Fatalf("?%s = %d %s", tt.query, rec.Code, rec.Body.String())
+			}
+			if got := seqs(body.Data); got != tt.want {
+				t.Fatalf("?%s returned seqs %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
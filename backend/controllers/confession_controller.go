@@ -26,16 +26,22 @@ func NewConfessionController(service services.ConfessionService) *ConfessionCont
 
 // GetConfessions retrieves all approved confessions
 func (cc *ConfessionController) GetConfessions(c *gin.Context) {
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	responses, err := cc.service.GetApprovedConfessions(limit, offset)
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	responses, err := cc.service.GetApprovedConfessions(viewerID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve confessions"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"confessions": responses})
+	c.JSON(http.StatusOK, gin.H{"confessions": responses.Items, "pagination": responses.PageInfo})
 }
 
 // GetConfessionByID retrieves a single confession by its ID
@@ -49,7 +55,7 @@ func (cc *ConfessionController) GetConfessionByID(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	currentUserID, _ := userID.(uint)
 
-	response, err := cc.service.GetConfessionByID(uint(id), currentUserID)
+	response, err := cc.service.GetConfessionByID(uint(id), currentUserID, viewerKey(c, currentUserID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -125,10 +131,7 @@ func (cc *ConfessionController) DeleteConfession(c *gin.Context) {
 		return
 	}
 
-	// For simplicity, passing role as string. In a real app, use a proper enum or const.
-	userRole := "user" // This should be fetched from user claims
-
-	err = cc.service.DeleteConfession(uint(id), userID.(uint), userRole)
+	err = cc.service.DeleteConfession(uint(id), userID.(uint))
 	if err != nil {
 		if err.Error() == "permission denied" {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to delete this confession"})
@@ -259,9 +262,7 @@ func (cc *ConfessionController) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	userRole := "user" // This should be fetched from user claims
-
-	err = cc.service.DeleteComment(uint(commentID), userID.(uint), userRole)
+	err = cc.service.DeleteComment(uint(commentID), userID.(uint))
 	if err != nil {
 		if err.Error() == "permission denied" {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot delete this comment"})
@@ -274,22 +275,29 @@ func (cc *ConfessionController) DeleteComment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
 
+// adminConfessionPageLimit keeps the page size admin clients got before the list was paginated
+const adminConfessionPageLimit = 50
+
 // GetAdminConfessions 获取管理员视图的树洞列表（包括未审核的内容）
 func (cc *ConfessionController) GetAdminConfessions(c *gin.Context) {
 	status := c.DefaultQuery("status", "")
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQueryWithLimit(c, adminConfessionPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	confessions, err := cc.service.GetConfessionsByStatus(status, limit, offset)
+	confessions, err := cc.service.GetConfessionsByStatus(status, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve confessions"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Confessions retrieved successfully",
-		"data":    confessions,
+		"success":    true,
+		"message":    "Confessions retrieved successfully",
+		"data":       confessions.Items,
+		"pagination": confessions.PageInfo,
 	})
 }
 
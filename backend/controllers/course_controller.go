@@ -21,15 +21,18 @@ func NewCourseController(service services.CourseService) *CourseController {
 
 // GetCourses retrieves all courses
 func (cc *CourseController) GetCourses(c *gin.Context) {
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	courses, err := cc.service.GetCourses(limit, offset)
+	courses, err := cc.service.GetCourses(page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve courses"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"courses": courses})
+	c.JSON(http.StatusOK, gin.H{"courses": courses.Items, "pagination": courses.PageInfo})
 }
 
 // GetCourseByID retrieves a single course by its ID
@@ -84,9 +87,17 @@ func (cc *CourseController) UpdateCourse(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	userRole := "admin" // For now, only admin can update
-	updatedCourse, err := cc.service.UpdateCourse(uint(id), &req, userRole)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	updatedCourse, err := cc.service.UpdateCourse(uint(id), userID.(uint), &req)
 	if err != nil {
+		if err.Error() == "permission denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to update this course"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -100,9 +111,17 @@ func (cc *CourseController) DeleteCourse(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
 		return
 	}
-	userRole := "admin" // For now, only admin can delete
-	err = cc.service.DeleteCourse(uint(id), userRole)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	err = cc.service.DeleteCourse(uint(id), userID.(uint))
 	if err != nil {
+		if err.Error() == "permission denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to delete this course"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -166,8 +185,7 @@ func (cc *CourseController) UpdateCourseReview(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	review, err := cc.service.UpdateCourseReview(uint(reviewID), userID.(uint), &req, userRole)
+	review, err := cc.service.UpdateCourseReview(uint(reviewID), userID.(uint), &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -187,8 +205,7 @@ func (cc *CourseController) DeleteCourseReview(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	err = cc.service.DeleteCourseReview(uint(reviewID), userID.(uint), userRole)
+	err = cc.service.DeleteCourseReview(uint(reviewID), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
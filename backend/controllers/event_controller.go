@@ -21,15 +21,44 @@ func NewEventController(service services.EventService) *EventController {
 
 // GetEvents retrieves all events
 func (ec *EventController) GetEvents(c *gin.Context) {
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	events, err := ec.service.GetEvents(viewerID, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events.Items, "pagination": events.PageInfo})
+}
+
+// GetUserEvents retrieves a paginated list of the events created by the user in the path
+func (ec *EventController) GetUserEvents(c *gin.Context) {
+	creatorID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	currentUserID, _ := userID.(uint)
 
-	events, err := ec.service.GetEvents(limit, offset)
+	events, err := ec.service.GetUserEvents(uint(creatorID), currentUserID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve events"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"events": events})
+	c.JSON(http.StatusOK, gin.H{"events": events.Items, "pagination": events.PageInfo})
 }
 
 // GetEventByID retrieves a single event by its ID
@@ -106,8 +135,7 @@ func (ec *EventController) UpdateEvent(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	updatedEvent, err := ec.service.UpdateEvent(uint(id), userID.(uint), &req, userRole)
+	updatedEvent, err := ec.service.UpdateEvent(uint(id), userID.(uint), &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -127,8 +155,7 @@ func (ec *EventController) DeleteEvent(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	err = ec.service.DeleteEvent(uint(id), userID.(uint), userRole)
+	err = ec.service.DeleteEvent(uint(id), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
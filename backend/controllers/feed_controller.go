@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeedController handles the personalized following feed
+type FeedController struct {
+	service services.FeedService
+}
+
+// NewFeedController creates a new feed controller
+func NewFeedController(service services.FeedService) *FeedController {
+	return &FeedController{service: service}
+}
+
+// GetFeed returns posts, events, partner requests and listings of the users the current user follows
+func (fc *FeedController) GetFeed(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Unauthorized"})
+		return
+	}
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	feed, err := fc.service.GetFeed(userID.(uint), page)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to retrieve feed"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": feed.Items, "pagination": feed.PageInfo})
+}
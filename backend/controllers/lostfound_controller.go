@@ -20,15 +20,21 @@ func NewLostFoundController(service services.LostFoundService) *LostFoundControl
 
 // GetItems retrieves all lost and found items
 func (lc *LostFoundController) GetItems(c *gin.Context) {
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	items, err := lc.service.GetItems(limit, offset)
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	items, err := lc.service.GetItems(viewerID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve items"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"items": items})
+	c.JSON(http.StatusOK, gin.H{"items": items.Items, "pagination": items.PageInfo})
 }
 
 // GetItemByID retrieves a single lost and found item by its ID
@@ -38,7 +44,10 @@ func (lc *LostFoundController) GetItemByID(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
 		return
 	}
-	item, err := lc.service.GetItemByID(uint(id))
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	item, err := lc.service.GetItemByID(uint(id), viewerID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
@@ -63,14 +72,17 @@ func (lc *LostFoundController) CreateItem(c *gin.Context) {
 		Description: req.Description,
 		Type:        req.Type,
 		Category:    req.Category,
-		ImageURLs:   req.ImageURLs,
 		Location:    req.Location,
 		Date:        req.Date,
 		Contact:     req.Contact,
 	}
-	newItem, err := lc.service.CreateItem(item, userID.(uint))
+	newItem, err := lc.service.CreateItem(item, req.MediaIDs, userID.(uint))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
+		}
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"item": newItem})
@@ -93,10 +105,13 @@ func (lc *LostFoundController) UpdateItem(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	updatedItem, err := lc.service.UpdateItem(uint(id), userID.(uint), &req, userRole)
+	updatedItem, err := lc.service.UpdateItem(uint(id), userID.(uint), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"item": updatedItem})
@@ -114,8 +129,7 @@ func (lc *LostFoundController) DeleteItem(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	err = lc.service.DeleteItem(uint(id), userID.(uint), userRole)
+	err = lc.service.DeleteItem(uint(id), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
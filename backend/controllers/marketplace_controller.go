@@ -21,15 +21,45 @@ func NewMarketplaceController(service services.MarketplaceService) *MarketplaceC
 
 // GetListings retrieves all listings
 func (mc *MarketplaceController) GetListings(c *gin.Context) {
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	listings, err := mc.service.GetListings(viewerID, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve listings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"listings": listings.Items, "pagination": listings.PageInfo})
+}
 
-	listings, err := mc.service.GetListings(limit, offset)
+// GetUserListings retrieves a paginated list of the listings of the user in the path
+func (mc *MarketplaceController) GetUserListings(c *gin.Context) {
+	sellerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	listings, err := mc.service.GetUserListings(uint(sellerID), viewerID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve listings"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"listings": listings})
+	c.JSON(http.StatusOK, gin.H{"listings": listings.Items, "pagination": listings.PageInfo})
 }
 
 // GetListingByID retrieves a single listing by its ID
@@ -39,7 +69,10 @@ func (mc *MarketplaceController) GetListingByID(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
 		return
 	}
-	listing, err := mc.service.GetListingByID(uint(id))
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	listing, err := mc.service.GetListingByID(uint(id), viewerID, viewerKey(c, viewerID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Listing not found"})
 		return
@@ -63,14 +96,17 @@ func (mc *MarketplaceController) CreateListing(c *gin.Context) {
 		Title:       req.Title,
 		Description: req.Description,
 		Price:       req.Price,
-		ImageURLs:   req.ImageURLs,
 		Category:    req.Category,
 		Condition:   req.Condition,
 		Location:    req.Location,
 	}
-	newListing, err := mc.service.CreateListing(listing, sellerID.(uint))
+	newListing, err := mc.service.CreateListing(listing, req.MediaIDs, sellerID.(uint))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create listing"})
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create listing"})
+		}
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"listing": newListing})
@@ -93,10 +129,13 @@ func (mc *MarketplaceController) UpdateListing(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	updatedListing, err := mc.service.UpdateListing(uint(id), sellerID.(uint), &req, userRole)
+	updatedListing, err := mc.service.UpdateListing(uint(id), sellerID.(uint), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"listing": updatedListing})
@@ -114,8 +153,7 @@ func (mc *MarketplaceController) DeleteListing(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	err = mc.service.DeleteListing(uint(id), sellerID.(uint), userRole)
+	err = mc.service.DeleteListing(uint(id), sellerID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
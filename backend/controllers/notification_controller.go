@@ -1,11 +1,13 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"nhcommunity/services"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // NotificationController handles notification-related endpoints
@@ -25,15 +27,27 @@ func (nc *NotificationController) GetNotifications(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	notifications, err := nc.service.GetNotifications(userID.(uint), limit, offset)
+	notifications, err := nc.service.GetNotifications(userID.(uint), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+	unreadCount, err := nc.service.GetUnreadCount(userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"notifications": notifications})
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications.Items,
+		"pagination":    notifications.PageInfo,
+		"unread_count":  unreadCount,
+	})
 }
 
 // MarkAsRead marks a single notification as read
@@ -50,6 +64,10 @@ func (nc *NotificationController) MarkAsRead(c *gin.Context) {
 	}
 	err = nc.service.MarkAsRead(uint(notificationID), userID.(uint))
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "permission denied" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification as read"})
 		return
 	}
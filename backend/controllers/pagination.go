@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"nhcommunity/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parsePageQuery reads the list parameters shared by every paginated endpoint:
+// limit, cursor (from the previous page's next_cursor) and with_total.
+func parsePageQuery(c *gin.Context) (models.PageQuery, error) {
+	return parsePageQueryWithLimit(c, models.DefaultPageLimit)
+}
+
+// parsePageQueryWithLimit is parsePageQuery for endpoints with their own default page size
+func parsePageQueryWithLimit(c *gin.Context, defaultLimit int) (models.PageQuery, error) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	withTotal, _ := strconv.ParseBool(c.DefaultQuery("with_total", "false"))
+	return models.NewPageQuery(limit, c.Query("cursor"), withTotal)
+}
@@ -44,41 +44,76 @@ func (pc *PartnerController) CreatePartner(c *gin.Context) {
 
 // GetPartners handles fetching a list of partners
 func (pc *PartnerController) GetPartners(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
 	params := map[string]string{
 		"category": c.Query("category"),
 		"type":     c.Query("type"),
 		"keyword":  c.Query("keyword"),
 	}
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
 
-	partners, total, err := pc.service.GetPartners(params, page, limit)
+	partners, err := pc.service.GetPartners(params, viewerID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to fetch partners"})
 		return
 	}
 
-	responses := make([]models.PartnerResponse, len(partners))
-	for i, p := range partners {
-		responses[i] = p.ToResponse()
+	responses := models.MapPage(partners, func(p models.Partner) models.PartnerResponse {
+		return p.ToResponse()
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"data":       responses.Items,
+		"pagination": responses.PageInfo,
+	})
+}
+
+// GetUserPartners handles fetching the partner requests posted by the user in the path
+func (pc *PartnerController) GetUserPartners(c *gin.Context) {
+	authorID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid user ID"})
+		return
+	}
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	params := map[string]string{"author_id": strconv.FormatUint(authorID, 10)}
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	partners, err := pc.service.GetPartners(params, viewerID, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to fetch partners"})
+		return
 	}
 
+	responses := models.MapPage(partners, func(p models.Partner) models.PartnerResponse {
+		return p.ToResponse()
+	})
+
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    responses,
-		"pagination": gin.H{
-			"page":       page,
-			"limit":      limit,
-			"total":      total,
-			"totalPages": (total + int64(limit) - 1) / int64(limit),
-		},
+		"success":    true,
+		"data":       responses.Items,
+		"pagination": responses.PageInfo,
 	})
 }
 
 // GetPartnerByID handles fetching a single partner by ID
 func (pc *PartnerController) GetPartnerByID(c *gin.Context) {
 	id := c.Param("id")
-	partner, err := pc.service.GetPartnerByID(id)
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	partner, err := pc.service.GetPartnerByID(id, viewerID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Partner not found"})
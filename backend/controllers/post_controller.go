@@ -23,15 +23,45 @@ func NewPostController(service services.PostService) *PostController {
 
 // GetPosts retrieves all posts
 func (pc *PostController) GetPosts(c *gin.Context) {
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	posts, err := pc.service.GetPosts(viewerID, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to retrieve posts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": posts.Items, "pagination": posts.PageInfo})
+}
+
+// GetUserPosts retrieves a paginated list of the posts of the user in the path
+func (pc *PostController) GetUserPosts(c *gin.Context) {
+	authorID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid user ID"})
+		return
+	}
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
 
-	posts, err := pc.service.GetPosts(limit, offset)
+	posts, err := pc.service.GetUserPosts(uint(authorID), viewerID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to retrieve posts"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": posts})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": posts.Items, "pagination": posts.PageInfo})
 }
 
 // GetPostByID retrieves a single post by its ID
@@ -44,7 +74,7 @@ func (pc *PostController) GetPostByID(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	currentUserID, _ := userID.(uint)
 
-	post, err := pc.service.GetPostByID(uint(id), currentUserID)
+	post, err := pc.service.GetPostByID(uint(id), currentUserID, viewerKey(c, currentUserID))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Post not found"})
@@ -58,25 +88,26 @@ func (pc *PostController) GetPostByID(c *gin.Context) {
 
 func (pc *PostController) SearchPosts(c *gin.Context) {
 	keyword := c.DefaultQuery("keyword", "")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	sort := c.DefaultQuery("sort", "newest")
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
 
-	posts, total, err := pc.service.SearchPosts(keyword, page, limit, sort)
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	posts, err := pc.service.SearchPosts(keyword, sort, viewerID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    posts,
-		"pagination": gin.H{
-			"page":       page,
-			"limit":      limit,
-			"total":      total,
-			"totalPages": (total + int64(limit) - 1) / int64(limit),
-		},
+		"success":    true,
+		"data":       posts.Items,
+		"pagination": posts.PageInfo,
 	})
 }
 
@@ -96,7 +127,11 @@ func (pc *PostController) CreatePost(c *gin.Context) {
 
 	post, err := pc.service.CreatePost(&req, userID.(uint))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to create post"})
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to create post"})
+		}
 		return
 	}
 
@@ -120,10 +155,13 @@ func (pc *PostController) UpdatePost(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	updatedPost, err := pc.service.UpdatePost(uint(id), userID.(uint), &req, userRole)
+	updatedPost, err := pc.service.UpdatePost(uint(id), userID.(uint), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": updatedPost})
@@ -141,8 +179,7 @@ func (pc *PostController) DeletePost(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	err = pc.service.DeletePost(uint(id), userID.(uint), userRole)
+	err = pc.service.DeletePost(uint(id), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
@@ -260,8 +297,7 @@ func (pc *PostController) DeleteComment(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Unauthorized"})
 		return
 	}
-	userRole := "user"
-	err = pc.service.DeleteComment(uint(commentID), userID.(uint), userRole)
+	err = pc.service.DeleteComment(uint(commentID), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
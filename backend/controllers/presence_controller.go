@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PresenceController handles the online status of users
+type PresenceController struct {
+	service services.PresenceService
+}
+
+// NewPresenceController creates a new presence controller
+func NewPresenceController(service services.PresenceService) *PresenceController {
+	return &PresenceController{service: service}
+}
+
+// GetPresence returns whether the user in the path is online, or when they were last seen
+func (pc *PresenceController) GetPresence(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid user ID"})
+		return
+	}
+	viewerID, _ := c.Get("user_id")
+
+	presence, err := pc.service.Get(uint(userID), viewerID.(uint))
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to retrieve presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": presence})
+}
+
+// UpdateMyPresence hides or shows the current user's presence to everyone else
+func (pc *PresenceController) UpdateMyPresence(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.UpdatePresenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	presence, err := pc.service.SetHidden(userID.(uint), *req.Hidden)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to update presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": presence})
+}
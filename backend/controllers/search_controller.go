@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchController handles unified search across all content types
+type SearchController struct {
+	service services.SearchService
+}
+
+// NewSearchController creates a new search controller
+func NewSearchController(service services.SearchService) *SearchController {
+	return &SearchController{service: service}
+}
+
+// Search finds posts, confessions, events, partners, listings, lost & found items, courses and users.
+// The optional type parameter is a comma-separated list of result types to include.
+func (sc *SearchController) Search(c *gin.Context) {
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	query := models.SearchQuery{
+		Keyword:  c.Query("keyword"),
+		ViewerID: viewerID,
+		Page:     page,
+	}
+	if types := c.Query("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				query.Types = append(query.Types, t)
+			}
+		}
+	}
+
+	hits, err := sc.service.Search(query)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) || errors.Is(err, models.ErrSearchKeywordRequired) ||
+			errors.Is(err, models.ErrUnknownSearchType) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Search failed"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": hits.Items, "pagination": hits.PageInfo})
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrendingController handles trending lists ranked by hot score
+type TrendingController struct {
+	service services.TrendingService
+}
+
+// NewTrendingController creates a new trending controller
+func NewTrendingController(service services.TrendingService) *TrendingController {
+	return &TrendingController{service: service}
+}
+
+// viewerKey identifies who views an item when counting views: the signed-in user, or else the client address
+func viewerKey(c *gin.Context, userID uint) string {
+	if userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// GetTrending returns the hottest posts, confessions or listings, selected by the type query parameter
+func (tc *TrendingController) GetTrending(c *gin.Context) {
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	viewerID, _ := userID.(uint)
+
+	var (
+		items    interface{}
+		pageInfo models.PageInfo
+	)
+	switch c.DefaultQuery("type", models.TrendingTypePosts) {
+	case models.TrendingTypePosts:
+		posts, e := tc.service.GetTrendingPosts(viewerID, page)
+		items, pageInfo, err = posts.Items, posts.PageInfo, e
+	case models.TrendingTypeConfessions:
+		confessions, e := tc.service.GetTrendingConfessions(viewerID, page)
+		items, pageInfo, err = confessions.Items, confessions.PageInfo, e
+	case models.TrendingTypeListings:
+		listings, e := tc.service.GetTrendingListings(viewerID, page)
+		items, pageInfo, err = listings.Items, listings.PageInfo, e
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "type must be one of posts, confessions, listings"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to retrieve trending items"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": items, "pagination": pageInfo})
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorController handles the two-factor authentication settings of the current user
+type TwoFactorController struct {
+	service services.TwoFactorService
+	guard   services.LoginGuard
+}
+
+// NewTwoFactorController creates a new two-factor authentication controller
+func NewTwoFactorController(service services.TwoFactorService, guard services.LoginGuard) *TwoFactorController {
+	return &TwoFactorController{service: service, guard: guard}
+}
+
+// GetStatus reports whether two-factor authentication is enabled and how many recovery codes are left
+func (tc *TwoFactorController) GetStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	status, err := tc.service.Status(userID.(uint))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// Setup creates a new TOTP secret and its provisioning URI, to be shown as a QR code
+func (tc *TwoFactorController) Setup(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	setup, err := tc.service.Setup(userID.(uint))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": setup})
+}
+
+// Enable turns two-factor authentication on with a code from the authenticator app and returns
+// the recovery codes, which are shown only this once
+func (tc *TwoFactorController) Enable(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	userID, ok := tc.bindCode(c, &req)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := tc.service.Enable(userID, req.Code)
+	if !tc.checkCode(c, userID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication enabled",
+		"data":    gin.H{"recovery_codes": recoveryCodes},
+	})
+}
+
+// Disable turns two-factor authentication off; it needs both the password and a code
+func (tc *TwoFactorController) Disable(c *gin.Context) {
+	var req models.DisableTwoFactorRequest
+	userID, ok := tc.bindCode(c, &req)
+	if !ok {
+		return
+	}
+
+	err := tc.service.Disable(userID, req.Password, req.Code)
+	if !tc.checkCode(c, userID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes with new ones
+func (tc *TwoFactorController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	userID, ok := tc.bindCode(c, &req)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := tc.service.RegenerateRecoveryCodes(userID, req.Code)
+	if !tc.checkCode(c, userID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"recovery_codes": recoveryCodes}})
+}
+
+// bindCode reads the request body of an endpoint confirmed with a code, and refuses it while
+// too many wrong codes have been tried
+func (tc *TwoFactorController) bindCode(c *gin.Context, req interface{}) (uint, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, false
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if wait := tc.guard.Check(twoFactorAttemptKey(userID.(uint)), c.ClientIP()); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return 0, false
+	}
+	return userID.(uint), true
+}
+
+// checkCode counts wrong codes and responds to errors; it reports whether the request succeeded
+func (tc *TwoFactorController) checkCode(c *gin.Context, userID uint, err error) bool {
+	identifier := twoFactorAttemptKey(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidTwoFactorCode) || errors.Is(err, models.ErrIncorrectPassword) {
+			tc.guard.Failure(identifier, c.ClientIP())
+		}
+		respondTwoFactorError(c, err)
+		return false
+	}
+	tc.guard.Success(identifier)
+	return true
+}
+
+// twoFactorAttemptKey is the LoginGuard identifier wrong two-factor codes of a user are counted under
+func twoFactorAttemptKey(userID uint) string {
+	return fmt.Sprintf("2fa:%d", userID)
+}
+
+func respondTooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, please try again later"})
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidTwoFactorToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please log in again"})
+	case errors.Is(err, models.ErrInvalidTwoFactorCode), errors.Is(err, models.ErrIncorrectPassword):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorNotSetUp), errors.Is(err, models.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorSetupPending):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process two-factor authentication"})
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead is the room left for multipart boundaries and headers on top of the file size limit
+const multipartOverhead = 1 << 20
+
+// UploadController handles file uploads
+type UploadController struct {
+	service services.MediaService
+	maxSize int64
+}
+
+// NewUploadController creates a new upload controller
+func NewUploadController(service services.MediaService, maxSize int64) *UploadController {
+	return &UploadController{service: service, maxSize: maxSize}
+}
+
+// Upload stores the multipart "file" field and returns the media to reference by ID
+func (uc *UploadController) Upload(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Unauthorized"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uc.maxSize+multipartOverhead)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": models.ErrFileTooLarge.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "A file is required in the \"file\" field"})
+		}
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Failed to read the uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	media, err := uc.service.Upload(userID.(uint), file)
+	if err != nil {
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to store the uploaded file"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": media})
+}
+
+// mediaErrorStatus maps upload and media reference errors to the HTTP status they should be reported with
+func mediaErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, models.ErrFileTooLarge), errors.Is(err, models.ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge, true
+	case errors.Is(err, models.ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType, true
+	case errors.Is(err, models.ErrMediaNotFound), errors.Is(err, models.ErrTooManyMedia):
+		return http.StatusBadRequest, true
+	}
+	return 0, false
+}
@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"nhcommunity/models"
+	"nhcommunity/repositories"
 	"nhcommunity/services"
 	"strconv"
 
@@ -53,7 +55,11 @@ func (uc *UserController) UpdateCurrentUser(c *gin.Context) {
 
 	userResponse, err := uc.service.UpdateCurrentUser(userID.(uint), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if status, ok := mediaErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
@@ -80,6 +86,44 @@ func (uc *UserController) GetUserByID(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": userResponse})
 }
 
+// GetFollowers lists the users following the user in the path
+func (uc *UserController) GetFollowers(c *gin.Context) {
+	uc.listFollows(c, uc.service.GetFollowers)
+}
+
+// GetFollowing lists the users the user in the path follows
+func (uc *UserController) GetFollowing(c *gin.Context) {
+	uc.listFollows(c, uc.service.GetFollowing)
+}
+
+// listFollows responds with a page of the follower or following list of the user in the path
+func (uc *UserController) listFollows(c *gin.Context, list func(userID, viewerID uint, page models.PageQuery) (models.Page[models.PublicUserResponse], error)) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid user ID"})
+		return
+	}
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	currentUserID, _ := c.Get("user_id")
+	viewerID, _ := currentUserID.(uint)
+
+	users, err := list(uint(userID), viewerID, page)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to retrieve users"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": users.Items, "pagination": users.PageInfo})
+}
+
 func (uc *UserController) Follow(c *gin.Context) {
 	followerID, exists := c.Get("user_id")
 	if !exists {
@@ -95,7 +139,11 @@ func (uc *UserController) Follow(c *gin.Context) {
 
 	err = uc.service.Follow(followerID.(uint), uint(followingID))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrUserBlocked) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 
@@ -124,6 +172,55 @@ func (uc *UserController) Unfollow(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Successfully unfollowed user"})
 }
 
+// Block blocks a user; follows between the two users are removed
+func (uc *UserController) Block(c *gin.Context) {
+	uc.updateRelation(c, uc.service.Block, "User blocked")
+}
+
+// Unblock lifts a block the current user placed
+func (uc *UserController) Unblock(c *gin.Context) {
+	uc.updateRelation(c, uc.service.Unblock, "User unblocked")
+}
+
+// Mute hides a user from the current user's feed and notifications
+func (uc *UserController) Mute(c *gin.Context) {
+	uc.updateRelation(c, uc.service.Mute, "User muted")
+}
+
+// Unmute lifts a mute the current user placed
+func (uc *UserController) Unmute(c *gin.Context) {
+	uc.updateRelation(c, uc.service.Unmute, "User unmuted")
+}
+
+// updateRelation applies a block or mute change between the current user and the user in the path
+func (uc *UserController) updateRelation(c *gin.Context, update func(userID, otherID uint) error, message string) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Unauthorized"})
+		return
+	}
+
+	otherID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid user ID"})
+		return
+	}
+
+	if err := update(userID.(uint), uint(otherID)); err != nil {
+		switch {
+		case errors.Is(err, models.ErrCannotBlockSelf):
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		case err.Error() == "user not found":
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to update user relation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": message})
+}
+
 // UpdateUserRole 管理员更新用户角色
 func (uc *UserController) UpdateUserRole(c *gin.Context) {
 	// 获取当前管理员信息
@@ -146,20 +243,16 @@ func (uc *UserController) UpdateUserRole(c *gin.Context) {
 		return
 	}
 
-	// 验证角色值
-	validRoles := map[string]bool{
-		"user":      true,
-		"moderator": true,
-		"admin":     true,
-	}
-
-	if !validRoles[req.Role] {
+	// 调用服务更新用户角色，角色值由服务按配置校验
+	err = uc.service.UpdateUserRole(uint(userId), req.Role, adminId.(uint))
+	if errors.Is(err, models.ErrUnknownRole) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色值"})
 		return
 	}
-
-	// 调用服务更新用户角色
-	err = uc.service.UpdateUserRole(uint(userId), req.Role, adminId.(uint))
+	if errors.Is(err, models.ErrLastRoleManager) {
+		c.JSON(http.StatusConflict, gin.H{"error": "不能移除最后一个可管理角色的用户的权限"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户角色失败: " + err.Error()})
 		return
@@ -175,6 +268,61 @@ func (uc *UserController) UpdateUserRole(c *gin.Context) {
 	})
 }
 
+// UpdateUserSections 管理员设置版主负责的板块
+func (uc *UserController) UpdateUserSections(c *gin.Context) {
+	adminId, _ := c.Get("user_id")
+
+	userId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req models.UpdateUserSectionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = uc.service.UpdateUserSections(uint(userId), req.Sections)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnknownSection):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新版主板块失败: " + err.Error()})
+		}
+		return
+	}
+
+	log.Printf("管理员 %v 将用户 %v 的负责板块设置为 %v", adminId, userId, req.Sections)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "版主板块已更新",
+		"user_id":  userId,
+		"sections": req.Sections,
+	})
+}
+
+// GetMyPermissions returns the permissions the current user holds, e.g. to show moderation tools
+func (uc *UserController) GetMyPermissions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	permissions, err := uc.service.GetPermissions(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": permissions})
+}
+
 // GetAllUsers 获取所有用户
 func (uc *UserController) GetAllUsers(c *gin.Context) {
 	log.Println("UserController: 开始获取所有用户")
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
+	"nhcommunity/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserDataController handles exporting the current user's data and deleting their account
+type UserDataController struct {
+	service services.UserDataService
+}
+
+// NewUserDataController creates a new user data controller
+func NewUserDataController(service services.UserDataService) *UserDataController {
+	return &UserDataController{service: service}
+}
+
+// Export downloads everything stored about the current user, as one JSON document or,
+// with ?format=zip, as a ZIP archive with one JSON file per section
+func (uc *UserDataController) Export(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	export, err := uc.service.Export(userID.(uint))
+	if err != nil {
+		log.Printf("ERROR: Failed to export data of user %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export your data"})
+		return
+	}
+
+	filename := fmt.Sprintf("nhcommunity-export-%d-%s.%s", userID, export.ExportedAt.Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if format == "json" {
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	// 先写入内存，出错时还能返回错误状态码
+	var archive bytes.Buffer
+	if err := services.WriteExportArchive(&archive, export); err != nil {
+		log.Printf("ERROR: Failed to write export archive of user %v: %v", userID, err)
+		c.Header("Content-Disposition", "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export your data"})
+		return
+	}
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// DeleteAccount schedules the current account for deletion after the grace period and signs it out
+// everywhere. Signing in again before then cancels the deletion.
+func (uc *UserDataController) DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sessionID string
+	if value, ok := c.Get("claims"); ok {
+		if claims, ok := value.(*utils.JWTClaims); ok {
+			sessionID = claims.SessionID
+		}
+	}
+
+	deletion, err := uc.service.RequestDeletion(userID.(uint), sessionID, req)
+	if err != nil {
+		if errors.Is(err, models.ErrIncorrectPassword) || errors.Is(err, models.ErrReauthenticationRequired) ||
+			errors.Is(err, models.ErrInvalidTwoFactorCode) || errors.Is(err, models.ErrTwoFactorNotEnabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("ERROR: Failed to schedule deletion of user %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete your account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Your account will be deleted; sign in again before then to cancel",
+		"data":    deletion,
+	})
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// VerificationController handles student identity verification endpoints
+type VerificationController struct {
+	service services.VerificationService
+}
+
+// NewVerificationController creates a new verification controller
+func NewVerificationController(service services.VerificationService) *VerificationController {
+	return &VerificationController{service: service}
+}
+
+// Submit starts a student verification request for the current user
+func (vc *VerificationController) Submit(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.SubmitVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	verification, err := vc.service.Submit(userID.(uint), &req)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": verification})
+}
+
+// GetMine returns the current user's most recent verification request
+func (vc *VerificationController) GetMine(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	verification, err := vc.service.GetLatest(userID.(uint))
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": verification})
+}
+
+// ConfirmCampusEmail completes a campus email verification with the token from the mailed link
+func (vc *VerificationController) ConfirmCampusEmail(c *gin.Context) {
+	var req models.ConfirmCampusEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := vc.service.ConfirmCampusEmail(req.Token); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Student identity verified successfully"})
+}
+
+// GetRequests lists verification requests for admins, filtered by ?status= (default pending)
+func (vc *VerificationController) GetRequests(c *gin.Context) {
+	status := c.DefaultQuery("status", models.VerificationPending)
+	if status == "all" {
+		status = ""
+	}
+	page, err := parsePageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	verifications, err := vc.service.ListRequests(status, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve verification requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "Verification requests retrieved successfully",
+		"data":       verifications.Items,
+		"pagination": verifications.PageInfo,
+	})
+}
+
+// Review approves or rejects a verification request (admin)
+func (vc *VerificationController) Review(c *gin.Context) {
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification request ID"})
+		return
+	}
+
+	var req models.ReviewVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := vc.service.Review(uint(id), adminID.(uint), &req); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Verification request " + req.Status})
+}
+
+func respondVerificationError(c *gin.Context, err error) {
+	if status, ok := mediaErrorStatus(err); ok {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Verification request not found"})
+	case errors.Is(err, models.ErrInvalidAccountToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+	case errors.Is(err, models.ErrEvidenceRequired), errors.Is(err, models.ErrNotCampusEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrAlreadyVerified), errors.Is(err, models.ErrVerificationPending),
+		errors.Is(err, models.ErrVerificationNotPending), errors.Is(err, repositories.ErrStudentIdExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process verification request"})
+	}
+}
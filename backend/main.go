@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"net/http"
 	"nhcommunity/config"
 	"nhcommunity/routes"
 	"nhcommunity/services"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,12 +42,31 @@ func main() {
 
 	// Initialize Gin Engine
 	router := gin.Default()
+	// Only the configured reverse proxies may set the client IP through X-Forwarded-For, otherwise
+	// anyone could pick their own IP and dodge the sign-in limits
+	if err := router.SetTrustedProxies(config.GetConfig().TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Background jobs and the server stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Setup Routes
-	routes.SetupRoutes(router, db, hub)
+	routes.SetupRoutes(ctx, router, db, hub)
 
 	// Start Server
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("failed to run server: %v", err)
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("failed to run server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down server: %v", err)
 	}
 }
@@ -3,14 +3,17 @@ package middlewares
 import (
 	"fmt"
 	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/services"
 	"nhcommunity/utils"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates JWT tokens and authorizes users
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates JWT tokens and authorizes users. Tokens of sessions that were logged out
+// or revoked, and tokens of deactivated users, are rejected even if they have not expired yet.
+func AuthMiddleware(sessions services.SessionStatusCache, users services.UserStatusCache) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -32,28 +35,65 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Validate the token
-		claims, err := utils.ValidateToken(tokenString)
+		claims, err := utils.ValidateAccessToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Invalid token: %v", err)})
 			c.Abort()
 			return
 		}
 
+		// 访问令牌随会话一起失效，不必等到过期
+		active, err := sessions.IsActive(claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate session"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token: session has ended"})
+			c.Abort()
+			return
+		}
+
+		// 被禁用的账号立即失去访问权限
+		status, err := users.Get(claims.UserID)
+		if err != nil || !status.IsActive {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token: account is disabled"})
+			c.Abort()
+			return
+		}
+
 		// Set user ID in the context
 		c.Set("user_id", claims.UserID)
 		// 保存完整的claims
 		c.Set("claims", claims)
-		// 如果claims中包含角色信息，直接设置到上下文
-		if claims.Role != "" {
-			c.Set("user_role", claims.Role)
-			fmt.Printf("AuthMiddleware: 从JWT获取用户角色: %s\n", claims.Role)
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware identifies the user on public routes when a valid Bearer token is present.
+// Requests without a token, or with an invalid one, one of an ended session or of a deactivated user,
+// continue anonymously instead of being rejected.
+func OptionalAuthMiddleware(sessions services.SessionStatusCache, users services.UserStatusCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			if claims, err := utils.ValidateAccessToken(parts[1]); err == nil {
+				active, _ := sessions.IsActive(claims.SessionID)
+				status, err := users.Get(claims.UserID)
+				if active && err == nil && status.IsActive {
+					c.Set("user_id", claims.UserID)
+					c.Set("claims", claims)
+				}
+			}
 		}
 		c.Next()
 	}
 }
 
-// AdminMiddleware 验证用户是否具有管理员权限
-func AdminMiddleware() gin.HandlerFunc {
+// RequirePermission 验证用户是否拥有指定权限
+// 权限由角色和版主负责的板块实时计算，而不是信任签发时写入JWT的角色
+func RequirePermission(authz services.Authorizer, permission models.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从上下文中获取用户ID
 		userID, exists := c.Get("user_id")
@@ -63,39 +103,49 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 打印调试信息
-		fmt.Printf("AdminMiddleware: 用户ID: %v\n", userID)
-
-		// 从上下文中获取用户角色
-		userRole, exists := c.Get("user_role")
-		if !exists {
-			// 如果上下文中没有角色信息，使用claims
-			claims, exists := c.Get("claims")
-			if exists {
-				if jwtClaims, ok := claims.(*utils.JWTClaims); ok && jwtClaims.Role != "" {
-					userRole = jwtClaims.Role
-					fmt.Printf("AdminMiddleware: 从JWT获取角色: %s\n", userRole)
-				}
-			}
-		} else {
-			fmt.Printf("AdminMiddleware: 从上下文获取角色: %v\n", userRole)
+		// 账号被禁用、角色或板块变更时立即失去权限
+		if !authz.Can(userID.(uint), permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "没有权限执行此操作"})
+			c.Abort()
+			return
 		}
+		c.Next()
+	}
+}
 
-		// 将userRole转换为字符串类型
-		roleStr := ""
-		if userRole != nil {
-			roleStr = fmt.Sprintf("%v", userRole)
-		}
+// VerifiedOnly returns a middleware factory for actions that may be limited to verified students.
+// Actions listed in restricted (e.g. "marketplace.create") reject users without a confirmed student
+// identity; every other action passes through, so the restriction is configured rather than hard-coded.
+func VerifiedOnly(statuses services.UserStatusCache, restricted []string) func(action string) gin.HandlerFunc {
+	restrictedSet := make(map[string]bool, len(restricted))
+	for _, action := range restricted {
+		restrictedSet[strings.TrimSpace(action)] = true
+	}
 
-		// 验证用户是否为管理员
-		if roleStr != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "没有管理员权限"})
-			c.Abort()
-			return
+	return func(action string) gin.HandlerFunc {
+		if !restrictedSet[action] {
+			return func(c *gin.Context) { c.Next() }
 		}
+		return func(c *gin.Context) {
+			userID, exists := c.Get("user_id")
+			if !exists {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				c.Abort()
+				return
+			}
 
-		// 添加一个头信息，便于前端知道用户有管理员权限
-		c.Header("X-Admin-Verified", "true")
-		c.Next()
+			status, err := statuses.Get(userID.(uint))
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				c.Abort()
+				return
+			}
+			if !status.Verified {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only verified students can do this, please verify your student identity first"})
+				c.Abort()
+				return
+			}
+			c.Next()
+		}
 	}
 }
@@ -0,0 +1,213 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nhcommunity/config"
+	"nhcommunity/models"
+	"nhcommunity/services"
+	"nhcommunity/utils"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = config.Config{JWTSecret: "test-secret", AccessTokenExpiresIn: 15, TokenExpiresIn: 60}
+	os.Exit(m.Run())
+}
+
+// fakeSessions reports the sessions in active as active
+type fakeSessions struct {
+	active map[string]bool
+}
+
+func (f fakeSessions) IsActive(sessionID string) (bool, error) { return f.active[sessionID], nil }
+func (f fakeSessions) Invalidate(string)                       {}
+func (f fakeSessions) InvalidateUser(uint)                     {}
+
+// fakeStatuses reports every user as active except the ones in disabled, and the ones in verified as verified students
+type fakeStatuses struct {
+	services.UserStatusCache
+	disabled map[uint]bool
+	verified map[uint]bool
+}
+
+func (f fakeStatuses) Get(userID uint) (services.UserStatus, error) {
+	return services.UserStatus{IsActive: !f.disabled[userID], Verified: f.verified[userID]}, nil
+}
+
+func token(t *testing.T, tokenType utils.TokenType, sessionID string) string {
+	t.Helper()
+	return userToken(t, 7, tokenType, sessionID)
+}
+
+func userToken(t *testing.T, userID uint, tokenType utils.TokenType, sessionID string) string {
+	t.Helper()
+	token, err := utils.GenerateSessionToken(userID, "user@example.com", tokenType, "user", sessionID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	sessions := fakeSessions{active: map[string]bool{"live": true}}
+	users := fakeStatuses{disabled: map[uint]bool{8: true}}
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"active session", token(t, utils.AccessToken, "live"), http.StatusOK},
+		{"deactivated user", userToken(t, 8, utils.AccessToken, "live"), http.StatusUnauthorized},
+		{"revoked session", token(t, utils.AccessToken, "revoked"), http.StatusUnauthorized},
+		{"token without session", token(t, utils.AccessToken, ""), http.StatusUnauthorized},
+		{"refresh token", token(t, utils.RefreshToken, "live"), http.StatusUnauthorized},
+		{"no header", "", http.StatusUnauthorized},
+		{"not bearer", "Basic abc", http.StatusUnauthorized},
+		{"garbage", "Bearer abc", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", AuthMiddleware(sessions, users), func(c *gin.Context) {
+				if c.GetUint("user_id") != 7 {
+					t.Errorf("user_id = %v", c.GetUint("user_id"))
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionalAuthMiddleware(t *testing.T) {
+	sessions := fakeSessions{active: map[string]bool{"live": true}}
+	users := fakeStatuses{disabled: map[uint]bool{8: true}}
+	tests := []struct {
+		name   string
+		header string
+		want   uint // 0 is anonymous
+	}{
+		{"active session", token(t, utils.AccessToken, "live"), 7},
+		{"deactivated user", userToken(t, 8, utils.AccessToken, "live"), 0},
+		{"revoked session", token(t, utils.AccessToken, "revoked"), 0},
+		{"token without session", token(t, utils.AccessToken, ""), 0},
+		{"no header", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got uint
+			router := gin.New()
+			router.GET("/", OptionalAuthMiddleware(sessions, users), func(c *gin.Context) {
+				got = c.GetUint("user_id")
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || got != tt.want {
+				t.Errorf("status = %d, user = %d; want 200, %d", rec.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeAuthorizer grants each user the listed permissions
+type fakeAuthorizer struct {
+	services.Authorizer
+	granted map[uint][]models.Permission
+}
+
+func (f fakeAuthorizer) Can(userID uint, permission models.Permission) bool {
+	for _, p := range f.granted[userID] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRequirePermission(t *testing.T) {
+	authz := fakeAuthorizer{granted: map[uint][]models.Permission{
+		1: {models.PermUserBan},
+		2: {models.PermPostDeleteAny},
+	}}
+	tests := []struct {
+		name   string
+		userID uint // 0 is anonymous
+		want   int
+	}{
+		{"granted", 1, http.StatusOK},
+		{"other permission", 2, http.StatusForbidden},
+		{"no permissions", 3, http.StatusForbidden},
+		{"anonymous", 0, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				if tt.userID != 0 {
+					c.Set("user_id", tt.userID)
+				}
+			}, RequirePermission(authz, models.PermUserBan), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifiedOnly(t *testing.T) {
+	verifiedOnly := VerifiedOnly(fakeStatuses{verified: map[uint]bool{1: true}}, []string{" marketplace.create "})
+	tests := []struct {
+		name   string
+		action string
+		userID uint // 0 is anonymous
+		want   int
+	}{
+		{"verified student", "marketplace.create", 1, http.StatusOK},
+		{"unverified user", "marketplace.create", 2, http.StatusForbidden},
+		{"anonymous", "marketplace.create", 0, http.StatusUnauthorized},
+		{"unrestricted action", "event.create", 2, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				if tt.userID != 0 {
+					c.Set("user_id", tt.userID)
+				}
+			}, verifiedOnly(tt.action), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import "errors"
+
+var (
+	// ErrEmailNotVerified is returned when signing in before the email address has been confirmed
+	ErrEmailNotVerified = errors.New("email address not verified")
+	// ErrAccountDisabled is returned when a deactivated or banned user proves who they are on any login path
+	ErrAccountDisabled = errors.New("account is disabled")
+	// ErrInvalidAccountToken is returned for email verification and password reset tokens
+	// that are malformed, expired or already used
+	ErrInvalidAccountToken = errors.New("invalid or expired token")
+)
+
+// VerifyEmailRequest represents the request body for confirming an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// EmailRequest represents the request body of endpoints that only take an email address,
+// such as requesting a password reset or another verification email
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the request body for choosing a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
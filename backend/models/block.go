@@ -0,0 +1,29 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrUserBlocked is returned when one of two users has blocked the other
+	ErrUserBlocked = errors.New("you cannot interact with this user")
+	// ErrCannotBlockSelf is returned when a user tries to block or mute themselves
+	ErrCannotBlockSelf = errors.New("you cannot block or mute yourself")
+)
+
+// UserBlock records that BlockerID blocked BlockedID. A block works in both directions:
+// neither user can message, follow or react to the other, and their content is hidden from each other.
+type UserBlock struct {
+	BlockerID uint      `gorm:"primaryKey" json:"blocker_id"`
+	BlockedID uint      `gorm:"primaryKey;index" json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserMute records that MuterID muted MutedID. Unlike a block it only affects the muter,
+// whose feed and notifications no longer include the muted user.
+type UserMute struct {
+	MuterID   uint      `gorm:"primaryKey" json:"muter_id"`
+	MutedID   uint      `gorm:"primaryKey" json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
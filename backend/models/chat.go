@@ -1,22 +1,68 @@
 package models
 
 import (
+	"errors"
 	"time"
 )
 
+var (
+	// ErrConversationNotFound is returned for conversations that do not exist or that the user is not a member of
+	ErrConversationNotFound = errors.New("conversation not found")
+	// ErrNotGroupConversation is returned when a group action is used on a direct conversation
+	ErrNotGroupConversation = errors.New("not a group conversation")
+	// ErrGroupFull is returned when a group would have more than MaxGroupMembers members
+	ErrGroupFull = errors.New("group has too many members")
+	// ErrInvalidConversationRole is returned for roles other than owner, admin and member
+	ErrInvalidConversationRole = errors.New("invalid conversation role")
+	// ErrClientMessageIDTooLong is returned for client message IDs longer than MaxClientMessageIDLength
+	ErrClientMessageIDTooLong = errors.New("client message ID is too long")
+)
+
+// MaxClientMessageIDLength is the longest ClientMessageID a message may carry
+const MaxClientMessageIDLength = 64
+
+// MaxSyncMessages caps how many messages of one conversation a sync replays; clients fetch
+// the rest with GET /conversations/:id/messages?after_seq=
+const MaxSyncMessages = 200
+
+// Conversation types
+const (
+	ConversationDirect = "direct"
+	ConversationGroup  = "group"
+)
+
+// Roles of the members of a group conversation. The owner manages admins and can hand over
+// ownership; owners and admins can rename the group and add or remove members.
+const (
+	ConversationRoleOwner  = "owner"
+	ConversationRoleAdmin  = "admin"
+	ConversationRoleMember = "member"
+)
+
+// MaxGroupMembers caps how many users a group conversation may have
+const MaxGroupMembers = 200
+
 // Conversation represents a chat session between two or more users.
 type Conversation struct {
 	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
 	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
 	UpdatedAt time.Time `gorm:"column:updated_at" json:"updatedAt"`
+	Type      string    `gorm:"size:10;not null;default:'direct';column:type" json:"type"` // direct, group
+	Name      string    `gorm:"size:100;column:name" json:"name,omitempty"`                // only for groups
 
 	// We can store participants in a separate join table
-	Participants []User    `gorm:"many2many:conversation_participants;" json:"participants"`
-	Messages     []Message `gorm:"-" json:"messages"` // Remove gorm relation tag to break circular dependency
+	Participants []User                    `gorm:"many2many:conversation_participants;" json:"participants"`
+	Members      []ConversationParticipant `gorm:"foreignKey:ConversationID" json:"members,omitempty"` // with roles
+	Messages     []Message                 `gorm:"-" json:"messages"`                                  // Remove gorm relation tag to break circular dependency
 
 	// For quick access to the last message
 	LastMessageID *uint    `gorm:"column:last_message_id" json:"lastMessageId"`
 	LastMessage   *Message `gorm:"-" json:"lastMessage"` // Remove gorm relation tag to break circular dependency
+	// LastSeq is the sequence number of the latest message, so clients can tell whether they missed any
+	LastSeq uint64 `gorm:"not null;default:0;column:last_seq" json:"lastSeq"`
+
+	// UnreadCount is the number of messages from others after the current user's read watermark
+	UnreadCount int64 `gorm:"-" json:"unreadCount"`
 }
 
 // TableName returns the database table name for the Conversation model.
@@ -24,15 +70,22 @@ func (Conversation) TableName() string {
 	return "conversations"
 }
 
-// Message represents a single chat message in a conversation.
+// Message represents a single chat message in a conversation. When the sender's account is deleted, their
+// group messages stay in place, so that the seq numbering has no gaps, but are emptied and get SenderID 0.
 type Message struct {
 	ID             uint      `gorm:"primaryKey;column:id" json:"id"`
-	ConversationID uint      `gorm:"not null;index;column:conversation_id" json:"conversationId"`
-	SenderID       uint      `gorm:"not null;index;column:sender_id" json:"senderId"`
+	ConversationID uint      `gorm:"not null;index;index:idx_messages_conversation_seq,priority:1;uniqueIndex:idx_messages_conversation_client_id,priority:1;column:conversation_id" json:"conversationId"`
+	SenderID       uint      `gorm:"index;uniqueIndex:idx_messages_conversation_client_id,priority:2;column:sender_id" json:"senderId"`
 	Content        string    `gorm:"type:text;not null;column:content" json:"content"`
-	IsRead         bool      `gorm:"default:false;column:is_read" json:"isRead"`
+	IsRead         bool      `gorm:"default:false;column:is_read" json:"isRead"` // read by at least one other participant
 	CreatedAt      time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
 
+	// Seq numbers the messages of a conversation 1, 2, 3, ... in the order they were stored
+	Seq uint64 `gorm:"not null;default:0;index:idx_messages_conversation_seq,priority:2;column:seq" json:"seq"`
+	// ClientMessageID is chosen by the sending client, so that a message retransmitted to the same
+	// conversation is only stored once
+	ClientMessageID *string `gorm:"size:64;uniqueIndex:idx_messages_conversation_client_id,priority:3;column:client_message_id" json:"clientMessageId,omitempty"`
+
 	Sender User `gorm:"foreignKey:SenderID" json:"sender"`
 }
 
@@ -46,7 +99,48 @@ type ConversationParticipant struct {
 	ConversationID uint      `gorm:"primaryKey;column:conversation_id" json:"conversationId"`
 	UserID         uint      `gorm:"primaryKey;column:user_id" json:"userId"`
 	JoinedAt       time.Time `gorm:"autoCreateTime;column:joined_at" json:"joinedAt"`
-	// We could add roles here later (e.g., admin)
+	Role           string    `gorm:"size:10;not null;default:'member';column:role" json:"role"` // owner, admin, member
+	// LastReadMessageID is the read watermark: every message up to this ID has been read by the user
+	LastReadMessageID uint `gorm:"not null;default:0;column:last_read_message_id" json:"lastReadMessageId"`
+	// JoinedSeq is the seq of the last message before the user joined; syncs only replay what came after
+	JoinedSeq uint64 `gorm:"not null;default:0;column:joined_seq" json:"joinedSeq"`
+}
+
+// CanManage reports whether the member may rename the group and add or remove members
+func (p ConversationParticipant) CanManage() bool {
+	return p.Role == ConversationRoleOwner || p.Role == ConversationRoleAdmin
+}
+
+// Member returns the membership of userID, or false if the user is not a member
+func (c *Conversation) Member(userID uint) (ConversationParticipant, bool) {
+	for _, member := range c.Members {
+		if member.UserID == userID {
+			return member, true
+		}
+	}
+	return ConversationParticipant{}, false
+}
+
+// CreateGroupRequest represents the request body for creating a group conversation
+type CreateGroupRequest struct {
+	Name      string `json:"name" binding:"required,max=100"`
+	MemberIDs []uint `json:"memberIds" binding:"required,min=1"`
+}
+
+// UpdateGroupRequest represents the request body for renaming a group conversation
+type UpdateGroupRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// AddMembersRequest represents the request body for adding members to a group conversation
+type AddMembersRequest struct {
+	UserIDs []uint `json:"userIds" binding:"required,min=1"`
+}
+
+// UpdateMemberRoleRequest represents the request body for changing the role of a group member.
+// Making someone the owner hands over ownership; the previous owner becomes an admin.
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member"`
 }
 
 // TableName returns the database table name for the ConversationParticipant model.
@@ -56,6 +150,22 @@ func (ConversationParticipant) TableName() string {
 
 // --- WebSocket Message Structures (Not for DB) ---
 
+// WebSocket message types exchanged with clients.
+const (
+	WSTypePrivateMessage         = "private_message"
+	WSTypeIncomingPrivateMessage = "incoming_private_message"
+	WSTypeGroupMessage           = "group_message"
+	WSTypeIncomingGroupMessage   = "incoming_group_message"
+	WSTypeNotification           = "notification"
+	WSTypeUnreadCount            = "unread_count"
+	WSTypeMarkRead               = "mark_read"
+	WSTypeReadReceipt            = "read_receipt"
+	WSTypeTyping                 = "typing"
+	WSTypePresence               = "presence"
+	WSTypeSync                   = "sync"
+	WSTypeAck                    = "ack"
+)
+
 // WebsocketMessage is the structure for messages sent over the WebSocket connection.
 type WebsocketMessage struct {
 	Type      string      `json:"type"` // e.g., "private_message", "typing_indicator", "error"
@@ -65,15 +175,110 @@ type WebsocketMessage struct {
 
 // PrivateMessagePayload is the payload for a 'private_message' type message.
 type PrivateMessagePayload struct {
-	RecipientID uint   `json:"recipientId"`
-	Content     string `json:"content"`
+	RecipientID     uint   `json:"recipientId"`
+	Content         string `json:"content"`
+	ClientMessageID string `json:"clientMessageId"`
 }
 
 // ToMessage converts the payload to a database Message model.
 func (p *PrivateMessagePayload) ToMessage(senderID, conversationID uint) *Message {
 	return &Message{
-		ConversationID: conversationID,
-		SenderID:       senderID,
-		Content:        p.Content,
+		ConversationID:  conversationID,
+		SenderID:        senderID,
+		Content:         p.Content,
+		ClientMessageID: clientMessageID(p.ClientMessageID),
+	}
+}
+
+// MarkReadPayload is the payload for a 'mark_read' type message and the body of
+// POST /conversations/:id/read. Without a MessageID everything up to the latest message is read.
+type MarkReadPayload struct {
+	ConversationID uint `json:"conversationId"`
+	MessageID      uint `json:"messageId"`
+}
+
+// ReadReceipt is the payload of a 'read_receipt' event, sent to the senders of the messages that were read
+type ReadReceipt struct {
+	ConversationID    uint      `json:"conversationId"`
+	UserID            uint      `json:"userId"`
+	LastReadMessageID uint      `json:"lastReadMessageId"`
+	ReadAt            time.Time `json:"readAt"`
+}
+
+// GroupMessagePayload is the payload for a 'group_message' type message.
+type GroupMessagePayload struct {
+	ConversationID  uint   `json:"conversationId"`
+	Content         string `json:"content"`
+	ClientMessageID string `json:"clientMessageId"`
+}
+
+// ToMessage converts the payload to a database Message model.
+func (p *GroupMessagePayload) ToMessage(senderID uint) *Message {
+	return &Message{
+		ConversationID:  p.ConversationID,
+		SenderID:        senderID,
+		Content:         p.Content,
+		ClientMessageID: clientMessageID(p.ClientMessageID),
+	}
+}
+
+// clientMessageID stores an empty client message ID as NULL, which the unique index ignores
+func clientMessageID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
+
+// SyncCursor is the sequence number of the last message a client has of a conversation
+type SyncCursor struct {
+	ConversationID uint   `json:"conversationId"`
+	LastSeq        uint64 `json:"lastSeq"`
+	// JoinedSeq is the JoinedSeq of the user's membership; it is only filled in by the server
+	JoinedSeq uint64 `json:"-"`
+}
+
+// SyncPayload is the payload for a 'sync' type message, sent by a client after connecting.
+// Conversations without a cursor are replayed from the start.
+type SyncPayload struct {
+	Cursors []SyncCursor `json:"cursors"`
+}
+
+// SyncedConversation holds the messages of one conversation a client was missing, oldest first
+type SyncedConversation struct {
+	ConversationID uint      `json:"conversationId"`
+	LastSeq        uint64    `json:"lastSeq"`
+	Messages       []Message `json:"messages"`
+	HasMore        bool      `json:"hasMore"` // more than MaxSyncMessages were missing
+}
+
+// SyncResult is the payload of the 'sync' event the server answers with. Only conversations
+// with messages after the client's cursor are included.
+type SyncResult struct {
+	Conversations []SyncedConversation `json:"conversations"`
+}
+
+// MessageAck is the payload of the 'ack' event sent to the connection a message came from,
+// confirming that it was stored, or why it was not
+type MessageAck struct {
+	ClientMessageID string     `json:"clientMessageId,omitempty"`
+	ConversationID  uint       `json:"conversationId,omitempty"`
+	MessageID       uint       `json:"messageId,omitempty"`
+	Seq             uint64     `json:"seq,omitempty"`
+	CreatedAt       *time.Time `json:"createdAt,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// NewMessageAck returns the acknowledgement of a stored message
+func NewMessageAck(message *Message) MessageAck {
+	ack := MessageAck{
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+		Seq:            message.Seq,
+		CreatedAt:      &message.CreatedAt,
+	}
+	if message.ClientMessageID != nil {
+		ack.ClientMessageID = *message.ClientMessageID
 	}
+	return ack
 }
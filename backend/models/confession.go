@@ -10,20 +10,22 @@ import (
 type Confession struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
 	UserID        uint      `gorm:"not null" json:"user_id"` // Creator ID, but not shown publicly if anonymous
-	Content       string    `gorm:"size:5000;not null" json:"content"`
+	Content       string    `gorm:"size:5000;not null;index:idx_confessions_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"content"`
 	ImageURL      string    `gorm:"size:500" json:"image_url"`
 	IsAnonymous   bool      `gorm:"default:true" json:"is_anonymous"`
 	IsApproved    bool      `gorm:"default:false" json:"is_approved"`        // Requires moderation
 	Status        string    `gorm:"size:20;default:'pending'" json:"status"` // pending, approved, rejected
 	LikesCount    int       `gorm:"default:0" json:"likes_count"`
 	CommentsCount int       `gorm:"default:0" json:"comments_count"`
-	CreatedAt     time.Time `gorm:"not null" json:"created_at"`
+	ViewsCount    int       `gorm:"default:0" json:"views_count"`
+	HotScore      float64   `gorm:"default:0;index" json:"hot_score"` // Recomputed periodically, see TrendingService
+	CreatedAt     time.Time `gorm:"not null;index" json:"created_at"`
 	UpdatedAt     time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	User     User                `gorm:"foreignKey:UserID" json:"user"`
-	Comments []ConfessionComment `gorm:"foreignKey:ConfessionID" json:"comments,omitempty"`
-	Likes    []ConfessionLike    `gorm:"foreignKey:ConfessionID" json:"likes,omitempty"`
+	User     User                `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	Comments []ConfessionComment `gorm:"foreignKey:ConfessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"comments,omitempty"`
+	Likes    []ConfessionLike    `gorm:"foreignKey:ConfessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"likes,omitempty"`
 }
 
 // ConfessionComment represents a comment on a confession
@@ -37,8 +39,8 @@ type ConfessionComment struct {
 	UpdatedAt    time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	User       User       `gorm:"foreignKey:UserID" json:"user"`
-	Confession Confession `gorm:"foreignKey:ConfessionID" json:"-"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	Confession Confession `gorm:"foreignKey:ConfessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
 
 // ConfessionLike represents a like on a confession
@@ -49,8 +51,8 @@ type ConfessionLike struct {
 	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
 
 	// Relationships
-	User       User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Confession Confession `gorm:"foreignKey:ConfessionID" json:"-"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user,omitempty"`
+	Confession Confession `gorm:"foreignKey:ConfessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
 
 // ConfessionResponse is the public confession data
@@ -61,6 +63,7 @@ type ConfessionResponse struct {
 	IsAnonymous   bool          `json:"is_anonymous"`
 	LikesCount    int           `json:"likes_count"`
 	CommentsCount int           `json:"comments_count"`
+	ViewsCount    int           `json:"views_count"`
 	CreatedAt     time.Time     `json:"created_at"`
 	User          *UserResponse `json:"user,omitempty"` // Only included if not anonymous
 	IsLiked       bool          `json:"is_liked,omitempty"`
@@ -114,6 +117,7 @@ func (c *Confession) ToResponse(currentUserID uint) ConfessionResponse {
 		IsAnonymous:   c.IsAnonymous,
 		LikesCount:    c.LikesCount,
 		CommentsCount: c.CommentsCount,
+		ViewsCount:    c.ViewsCount,
 		CreatedAt:     c.CreatedAt,
 		IsLiked:       isLiked,
 	}
@@ -173,3 +177,13 @@ func (l *ConfessionLike) AfterDelete(tx *gorm.DB) error {
 	return tx.Model(&Confession{}).Where("id = ?", l.ConfessionID).
 		UpdateColumn("likes_count", gorm.Expr("likes_count - ?", 1)).Error
 }
+
+// CursorKey returns the keyset pagination position of the confession
+func (c Confession) CursorKey() Cursor {
+	return uintCursor(c.CreatedAt, c.ID)
+}
+
+// ScoreKey returns the hot ranking pagination position of the confession
+func (c Confession) ScoreKey() Cursor {
+	return scoreCursor(c.HotScore, c.ID)
+}
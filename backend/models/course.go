@@ -10,9 +10,9 @@ import (
 type Course struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	Code        string    `gorm:"size:50;not null;unique" json:"code"`
-	Name        string    `gorm:"size:200;not null" json:"name"`
+	Name        string    `gorm:"size:200;not null;index:idx_courses_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"name"`
 	Department  string    `gorm:"size:100;not null" json:"department"`
-	Description string    `gorm:"size:5000" json:"description"`
+	Description string    `gorm:"size:5000;index:idx_courses_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"description"`
 	Credits     float64   `gorm:"not null" json:"credits"`
 	Instructor  string    `gorm:"size:200" json:"instructor"`
 	Semester    string    `gorm:"size:50" json:"semester"` // Fall, Spring, Summer
@@ -21,11 +21,11 @@ type Course struct {
 	RatingCount int       `gorm:"default:0" json:"rating_count"`
 	Difficulty  float64   `gorm:"default:0" json:"difficulty"`
 	Workload    float64   `gorm:"default:0" json:"workload"`
-	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	CreatedAt   time.Time `gorm:"not null;index" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	Reviews []CourseReview `gorm:"foreignKey:CourseID" json:"reviews,omitempty"`
+	Reviews []CourseReview `gorm:"foreignKey:CourseID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"reviews,omitempty"`
 }
 
 // CourseReview represents a review for a course
@@ -44,8 +44,8 @@ type CourseReview struct {
 	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	User   User   `gorm:"foreignKey:UserID" json:"user"`
-	Course Course `gorm:"foreignKey:CourseID" json:"-"`
+	User   User   `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	Course Course `gorm:"foreignKey:CourseID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
 
 // CourseResponse is the public course data
@@ -229,3 +229,8 @@ func (r *CourseReview) BeforeDelete(tx *gorm.DB) error {
 		"rating_count": newRatingCount,
 	}).Error
 }
+
+// CursorKey returns the keyset pagination position of the course
+func (c Course) CursorKey() Cursor {
+	return uintCursor(c.CreatedAt, c.ID)
+}
@@ -7,8 +7,8 @@ import (
 // Event represents a community event
 type Event struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
-	Title        string    `gorm:"size:200;not null" json:"title"`
-	Description  string    `gorm:"size:5000;not null" json:"description"`
+	Title        string    `gorm:"size:200;not null;index:idx_events_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"title"`
+	Description  string    `gorm:"size:5000;not null;index:idx_events_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"description"`
 	Location     string    `gorm:"size:500;not null" json:"location"`
 	StartDate    time.Time `gorm:"not null" json:"start_date"`
 	EndDate      time.Time `gorm:"not null" json:"end_date"`
@@ -16,12 +16,12 @@ type Event struct {
 	MaxAttendees int       `gorm:"default:0" json:"max_attendees"` // 0 means unlimited
 	CreatorID    uint      `gorm:"not null" json:"creator_id"`
 	IsActive     bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
+	CreatedAt    time.Time `gorm:"not null;index" json:"created_at"`
 	UpdatedAt    time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	Creator   User            `gorm:"foreignKey:CreatorID" json:"creator"`
-	Attendees []EventAttendee `gorm:"foreignKey:EventID" json:"attendees,omitempty"`
+	Creator   User            `gorm:"foreignKey:CreatorID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"creator"`
+	Attendees []EventAttendee `gorm:"foreignKey:EventID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"attendees,omitempty"`
 }
 
 // EventAttendee represents a user attending an event
@@ -34,8 +34,8 @@ type EventAttendee struct {
 	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	User  User  `gorm:"foreignKey:UserID" json:"user"`
-	Event Event `gorm:"foreignKey:EventID" json:"-"`
+	User  User  `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	Event Event `gorm:"foreignKey:EventID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
 
 // EventResponse is the public event data with creator info
@@ -108,3 +108,8 @@ func (e *Event) ToResponse(currentUserID uint) EventResponse {
 		UserAttendance: userAttendance,
 	}
 }
+
+// CursorKey returns the keyset pagination position of the event
+func (e Event) CursorKey() Cursor {
+	return uintCursor(e.CreatedAt, e.ID)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Feed entry types, listed from the lowest to the highest tie-break rank.
+// Entries created at the same instant are ordered by rank, then by ID.
+const (
+	FeedTypeListing = "listing"
+	FeedTypePartner = "partner"
+	FeedTypeEvent   = "event"
+	FeedTypePost    = "post"
+)
+
+// FeedTypes lists every feed entry type in tie-break order
+var FeedTypes = []string{FeedTypeListing, FeedTypePartner, FeedTypeEvent, FeedTypePost}
+
+// FeedItem is a single entry of the following feed.
+// Payload holds the response of the underlying resource and is selected by Type:
+// PostResponse, EventResponse, PartnerResponse or MarketplaceResponse.
+type FeedItem struct {
+	Type      string      `json:"type"`
+	ID        string      `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Payload   interface{} `json:"payload"`
+}
+
+// CursorKey returns the keyset pagination position of the entry.
+// The entry type is folded into the cursor ID so that the feed can be resumed across types.
+func (f FeedItem) CursorKey() Cursor {
+	return Cursor{CreatedAt: f.CreatedAt, ID: f.Type + ":" + f.ID}
+}
+
+// FeedRank returns the tie-break rank of a feed entry type, or -1 if the type is unknown
+func FeedRank(feedType string) int {
+	for i, t := range FeedTypes {
+		if t == feedType {
+			return i
+		}
+	}
+	return -1
+}
+
+// SplitFeedCursor splits a feed cursor ID back into its entry type and resource ID
+func SplitFeedCursor(cursor *Cursor) (feedType, id string, err error) {
+	return splitTypedCursor(cursor, FeedRank)
+}
+
+// splitTypedCursor splits a "type:id" cursor ID, accepting only types that rank knows about
+func splitTypedCursor(cursor *Cursor, rank func(string) int) (string, string, error) {
+	parts := strings.SplitN(cursor.ID, ":", 2)
+	if len(parts) != 2 || parts[1] == "" || rank(parts[0]) < 0 {
+		return "", "", ErrInvalidCursor
+	}
+	return parts[0], parts[1], nil
+}
@@ -2,43 +2,55 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // LostFound represents a lost or found item
 type LostFound struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	Title       string    `gorm:"size:200;not null" json:"title"`
-	Description string    `gorm:"size:5000;not null" json:"description"`
+	Title       string    `gorm:"size:200;not null;index:idx_lost_founds_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"title"`
+	Description string    `gorm:"size:5000;not null;index:idx_lost_founds_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"description"`
 	Type        string    `gorm:"size:20;not null" json:"type"` // lost, found
 	Category    string    `gorm:"size:100;not null" json:"category"`
-	ImageURLs   string    `gorm:"size:1000" json:"image_urls"` // Comma-separated list of image URLs
+	ImageURLs   string    `gorm:"size:1000" json:"image_urls"` // Deprecated: legacy comma-separated URLs, new uploads are linked through Media
 	Location    string    `gorm:"size:500" json:"location"`
 	Date        time.Time `gorm:"not null" json:"date"`                   // Date when the item was lost or found
 	Status      string    `gorm:"size:20;default:'active'" json:"status"` // active, resolved, expired
 	UserID      uint      `gorm:"not null" json:"user_id"`
 	Contact     string    `gorm:"size:200" json:"contact"` // Contact information
-	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	CreatedAt   time.Time `gorm:"not null;index" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	User User `gorm:"foreignKey:UserID" json:"user"`
+	User  User    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	Media []Media `gorm:"-" json:"media,omitempty"` // Filled from MediaLinks when they are preloaded
+	// MediaLinks attach Media in order; the repository writes them, see attachMedia
+	MediaLinks []LostFoundMedia `gorm:"foreignKey:LostFoundID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// AfterFind puts the preloaded media in order
+func (lf *LostFound) AfterFind(*gorm.DB) error {
+	lf.Media = linkedMedia(lf.MediaLinks, lf.Media)
+	return nil
 }
 
 // LostFoundResponse is the public lost & found item data with user info
 type LostFoundResponse struct {
-	ID          uint         `json:"id"`
-	Title       string       `json:"title"`
-	Description string       `json:"description"`
-	Type        string       `json:"type"`
-	Category    string       `json:"category"`
-	ImageURLs   string       `json:"image_urls"`
-	Location    string       `json:"location"`
-	Date        time.Time    `json:"date"`
-	Status      string       `json:"status"`
-	Contact     string       `json:"contact"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
-	User        UserResponse `json:"user"`
+	ID          uint            `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Type        string          `json:"type"`
+	Category    string          `json:"category"`
+	ImageURLs   string          `json:"image_urls"`
+	Media       []MediaResponse `json:"media"`
+	Location    string          `json:"location"`
+	Date        time.Time       `json:"date"`
+	Status      string          `json:"status"`
+	Contact     string          `json:"contact"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	User        UserResponse    `json:"user"`
 }
 
 // LostFoundCategory represents a category for lost & found items
@@ -56,7 +68,7 @@ type CreateItemRequest struct {
 	Description string    `json:"description" binding:"required"`
 	Type        string    `json:"type" binding:"required"`
 	Category    string    `json:"category" binding:"required"`
-	ImageURLs   string    `json:"image_urls"`
+	MediaIDs    []uint    `json:"media_ids"` // IDs returned by POST /uploads
 	Location    string    `json:"location"`
 	Date        time.Time `json:"date" binding:"required"`
 	Contact     string    `json:"contact"`
@@ -68,7 +80,7 @@ type UpdateLostFoundRequest struct {
 	Description string    `json:"description"`
 	Type        string    `json:"type"`
 	Category    string    `json:"category"`
-	ImageURLs   string    `json:"image_urls"`
+	MediaIDs    *[]uint   `json:"media_ids"` // Replaces the attached media when present
 	Location    string    `json:"location"`
 	Date        time.Time `json:"date"`
 	Status      string    `json:"status"`
@@ -84,6 +96,7 @@ func (lf *LostFound) ToResponse() LostFoundResponse {
 		Type:        lf.Type,
 		Category:    lf.Category,
 		ImageURLs:   lf.ImageURLs,
+		Media:       MediaResponses(lf.Media),
 		Location:    lf.Location,
 		Date:        lf.Date,
 		Status:      lf.Status,
@@ -93,3 +106,8 @@ func (lf *LostFound) ToResponse() LostFoundResponse {
 		User:        lf.User.ToResponse(),
 	}
 }
+
+// CursorKey returns the keyset pagination position of the item
+func (lf LostFound) CursorKey() Cursor {
+	return uintCursor(lf.CreatedAt, lf.ID)
+}
@@ -2,26 +2,38 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Marketplace represents a marketplace listing
 type Marketplace struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	Title       string    `gorm:"size:200;not null" json:"title"`
-	Description string    `gorm:"size:5000;not null" json:"description"`
+	Title       string    `gorm:"size:200;not null;index:idx_marketplaces_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"title"`
+	Description string    `gorm:"size:5000;not null;index:idx_marketplaces_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"description"`
 	Price       float64   `gorm:"not null" json:"price"`
-	ImageURLs   string    `gorm:"size:1000" json:"image_urls"` // Comma-separated list of image URLs
+	ImageURLs   string    `gorm:"size:1000" json:"image_urls"` // Deprecated: legacy comma-separated URLs, new uploads are linked through Media
 	Category    string    `gorm:"size:100;not null" json:"category"`
 	Condition   string    `gorm:"size:50;not null" json:"condition"` // new, like_new, good, fair, poor
 	SellerID    uint      `gorm:"not null" json:"seller_id"`
 	Status      string    `gorm:"size:20;default:'active'" json:"status"` // active, sold, reserved, deleted
 	Location    string    `gorm:"size:200" json:"location"`
 	Views       int       `gorm:"default:0" json:"views"`
-	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	HotScore    float64   `gorm:"default:0;index" json:"hot_score"` // Recomputed periodically, see TrendingService
+	CreatedAt   time.Time `gorm:"not null;index" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
-	Seller User `gorm:"foreignKey:SellerID" json:"seller"`
+	Seller User    `gorm:"foreignKey:SellerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"seller"`
+	Media  []Media `gorm:"-" json:"media,omitempty"` // Filled from MediaLinks when they are preloaded
+	// MediaLinks attach Media in order; the repository writes them, see attachMedia
+	MediaLinks []MarketplaceMedia `gorm:"foreignKey:MarketplaceID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// AfterFind puts the preloaded media in order
+func (m *Marketplace) AfterFind(*gorm.DB) error {
+	m.Media = linkedMedia(m.MediaLinks, m.Media)
+	return nil
 }
 
 // CreateListingRequest represents the request body for creating a listing
@@ -29,7 +41,7 @@ type CreateListingRequest struct {
 	Title       string  `json:"title" binding:"required"`
 	Description string  `json:"description" binding:"required"`
 	Price       float64 `json:"price" binding:"required"`
-	ImageURLs   string  `json:"image_urls"`
+	MediaIDs    []uint  `json:"media_ids"` // IDs returned by POST /uploads
 	Category    string  `json:"category" binding:"required"`
 	Condition   string  `json:"condition" binding:"required"`
 	Location    string  `json:"location"`
@@ -40,7 +52,7 @@ type UpdateListingRequest struct {
 	Title       string   `json:"title"`
 	Description string   `json:"description"`
 	Price       *float64 `json:"price"`
-	ImageURLs   string   `json:"image_urls"`
+	MediaIDs    *[]uint  `json:"media_ids"` // Replaces the attached media when present
 	Category    string   `json:"category"`
 	Condition   string   `json:"condition"`
 	Status      string   `json:"status"`
@@ -49,19 +61,20 @@ type UpdateListingRequest struct {
 
 // MarketplaceResponse is the public marketplace listing data with seller info
 type MarketplaceResponse struct {
-	ID          uint         `json:"id"`
-	Title       string       `json:"title"`
-	Description string       `json:"description"`
-	Price       float64      `json:"price"`
-	ImageURLs   string       `json:"image_urls"`
-	Category    string       `json:"category"`
-	Condition   string       `json:"condition"`
-	Status      string       `json:"status"`
-	Location    string       `json:"location"`
-	Views       int          `json:"views"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
-	Seller      UserResponse `json:"seller"`
+	ID          uint            `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Price       float64         `json:"price"`
+	ImageURLs   string          `json:"image_urls"`
+	Media       []MediaResponse `json:"media"`
+	Category    string          `json:"category"`
+	Condition   string          `json:"condition"`
+	Status      string          `json:"status"`
+	Location    string          `json:"location"`
+	Views       int             `json:"views"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Seller      UserResponse    `json:"seller"`
 }
 
 // MarketplaceCategory represents a category for marketplace listings
@@ -81,6 +94,7 @@ func (m *Marketplace) ToResponse() MarketplaceResponse {
 		Description: m.Description,
 		Price:       m.Price,
 		ImageURLs:   m.ImageURLs,
+		Media:       MediaResponses(m.Media),
 		Category:    m.Category,
 		Condition:   m.Condition,
 		Status:      m.Status,
@@ -102,3 +116,13 @@ func (m *Marketplace) IncrementViews(db interface {
 }) error {
 	return db.Model(m).UpdateColumn("views", m.Views+1).Error()
 }
+
+// CursorKey returns the keyset pagination position of the listing
+func (m Marketplace) CursorKey() Cursor {
+	return uintCursor(m.CreatedAt, m.ID)
+}
+
+// ScoreKey returns the hot ranking pagination position of the listing
+func (m Marketplace) ScoreKey() Cursor {
+	return scoreCursor(m.HotScore, m.ID)
+}
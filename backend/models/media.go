@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxMediaPerItem caps how many uploads can be attached to a single post, listing or lost & found item
+const MaxMediaPerItem = 9
+
+// Errors returned by the upload service
+var (
+	ErrFileTooLarge         = errors.New("file is too large")
+	ErrUnsupportedMediaType = errors.New("unsupported file type")
+	ErrImageTooLarge        = errors.New("image dimensions are too large")
+	ErrMediaNotFound        = errors.New("media not found")
+	ErrTooManyMedia         = errors.New("too many media attached")
+)
+
+// AllowedUploadTypes lists the MIME types accepted by POST /uploads, as detected from the file content.
+// Images are re-encoded, which strips EXIF and other metadata, and get a thumbnail.
+var AllowedUploadTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+// Media is a file uploaded through POST /uploads and stored in the configured BlobStore.
+// Posts, marketplace listings, lost & found items and avatars reference media by ID.
+type Media struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	OwnerID      uint      `gorm:"not null;index" json:"owner_id"`
+	Key          string    `gorm:"size:255;not null" json:"-"` // Storage key in the BlobStore
+	ThumbnailKey string    `gorm:"size:255" json:"-"`
+	URL          string    `gorm:"size:500;not null" json:"url"`
+	ThumbnailURL string    `gorm:"size:500" json:"thumbnail_url"`
+	ContentType  string    `gorm:"size:100;not null" json:"content_type"`
+	Size         int64     `gorm:"not null" json:"size"`
+	Width        int       `gorm:"default:0" json:"width"`
+	Height       int       `gorm:"default:0" json:"height"`
+	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
+
+	// Relationships
+	Owner User `gorm:"foreignKey:OwnerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TableName returns the database table name for the Media model.
+func (Media) TableName() string {
+	return "media"
+}
+
+// PostMedia, MarketplaceMedia and LostFoundMedia attach media to a post, listing or lost & found item.
+// Position is the index of the medium in the media_ids it was attached with, so that media are shown
+// in the order the author chose rather than the order they were uploaded in.
+type PostMedia struct {
+	PostID   uint  `gorm:"primaryKey;autoIncrement:false"`
+	MediaID  uint  `gorm:"primaryKey;autoIncrement:false"`
+	Position int   `gorm:"not null;default:0"`
+	Media    Media `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type MarketplaceMedia struct {
+	MarketplaceID uint  `gorm:"primaryKey;autoIncrement:false"`
+	MediaID       uint  `gorm:"primaryKey;autoIncrement:false"`
+	Position      int   `gorm:"not null;default:0"`
+	Media         Media `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type LostFoundMedia struct {
+	LostFoundID uint  `gorm:"primaryKey;autoIncrement:false"`
+	MediaID     uint  `gorm:"primaryKey;autoIncrement:false"`
+	Position    int   `gorm:"not null;default:0"`
+	Media       Media `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+func (PostMedia) TableName() string        { return "post_media" }
+func (MarketplaceMedia) TableName() string { return "marketplace_media" }
+func (LostFoundMedia) TableName() string   { return "lost_found_media" }
+
+func (l PostMedia) medium() Media        { return l.Media }
+func (l MarketplaceMedia) medium() Media { return l.Media }
+func (l LostFoundMedia) medium() Media   { return l.Media }
+
+// linkedMedia returns the media of preloaded links, which are ordered by position.
+// Links that were not preloaded are nil and leave media as they were.
+func linkedMedia[L interface{ medium() Media }](links []L, media []Media) []Media {
+	if links == nil {
+		return media
+	}
+	media = make([]Media, len(links))
+	for i, link := range links {
+		media[i] = link.medium()
+	}
+	return media
+}
+
+// MediaResponse is the public data of an uploaded file
+type MediaResponse struct {
+	ID           uint      `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ToResponse converts an uploaded file to a media response
+func (m *Media) ToResponse() MediaResponse {
+	return MediaResponse{
+		ID:           m.ID,
+		URL:          m.URL,
+		ThumbnailURL: m.ThumbnailURL,
+		ContentType:  m.ContentType,
+		Size:         m.Size,
+		Width:        m.Width,
+		Height:       m.Height,
+		CreatedAt:    m.CreatedAt,
+	}
+}
+
+// MediaResponses converts a list of uploaded files to media responses
+func MediaResponses(media []Media) []MediaResponse {
+	responses := make([]MediaResponse, 0, len(media))
+	for _, m := range media {
+		responses = append(responses, m.ToResponse())
+	}
+	return responses
+}
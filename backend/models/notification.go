@@ -34,8 +34,9 @@ type Notification struct {
 	Type         NotificationType `gorm:"size:20;not null" json:"type"`
 	ResourceType string          `gorm:"size:50" json:"resource_type"` // post, comment, user, event, message, etc.
 	ResourceID   uint            `json:"resource_id"`                 // ID of the related resource
+	ResourceRef  string          `gorm:"size:36" json:"resource_ref"` // String key for resources with UUID ids (e.g. partners)
 	IsRead       bool            `gorm:"default:false" json:"is_read"`
-	CreatedAt    time.Time       `gorm:"not null" json:"created_at"`
+	CreatedAt    time.Time       `gorm:"not null;index" json:"created_at"`
 	UpdatedAt    time.Time       `gorm:"not null" json:"updated_at"`
 
 	// Relationships
@@ -51,11 +52,23 @@ type NotificationResponse struct {
 	Type         NotificationType `json:"type"`
 	ResourceType string           `json:"resource_type"`
 	ResourceID   uint             `json:"resource_id"`
+	ResourceRef  string           `json:"resource_ref,omitempty"`
 	IsRead       bool             `json:"is_read"`
 	CreatedAt    time.Time        `json:"created_at"`
 	Sender       *UserResponse    `json:"sender,omitempty"`
 }
 
+// NotificationPushPayload is the payload of a 'notification' WebSocket message.
+type NotificationPushPayload struct {
+	Notification NotificationResponse `json:"notification"`
+	UnreadCount  int64                `json:"unread_count"`
+}
+
+// UnreadCountPayload is the payload of an 'unread_count' WebSocket message.
+type UnreadCountPayload struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
 // ToResponse converts a notification to a response
 func (n *Notification) ToResponse() NotificationResponse {
 	response := NotificationResponse{
@@ -65,6 +78,7 @@ func (n *Notification) ToResponse() NotificationResponse {
 		Type:         n.Type,
 		ResourceType: n.ResourceType,
 		ResourceID:   n.ResourceID,
+		ResourceRef:  n.ResourceRef,
 		IsRead:       n.IsRead,
 		CreatedAt:    n.CreatedAt,
 	}
@@ -95,4 +109,9 @@ func CreateNotification(db interface {
 	}
 
 	return db.Create(&notification).Error()
-} 
+}
+
+// CursorKey returns the keyset pagination position of the notification
+func (n Notification) CursorKey() Cursor {
+	return uintCursor(n.CreatedAt, n.ID)
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSSODisabled is returned by the single sign-on endpoints while no OIDC issuer is configured
+	ErrSSODisabled = errors.New("single sign-on is not enabled")
+	// ErrInvalidSSOState is returned when the state of a sign-on callback is unknown, expired or already used
+	ErrInvalidSSOState = errors.New("invalid or expired sign-on request")
+	// ErrSSOMissingEmail is returned when the identity provider shares no email address for a new account
+	ErrSSOMissingEmail = errors.New("identity provider did not provide an email address")
+	// ErrSSOUnverifiedAccount is returned when the account with the provider's email has not verified it,
+	// so whoever registered it may not own the address and it cannot be linked automatically
+	ErrSSOUnverifiedAccount = errors.New("the account with this email has not verified it")
+	// ErrSSOBusy is returned when too many sign-ons are waiting for the provider to redirect back
+	ErrSSOBusy = errors.New("too many sign-ons in progress")
+)
+
+// ExternalIdentity links a user to an account at an OpenID Connect provider.
+// Issuer and Subject identify the provider account; they never change, unlike its email or username.
+type ExternalIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Issuer    string    `gorm:"size:255;not null;uniqueIndex:idx_external_identity" json:"issuer"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_external_identity" json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SSOCallbackRequest represents the request body for completing a single sign-on,
+// with the code and state the identity provider redirected back with
+type SSOCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageLimit is used when a list request does not specify a limit
+	DefaultPageLimit = 10
+	// MaxPageLimit caps how many items a single page may contain
+	MaxPageLimit = 100
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a keyset pagination position on (created_at, id), or on (score, id) for ranked lists.
+// ID is kept as a string so that both numeric and UUID keys can be used.
+type Cursor struct {
+	CreatedAt time.Time
+	Score     float64
+	ID        string
+}
+
+// Keyed is implemented by models that can be listed with keyset pagination.
+type Keyed interface {
+	CursorKey() Cursor
+}
+
+// Scored is implemented by models that can be listed by their stored hot score.
+type Scored interface {
+	ScoreKey() Cursor
+}
+
+// PageQuery describes which page of a list the client wants
+type PageQuery struct {
+	Limit     int
+	Cursor    *Cursor
+	WithTotal bool
+}
+
+// PageInfo is the pagination envelope returned alongside every list
+type PageInfo struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// Page is a single page of items plus its pagination info
+type Page[T any] struct {
+	Items []T
+	PageInfo
+}
+
+// NewPageQuery validates the raw query parameters of a list request.
+func NewPageQuery(limit int, cursor string, withTotal bool) (PageQuery, error) {
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	query := PageQuery{Limit: limit, WithTotal: withTotal}
+	if cursor != "" {
+		decoded, err := DecodeCursor(cursor)
+		if err != nil {
+			return PageQuery{}, err
+		}
+		query.Cursor = decoded
+	}
+	return query, nil
+}
+
+// Encode returns the opaque string form of the cursor handed to clients.
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" +
+		strconv.FormatFloat(c.Score, 'g', -1, 64) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	score, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.Unix(0, nanos), Score: score, ID: parts[2]}, nil
+}
+
+// MapPage converts the items of a page while keeping its pagination info.
+func MapPage[T, R any](page Page[T], convert func(T) R) Page[R] {
+	items := make([]R, 0, len(page.Items))
+	for _, item := range page.Items {
+		items = append(items, convert(item))
+	}
+	return Page[R]{Items: items, PageInfo: page.PageInfo}
+}
+
+func uintCursor(createdAt time.Time, id uint) Cursor {
+	return Cursor{CreatedAt: createdAt, ID: strconv.FormatUint(uint64(id), 10)}
+}
+
+func scoreCursor(score float64, id uint) Cursor {
+	return Cursor{Score: score, ID: strconv.FormatUint(uint64(id), 10)}
+}
@@ -9,8 +9,8 @@ import (
 // Partner represents a user looking for others for an activity.
 type Partner struct {
 	ID                  string         `gorm:"type:char(36);primaryKey" json:"id"`
-	Title               string         `gorm:"type:varchar(255);not null" json:"title"`
-	Description         string         `gorm:"type:text" json:"description"`
+	Title               string         `gorm:"type:varchar(255);not null;index:idx_partners_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"title"`
+	Description         string         `gorm:"type:text;index:idx_partners_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"description"`
 	Category            string         `gorm:"type:varchar(100);index" json:"category"`
 	Type                string         `gorm:"type:varchar(100);index" json:"type"`
 	Status              string         `gorm:"type:varchar(50);default:'open'" json:"status"` // e.g., open, closed, completed
@@ -20,7 +20,7 @@ type Partner struct {
 	CurrentParticipants int            `gorm:"default:1" json:"currentParticipants"`
 	AuthorID            string         `gorm:"type:char(36);not null" json:"authorId"`
 	ExpiresAt           *time.Time     `json:"expiresAt,omitempty"`
-	CreatedAt           time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	CreatedAt           time.Time      `gorm:"autoCreateTime;index" json:"createdAt"`
 	UpdatedAt           time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
 	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
 
@@ -116,3 +116,8 @@ func (Partner) TableName() string {
 func (PartnerTag) TableName() string {
 	return "partner_tags"
 }
+
+// CursorKey returns the keyset pagination position of the partner
+func (p Partner) CursorKey() Cursor {
+	return Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+}
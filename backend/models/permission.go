@@ -0,0 +1,107 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Permission names an action that is not open to every user.
+// The part before the first dot is the section the permission belongs to,
+// which is what moderator scopes restrict.
+type Permission string
+
+const (
+	PermPostUpdateAny              Permission = "post.update.any"
+	PermPostDeleteAny              Permission = "post.delete.any"
+	PermPostCommentDeleteAny       Permission = "post.comment.delete.any"
+	PermConfessionReview           Permission = "confession.review"
+	PermConfessionDeleteAny        Permission = "confession.delete.any"
+	PermConfessionCommentDeleteAny Permission = "confession.comment.delete.any"
+	PermMarketplaceUpdateAny       Permission = "marketplace.update.any"
+	PermMarketplaceDeleteAny       Permission = "marketplace.delete.any"
+	PermLostFoundUpdateAny         Permission = "lost_found.update.any"
+	PermLostFoundDeleteAny         Permission = "lost_found.delete.any"
+	PermEventUpdateAny             Permission = "event.update.any"
+	PermEventDeleteAny             Permission = "event.delete.any"
+	PermPartnerUpdateAny           Permission = "partner.update.any"
+	PermPartnerDeleteAny           Permission = "partner.delete.any"
+	PermCourseManage               Permission = "course.manage"
+	PermCourseReviewUpdateAny      Permission = "course.review.update.any"
+	PermCourseReviewDeleteAny      Permission = "course.review.delete.any"
+	PermUserView                   Permission = "user.view"
+	PermUserBan                    Permission = "user.ban"
+	PermUserRole                   Permission = "user.role"
+	PermVerificationReview         Permission = "verification.review"
+	PermStatsView                  Permission = "stats.view"
+)
+
+// AllPermissions lists every permission, in the order they are documented above
+var AllPermissions = []Permission{
+	PermPostUpdateAny, PermPostDeleteAny, PermPostCommentDeleteAny,
+	PermConfessionReview, PermConfessionDeleteAny, PermConfessionCommentDeleteAny,
+	PermMarketplaceUpdateAny, PermMarketplaceDeleteAny,
+	PermLostFoundUpdateAny, PermLostFoundDeleteAny,
+	PermEventUpdateAny, PermEventDeleteAny,
+	PermPartnerUpdateAny, PermPartnerDeleteAny,
+	PermCourseManage, PermCourseReviewUpdateAny, PermCourseReviewDeleteAny,
+	PermUserView, PermUserBan, PermUserRole,
+	PermVerificationReview, PermStatsView,
+}
+
+// Roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// DefaultRolePermissions maps each role to its permissions unless ROLE_PERMISSIONS overrides them.
+// "*" grants every permission.
+var DefaultRolePermissions = map[string][]string{
+	RoleUser: {},
+	RoleModerator: {
+		string(PermPostDeleteAny), string(PermPostCommentDeleteAny),
+		string(PermConfessionReview), string(PermConfessionDeleteAny), string(PermConfessionCommentDeleteAny),
+		string(PermMarketplaceDeleteAny), string(PermLostFoundDeleteAny),
+		string(PermEventDeleteAny), string(PermPartnerDeleteAny), string(PermCourseReviewDeleteAny),
+	},
+	RoleAdmin: {"*"},
+}
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrUnknownSection is returned when scoping a moderator to a section that no permission belongs to
+	ErrUnknownSection = errors.New("unknown section")
+	// ErrLastRoleManager is returned when a role change would leave no active user who can change roles
+	ErrLastRoleManager = errors.New("no other active user can manage roles")
+)
+
+// Section returns the section a permission belongs to, e.g. "confession" for confession.review
+func (p Permission) Section() string {
+	section, _, _ := strings.Cut(string(p), ".")
+	return section
+}
+
+// IsSection reports whether any permission belongs to the given section
+func IsSection(section string) bool {
+	for _, permission := range AllPermissions {
+		if permission.Section() == section {
+			return true
+		}
+	}
+	return false
+}
+
+// ModeratorScope limits a user's role permissions to one section.
+// A user without scopes holds the permissions of their role everywhere.
+type ModeratorScope struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	Section   string    `gorm:"primaryKey;size:30" json:"section"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UpdateUserSectionsRequest represents the request body for setting the sections a moderator is scoped to
+type UpdateUserSectionsRequest struct {
+	Sections []string `json:"sections"`
+}
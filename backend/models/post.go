@@ -10,46 +10,72 @@ import (
 type Post struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
 	UserID        uint      `gorm:"not null;index" json:"user_id"`
-	Title         string    `gorm:"size:255;not null" json:"title"`
-	Content       string    `gorm:"size:5000;not null" json:"content"`
-	ImageURLs     string    `gorm:"size:1000" json:"image_urls"`                // Comma-separated list of image URLs
-	Visibility    string    `gorm:"size:20;default:'public'" json:"visibility"` // public, private, friends
+	Title         string    `gorm:"size:255;not null;index:idx_posts_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"title"`
+	Content       string    `gorm:"size:5000;not null;index:idx_posts_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"content"`
+	ImageURLs     string    `gorm:"size:1000" json:"image_urls"`                      // Deprecated: legacy comma-separated URLs, new uploads are linked through Media
+	Visibility    string    `gorm:"size:20;default:'public';index" json:"visibility"` // public, followers, private
 	LikesCount    int       `gorm:"default:0" json:"likes_count"`
 	CommentsCount int       `gorm:"default:0" json:"comments_count"`
-	CreatedAt     time.Time `gorm:"not null" json:"created_at"`
+	ViewsCount    int       `gorm:"default:0" json:"views_count"`
+	HotScore      float64   `gorm:"default:0;index" json:"hot_score"` // Recomputed periodically, see TrendingService
+	CreatedAt     time.Time `gorm:"not null;index" json:"created_at"`
 	UpdatedAt     time.Time `gorm:"not null" json:"updated_at"`
 
 	// Relationships
 	User     User      `gorm:"foreignKey:UserID" json:"user"`
 	Comments []Comment `gorm:"foreignKey:PostID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"comments,omitempty"`
 	Likes    []Like    `gorm:"foreignKey:PostID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"likes,omitempty"`
+	Media    []Media   `gorm:"-" json:"media,omitempty"` // Filled from MediaLinks when they are preloaded
+	// MediaLinks attach Media in order; the repository writes them, see attachMedia
+	MediaLinks []PostMedia `gorm:"foreignKey:PostID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
 
+// AfterFind puts the preloaded media in order
+func (p *Post) AfterFind(*gorm.DB) error {
+	p.Media = linkedMedia(p.MediaLinks, p.Media)
+	return nil
+}
+
+// Post visibility levels
+const (
+	PostVisibilityPublic    = "public"
+	PostVisibilityFollowers = "followers"
+	PostVisibilityPrivate   = "private"
+	// PostVisibilityFriends is the legacy name of PostVisibilityFollowers and is treated the same way
+	PostVisibilityFriends = "friends"
+)
+
 // PostResponse is the public post data with user info
 type PostResponse struct {
-	ID            uint         `json:"id"`
-	Title         string       `json:"title"`
-	Content       string       `json:"content"`
-	ImageURLs     string       `json:"image_urls"`
-	Visibility    string       `json:"visibility"`
-	LikesCount    int          `json:"likes_count"`
-	CommentsCount int          `json:"comments_count"`
-	CreatedAt     time.Time    `json:"created_at"`
-	UpdatedAt     time.Time    `json:"updated_at"`
-	User          UserResponse `json:"user"`
-	IsLiked       bool         `json:"is_liked,omitempty"`
+	ID            uint            `json:"id"`
+	Title         string          `json:"title"`
+	Content       string          `json:"content"`
+	ImageURLs     string          `json:"image_urls"`
+	Media         []MediaResponse `json:"media"`
+	Visibility    string          `json:"visibility"`
+	LikesCount    int             `json:"likes_count"`
+	CommentsCount int             `json:"comments_count"`
+	ViewsCount    int             `json:"views_count"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	User          UserResponse    `json:"user"`
+	IsLiked       bool            `json:"is_liked,omitempty"`
 }
 
 // CreatePostRequest represents the request body for creating a post
 type CreatePostRequest struct {
-	Title   string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	Title      string `json:"title" binding:"required"`
+	Content    string `json:"content" binding:"required"`
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public followers friends private"`
+	MediaIDs   []uint `json:"media_ids"` // IDs returned by POST /uploads
 }
 
 // UpdatePostRequest represents the request body for updating a post
 type UpdatePostRequest struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Title      string  `json:"title"`
+	Content    string  `json:"content"`
+	Visibility string  `json:"visibility" binding:"omitempty,oneof=public followers friends private"`
+	MediaIDs   *[]uint `json:"media_ids"` // Replaces the attached media when present
 }
 
 // CreateCommentRequest represents the request body for creating a comment
@@ -109,9 +135,11 @@ func (p *Post) ToResponse(currentUserID uint) PostResponse {
 		Title:         p.Title,
 		Content:       p.Content,
 		ImageURLs:     p.ImageURLs,
+		Media:         MediaResponses(p.Media),
 		Visibility:    p.Visibility,
 		LikesCount:    p.LikesCount,
 		CommentsCount: p.CommentsCount,
+		ViewsCount:    p.ViewsCount,
 		CreatedAt:     p.CreatedAt,
 		UpdatedAt:     p.UpdatedAt,
 		User:          p.User.ToResponse(),
@@ -157,3 +185,13 @@ func (l *Like) AfterDelete(tx *gorm.DB) error {
 	return tx.Model(&Post{}).Where("id = ?", l.PostID).
 		UpdateColumn("likes_count", gorm.Expr("likes_count - ?", 1)).Error
 }
+
+// CursorKey returns the keyset pagination position of the post
+func (p Post) CursorKey() Cursor {
+	return uintCursor(p.CreatedAt, p.ID)
+}
+
+// ScoreKey returns the hot ranking pagination position of the post
+func (p Post) ScoreKey() Cursor {
+	return scoreCursor(p.HotScore, p.ID)
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Presence statuses
+const (
+	PresenceOnline  = "online"
+	PresenceOffline = "offline"
+)
+
+// Presence tells whether a user currently has an open WebSocket connection. It is also the payload
+// of 'presence' events, pushed to the user's contacts when they come online or go offline.
+type Presence struct {
+	UserID     uint       `json:"userId"`
+	Status     string     `json:"status"`               // online, offline
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"` // only while offline
+	Hidden     bool       `json:"hidden,omitempty"`     // only shown to the user themselves
+}
+
+// UpdatePresenceRequest represents the request body for hiding or showing the current user's presence
+type UpdatePresenceRequest struct {
+	Hidden *bool `json:"hidden" binding:"required"`
+}
+
+// TypingPayload is the payload for a 'typing' type message sent by a client. Typing frames are
+// relayed to the other participants of the conversation and never stored.
+type TypingPayload struct {
+	ConversationID uint `json:"conversationId"`
+	IsTyping       bool `json:"isTyping"`
+}
+
+// TypingEvent is the payload of the 'typing' event relayed to the other participants
+type TypingEvent struct {
+	ConversationID uint `json:"conversationId"`
+	UserID         uint `json:"userId"`
+	IsTyping       bool `json:"isTyping"`
+}
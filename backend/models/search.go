@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Search result types, listed from the lowest to the highest tie-break rank.
+// Results with the same relevance are ordered by rank, then by ID.
+const (
+	SearchTypeUser       = "user"
+	SearchTypeCourse     = "course"
+	SearchTypeLostFound  = "lost_found"
+	SearchTypeListing    = "listing"
+	SearchTypePartner    = "partner"
+	SearchTypeEvent      = "event"
+	SearchTypeConfession = "confession"
+	SearchTypePost       = "post"
+)
+
+// Errors returned for malformed search requests
+var (
+	ErrSearchKeywordRequired = errors.New("keyword is required")
+	ErrUnknownSearchType     = errors.New("unknown search type")
+)
+
+// SearchTypes lists every searchable type in tie-break order
+var SearchTypes = []string{
+	SearchTypeUser, SearchTypeCourse, SearchTypeLostFound, SearchTypeListing,
+	SearchTypePartner, SearchTypeEvent, SearchTypeConfession, SearchTypePost,
+}
+
+// SearchQuery describes a unified search request
+type SearchQuery struct {
+	Keyword  string
+	Types    []string // Empty means every type
+	ViewerID uint     // 0 for anonymous viewers, used for post visibility and blocks
+	Page     PageQuery
+}
+
+// SearchHit is a single search result.
+// Body holds the indexed text the snippet is cut from and is not sent to clients.
+type SearchHit struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Snippet   string    `json:"snippet"`
+	Score     float64   `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+	Body      string    `json:"-"`
+}
+
+// ScoreKey returns the relevance pagination position of the hit.
+// The result type is folded into the cursor ID so that a search can be resumed across types.
+func (h SearchHit) ScoreKey() Cursor {
+	return Cursor{Score: h.Score, ID: h.Type + ":" + h.ID}
+}
+
+// SearchRank returns the tie-break rank of a search type, or -1 if the type is unknown
+func SearchRank(searchType string) int {
+	for i, t := range SearchTypes {
+		if t == searchType {
+			return i
+		}
+	}
+	return -1
+}
+
+// SplitSearchCursor splits a search cursor ID back into its result type and resource ID
+func SplitSearchCursor(cursor *Cursor) (searchType, id string, err error) {
+	return splitTypedCursor(cursor, SearchRank)
+}
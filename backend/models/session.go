@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for refresh tokens that are malformed, expired or belong to a revoked session
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again;
+	// the session it belongs to is revoked because the token has most likely been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// Session is one signed-in device of a user.
+// Every refresh rotates TokenID, so only the most recently issued refresh token of a session is accepted.
+type Session struct {
+	ID        string     `gorm:"primaryKey;size:36" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenID   string     `gorm:"size:36;not null" json:"-"` // jti of the current refresh token
+	UserAgent string     `gorm:"size:255" json:"user_agent"`
+	IP        string     `gorm:"size:45" json:"ip"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// TokenPair is the access and refresh token handed out when a session is created or refreshed
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenRequest represents the request body for refreshing or revoking a session
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest represents the request body for logging out; without a refresh token
+// the session of the access token used for the request is ended.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Weights of the hot score. An item's score is its weighted engagement divided by
+// (age in hours + HotScoreAgeOffset) ^ HotScoreGravity, so newer items rank higher
+// for the same amount of engagement.
+const (
+	HotScoreLikeWeight    = 1.0
+	HotScoreCommentWeight = 2.0
+	HotScoreViewWeight    = 0.1
+	HotScoreAgeOffset     = 2.0
+	HotScoreGravity       = 1.5
+
+	// HotScoreWindow limits trending to recent items; older items have their score reset to 0
+	HotScoreWindow = 7 * 24 * time.Hour
+)
+
+// HotScore is the hot score as of now of an item created at createdAt with the given engagement
+func HotScore(likes, comments, views int, createdAt, now time.Time) float64 {
+	engagement := float64(likes)*HotScoreLikeWeight + float64(comments)*HotScoreCommentWeight + float64(views)*HotScoreViewWeight
+	// 时钟偏差可能让刚创建的内容看起来来自未来，按零岁计算
+	age := max(now.Sub(createdAt), 0)
+	return engagement / math.Pow(age.Hours()+HotScoreAgeOffset, HotScoreGravity)
+}
+
+// Trending list types
+const (
+	TrendingTypePosts       = "posts"
+	TrendingTypeConfessions = "confessions"
+	TrendingTypeListings    = "listings"
+)
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTwoFactorSetupPending is returned when asking for another secret right after the previous one
+	ErrTwoFactorSetupPending = errors.New("a two-factor secret was just created, use it or try again later")
+	// ErrTwoFactorNotSetUp is returned when enabling two-factor authentication before requesting a secret
+	ErrTwoFactorNotSetUp = errors.New("two-factor authentication has not been set up")
+	// ErrTwoFactorRequired is returned when disabling two-factor authentication that the role requires
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for this account")
+	// ErrInvalidTwoFactorCode is returned for wrong, expired or already used authenticator and recovery codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrIncorrectPassword is returned when confirming a sensitive change with a wrong password
+	ErrIncorrectPassword = errors.New("incorrect password")
+	// ErrInvalidTwoFactorToken is returned when the token of the second login step is malformed or expired
+	ErrInvalidTwoFactorToken = errors.New("invalid or expired two-factor login token")
+)
+
+// TwoFactor holds the TOTP secret of a user. It exists from setup on, but only counts once EnabledAt is set,
+// which happens when the user proves their authenticator app produces matching codes.
+type TwoFactor struct {
+	UserID uint   `gorm:"primaryKey" json:"user_id"`
+	Secret string `gorm:"size:64;not null" json:"-"` // base32, as shown to authenticator apps
+	// LastUsedStep is the time step of the last accepted code, so that a code cannot be replayed
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode is a single-use code to sign in without the authenticator app; only its hash is stored
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TwoFactorChallenge is returned by login instead of tokens when the account needs a second step.
+// With SetupRequired the account must first set up two-factor authentication, which its role requires.
+type TwoFactorChallenge struct {
+	Required      bool   `json:"two_factor_required"`
+	SetupRequired bool   `json:"two_factor_setup_required"`
+	Token         string `json:"two_factor_token"`
+}
+
+// TwoFactorStatusResponse describes the two-factor authentication of the current user
+type TwoFactorStatusResponse struct {
+	Enabled bool `json:"enabled"`
+	// Required is set when the role of the user does not allow turning two-factor authentication off
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetupResponse carries a new TOTP secret; ProvisioningURI is meant to be shown as a QR code
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorCodeRequest represents a request confirmed with an authenticator or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest represents the request body for turning two-factor authentication off
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorTokenRequest represents the request body for setting up two-factor authentication during login
+type TwoFactorTokenRequest struct {
+	Token string `json:"two_factor_token" binding:"required"`
+}
+
+// TwoFactorLoginRequest represents the request body of the second login step
+type TwoFactorLoginRequest struct {
+	Token string `json:"two_factor_token" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
@@ -12,19 +12,30 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	Username     string    `gorm:"size:50;not null;unique" json:"username"`
-	Email        string    `gorm:"size:100;not null;unique" json:"email"`
-	Password     string    `gorm:"size:100;not null" json:"-"`
-	FullName     string    `gorm:"size:100" json:"full_name"`
-	StudentId    string    `gorm:"size:50;unique" json:"student_id,omitempty"`
-	AvatarURL    string    `gorm:"size:255" json:"avatar_url"`
-	Bio          string    `gorm:"size:500" json:"bio"`
-	Role         string    `gorm:"size:20;default:'user'" json:"role"` // user, admin, moderator
-	IsActive     bool      `gorm:"default:true" json:"is_active"`
-	RefreshToken string    `gorm:"size:500" json:"-"` // 增加长度到500
-	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
-	UpdatedAt    time.Time `gorm:"not null" json:"updated_at"`
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Username      string    `gorm:"size:50;not null;unique;index:idx_users_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"username"`
+	Email         string    `gorm:"size:100;not null;unique" json:"email"`
+	Password      string    `gorm:"size:100;not null" json:"-"`
+	FullName      string    `gorm:"size:100;index:idx_users_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"full_name"`
+	StudentId     *string   `gorm:"size:50;unique" json:"student_id,omitempty"`
+	AvatarURL     string    `gorm:"size:255" json:"avatar_url"` // Set from AvatarMediaID
+	AvatarMediaID *uint     `json:"avatar_media_id"`
+	Bio           string    `gorm:"size:500;index:idx_users_fulltext,class:FULLTEXT,option:WITH PARSER ngram" json:"bio"`
+	Role          string    `gorm:"size:20;default:'user'" json:"role"` // user, admin, moderator
+	IsActive      bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt     time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"not null" json:"updated_at"`
+
+	// EmailVerifiedAt is set once the user follows the link of the verification email
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// StudentVerifiedAt is set when a StudentVerification of the user is approved, which also sets StudentId
+	StudentVerifiedAt *time.Time `json:"student_verified_at"`
+	// LastSeenAt is when the user's last WebSocket connection closed
+	LastSeenAt *time.Time `json:"-"`
+	// HidePresence makes the user appear offline, without a last-seen time, to everyone else
+	HidePresence bool `gorm:"not null;default:false" json:"-"`
+	// DeletionScheduledAt is when the account requested to be deleted will be removed; signing in clears it
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletion_scheduled_at,omitempty"`
 
 	// Relationships
 	Posts         []Post         `gorm:"foreignKey:UserID" json:"-"`
@@ -41,27 +52,76 @@ type User struct {
 
 // UserResponse is the public user data without sensitive info
 type UserResponse struct {
-	ID             uint      `json:"id"`
-	Username       string    `json:"username"`
-	Email          string    `json:"email"`
-	FullName       string    `json:"full_name"`
-	AvatarURL      string    `json:"avatar_url"`
-	Bio            string    `json:"bio"`
-	Role           string    `json:"role"`
-	IsActive       bool      `json:"is_active"`
-	CreatedAt      time.Time `json:"created_at"`
-	FollowerCount  int       `json:"followerCount"`
-	FollowingCount int       `json:"followingCount"`
-	IsFollowing    bool      `json:"isFollowing,omitempty"`
+	ID             uint       `json:"id"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email"`
+	FullName       string     `json:"full_name"`
+	AvatarURL      string     `json:"avatar_url"`
+	Bio            string     `json:"bio"`
+	Role           string     `json:"role"`
+	IsActive       bool       `json:"is_active"`
+	EmailVerified  bool       `json:"email_verified"`
+	Verified       bool       `json:"verified"` // student identity confirmed
+	VerifiedAt     *time.Time `json:"verified_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	FollowerCount  int        `json:"followerCount"`
+	FollowingCount int        `json:"followingCount"`
+	PostCount      int        `json:"postCount"`
+	IsFollowing    bool       `json:"isFollowing"`
+}
+
+// PublicUserResponse is the part of a profile shown to everyone in lists of other users, without the
+// email address and account state
+type PublicUserResponse struct {
+	ID             uint   `json:"id"`
+	Username       string `json:"username"`
+	FullName       string `json:"full_name"`
+	AvatarURL      string `json:"avatar_url"`
+	Bio            string `json:"bio"`
+	Verified       bool   `json:"verified"` // student identity confirmed
+	FollowerCount  int    `json:"followerCount"`
+	FollowingCount int    `json:"followingCount"`
+	PostCount      int    `json:"postCount"`
+	IsFollowing    bool   `json:"isFollowing"`
+}
+
+// UserFollow is a row of user_follows, recording when FollowerID started following FollowingID
+type UserFollow struct {
+	FollowerID  uint      `gorm:"primaryKey;index:idx_user_follows_follower_time,priority:1"`
+	FollowingID uint      `gorm:"primaryKey;index:idx_user_follows_following_time,priority:1"`
+	CreatedAt   time.Time `gorm:"index:idx_user_follows_follower_time,priority:2;index:idx_user_follows_following_time,priority:2"`
+}
+
+// FollowedUser is a user listed as a follower or as followed, with when that follow started
+type FollowedUser struct {
+	User
+	FollowedAt time.Time
+}
+
+// TableName keeps FollowedUser reading from the users table
+func (FollowedUser) TableName() string {
+	return "users"
+}
+
+// CursorKey returns the keyset pagination position of the user in a follow list, which is ordered by follow time
+func (u FollowedUser) CursorKey() Cursor {
+	return uintCursor(u.FollowedAt, u.ID)
+}
+
+// UserStats holds the counters shown on a profile and whether the viewer follows the user
+type UserStats struct {
+	FollowerCount  int
+	FollowingCount int
+	PostCount      int // posts the viewer is allowed to see
+	IsFollowing    bool
 }
 
 // RegisterRequest represents the request body for user registration
 type RegisterRequest struct {
-	Username  string `json:"username" binding:"required,min=3,max=50"`
-	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=6"`
-	FullName  string `json:"full_name"`
-	StudentId string `json:"studentId"`
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+	FullName string `json:"full_name"`
 }
 
 // LoginRequest represents the request body for user login
@@ -72,10 +132,10 @@ type LoginRequest struct {
 
 // UpdateUserRequest represents the request body for updating a user
 type UpdateUserRequest struct {
-	FullName  string `json:"full_name"`
-	AvatarURL string `json:"avatar_url"`
-	Bio       string `json:"bio"`
-	Password  string `json:"password"`
+	FullName      string `json:"full_name"`
+	AvatarMediaID *uint  `json:"avatar_media_id"` // ID of an image returned by POST /uploads
+	Bio           string `json:"bio"`
+	Password      string `json:"password"`
 }
 
 // AuthResponse represents the response for authentication endpoints
@@ -143,9 +203,42 @@ func (u *User) ToResponse(currentUserID ...uint) UserResponse {
 		Bio:            u.Bio,
 		Role:           u.Role,
 		IsActive:       u.IsActive,
+		EmailVerified:  u.EmailVerifiedAt != nil,
+		Verified:       u.StudentVerifiedAt != nil,
+		VerifiedAt:     u.StudentVerifiedAt,
 		CreatedAt:      u.CreatedAt,
 		FollowerCount:  len(u.Followers),
 		FollowingCount: len(u.Following),
 		IsFollowing:    isFollowing,
 	}
 }
+
+// WithStats returns the response with the counters and follow state of stats
+func (r UserResponse) WithStats(stats UserStats) UserResponse {
+	r.FollowerCount = stats.FollowerCount
+	r.FollowingCount = stats.FollowingCount
+	r.PostCount = stats.PostCount
+	r.IsFollowing = stats.IsFollowing
+	return r
+}
+
+// Public returns the fields of the response that anyone may see
+func (r UserResponse) Public() PublicUserResponse {
+	return PublicUserResponse{
+		ID:             r.ID,
+		Username:       r.Username,
+		FullName:       r.FullName,
+		AvatarURL:      r.AvatarURL,
+		Bio:            r.Bio,
+		Verified:       r.Verified,
+		FollowerCount:  r.FollowerCount,
+		FollowingCount: r.FollowingCount,
+		PostCount:      r.PostCount,
+		IsFollowing:    r.IsFollowing,
+	}
+}
+
+// CursorKey returns the keyset pagination position of the user
+func (u User) CursorKey() Cursor {
+	return uintCursor(u.CreatedAt, u.ID)
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReauthenticationRequired is returned when an account signed up through single sign-on, which has no
+// password of its own, asks to be deleted neither with a two-factor code nor right after signing in
+var ErrReauthenticationRequired = errors.New("sign in again or enter a two-factor code to confirm")
+
+// What happens to an account once its deletion grace period is over
+const (
+	// AccountDeletionAnonymize removes the personal data but keeps the public content,
+	// such as posts and comments, under a placeholder account
+	AccountDeletionAnonymize = "anonymize"
+	// AccountDeletionHardDelete removes the account together with everything it created
+	AccountDeletionHardDelete = "delete"
+)
+
+// DeleteAccountRequest represents the request body for deleting the current account. Accounts signed up
+// through single sign-on never saw their password and confirm with a two-factor code instead, or with
+// nothing at all right after signing in.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// AccountDeletionResponse tells when a scheduled account deletion takes place
+type AccountDeletionResponse struct {
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// UserDataExport holds everything stored about a user, as returned by GET /users/me/export.
+// Other users only appear by ID, except as senders of notifications.
+type UserDataExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Profile    User      `json:"profile"`
+
+	Posts              []Post              `json:"posts"`
+	Comments           []Comment           `json:"comments"`
+	Likes              []ExportedLike      `json:"likes"`
+	Confessions        []Confession        `json:"confessions"`
+	ConfessionComments []ConfessionComment `json:"confession_comments"`
+	Events             []Event             `json:"events"`
+	EventAttendances   []EventAttendee     `json:"event_attendances"`
+	Listings           []Marketplace       `json:"listings"`
+	LostFound          []LostFound         `json:"lost_found"`
+	CourseReviews      []CourseReview      `json:"course_reviews"`
+	Partners           []Partner           `json:"partners"`
+	JoinedPartnerIDs   []string            `json:"joined_partner_ids"`
+	Media              []Media             `json:"media"`
+
+	Conversations []ExportedConversation `json:"conversations"`
+	Notifications []NotificationResponse `json:"notifications"`
+
+	FollowingIDs []uint      `json:"following_ids"`
+	FollowerIDs  []uint      `json:"follower_ids"`
+	Blocks       []UserBlock `json:"blocks"`
+	Mutes        []UserMute  `json:"mutes"`
+
+	Sessions           []Session             `json:"sessions"`
+	Verifications      []StudentVerification `json:"verifications"`
+	ExternalIdentities []ExternalIdentity    `json:"external_identities"`
+}
+
+// ExportedLike is a like the user gave to a post or a confession
+type ExportedLike struct {
+	ResourceType string    `json:"resource_type"` // post, confession
+	ResourceID   uint      `json:"resource_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ExportedConversation is a conversation the user takes part in, with all of its messages
+type ExportedConversation struct {
+	ID             uint      `json:"id"`
+	Type           string    `json:"type"`
+	Name           string    `json:"name,omitempty"`
+	ParticipantIDs []uint    `json:"participant_ids"`
+	Messages       []Message `json:"messages"`
+	CreatedAt      time.Time `json:"created_at"`
+}
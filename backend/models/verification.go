@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Student verification methods
+const (
+	// VerificationMethodEvidence means the user uploaded a photo of their student card for an admin to check
+	VerificationMethodEvidence = "evidence"
+	// VerificationMethodCampusEmail means the user proves enrolment by confirming a campus mailbox
+	VerificationMethodCampusEmail = "campus_email"
+)
+
+// Student verification statuses
+const (
+	VerificationPending  = "pending"
+	VerificationApproved = "approved"
+	VerificationRejected = "rejected"
+)
+
+var (
+	// ErrAlreadyVerified is returned when a verified user submits another verification request
+	ErrAlreadyVerified = errors.New("user is already verified")
+	// ErrVerificationPending is returned when a user submits while an earlier request is still pending
+	ErrVerificationPending = errors.New("a verification request is already pending")
+	// ErrEvidenceRequired is returned when an evidence request does not reference an uploaded image
+	ErrEvidenceRequired = errors.New("evidence_media_id is required")
+	// ErrNotCampusEmail is returned when a campus email is not on one of the configured campus domains
+	ErrNotCampusEmail = errors.New("email is not a campus email address")
+	// ErrVerificationNotPending is returned when reviewing a request that has already been decided
+	ErrVerificationNotPending = errors.New("verification request is not pending")
+)
+
+// StudentVerification is a request by a user to have their student ID confirmed
+type StudentVerification struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"not null;index" json:"user_id"`
+	StudentID       string     `gorm:"size:50;not null" json:"student_id"`
+	Method          string     `gorm:"size:20;not null" json:"method"`
+	EvidenceMediaID *uint      `json:"evidence_media_id,omitempty"`
+	CampusEmail     string     `gorm:"size:100" json:"campus_email,omitempty"`
+	Status          string     `gorm:"size:20;not null;default:'pending';index" json:"status"`
+	ReviewerID      *uint      `json:"reviewer_id,omitempty"`
+	ReviewNote      string     `gorm:"size:500" json:"review_note,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"not null" json:"updated_at"`
+
+	// Relationships
+	User     User   `gorm:"foreignKey:UserID" json:"-"`
+	Evidence *Media `gorm:"foreignKey:EvidenceMediaID" json:"-"`
+}
+
+// StudentVerificationResponse is the verification request data returned by the API
+type StudentVerificationResponse struct {
+	ID          uint           `json:"id"`
+	StudentID   string         `json:"student_id"`
+	Method      string         `json:"method"`
+	Evidence    *MediaResponse `json:"evidence,omitempty"`
+	CampusEmail string         `json:"campus_email,omitempty"`
+	Status      string         `json:"status"`
+	ReviewNote  string         `json:"review_note,omitempty"`
+	ReviewedAt  *time.Time     `json:"reviewed_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	User        *UserResponse  `json:"user,omitempty"`
+}
+
+// SubmitVerificationRequest represents the request body for requesting student verification.
+// Exactly one of EvidenceMediaID and CampusEmail is used, depending on Method.
+type SubmitVerificationRequest struct {
+	StudentID       string `json:"student_id" binding:"required,max=50"`
+	Method          string `json:"method" binding:"required,oneof=evidence campus_email"`
+	EvidenceMediaID *uint  `json:"evidence_media_id"` // ID of an image returned by POST /uploads
+	CampusEmail     string `json:"campus_email" binding:"omitempty,email"`
+}
+
+// ReviewVerificationRequest represents the request body for an admin decision on a verification request
+type ReviewVerificationRequest struct {
+	Status string `json:"status" binding:"required,oneof=approved rejected"`
+	Note   string `json:"note" binding:"max=500"`
+}
+
+// ConfirmCampusEmailRequest represents the request body for confirming a campus mailbox
+type ConfirmCampusEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CursorKey returns the keyset pagination position of the verification request
+func (v StudentVerification) CursorKey() Cursor {
+	return uintCursor(v.CreatedAt, v.ID)
+}
+
+// ToResponse converts a verification request to its API form; the user is included for admin views
+func (v *StudentVerification) ToResponse(withUser bool) StudentVerificationResponse {
+	response := StudentVerificationResponse{
+		ID:          v.ID,
+		StudentID:   v.StudentID,
+		Method:      v.Method,
+		CampusEmail: v.CampusEmail,
+		Status:      v.Status,
+		ReviewNote:  v.ReviewNote,
+		ReviewedAt:  v.ReviewedAt,
+		CreatedAt:   v.CreatedAt,
+	}
+	if v.Evidence != nil {
+		evidence := v.Evidence.ToResponse()
+		response.Evidence = &evidence
+	}
+	if withUser && v.User.ID != 0 {
+		user := v.User.ToResponse()
+		response.User = &user
+	}
+	return response
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore stores uploaded files under opaque keys and tells where clients can fetch them
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+var errInvalidBlobKey = errors.New("invalid blob key")
+
+type localBlobStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalBlobStore creates a BlobStore that writes files below dir.
+// The files are expected to be served as static files under baseURL.
+func NewLocalBlobStore(dir, baseURL string) BlobStore {
+	return &localBlobStore{dir: dir, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (s *localBlobStore) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", errInvalidBlobKey
+	}
+	return filepath.Join(s.dir, cleaned), nil
+}
+
+// Put writes to a temporary file first so that a half-written file is never served
+func (s *localBlobStore) Put(_ context.Context, key string, data []byte, _ string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *localBlobStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *localBlobStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlockRepository defines the data operations for blocking and muting users
+type BlockRepository interface {
+	// Block records the block and removes the follows between the two users in both directions
+	Block(blockerID, blockedID uint) error
+	Unblock(blockerID, blockedID uint) error
+	// IsBlocked reports whether either user has blocked the other
+	IsBlocked(userID, otherID uint) (bool, error)
+	Mute(muterID, mutedID uint) error
+	Unmute(muterID, mutedID uint) error
+	IsMuted(muterID, mutedID uint) (bool, error)
+}
+
+type blockRepository struct {
+	db *gorm.DB
+}
+
+// NewBlockRepository creates a new instance of BlockRepository
+func NewBlockRepository(db *gorm.DB) BlockRepository {
+	return &blockRepository{db: db}
+}
+
+// blockedSubquery selects the users viewerID has blocked or been blocked by
+const blockedSubquery = "SELECT blocked_id FROM user_blocks WHERE blocker_id = ? UNION SELECT blocker_id FROM user_blocks WHERE blocked_id = ?"
+
+// blockedTextSubquery is blockedSubquery for user columns that hold IDs as strings, like partners.author_id
+const blockedTextSubquery = "SELECT CAST(blocked_id AS CHAR) FROM user_blocks WHERE blocker_id = ? UNION SELECT CAST(blocker_id AS CHAR) FROM user_blocks WHERE blocked_id = ?"
+
+// mutedSubquery selects the users viewerID has muted
+const mutedSubquery = "SELECT muted_id FROM user_mutes WHERE muter_id = ?"
+
+// notBlocked hides rows whose user column refers to someone viewerID has a block with.
+// Anonymous viewers (viewerID 0) have no blocks.
+func notBlocked(column string, viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db
+		}
+		return db.Where(column+" NOT IN ("+blockedSubquery+")", viewerID, viewerID)
+	}
+}
+
+// notBlockedText is notBlocked for user columns that hold IDs as strings
+func notBlockedText(column string, viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db
+		}
+		return db.Where(column+" NOT IN ("+blockedTextSubquery+")", viewerID, viewerID)
+	}
+}
+
+// notMuted hides rows whose user column refers to someone viewerID has muted
+func notMuted(column string, viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" NOT IN ("+mutedSubquery+")", viewerID)
+	}
+}
+
+func (r *blockRepository) Block(blockerID, blockedID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		block := &models.UserBlock{BlockerID: blockerID, BlockedID: blockedID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(block).Error; err != nil {
+			return err
+		}
+		return tx.Exec(
+			"DELETE FROM user_follows WHERE (follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)",
+			blockerID, blockedID, blockedID, blockerID,
+		).Error
+	})
+}
+
+func (r *blockRepository) Unblock(blockerID, blockedID uint) error {
+	return r.db.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.UserBlock{}).Error
+}
+
+func (r *blockRepository) IsBlocked(userID, otherID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userID, otherID, otherID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *blockRepository) Mute(muterID, mutedID uint) error {
+	mute := &models.UserMute{MuterID: muterID, MutedID: mutedID}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(mute).Error
+}
+
+func (r *blockRepository) Unmute(muterID, mutedID uint) error {
+	return r.db.Where("muter_id = ? AND muted_id = ?", muterID, mutedID).Delete(&models.UserMute{}).Error
+}
+
+func (r *blockRepository) IsMuted(muterID, mutedID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.UserMute{}).Where("muter_id = ? AND muted_id = ?", muterID, mutedID).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Content of users the viewer has a block with is left out of every public listing and lookup
+func TestBlockedContentIsHidden(t *testing.T) {
+	page := models.PageQuery{Limit: 20}
+	type blockCase struct {
+		name string
+		// query runs the lookup as viewerID
+		query func(db *gorm.DB, viewerID uint)
+		// filtered is the start of the filter the statement must contain
+		filtered string
+	}
+	tests := []blockCase{
+		// likes and comments look the post up this way first
+		{"post", func(db *gorm.DB, v uint) { NewPostRepository(db).FindVisibleByID(1, v) }, "posts.user_id NOT IN (SELECT blocked_id"},
+		{"events", func(db *gorm.DB, v uint) { NewEventRepository(db).FindAll(v, page) }, "events.creator_id NOT IN (SELECT blocked_id"},
+		{"events of a user", func(db *gorm.DB, v uint) { NewEventRepository(db).FindByCreator(3, v, page) }, "events.creator_id NOT IN (SELECT blocked_id"},
+		{"event", func(db *gorm.DB, v uint) { NewEventRepository(db).FindVisibleByID(1, v) }, "events.creator_id NOT IN (SELECT blocked_id"},
+		{"listings", func(db *gorm.DB, v uint) { NewMarketplaceRepository(db).FindAll(v, page) }, "marketplaces.seller_id NOT IN (SELECT blocked_id"},
+		{"listings of a user", func(db *gorm.DB, v uint) { NewMarketplaceRepository(db).FindBySeller(3, v, page) }, "marketplaces.seller_id NOT IN (SELECT blocked_id"},
+		{"listing", func(db *gorm.DB, v uint) { NewMarketplaceRepository(db).FindVisibleByID(1, v) }, "marketplaces.seller_id NOT IN (SELECT blocked_id"},
+		{"trending listings", func(db *gorm.DB, v uint) { NewTrendingRepository(db).FindTrendingListings(v, page) }, "marketplaces.seller_id NOT IN (SELECT blocked_id"},
+		{"lost and found", func(db *gorm.DB, v uint) { NewLostFoundRepository(db).FindAll(v, page) }, "lost_founds.user_id NOT IN (SELECT blocked_id"},
+		{"lost and found item", func(db *gorm.DB, v uint) { NewLostFoundRepository(db).FindVisibleByID(1, v) }, "lost_founds.user_id NOT IN (SELECT blocked_id"},
+		{"confessions", func(db *gorm.DB, v uint) { NewConfessionRepository(db).FindApproved(v, page) }, "confessions.user_id NOT IN (SELECT blocked_id"},
+		{"confession", func(db *gorm.DB, v uint) { NewConfessionRepository(db).FindVisibleByID(1, v) }, "confessions.user_id NOT IN (SELECT blocked_id"},
+		{"trending confessions", func(db *gorm.DB, v uint) { NewTrendingRepository(db).FindTrendingConfessions(v, page) }, "confessions.user_id NOT IN (SELECT blocked_id"},
+		{"partners", func(db *gorm.DB, v uint) { NewPartnerRepository(db).FindAll(map[string]string{}, v, page) }, "partners.author_id NOT IN (SELECT CAST(blocked_id AS CHAR)"},
+		{"partner", func(db *gorm.DB, v uint) { NewPartnerRepository(db).FindVisibleByID("p1", v) }, "partners.author_id NOT IN (SELECT CAST(blocked_id AS CHAR)"},
+	}
+	for searchType, column := range map[string]string{
+		models.SearchTypePost:       "posts.user_id NOT IN (SELECT blocked_id",
+		models.SearchTypeConfession: "confessions.user_id NOT IN (SELECT blocked_id",
+		models.SearchTypeEvent:      "events.creator_id NOT IN (SELECT blocked_id",
+		models.SearchTypePartner:    "partners.author_id NOT IN (SELECT CAST(blocked_id AS CHAR)",
+		models.SearchTypeListing:    "marketplaces.seller_id NOT IN (SELECT blocked_id",
+		models.SearchTypeLostFound:  "lost_founds.user_id NOT IN (SELECT blocked_id",
+		models.SearchTypeUser:       "users.id NOT IN (SELECT blocked_id",
+	} {
+		searchType := searchType
+		tests = append(tests, blockCase{"search " + searchType, func(db *gorm.DB, v uint) {
+			NewMySQLSearchIndex(db).Search(models.SearchQuery{Keyword: "bike", Types: []string{searchType}, ViewerID: v, Page: page})
+		}, column})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+
+			tt.query(db, 7)
+			sql := recorder.take()
+			// blocks apply whoever made them
+			if !strings.Contains(sql, tt.filtered) || !strings.Contains(sql, "WHERE blocker_id = 7 UNION") || !strings.Contains(sql, "WHERE blocked_id = 7") {
+				t.Errorf("viewer 7 is not filtered on %q:\n%s", tt.filtered, sql)
+			}
+
+			// Anonymous visitors have no blocks
+			tt.query(db, 0)
+			if sql := recorder.take(); strings.Contains(sql, "user_blocks") {
+				t.Errorf("anonymous query is filtered:\n%s", sql)
+			}
+		})
+	}
+}
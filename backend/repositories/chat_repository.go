@@ -4,16 +4,56 @@ import (
 	"nhcommunity/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ChatRepository interface {
+	// GetConversationsByUserID lists the user's conversations by last activity, with their last
+	// message and the user's unread count
 	GetConversationsByUserID(userID uint) ([]models.Conversation, error)
 	GetConversationByID(conversationID uint) (*models.Conversation, error)
 	FindConversationBetweenUsers(userID1, userID2 uint) (*models.Conversation, error)
-	CreateConversation(conversation *models.Conversation) (*models.Conversation, error)
-	GetMessagesByConversationID(conversationID uint, limit, offset int) ([]models.Message, error)
-	CreateMessage(message *models.Message) (*models.Message, error)
+	// IsParticipant reports whether the user is currently a member of the conversation
+	IsParticipant(conversationID, userID uint) (bool, error)
+	// FindParticipant returns the current membership of the user in the conversation
+	FindParticipant(conversationID, userID uint) (*models.ConversationParticipant, error)
+	// CreateConversation creates the conversation together with its members
+	CreateConversation(conversation *models.Conversation, members []models.ConversationParticipant) (*models.Conversation, error)
+	// GetMessagesByConversationID pages back through the messages with a sequence number above afterSeq, newest first
+	GetMessagesByConversationID(conversationID uint, afterSeq uint64, limit, offset int) ([]models.Message, error)
+	// CreateMessage saves the message with the next sequence number of the conversation and makes it the
+	// last message. The sender's read watermark is left to MarkRead. If the sender already stored a
+	// message with the same ClientMessageID in the conversation, that message is returned instead and
+	// created is false.
+	CreateMessage(message *models.Message) (saved *models.Message, created bool, err error)
+	// GetMessagesAfterSeq returns up to limit messages with a sequence number above afterSeq, oldest first
+	GetMessagesAfterSeq(conversationID uint, afterSeq uint64, limit int) ([]models.Message, error)
+	// GetConversationSeqs returns the IDs and last sequence numbers of the user's conversations, with
+	// the sequence number each membership started at
+	GetConversationSeqs(userID uint) ([]models.SyncCursor, error)
+	// MarkRead moves the user's read watermark up to messageID, or to the latest message when messageID
+	// is 0, and returns the watermark before and after. The watermark never moves backwards.
+	MarkRead(conversationID, userID, messageID uint) (previous, current uint, err error)
+	// FindSenderIDs returns who other than userID sent messages with IDs in (afterID, uptoID]
+	FindSenderIDs(conversationID, afterID, uptoID, userID uint) ([]uint, error)
 	UpdateConversation(conversation *models.Conversation) error
+	RenameConversation(conversationID uint, name string) error
+
+	// FindContactIDs returns the users userID has a direct conversation with
+	FindContactIDs(userID uint) ([]uint, error)
+	// FindUserIDs returns which of the given users exist
+	FindUserIDs(userIDs []uint) ([]uint, error)
+	// GetParticipantIDs returns the users currently taking part in the conversation
+	GetParticipantIDs(conversationID uint) ([]uint, error)
+	// AddParticipants adds users with the given role, skipping those who already are members. The new
+	// members start at the current last message.
+	AddParticipants(conversationID uint, userIDs []uint, role string) error
+	// RemoveParticipant removes a member; when the owner leaves, the longest-standing admin,
+	// or else member, becomes the owner
+	RemoveParticipant(conversationID, userID uint) error
+	UpdateParticipantRole(conversationID, userID uint, role string) error
+	// TransferOwnership makes toID the owner and demotes the current owner fromID to admin
+	TransferOwnership(conversationID, fromID, toID uint) error
 }
 
 type chatRepository struct {
@@ -28,20 +68,88 @@ func (r *chatRepository) GetConversationsByUserID(userID uint) ([]models.Convers
 	var conversations []models.Conversation
 	err := r.db.
 		Preload("Participants").
-		Preload("LastMessage.Sender").
+		Preload("Members").
 		Joins("JOIN conversation_participants cp ON cp.conversation_id = conversations.id").
 		Where("cp.user_id = ?", userID).
 		Order("conversations.updated_at desc").
+		Order("conversations.id desc").
 		Find(&conversations).Error
-	return conversations, err
+	if err != nil || len(conversations) == 0 {
+		return conversations, err
+	}
+
+	ids := make([]uint, len(conversations))
+	var lastMessageIDs []uint
+	for i, conversation := range conversations {
+		ids[i] = conversation.ID
+		if conversation.LastMessageID != nil {
+			lastMessageIDs = append(lastMessageIDs, *conversation.LastMessageID)
+		}
+	}
+
+	var lastMessages []models.Message
+	if len(lastMessageIDs) > 0 {
+		if err := r.db.Preload("Sender").Where("id IN ?", lastMessageIDs).Find(&lastMessages).Error; err != nil {
+			return nil, err
+		}
+	}
+	unread, err := r.countUnread(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range conversations {
+		for j := range lastMessages {
+			if conversations[i].LastMessageID != nil && lastMessages[j].ID == *conversations[i].LastMessageID {
+				conversations[i].LastMessage = &lastMessages[j]
+			}
+		}
+		conversations[i].UnreadCount = unread[conversations[i].ID]
+	}
+	return conversations, nil
+}
+
+// countUnread counts, per conversation, the messages from others after the user's read watermark
+func (r *chatRepository) countUnread(userID uint, conversationIDs []uint) (map[uint]int64, error) {
+	var rows []struct {
+		ConversationID uint
+		Count          int64
+	}
+	err := r.db.Table("messages m").
+		Select("m.conversation_id, COUNT(*) AS count").
+		Joins("JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = ?", userID).
+		Where("m.conversation_id IN ? AND m.id > cp.last_read_message_id AND m.sender_id <> ?", conversationIDs, userID).
+		Group("m.conversation_id").
+		Scan(&rows).Error
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Count
+	}
+	return counts, err
 }
 
 func (r *chatRepository) GetConversationByID(conversationID uint) (*models.Conversation, error) {
 	var conversation models.Conversation
-	err := r.db.Preload("Participants").First(&conversation, conversationID).Error
+	err := r.db.Preload("Participants").Preload("Members").First(&conversation, conversationID).Error
 	return &conversation, err
 }
 
+func (r *chatRepository) IsParticipant(conversationID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *chatRepository) FindParticipant(conversationID, userID uint) (*models.ConversationParticipant, error) {
+	var member models.ConversationParticipant
+	err := r.db.Where("conversation_id = ? AND user_id = ?", conversationID, userID).First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
 // FindConversationBetweenUsers finds a direct message conversation between two users
 func (r *chatRepository) FindConversationBetweenUsers(userID1, userID2 uint) (*models.Conversation, error) {
 	var conversation models.Conversation
@@ -51,7 +159,7 @@ func (r *chatRepository) FindConversationBetweenUsers(userID1, userID2 uint) (*m
 		Joins("JOIN conversation_participants cp1 ON cp1.conversation_id = conversations.id AND cp1.user_id = ?", userID1).
 		Joins("JOIN conversation_participants cp2 ON cp2.conversation_id = conversations.id AND cp2.user_id = ?", userID2).
 		Joins("LEFT JOIN conversation_participants cp_other ON cp_other.conversation_id = conversations.id AND cp_other.user_id NOT IN (?, ?)", userID1, userID2).
-		Where("cp_other.user_id IS NULL").
+		Where("cp_other.user_id IS NULL AND conversations.type = ?", models.ConversationDirect).
 		First(&conversation).Error
 
 	if err != nil {
@@ -60,36 +168,254 @@ func (r *chatRepository) FindConversationBetweenUsers(userID1, userID2 uint) (*m
 	return &conversation, nil
 }
 
-func (r *chatRepository) CreateConversation(conversation *models.Conversation) (*models.Conversation, error) {
-	err := r.db.Create(conversation).Error
-	return conversation, err
+func (r *chatRepository) CreateConversation(conversation *models.Conversation, members []models.ConversationParticipant) (*models.Conversation, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 成员单独写入，避免关联保存时回写用户表
+		if err := tx.Omit(clause.Associations).Create(conversation).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].ConversationID = conversation.ID
+		}
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	conversation.Members = members
+	return conversation, nil
 }
 
-func (r *chatRepository) GetMessagesByConversationID(conversationID uint, limit, offset int) ([]models.Message, error) {
+func (r *chatRepository) GetMessagesByConversationID(conversationID uint, afterSeq uint64, limit, offset int) ([]models.Message, error) {
 	var messages []models.Message
 	err := r.db.
-		Where("conversation_id = ?", conversationID).
-		Order("created_at desc").
+		Where("conversation_id = ? AND seq > ?", conversationID, afterSeq).
+		Order("seq desc").
 		Limit(limit).
 		Offset(offset).
 		Find(&messages).Error
 	return messages, err
 }
 
-func (r *chatRepository) CreateMessage(message *models.Message) (*models.Message, error) {
-	err := r.db.Create(message).Error
+func (r *chatRepository) CreateMessage(message *models.Message) (*models.Message, bool, error) {
+	saved, created := message, true
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 锁住会话行，保证同一会话内的序号连续且唯一，重发检查也随之串行
+		var conversation models.Conversation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "last_seq").
+			First(&conversation, message.ConversationID).Error
+		if err != nil {
+			return err
+		}
+
+		if message.ClientMessageID != nil {
+			var existing models.Message
+			err := tx.Where("conversation_id = ? AND sender_id = ? AND client_message_id = ?",
+				message.ConversationID, message.SenderID, *message.ClientMessageID).
+				Limit(1).Find(&existing).Error
+			if err != nil {
+				return err
+			}
+			if existing.ID != 0 {
+				saved, created = &existing, false
+				return nil
+			}
+		}
+
+		message.Seq = conversation.LastSeq + 1
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		// Also update the conversation's last message, sequence number and updated_at time
+		return tx.Model(&models.Conversation{}).Where("id = ?", message.ConversationID).Updates(map[string]interface{}{
+			"last_message_id": message.ID,
+			"last_seq":        message.Seq,
+			"updated_at":      message.CreatedAt,
+		}).Error
+	})
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	return saved, created, nil
+}
+
+func (r *chatRepository) GetMessagesAfterSeq(conversationID uint, afterSeq uint64, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.
+		Where("conversation_id = ? AND seq > ?", conversationID, afterSeq).
+		Order("seq").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+func (r *chatRepository) GetConversationSeqs(userID uint) ([]models.SyncCursor, error) {
+	var cursors []models.SyncCursor
+	err := r.db.Table("conversations").
+		Select("conversations.id AS conversation_id, conversations.last_seq, cp.joined_seq").
+		Joins("JOIN conversation_participants cp ON cp.conversation_id = conversations.id AND cp.user_id = ?", userID).
+		Order("conversations.id").
+		Scan(&cursors).Error
+	return cursors, err
+}
+
+func (r *chatRepository) MarkRead(conversationID, userID, messageID uint) (previous, current uint, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		var member models.ConversationParticipant
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).First(&member).Error
+		if err != nil {
+			return err
+		}
+		previous, current = member.LastReadMessageID, member.LastReadMessageID
+
+		// 只能标记到会话中实际存在的最新消息
+		var latest uint
+		err = tx.Model(&models.Message{}).Where("conversation_id = ?", conversationID).
+			Select("COALESCE(MAX(id), 0)").Scan(&latest).Error
+		if err != nil {
+			return err
+		}
+		target := readWatermark(previous, latest, messageID)
+		if target == previous {
+			return nil
+		}
+
+		err = tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Update("last_read_message_id", target).Error
+		if err != nil {
+			return err
+		}
+		current = target
+		return tx.Model(&models.Message{}).
+			Where("conversation_id = ? AND id > ? AND id <= ? AND sender_id <> ? AND is_read = ?", conversationID, previous, target, userID, false).
+			Update("is_read", true).Error
+	})
+	return previous, current, err
+}
+
+// readWatermark returns where a read watermark at previous moves when the user reads up to messageID,
+// or to the latest message when messageID is 0. It never moves backwards or past the latest message.
+func readWatermark(previous, latest, messageID uint) uint {
+	target := latest
+	if messageID != 0 && messageID < latest {
+		target = messageID
 	}
-	// Also update the conversation's last message and updated_at time
-	err = r.db.Model(&models.Conversation{}).Where("id = ?", message.ConversationID).Updates(map[string]interface{}{
-		"last_message_id": message.ID,
-		"updated_at":      message.CreatedAt,
-	}).Error
+	return max(target, previous)
+}
 
-	return message, err
+func (r *chatRepository) FindSenderIDs(conversationID, afterID, uptoID, userID uint) ([]uint, error) {
+	var senderIDs []uint
+	err := r.db.Model(&models.Message{}).
+		Where("conversation_id = ? AND id > ? AND id <= ? AND sender_id <> ?", conversationID, afterID, uptoID, userID).
+		Distinct().Pluck("sender_id", &senderIDs).Error
+	return senderIDs, err
 }
 
 func (r *chatRepository) UpdateConversation(conversation *models.Conversation) error {
 	return r.db.Save(conversation).Error
 }
+
+func (r *chatRepository) RenameConversation(conversationID uint, name string) error {
+	return r.db.Model(&models.Conversation{}).Where("id = ?", conversationID).Update("name", name).Error
+}
+
+func (r *chatRepository) FindContactIDs(userID uint) ([]uint, error) {
+	var contactIDs []uint
+	err := r.db.Table("conversation_participants other").
+		Joins("JOIN conversation_participants cp ON cp.conversation_id = other.conversation_id AND cp.user_id = ?", userID).
+		Joins("JOIN conversations c ON c.id = other.conversation_id AND c.type = ?", models.ConversationDirect).
+		Where("other.user_id <> ?", userID).
+		Distinct().Pluck("other.user_id", &contactIDs).Error
+	return contactIDs, err
+}
+
+func (r *chatRepository) FindUserIDs(userIDs []uint) ([]uint, error) {
+	var existing []uint
+	if len(userIDs) == 0 {
+		return existing, nil
+	}
+	err := r.db.Model(&models.User{}).Where("id IN ?", userIDs).Pluck("id", &existing).Error
+	return existing, err
+}
+
+func (r *chatRepository) GetParticipantIDs(conversationID uint) ([]uint, error) {
+	var userIDs []uint
+	err := r.db.Model(&models.ConversationParticipant{}).Where("conversation_id = ?", conversationID).
+		Order("user_id").Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+func (r *chatRepository) AddParticipants(conversationID uint, userIDs []uint, role string) error {
+	// 新成员从加入时开始计算未读，之前的历史消息不算未读，也不在同步时补发
+	var conversation models.Conversation
+	if err := r.db.Select("id", "last_message_id", "last_seq").First(&conversation, conversationID).Error; err != nil {
+		return err
+	}
+	var lastRead uint
+	if conversation.LastMessageID != nil {
+		lastRead = *conversation.LastMessageID
+	}
+
+	members := make([]models.ConversationParticipant, len(userIDs))
+	for i, userID := range userIDs {
+		members[i] = models.ConversationParticipant{
+			ConversationID: conversationID, UserID: userID, Role: role, LastReadMessageID: lastRead, JoinedSeq: conversation.LastSeq,
+		}
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+func (r *chatRepository) RemoveParticipant(conversationID, userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Delete(&models.ConversationParticipant{}).Error
+		if err != nil {
+			return err
+		}
+		return ensureOwner(tx, conversationID)
+	})
+}
+
+// ensureOwner promotes the longest-standing admin, or else member, of a group that has no owner left
+func ensureOwner(tx *gorm.DB, conversationID uint) error {
+	var owners int64
+	err := tx.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND role = ?", conversationID, models.ConversationRoleOwner).Count(&owners).Error
+	if err != nil || owners > 0 {
+		return err
+	}
+
+	var successor models.ConversationParticipant
+	err = tx.Where("conversation_id = ?", conversationID).
+		Order("role = '" + models.ConversationRoleAdmin + "' DESC").
+		Order("joined_at").Order("user_id").
+		Limit(1).Find(&successor).Error
+	if err != nil || successor.UserID == 0 {
+		return err
+	}
+	return tx.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, successor.UserID).
+		Update("role", models.ConversationRoleOwner).Error
+}
+
+func (r *chatRepository) UpdateParticipantRole(conversationID, userID uint, role string) error {
+	return r.db.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Update("role", role).Error
+}
+
+func (r *chatRepository) TransferOwnership(conversationID, fromID, toID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, fromID).
+			Update("role", models.ConversationRoleAdmin).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, toID).
+			Update("role", models.ConversationRoleOwner).Error
+	})
+}
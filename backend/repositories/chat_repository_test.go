@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadWatermark(t *testing.T) {
+	tests := []struct {
+		name                        string
+		previous, latest, messageID uint
+		want                        uint
+	}{
+		{"everything", 3, 9, 0, 9},
+		{"up to a message", 3, 9, 6, 6},
+		{"past the latest message", 3, 9, 12, 9},
+		// an older read, e.g. from a device that was behind, leaves the watermark alone
+		{"backwards", 6, 9, 4, 6},
+		{"already read", 9, 9, 0, 9},
+		{"empty conversation", 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readWatermark(tt.previous, tt.latest, tt.messageID); got != tt.want {
+				t.Fatalf("watermark = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// Only messages from others after the reader's own watermark count as unread
+func TestUnreadCounts(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	NewChatRepository(db).(*chatRepository).countUnread(7, []uint{1, 2})
+	sql := recorder.take()
+	for _, want := range []string{
+		"JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = 7",
+		"WHERE m.conversation_id IN (1,2) AND m.id > cp.last_read_message_id AND m.sender_id <> 7",
+		"GROUP BY `m`.`conversation_id`",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("unread count query lacks %q:\n%s", want, sql)
+		}
+	}
+}
+
+// History pages back in the order messages were numbered, which created_at can disagree with
+// when two messages are stored within the same moment
+func TestMessagesAreOrderedBySeq(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	NewChatRepository(db).GetMessagesByConversationID(3, 10, 20, 40)
+	want := "WHERE conversation_id = 3 AND seq > 10 ORDER BY seq desc LIMIT 20 OFFSET 40"
+	if sql := recorder.take(); !strings.Contains(sql, want) {
+		t.Errorf("history query lacks %q:\n%s", want, sql)
+	}
+}
@@ -8,14 +8,19 @@ import (
 
 // ConfessionRepository defines the interface for confession data operations
 type ConfessionRepository interface {
-	FindAll(limit, offset int, preload bool) ([]models.Confession, error)
-	FindApproved(limit, offset int) ([]models.Confession, error)
-	FindByStatus(status string, limit, offset int) ([]models.Confession, error)
+	FindAll(page models.PageQuery, preload bool) (models.Page[models.Confession], error)
+	// FindApproved lists approved confessions, leaving out those of users viewerID has a block with
+	FindApproved(viewerID uint, page models.PageQuery) (models.Page[models.Confession], error)
+	FindByStatus(status string, page models.PageQuery) (models.Page[models.Confession], error)
 	CountByStatus(status string) (int64, error)
 	FindByID(id uint) (*models.Confession, error)
+	// FindVisibleByID finds a confession unless viewerID has a block with its author; comments of
+	// users viewerID has a block with are left out
+	FindVisibleByID(id, viewerID uint) (*models.Confession, error)
 	Create(confession *models.Confession) (*models.Confession, error)
 	Update(confession *models.Confession) (*models.Confession, error)
 	Delete(confession *models.Confession) error
+	IncrementViews(id uint) error
 
 	FindLike(userID, confessionID uint) (*models.ConfessionLike, error)
 	CreateLike(like *models.ConfessionLike) error
@@ -38,26 +43,23 @@ func NewConfessionRepository(db *gorm.DB) ConfessionRepository {
 	return &confessionRepository{db: db}
 }
 
-func (r *confessionRepository) FindAll(limit, offset int, preload bool) ([]models.Confession, error) {
-	var confessions []models.Confession
-	query := r.db.Limit(limit).Offset(offset).Order("created_at desc")
+func (r *confessionRepository) FindAll(page models.PageQuery, preload bool) (models.Page[models.Confession], error) {
+	query := r.db.Model(&models.Confession{})
 	if preload {
 		query = query.Preload("User")
 	}
-	err := query.Find(&confessions).Error
-	return confessions, err
+	return paginate[models.Confession](query, "confessions", page)
 }
 
-func (r *confessionRepository) FindApproved(limit, offset int) ([]models.Confession, error) {
-	var confessions []models.Confession
-	err := r.db.Where("is_approved = ?", true).Preload("User").Limit(limit).Offset(offset).Order("created_at desc").Find(&confessions).Error
-	return confessions, err
+func (r *confessionRepository) FindApproved(viewerID uint, page models.PageQuery) (models.Page[models.Confession], error) {
+	query := r.db.Model(&models.Confession{}).Where("is_approved = ?", true).
+		Scopes(notBlocked("confessions.user_id", viewerID)).Preload("User")
+	return paginate[models.Confession](query, "confessions", page)
 }
 
-func (r *confessionRepository) FindByStatus(status string, limit, offset int) ([]models.Confession, error) {
-	var confessions []models.Confession
-	err := r.db.Where("status = ?", status).Preload("User").Limit(limit).Offset(offset).Order("created_at desc").Find(&confessions).Error
-	return confessions, err
+func (r *confessionRepository) FindByStatus(status string, page models.PageQuery) (models.Page[models.Confession], error) {
+	query := r.db.Model(&models.Confession{}).Where("status = ?", status).Preload("User")
+	return paginate[models.Confession](query, "confessions", page)
 }
 
 func (r *confessionRepository) CountByStatus(status string) (int64, error) {
@@ -75,6 +77,17 @@ func (r *confessionRepository) FindByID(id uint) (*models.Confession, error) {
 	return &confession, nil
 }
 
+func (r *confessionRepository) FindVisibleByID(id, viewerID uint) (*models.Confession, error) {
+	var confession models.Confession
+	err := r.db.Scopes(notBlocked("confessions.user_id", viewerID)).Preload("User").Preload("Likes").
+		Preload("Comments", notBlocked("confession_comments.user_id", viewerID)).Preload("Comments.User").
+		First(&confession, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &confession, nil
+}
+
 func (r *confessionRepository) Create(confession *models.Confession) (*models.Confession, error) {
 	err := r.db.Create(confession).Error
 	return confession, err
@@ -89,6 +102,11 @@ func (r *confessionRepository) Delete(confession *models.Confession) error {
 	return r.db.Delete(confession).Error
 }
 
+func (r *confessionRepository) IncrementViews(id uint) error {
+	return r.db.Model(&models.Confession{}).Where("id = ?", id).
+		UpdateColumn("views_count", gorm.Expr("views_count + ?", 1)).Error
+}
+
 func (r *confessionRepository) FindLike(userID, confessionID uint) (*models.ConfessionLike, error) {
 	var like models.ConfessionLike
 	err := r.db.Where("user_id = ? AND confession_id = ?", userID, confessionID).First(&like).Error
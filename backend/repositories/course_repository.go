@@ -8,7 +8,7 @@ import (
 
 // CourseRepository defines the interface for course data operations
 type CourseRepository interface {
-	FindAll(limit, offset int) ([]models.Course, error)
+	FindAll(page models.PageQuery) (models.Page[models.Course], error)
 	FindByID(id uint) (*models.Course, error)
 	Create(course *models.Course) (*models.Course, error)
 	Update(course *models.Course) (*models.Course, error)
@@ -30,10 +30,8 @@ func NewCourseRepository(db *gorm.DB) CourseRepository {
 	return &courseRepository{db: db}
 }
 
-func (r *courseRepository) FindAll(limit, offset int) ([]models.Course, error) {
-	var courses []models.Course
-	err := r.db.Limit(limit).Offset(offset).Order("rating desc").Find(&courses).Error
-	return courses, err
+func (r *courseRepository) FindAll(page models.PageQuery) (models.Page[models.Course], error) {
+	return paginate[models.Course](r.db.Model(&models.Course{}), "courses", page)
 }
 
 func (r *courseRepository) FindByID(id uint) (*models.Course, error) {
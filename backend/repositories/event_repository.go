@@ -8,8 +8,13 @@ import (
 
 // EventRepository defines the interface for event data operations
 type EventRepository interface {
-	FindAll(limit, offset int) ([]models.Event, error)
+	// FindAll lists events, leaving out those of users viewerID has a block with
+	FindAll(viewerID uint, page models.PageQuery) (models.Page[models.Event], error)
+	FindByCreator(creatorID, viewerID uint, page models.PageQuery) (models.Page[models.Event], error)
 	FindByID(id uint) (*models.Event, error)
+	// FindVisibleByID finds an event unless viewerID has a block with its creator; attendees
+	// viewerID has a block with are left out
+	FindVisibleByID(id, viewerID uint) (*models.Event, error)
 	Create(event *models.Event) (*models.Event, error)
 	Update(event *models.Event) (*models.Event, error)
 	Delete(event *models.Event) error
@@ -28,10 +33,15 @@ func NewEventRepository(db *gorm.DB) EventRepository {
 	return &eventRepository{db: db}
 }
 
-func (r *eventRepository) FindAll(limit, offset int) ([]models.Event, error) {
-	var events []models.Event
-	err := r.db.Preload("Creator").Limit(limit).Offset(offset).Order("start_date desc").Find(&events).Error
-	return events, err
+func (r *eventRepository) FindAll(viewerID uint, page models.PageQuery) (models.Page[models.Event], error) {
+	query := r.db.Model(&models.Event{}).Scopes(notBlocked("events.creator_id", viewerID)).Preload("Creator")
+	return paginate[models.Event](query, "events", page)
+}
+
+func (r *eventRepository) FindByCreator(creatorID, viewerID uint, page models.PageQuery) (models.Page[models.Event], error) {
+	query := r.db.Model(&models.Event{}).Where("events.creator_id = ?", creatorID).
+		Scopes(notBlocked("events.creator_id", viewerID)).Preload("Creator")
+	return paginate[models.Event](query, "events", page)
 }
 
 func (r *eventRepository) FindByID(id uint) (*models.Event, error) {
@@ -43,6 +53,17 @@ func (r *eventRepository) FindByID(id uint) (*models.Event, error) {
 	return &event, nil
 }
 
+func (r *eventRepository) FindVisibleByID(id, viewerID uint) (*models.Event, error) {
+	var event models.Event
+	err := r.db.Scopes(notBlocked("events.creator_id", viewerID)).Preload("Creator").
+		Preload("Attendees", notBlocked("event_attendees.user_id", viewerID)).Preload("Attendees.User").
+		First(&event, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
 func (r *eventRepository) Create(event *models.Event) (*models.Event, error) {
 	err := r.db.Create(event).Error
 	return event, err
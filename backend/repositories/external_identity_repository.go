@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+
+	"gorm.io/gorm"
+)
+
+// ExternalIdentityRepository defines the data operations for accounts linked at identity providers
+type ExternalIdentityRepository interface {
+	Create(identity *models.ExternalIdentity) error
+	FindBySubject(issuer, subject string) (*models.ExternalIdentity, error)
+	FindByUser(userID uint) ([]models.ExternalIdentity, error)
+}
+
+type externalIdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewExternalIdentityRepository creates a new instance of ExternalIdentityRepository
+func NewExternalIdentityRepository(db *gorm.DB) ExternalIdentityRepository {
+	return &externalIdentityRepository{db: db}
+}
+
+func (r *externalIdentityRepository) Create(identity *models.ExternalIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *externalIdentityRepository) FindBySubject(issuer, subject string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	if err := r.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *externalIdentityRepository) FindByUser(userID uint) ([]models.ExternalIdentity, error) {
+	var identities []models.ExternalIdentity
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	return identities, err
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+
+	"gorm.io/gorm"
+)
+
+// FeedRepository defines the data operations behind the following feed.
+// Each method returns up to limit entries authored by users that userID follows
+// and has not muted, newest first and strictly after cursor in feed order.
+type FeedRepository interface {
+	FindPosts(userID uint, cursor *models.Cursor, limit int) ([]models.Post, error)
+	FindEvents(userID uint, cursor *models.Cursor, limit int) ([]models.Event, error)
+	FindPartners(userID uint, cursor *models.Cursor, limit int) ([]models.Partner, error)
+	FindListings(userID uint, cursor *models.Cursor, limit int) ([]models.Marketplace, error)
+}
+
+type feedRepository struct {
+	db *gorm.DB
+}
+
+// NewFeedRepository creates a new instance of FeedRepository
+func NewFeedRepository(db *gorm.DB) FeedRepository {
+	return &feedRepository{db: db}
+}
+
+const followingSubquery = "SELECT following_id FROM user_follows WHERE follower_id = ?"
+
+func (r *feedRepository) FindPosts(userID uint, cursor *models.Cursor, limit int) ([]models.Post, error) {
+	var posts []models.Post
+	query := r.db.Model(&models.Post{}).
+		Scopes(visibleTo(userID)).
+		Where("posts.user_id IN ("+followingSubquery+")", userID).
+		Scopes(notMuted("posts.user_id", userID)).
+		Preload("User").Scopes(preloadMedia)
+	err := feedPage(query, "posts", models.FeedTypePost, cursor, limit).Find(&posts).Error
+	return posts, err
+}
+
+func (r *feedRepository) FindEvents(userID uint, cursor *models.Cursor, limit int) ([]models.Event, error) {
+	var events []models.Event
+	query := r.db.Model(&models.Event{}).
+		Where("events.creator_id IN ("+followingSubquery+") AND events.is_active = ?", userID, true).
+		Scopes(notMuted("events.creator_id", userID)).
+		Preload("Creator")
+	err := feedPage(query, "events", models.FeedTypeEvent, cursor, limit).Find(&events).Error
+	return events, err
+}
+
+func (r *feedRepository) FindPartners(userID uint, cursor *models.Cursor, limit int) ([]models.Partner, error) {
+	var partners []models.Partner
+	// author_id 以字符串形式保存用户ID
+	query := r.db.Model(&models.Partner{}).
+		Where("partners.author_id IN (SELECT CAST(following_id AS CHAR) FROM user_follows WHERE follower_id = ?)", userID).
+		Where("partners.author_id NOT IN (SELECT CAST(muted_id AS CHAR) FROM user_mutes WHERE muter_id = ?)", userID).
+		Preload("Author").Preload("Tags")
+	err := feedPage(query, "partners", models.FeedTypePartner, cursor, limit).Find(&partners).Error
+	return partners, err
+}
+
+func (r *feedRepository) FindListings(userID uint, cursor *models.Cursor, limit int) ([]models.Marketplace, error) {
+	var listings []models.Marketplace
+	query := r.db.Model(&models.Marketplace{}).
+		Where("marketplaces.seller_id IN ("+followingSubquery+") AND marketplaces.status <> ?", userID, "deleted").
+		Scopes(notMuted("marketplaces.seller_id", userID)).
+		Preload("Seller").Scopes(preloadMedia)
+	err := feedPage(query, "marketplaces", models.FeedTypeListing, cursor, limit).Find(&listings).Error
+	return listings, err
+}
+
+// feedPage orders one feed source and skips everything up to and including the cursor.
+// On equal timestamps entries of a lower-ranked type come after the cursor's type,
+// so the condition depends on how this source ranks against the cursor.
+func feedPage(query *gorm.DB, table, feedType string, cursor *models.Cursor, limit int) *gorm.DB {
+	if cursor != nil {
+		cursorType, cursorID, _ := models.SplitFeedCursor(cursor)
+		rank, cursorRank := models.FeedRank(feedType), models.FeedRank(cursorType)
+		switch {
+		case rank < cursorRank:
+			query = query.Where(table+".created_at <= ?", cursor.CreatedAt)
+		case rank == cursorRank:
+			query = query.Where(
+				"("+table+".created_at < ? OR ("+table+".created_at = ? AND "+table+".id < ?))",
+				cursor.CreatedAt, cursor.CreatedAt, cursorID,
+			)
+		default:
+			query = query.Where(table+".created_at < ?", cursor.CreatedAt)
+		}
+	}
+	return query.Order(table + ".created_at DESC").Order(table + ".id DESC").Limit(limit)
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// After a cursor, entries with the cursor's timestamp are kept only if they rank below it
+func TestFeedCursorTies(t *testing.T) {
+	cursor := &models.Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: models.FeedTypeEvent + ":9"}
+	const at = "'2024-05-01 12:00:00'"
+	tests := []struct {
+		name  string
+		query func(r FeedRepository)
+		want  string
+		// unwanted must not appear: entries of a higher rank at the cursor's timestamp were already shown
+		unwanted string
+	}{
+		{"higher rank", func(r FeedRepository) { r.FindPosts(1, cursor, 5) }, "posts.created_at < " + at, "posts.created_at = "},
+		{"same type", func(r FeedRepository) { r.FindEvents(1, cursor, 5) },
+			"(events.created_at < " + at + " OR (events.created_at = " + at + " AND events.id < '9'))", "events.created_at <= "},
+		{"lower rank", func(r FeedRepository) { r.FindPartners(1, cursor, 5) }, "partners.created_at <= " + at, "partners.id <"},
+		{"lowest rank", func(r FeedRepository) { r.FindListings(1, cursor, 5) }, "marketplaces.created_at <= " + at, "marketplaces.id <"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			tt.query(NewFeedRepository(db))
+			sql := recorder.take()
+			if !strings.Contains(sql, tt.want) || strings.Contains(sql, tt.unwanted) {
+				t.Fatalf("query lacks %q or has %q:\n%s", tt.want, tt.unwanted, sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginAttemptStore keeps failed sign-in counters and blocks, keyed by identifier or client IP.
+// Implementations shared between instances (see NewRedisLoginAttemptStore) make the limits global.
+type LoginAttemptStore interface {
+	// BlockedUntil returns until when key is blocked, or the zero time if it is not
+	BlockedUntil(key string) (time.Time, error)
+	// RecordFailure counts a failed attempt and returns the number of failures within window.
+	// The window starts with the first failure and is not extended by later ones.
+	RecordFailure(key string, window time.Duration) (int, error)
+	// Block rejects attempts for key until the given time
+	Block(key string, until time.Time) error
+	// Reset forgets the failures and block of key
+	Reset(key string) error
+}
+
+type loginAttempt struct {
+	failures     int
+	expiresAt    time.Time
+	blockedUntil time.Time
+}
+
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*loginAttempt
+	sweptAt  time.Time
+}
+
+// NewMemoryLoginAttemptStore creates a LoginAttemptStore that lives in process memory
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: make(map[string]*loginAttempt)}
+}
+
+func (s *memoryLoginAttemptStore) BlockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok && time.Now().Before(attempt.blockedUntil) {
+		return attempt.blockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *memoryLoginAttemptStore) RecordFailure(key string, window time.Duration) (int, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &loginAttempt{}
+		s.attempts[key] = attempt
+	}
+	if !now.Before(attempt.expiresAt) {
+		attempt.failures = 0
+		attempt.expiresAt = now.Add(window)
+	}
+	attempt.failures++
+	return attempt.failures, nil
+}
+
+func (s *memoryLoginAttemptStore) Block(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &loginAttempt{}
+		s.attempts[key] = attempt
+	}
+	attempt.blockedUntil = until
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	delete(s.attempts, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// sweep drops expired entries once a minute so that sprayed identifiers do not pile up
+func (s *memoryLoginAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.sweptAt) < time.Minute {
+		return
+	}
+	s.sweptAt = now
+	for key, attempt := range s.attempts {
+		if !now.Before(attempt.expiresAt) && !now.Before(attempt.blockedUntil) {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+type redisLoginAttemptStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// recordFailureScript counts a failure and starts the window on the first one. Running both in one
+// script means a counter can never be left without an expiry, which would block the key for good.
+var recordFailureScript = redis.NewScript(`
+local failures = redis.call("INCR", KEYS[1])
+if failures == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return failures
+`)
+
+// NewRedisLoginAttemptStore creates a LoginAttemptStore on a Redis-compatible server,
+// so that every instance of the API shares the same counters
+func NewRedisLoginAttemptStore(cfg RedisConfig) LoginAttemptStore {
+	return &redisLoginAttemptStore{client: newRedisClient(cfg), prefix: "nhcommunity:login:"}
+}
+
+func (s *redisLoginAttemptStore) BlockedUntil(key string) (time.Time, error) {
+	millis, err := s.client.Get(context.Background(), s.prefix+"blocked:"+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(millis), nil
+}
+
+func (s *redisLoginAttemptStore) RecordFailure(key string, window time.Duration) (int, error) {
+	failures, err := recordFailureScript.Run(context.Background(), s.client,
+		[]string{s.prefix + "failures:" + key}, window.Milliseconds()).Int()
+	if err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (s *redisLoginAttemptStore) Block(key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl < time.Millisecond {
+		return nil
+	}
+	return s.client.Set(context.Background(), s.prefix+"blocked:"+key, until.UnixMilli(), ttl).Err()
+}
+
+func (s *redisLoginAttemptStore) Reset(key string) error {
+	return s.client.Del(context.Background(), s.prefix+"failures:"+key, s.prefix+"blocked:"+key).Err()
+}
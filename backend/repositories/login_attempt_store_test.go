@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLoginAttemptStores(t *testing.T) {
+	// each store comes with a wait that lets time pass for its keys
+	stores := []struct {
+		name string
+		new  func(t *testing.T) (LoginAttemptStore, func(time.Duration))
+	}{
+		{"memory", func(*testing.T) (LoginAttemptStore, func(time.Duration)) {
+			return NewMemoryLoginAttemptStore(), time.Sleep
+		}},
+		{"redis", func(t *testing.T) (LoginAttemptStore, func(time.Duration)) {
+			server := miniredis.RunT(t)
+			// miniredis only expires keys when told that time has passed
+			wait := func(d time.Duration) {
+				time.Sleep(d)
+				server.FastForward(d)
+			}
+			return NewRedisLoginAttemptStore(RedisConfig{Addr: server.Addr()}), wait
+		}},
+	}
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			t.Run("counts failures per key", func(t *testing.T) {
+				store, _ := s.new(t)
+				for want := 1; want <= 3; want++ {
+					if got, err := store.RecordFailure("id:alice", time.Minute); err != nil || got != want {
+						t.Fatalf("RecordFailure = %d, %v; want %d", got, err, want)
+					}
+				}
+				if got, _ := store.RecordFailure("id:bob", time.Minute); got != 1 {
+					t.Fatalf("failures of another key = %d, want 1", got)
+				}
+			})
+
+			t.Run("window restarts the count", func(t *testing.T) {
+				store, wait := s.new(t)
+				store.RecordFailure("id:alice", 20*time.Millisecond)
+				store.RecordFailure("id:alice", 20*time.Millisecond)
+				wait(40 * time.Millisecond)
+				if got, _ := store.RecordFailure("id:alice", 20*time.Millisecond); got != 1 {
+					t.Fatalf("failures after the window = %d, want 1", got)
+				}
+			})
+
+			t.Run("block", func(t *testing.T) {
+				store, _ := s.new(t)
+				if until, err := store.BlockedUntil("id:alice"); err != nil || !until.IsZero() {
+					t.Fatalf("BlockedUntil of a new key = %v, %v", until, err)
+				}
+				until := time.Now().Add(time.Hour)
+				if err := store.Block("id:alice", until); err != nil {
+					t.Fatal(err)
+				}
+				got, err := store.BlockedUntil("id:alice")
+				if err != nil || got.Sub(until).Abs() > time.Millisecond {
+					t.Fatalf("BlockedUntil = %v, %v; want %v", got, err, until)
+				}
+				if got, _ := store.BlockedUntil("ip:10.0.0.1"); !got.IsZero() {
+					t.Fatalf("another key is blocked until %v", got)
+				}
+			})
+
+			t.Run("block ends", func(t *testing.T) {
+				store, wait := s.new(t)
+				store.Block("id:alice", time.Now().Add(20*time.Millisecond))
+				wait(40 * time.Millisecond)
+				if got, _ := store.BlockedUntil("id:alice"); time.Now().Before(got) {
+					t.Fatalf("still blocked until %v", got)
+				}
+			})
+
+			t.Run("reset forgets failures and block", func(t *testing.T) {
+				store, _ := s.new(t)
+				store.RecordFailure("id:alice", time.Minute)
+				store.RecordFailure("id:alice", time.Minute)
+				store.Block("id:alice", time.Now().Add(time.Hour))
+				if err := store.Reset("id:alice"); err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := store.BlockedUntil("id:alice"); !got.IsZero() {
+					t.Fatalf("blocked until %v after reset", got)
+				}
+				if got, _ := store.RecordFailure("id:alice", time.Minute); got != 1 {
+					t.Fatalf("failures after reset = %d, want 1", got)
+				}
+			})
+		})
+	}
+}
+
+func TestRedisLoginAttemptStoreUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	store := NewRedisLoginAttemptStore(RedisConfig{Addr: addr})
+	if _, err := store.RecordFailure("id:alice", time.Minute); err == nil {
+		t.Fatal("RecordFailure without a server did not fail")
+	}
+	if _, err := store.BlockedUntil("id:alice"); err == nil {
+		t.Fatal("BlockedUntil without a server did not fail")
+	}
+}
+
+func TestRedisLoginAttemptStoreExpiresCounters(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisLoginAttemptStore(RedisConfig{Addr: server.Addr()})
+	store.RecordFailure("id:alice", time.Minute)
+	server.FastForward(30 * time.Second)
+	store.RecordFailure("id:alice", time.Minute)
+
+	// the window is set with the first failure and later ones leave it alone
+	if ttl := server.TTL("nhcommunity:login:failures:id:alice"); ttl != 30*time.Second {
+		t.Fatalf("counter expires in %v, want 30s", ttl)
+	}
+}
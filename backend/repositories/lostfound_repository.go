@@ -7,11 +7,15 @@ import (
 
 // LostFoundRepository defines the interface for lost and found data operations
 type LostFoundRepository interface {
-	FindAll(limit, offset int) ([]models.LostFound, error)
+	// FindAll lists items, leaving out those of users viewerID has a block with
+	FindAll(viewerID uint, page models.PageQuery) (models.Page[models.LostFound], error)
 	FindByID(id uint) (*models.LostFound, error)
+	// FindVisibleByID finds an item unless viewerID has a block with the user who posted it
+	FindVisibleByID(id, viewerID uint) (*models.LostFound, error)
 	Create(item *models.LostFound) (*models.LostFound, error)
 	Update(item *models.LostFound) (*models.LostFound, error)
 	Delete(item *models.LostFound) error
+	ReplaceMedia(item *models.LostFound, media []models.Media) error
 }
 
 type lostFoundRepository struct {
@@ -23,15 +27,23 @@ func NewLostFoundRepository(db *gorm.DB) LostFoundRepository {
 	return &lostFoundRepository{db: db}
 }
 
-func (r *lostFoundRepository) FindAll(limit, offset int) ([]models.LostFound, error) {
-	var items []models.LostFound
-	err := r.db.Preload("User").Limit(limit).Offset(offset).Order("created_at desc").Find(&items).Error
-	return items, err
+func (r *lostFoundRepository) FindAll(viewerID uint, page models.PageQuery) (models.Page[models.LostFound], error) {
+	query := r.db.Model(&models.LostFound{}).Scopes(notBlocked("lost_founds.user_id", viewerID)).Preload("User").Scopes(preloadMedia)
+	return paginate[models.LostFound](query, "lost_founds", page)
 }
 
 func (r *lostFoundRepository) FindByID(id uint) (*models.LostFound, error) {
 	var item models.LostFound
-	err := r.db.Preload("User").First(&item, id).Error
+	err := r.db.Preload("User").Scopes(preloadMedia).First(&item, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *lostFoundRepository) FindVisibleByID(id, viewerID uint) (*models.LostFound, error) {
+	var item models.LostFound
+	err := r.db.Scopes(notBlocked("lost_founds.user_id", viewerID)).Preload("User").Scopes(preloadMedia).First(&item, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +51,12 @@ func (r *lostFoundRepository) FindByID(id uint) (*models.LostFound, error) {
 }
 
 func (r *lostFoundRepository) Create(item *models.LostFound) (*models.LostFound, error) {
-	err := r.db.Create(item).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		return attachMedia(tx, "lost_found_media", "lost_found_id", item.ID, item.Media)
+	})
 	return item, err
 }
 
@@ -52,3 +69,8 @@ func (r *lostFoundRepository) Delete(item *models.LostFound) error {
 	return r.db.Delete(item).Error
 }
 
+func (r *lostFoundRepository) ReplaceMedia(item *models.LostFound, media []models.Media) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return attachMedia(tx, "lost_found_media", "lost_found_id", item.ID, media)
+	})
+}
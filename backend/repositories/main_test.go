@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder is a gorm logger that keeps the statements instead of printing them
+type sqlRecorder struct {
+	logger.Interface
+	mu         sync.Mutex
+	statements []string
+}
+
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, sql)
+}
+
+func (r *sqlRecorder) take() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sql := strings.Join(r.statements, "\n")
+	r.statements = nil
+	return sql
+}
+
+// dryRunDB returns a MySQL connection that only builds statements, and the recorder they go to
+func dryRunDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test:test@tcp(127.0.0.1:1)/test?parseTime=true", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, recorder
+}
@@ -7,11 +7,17 @@ import (
 
 // MarketplaceRepository defines the interface for marketplace data operations
 type MarketplaceRepository interface {
-	FindAll(limit, offset int) ([]models.Marketplace, error)
+	// FindAll lists listings, leaving out those of sellers viewerID has a block with
+	FindAll(viewerID uint, page models.PageQuery) (models.Page[models.Marketplace], error)
+	FindBySeller(sellerID, viewerID uint, page models.PageQuery) (models.Page[models.Marketplace], error)
 	FindByID(id uint) (*models.Marketplace, error)
+	// FindVisibleByID finds a listing unless viewerID has a block with its seller
+	FindVisibleByID(id, viewerID uint) (*models.Marketplace, error)
 	Create(listing *models.Marketplace) (*models.Marketplace, error)
 	Update(listing *models.Marketplace) (*models.Marketplace, error)
 	Delete(listing *models.Marketplace) error
+	ReplaceMedia(listing *models.Marketplace, media []models.Media) error
+	IncrementViews(id uint) error
 }
 
 type marketplaceRepository struct {
@@ -23,15 +29,29 @@ func NewMarketplaceRepository(db *gorm.DB) MarketplaceRepository {
 	return &marketplaceRepository{db: db}
 }
 
-func (r *marketplaceRepository) FindAll(limit, offset int) ([]models.Marketplace, error) {
-	var listings []models.Marketplace
-	err := r.db.Preload("Seller").Limit(limit).Offset(offset).Order("created_at desc").Find(&listings).Error
-	return listings, err
+func (r *marketplaceRepository) FindAll(viewerID uint, page models.PageQuery) (models.Page[models.Marketplace], error) {
+	query := r.db.Model(&models.Marketplace{}).Scopes(notBlocked("marketplaces.seller_id", viewerID)).Preload("Seller").Scopes(preloadMedia)
+	return paginate[models.Marketplace](query, "marketplaces", page)
+}
+
+func (r *marketplaceRepository) FindBySeller(sellerID, viewerID uint, page models.PageQuery) (models.Page[models.Marketplace], error) {
+	query := r.db.Model(&models.Marketplace{}).Where("marketplaces.seller_id = ?", sellerID).
+		Scopes(notBlocked("marketplaces.seller_id", viewerID)).Preload("Seller").Scopes(preloadMedia)
+	return paginate[models.Marketplace](query, "marketplaces", page)
 }
 
 func (r *marketplaceRepository) FindByID(id uint) (*models.Marketplace, error) {
 	var listing models.Marketplace
-	err := r.db.Preload("Seller").First(&listing, id).Error
+	err := r.db.Preload("Seller").Scopes(preloadMedia).First(&listing, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &listing, nil
+}
+
+func (r *marketplaceRepository) FindVisibleByID(id, viewerID uint) (*models.Marketplace, error) {
+	var listing models.Marketplace
+	err := r.db.Scopes(notBlocked("marketplaces.seller_id", viewerID)).Preload("Seller").Scopes(preloadMedia).First(&listing, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +59,12 @@ func (r *marketplaceRepository) FindByID(id uint) (*models.Marketplace, error) {
 }
 
 func (r *marketplaceRepository) Create(listing *models.Marketplace) (*models.Marketplace, error) {
-	err := r.db.Create(listing).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(listing).Error; err != nil {
+			return err
+		}
+		return attachMedia(tx, "marketplace_media", "marketplace_id", listing.ID, listing.Media)
+	})
 	return listing, err
 }
 
@@ -52,3 +77,14 @@ func (r *marketplaceRepository) Delete(listing *models.Marketplace) error {
 	return r.db.Delete(listing).Error
 }
 
+
+func (r *marketplaceRepository) IncrementViews(id uint) error {
+	return r.db.Model(&models.Marketplace{}).Where("id = ?", id).
+		UpdateColumn("views", gorm.Expr("views + ?", 1)).Error
+}
+
+func (r *marketplaceRepository) ReplaceMedia(listing *models.Marketplace, media []models.Media) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return attachMedia(tx, "marketplace_media", "marketplace_id", listing.ID, media)
+	})
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+
+	"gorm.io/gorm"
+)
+
+// MediaRepository defines the interface for uploaded media data operations
+type MediaRepository interface {
+	Create(media *models.Media) (*models.Media, error)
+	FindByID(id uint) (*models.Media, error)
+	FindByIDs(ids []uint) ([]models.Media, error)
+}
+
+type mediaRepository struct {
+	db *gorm.DB
+}
+
+// NewMediaRepository creates a new instance of MediaRepository
+func NewMediaRepository(db *gorm.DB) MediaRepository {
+	return &mediaRepository{db: db}
+}
+
+func (r *mediaRepository) Create(media *models.Media) (*models.Media, error) {
+	err := r.db.Create(media).Error
+	return media, err
+}
+
+func (r *mediaRepository) FindByID(id uint) (*models.Media, error) {
+	var media models.Media
+	err := r.db.First(&media, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (r *mediaRepository) FindByIDs(ids []uint) ([]models.Media, error) {
+	var media []models.Media
+	err := r.db.Where("id IN ?", ids).Find(&media).Error
+	return media, err
+}
+
+// preloadMedia preloads the media attached to a post, listing or lost & found item in the order
+// they were attached in; links from before positions were stored all have position 0 and fall back
+// to upload order.
+func preloadMedia(db *gorm.DB) *gorm.DB {
+	return db.Preload("MediaLinks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position").Order("media_id")
+	}).Preload("MediaLinks.Media")
+}
+
+// attachMedia replaces the media linked to an item through joinTable, where ownerColumn holds the
+// item's ID, with media in the given order
+func attachMedia(tx *gorm.DB, joinTable, ownerColumn string, ownerID uint, media []models.Media) error {
+	if err := tx.Exec("DELETE FROM "+joinTable+" WHERE "+ownerColumn+" = ?", ownerID).Error; err != nil {
+		return err
+	}
+	if len(media) == 0 {
+		return nil
+	}
+	links := make([]map[string]interface{}, len(media))
+	for i, m := range media {
+		links[i] = map[string]interface{}{ownerColumn: ownerID, "media_id": m.ID, "position": i}
+	}
+	return tx.Table(joinTable).Create(links).Error
+}
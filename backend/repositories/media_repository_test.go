@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Media are stored with their position in media_ids and come back in that order
+func TestMediaOrder(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	db = db.Session(&gorm.Session{SkipDefaultTransaction: true})
+	if err := attachMedia(db, "post_media", "post_id", 5, []models.Media{{ID: 9}, {ID: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	post := models.Post{ID: 5}
+	db.Scopes(preloadMedia).First(&post)
+
+	sql := recorder.take()
+	for _, want := range []string{
+		"DELETE FROM post_media WHERE post_id = 5",
+		"INSERT INTO `post_media` (`media_id`,`position`,`post_id`) VALUES (9,0,5),(3,1,5)",
+		"SELECT * FROM `post_media` WHERE `post_media`.`post_id` = 5 ORDER BY position,media_id",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("media statements lack %q:\n%s", want, sql)
+		}
+	}
+
+	post.MediaLinks = []models.PostMedia{{MediaID: 9, Media: models.Media{ID: 9}}, {MediaID: 3, Media: models.Media{ID: 3}}}
+	post.AfterFind(db)
+	if len(post.Media) != 2 || post.Media[0].ID != 9 || post.Media[1].ID != 3 {
+		t.Fatalf("media = %+v", post.Media)
+	}
+}
@@ -8,7 +8,11 @@ import (
 
 // NotificationRepository defines the interface for notification data operations
 type NotificationRepository interface {
-	FindByUserID(userID uint, limit, offset int) ([]models.Notification, error)
+	FindByUserID(userID uint, page models.PageQuery) (models.Page[models.Notification], error)
+	FindByID(id uint) (*models.Notification, error)
+	CountUnread(userID uint) (int64, error)
+	// HasUnread reports whether the user has an unread notification of the type about the resource
+	HasUnread(userID uint, notificationType models.NotificationType, resourceType string, resourceID uint) (bool, error)
 	Create(notification *models.Notification) (*models.Notification, error)
 	MarkAsRead(notification *models.Notification) error
 	MarkAllAsRead(userID uint) error
@@ -23,10 +27,32 @@ func NewNotificationRepository(db *gorm.DB) NotificationRepository {
 	return &notificationRepository{db: db}
 }
 
-func (r *notificationRepository) FindByUserID(userID uint, limit, offset int) ([]models.Notification, error) {
-	var notifications []models.Notification
-	err := r.db.Where("user_id = ?", userID).Preload("Sender").Limit(limit).Offset(offset).Order("created_at desc").Find(&notifications).Error
-	return notifications, err
+func (r *notificationRepository) FindByUserID(userID uint, page models.PageQuery) (models.Page[models.Notification], error) {
+	query := r.db.Model(&models.Notification{}).Where("user_id = ?", userID).Preload("Sender")
+	return paginate[models.Notification](query, "notifications", page)
+}
+
+func (r *notificationRepository) FindByID(id uint) (*models.Notification, error) {
+	var notification models.Notification
+	err := r.db.Preload("Sender").First(&notification, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+func (r *notificationRepository) CountUnread(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Notification{}).Where("user_id = ? AND is_read = ?", userID, false).Count(&count).Error
+	return count, err
+}
+
+func (r *notificationRepository) HasUnread(userID uint, notificationType models.NotificationType, resourceType string, resourceID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Notification{}).
+		Where("user_id = ? AND type = ? AND resource_type = ? AND resource_id = ? AND is_read = ?", userID, notificationType, resourceType, resourceID, false).
+		Limit(1).Count(&count).Error
+	return count > 0, err
 }
 
 func (r *notificationRepository) Create(notification *models.Notification) (*models.Notification, error) {
@@ -36,7 +62,7 @@ func (r *notificationRepository) Create(notification *models.Notification) (*mod
 
 func (r *notificationRepository) MarkAsRead(notification *models.Notification) error {
 	notification.IsRead = true
-	return r.db.Save(notification).Error
+	return r.db.Model(notification).Update("is_read", true).Error
 }
 
 func (r *notificationRepository) MarkAllAsRead(userID uint) error {
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"fmt"
+	"nhcommunity/models"
+
+	"gorm.io/gorm"
+)
+
+// paginate runs query as a keyset-paginated list ordered by (created_at, id) descending.
+// The total is only counted when the caller asks for it, since it costs an extra query.
+func paginate[T models.Keyed](query *gorm.DB, table string, page models.PageQuery) (models.Page[T], error) {
+	return paginateOn[T](query, table+".created_at", table+".id", page)
+}
+
+// paginateOn runs query as a keyset-paginated list ordered by (timeColumn, idColumn) descending, for lists
+// whose order comes from another table than the items
+func paginateOn[T models.Keyed](query *gorm.DB, timeColumn, idColumn string, page models.PageQuery) (models.Page[T], error) {
+	var result models.Page[T]
+
+	if page.WithTotal {
+		var total int64
+		if err := query.Session(&gorm.Session{}).Model(new(T)).Count(&total).Error; err != nil {
+			return result, err
+		}
+		result.Total = &total
+	}
+
+	if page.Cursor != nil {
+		query = query.Where(
+			fmt.Sprintf("(%[1]s < ? OR (%[1]s = ? AND %[2]s < ?))", timeColumn, idColumn),
+			page.Cursor.CreatedAt, page.Cursor.CreatedAt, page.Cursor.ID,
+		)
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	var items []T
+	err := query.
+		Order(timeColumn + " DESC").
+		Order(idColumn + " DESC").
+		Limit(page.Limit + 1).
+		Find(&items).Error
+	if err != nil {
+		return result, err
+	}
+
+	if len(items) > page.Limit {
+		items = items[:page.Limit]
+		result.HasMore = true
+		result.NextCursor = items[len(items)-1].CursorKey().Encode()
+	}
+	if items == nil {
+		items = []T{}
+	}
+	result.Items = items
+	return result, nil
+}
+
+// paginateByScore runs query as a keyset-paginated list ordered by (hot_score, id) descending.
+// Scores are recomputed periodically, so an item may move between pages while a client is paging.
+func paginateByScore[T models.Scored](query *gorm.DB, table string, page models.PageQuery) (models.Page[T], error) {
+	var result models.Page[T]
+
+	if page.WithTotal {
+		var total int64
+		if err := query.Session(&gorm.Session{}).Model(new(T)).Count(&total).Error; err != nil {
+			return result, err
+		}
+		result.Total = &total
+	}
+
+	if page.Cursor != nil {
+		query = query.Where(
+			fmt.Sprintf("(%[1]s.hot_score < ? OR (%[1]s.hot_score = ? AND %[1]s.id < ?))", table),
+			page.Cursor.Score, page.Cursor.Score, page.Cursor.ID,
+		)
+	}
+
+	var items []T
+	err := query.
+		Order(table + ".hot_score DESC").
+		Order(table + ".id DESC").
+		Limit(page.Limit + 1).
+		Find(&items).Error
+	if err != nil {
+		return result, err
+	}
+
+	if len(items) > page.Limit {
+		items = items[:page.Limit]
+		result.HasMore = true
+		result.NextCursor = items[len(items)-1].ScoreKey().Encode()
+	}
+	if items == nil {
+		items = []T{}
+	}
+	result.Items = items
+	return result, nil
+}
@@ -8,8 +8,12 @@ import (
 
 type PartnerRepository interface {
 	Create(partner *models.Partner) error
-	FindAll(params map[string]string, page, limit int) ([]models.Partner, int64, error)
+	// FindAll lists partner requests, leaving out those of authors viewerID has a block with
+	FindAll(params map[string]string, viewerID uint, page models.PageQuery) (models.Page[models.Partner], error)
 	FindByID(id string) (*models.Partner, error)
+	// FindVisibleByID finds a partner request unless viewerID has a block with its author;
+	// participants viewerID has a block with are left out
+	FindVisibleByID(id string, viewerID uint) (*models.Partner, error)
 	Update(partner *models.Partner) error
 	Delete(id string) error
 	AddParticipant(partnerID string, userID string) error
@@ -32,10 +36,8 @@ func (r *partnerRepository) Create(partner *models.Partner) error {
 	return r.db.Create(partner).Error
 }
 
-func (r *partnerRepository) FindAll(params map[string]string, page, limit int) ([]models.Partner, int64, error) {
-	var partners []models.Partner
-	var total int64
-	query := r.db.Model(&models.Partner{}).Preload("Author").Preload("Tags")
+func (r *partnerRepository) FindAll(params map[string]string, viewerID uint, page models.PageQuery) (models.Page[models.Partner], error) {
+	query := r.db.Model(&models.Partner{}).Scopes(notBlockedText("partners.author_id", viewerID)).Preload("Author").Preload("Tags")
 
 	if category, ok := params["category"]; ok && category != "" && category != "all" {
 		query = query.Where("category = ?", category)
@@ -43,17 +45,14 @@ func (r *partnerRepository) FindAll(params map[string]string, page, limit int) (
 	if pType, ok := params["type"]; ok && pType != "" && pType != "all" {
 		query = query.Where("type = ?", pType)
 	}
-	if keyword, ok := params["keyword"]; ok && keyword != "" {
-		query = query.Where("title LIKE ? OR description LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	if authorID, ok := params["author_id"]; ok && authorID != "" {
+		query = query.Where("author_id = ?", authorID)
 	}
-
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+	if keyword, ok := params["keyword"]; ok && keyword != "" {
+		query = query.Where("(title LIKE ? OR description LIKE ?)", "%"+keyword+"%", "%"+keyword+"%")
 	}
 
-	offset := (page - 1) * limit
-	err := query.Order("created_at desc").Offset(offset).Limit(limit).Find(&partners).Error
-	return partners, total, err
+	return paginate[models.Partner](query, "partners", page)
 }
 
 func (r *partnerRepository) FindByID(id string) (*models.Partner, error) {
@@ -62,6 +61,14 @@ func (r *partnerRepository) FindByID(id string) (*models.Partner, error) {
 	return &partner, err
 }
 
+func (r *partnerRepository) FindVisibleByID(id string, viewerID uint) (*models.Partner, error) {
+	var partner models.Partner
+	err := r.db.Scopes(notBlockedText("partners.author_id", viewerID)).Preload("Author").
+		Preload("Participants", notBlocked("users.id", viewerID)).Preload("Tags").
+		First(&partner, "id = ?", id).Error
+	return &partner, err
+}
+
 func (r *partnerRepository) Update(partner *models.Partner) error {
 	return r.db.Session(&gorm.Session{FullSaveAssociations: true}).Save(partner).Error
 }
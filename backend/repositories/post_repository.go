@@ -8,12 +8,17 @@ import (
 
 // PostRepository defines the interface for post data operations
 type PostRepository interface {
-	FindAll(limit, offset int) ([]models.Post, error)
+	FindAll(viewerID uint, page models.PageQuery) (models.Page[models.Post], error)
+	// FindByUser lists the posts of userID that viewerID is allowed to see
+	FindByUser(userID, viewerID uint, page models.PageQuery) (models.Page[models.Post], error)
 	FindByID(id uint) (*models.Post, error)
+	FindVisibleByID(id, viewerID uint) (*models.Post, error)
 	Create(post *models.Post) (*models.Post, error)
 	Update(post *models.Post) (*models.Post, error)
 	Delete(post *models.Post) error
-	SearchPosts(keyword string, page, limit int, sort string) ([]models.Post, int64, error)
+	IncrementViews(id uint) error
+	ReplaceMedia(post *models.Post, media []models.Media) error
+	SearchPosts(keyword, sort string, viewerID uint, page models.PageQuery) (models.Page[models.Post], error)
 
 	FindLike(userID, postID uint) (*models.Like, error)
 	CreateLike(like *models.Like) error
@@ -34,15 +39,52 @@ func NewPostRepository(db *gorm.DB) PostRepository {
 	return &postRepository{db: db}
 }
 
-func (r *postRepository) FindAll(limit, offset int) ([]models.Post, error) {
-	var posts []models.Post
-	err := r.db.Preload("User").Limit(limit).Offset(offset).Order("created_at desc").Find(&posts).Error
-	return posts, err
+// visibleTo restricts a post query to the posts viewerID is allowed to see.
+// Anonymous viewers (viewerID 0) only see public posts; followers-only posts
+// are visible to users that follow the author, and authors always see their own posts.
+// Posts of users the viewer has a block with are hidden either way.
+func visibleTo(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db.Where("posts.visibility = ? OR posts.visibility = '' OR posts.visibility IS NULL", models.PostVisibilityPublic)
+		}
+		return notBlocked("posts.user_id", viewerID)(db).Where(
+			"(posts.visibility = ? OR posts.visibility = '' OR posts.visibility IS NULL OR posts.user_id = ? OR "+
+				"(posts.visibility IN ? AND EXISTS (SELECT 1 FROM user_follows uf WHERE uf.follower_id = ? AND uf.following_id = posts.user_id)))",
+			models.PostVisibilityPublic, viewerID,
+			[]string{models.PostVisibilityFollowers, models.PostVisibilityFriends}, viewerID,
+		)
+	}
+}
+
+func (r *postRepository) FindAll(viewerID uint, page models.PageQuery) (models.Page[models.Post], error) {
+	query := r.db.Model(&models.Post{}).Scopes(visibleTo(viewerID)).Preload("User").Scopes(preloadMedia)
+	return paginate[models.Post](query, "posts", page)
+}
+
+func (r *postRepository) FindByUser(userID, viewerID uint, page models.PageQuery) (models.Page[models.Post], error) {
+	query := r.db.Model(&models.Post{}).Where("posts.user_id = ?", userID).
+		Scopes(visibleTo(viewerID)).Preload("User").Scopes(preloadMedia)
+	return paginate[models.Post](query, "posts", page)
 }
 
 func (r *postRepository) FindByID(id uint) (*models.Post, error) {
 	var post models.Post
-	err := r.db.Preload("User").Preload("Comments.User").Preload("Likes").First(&post, id).Error
+	err := r.db.Preload("User").Scopes(preloadMedia).Preload("Comments.User").Preload("Likes").First(&post, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// FindVisibleByID returns the post only if viewerID may see it, otherwise gorm.ErrRecordNotFound
+// so that hidden posts are indistinguishable from missing ones.
+func (r *postRepository) FindVisibleByID(id, viewerID uint) (*models.Post, error) {
+	var post models.Post
+	err := r.db.Scopes(visibleTo(viewerID)).
+		Preload("User").Scopes(preloadMedia).Preload("Likes").
+		Preload("Comments", notBlocked("comments.user_id", viewerID)).Preload("Comments.User").
+		First(&post, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +92,12 @@ func (r *postRepository) FindByID(id uint) (*models.Post, error) {
 }
 
 func (r *postRepository) Create(post *models.Post) (*models.Post, error) {
-	err := r.db.Create(post).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+		return attachMedia(tx, "post_media", "post_id", post.ID, post.Media)
+	})
 	return post, err
 }
 
@@ -63,37 +110,29 @@ func (r *postRepository) Delete(post *models.Post) error {
 	return r.db.Delete(post).Error
 }
 
-func (r *postRepository) SearchPosts(keyword string, page, limit int, sort string) ([]models.Post, int64, error) {
-	var posts []models.Post
-	var total int64
+func (r *postRepository) IncrementViews(id uint) error {
+	return r.db.Model(&models.Post{}).Where("id = ?", id).
+		UpdateColumn("views_count", gorm.Expr("views_count + ?", 1)).Error
+}
 
-	query := r.db.Model(&models.Post{}).Preload("User")
+func (r *postRepository) ReplaceMedia(post *models.Post, media []models.Media) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return attachMedia(tx, "post_media", "post_id", post.ID, media)
+	})
+}
 
-	if keyword != "" {
-		query = query.Where("title LIKE ? OR content LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
-	}
+func (r *postRepository) SearchPosts(keyword, sort string, viewerID uint, page models.PageQuery) (models.Page[models.Post], error) {
+	query := r.db.Model(&models.Post{}).Scopes(visibleTo(viewerID)).Preload("User").Scopes(preloadMedia)
 
-	// 先计算总数
-	err := query.Count(&total).Error
-	if err != nil {
-		return nil, 0, err
+	if keyword != "" {
+		query = query.Where("(title LIKE ? OR content LIKE ?)", "%"+keyword+"%", "%"+keyword+"%")
 	}
 
-	// 添加排序
-	switch sort {
-	case "hot":
-		// 这里的 "hot" 排序逻辑可能需要根据点赞数、评论数或浏览量等来实现
-		// 暂时我们先按创建时间排序
-		query = query.Order("created_at DESC")
-	default: // newest
-		query = query.Order("created_at DESC")
+	// "hot" 按定期重新计算的热度分数排序
+	if sort == "hot" {
+		return paginateByScore[models.Post](query, "posts", page)
 	}
-
-	// 添加分页
-	offset := (page - 1) * limit
-	err = query.Offset(offset).Limit(limit).Find(&posts).Error
-
-	return posts, total, err
+	return paginate[models.Post](query, "posts", page)
 }
 
 func (r *postRepository) FindLike(userID, postID uint) (*models.Like, error) {
@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Followers-only posts are shown to followers of the author and private posts only to the author
+func TestPostVisibility(t *testing.T) {
+	page := models.PageQuery{Limit: 20}
+	queries := map[string]func(db *gorm.DB, viewerID uint){
+		"list":   func(db *gorm.DB, v uint) { NewPostRepository(db).FindAll(v, page) },
+		"post":   func(db *gorm.DB, v uint) { NewPostRepository(db).FindVisibleByID(1, v) },
+		"search": func(db *gorm.DB, v uint) { NewPostRepository(db).SearchPosts("bike", "", v, page) },
+	}
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+
+			query(db, 0)
+			sql := recorder.take()
+			if !strings.Contains(sql, "posts.visibility = 'public'") || strings.Contains(sql, "user_follows") || strings.Contains(sql, "posts.user_id =") {
+				t.Errorf("anonymous visitors see more than public posts:\n%s", sql)
+			}
+
+			query(db, 7)
+			sql = recorder.take()
+			for _, want := range []string{
+				"posts.visibility = 'public'",
+				// the author sees all of their posts, private ones included
+				"posts.user_id = 7",
+				"posts.visibility IN ('followers','friends') AND EXISTS (SELECT 1 FROM user_follows uf WHERE uf.follower_id = 7 AND uf.following_id = posts.user_id)",
+			} {
+				if !strings.Contains(sql, want) {
+					t.Errorf("viewer 7 query lacks %q:\n%s", want, sql)
+				}
+			}
+			if strings.Contains(sql, "'private'") {
+				t.Errorf("private posts are shown to others than the author:\n%s", sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig configures the connection to a Redis-compatible server (Redis, KeyDB, Valkey...)
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// newRedisClient connects to the server in cfg. Timeouts are short because the callers sit on the
+// request path and have a fallback when Redis is unavailable.
+func newRedisClient(cfg RedisConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  3 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+	})
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config configures a BlobStore backed by an S3-compatible object storage (AWS S3, MinIO, OSS, COS...)
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PublicURL is the prefix clients fetch objects from; defaults to Endpoint/Bucket
+	PublicURL string
+}
+
+type s3BlobStore struct {
+	cfg    S3Config
+	client *http.Client
+}
+
+// NewS3BlobStore creates a BlobStore that uploads objects with path-style requests
+// signed with AWS Signature Version 4, which every S3-compatible service accepts.
+func NewS3BlobStore(cfg S3Config) BlobStore {
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = cfg.Endpoint + "/" + cfg.Bucket
+	}
+	cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	return &s3BlobStore{cfg: cfg, client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return s.do(ctx, http.MethodPut, key, data, contentType)
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, http.MethodDelete, key, nil, "")
+}
+
+func (s *s3BlobStore) URL(key string) string {
+	return s.cfg.PublicURL + "/" + escapeS3Key(key)
+}
+
+func (s *s3BlobStore) do(ctx context.Context, method, key string, body []byte, contentType string) error {
+	path := "/" + s.cfg.Bucket + "/" + escapeS3Key(key)
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, path, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && !(method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, message)
+	}
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req
+func (s *s3BlobStore) sign(req *http.Request, path string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	host := req.URL.Host
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		"", // no query string
+		"host:" + host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, s.cfg.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// escapeS3Key URI-encodes every segment of an object key, keeping the slashes
+func escapeS3Key(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
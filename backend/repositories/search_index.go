@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SearchIndex finds content matching a keyword across every searchable type.
+// Hits are ordered by relevance and carry their indexed text in Body so that
+// callers can cut snippets; the index itself does not highlight anything.
+type SearchIndex interface {
+	Search(query models.SearchQuery) (models.Page[models.SearchHit], error)
+}
+
+// searchSource describes how one content type is searched in MySQL.
+// Columns must match a FULLTEXT index created WITH PARSER ngram, so that
+// Chinese text is tokenized into bigrams instead of needing whitespace.
+// Scopes hide what viewerID may not see, including content of users they have a block with.
+type searchSource struct {
+	table   string
+	columns string
+	title   string
+	body    string
+	scope   func(db *gorm.DB, viewerID uint) *gorm.DB
+}
+
+var searchSources = map[string]searchSource{
+	models.SearchTypePost: {
+		table: "posts", columns: "posts.title, posts.content",
+		title: "posts.title", body: "posts.content",
+		scope: func(db *gorm.DB, viewerID uint) *gorm.DB { return db.Scopes(visibleTo(viewerID)) },
+	},
+	models.SearchTypeConfession: {
+		// 未审核的表白绝不能出现在搜索结果中
+		table: "confessions", columns: "confessions.content",
+		title: "''", body: "confessions.content",
+		scope: func(db *gorm.DB, viewerID uint) *gorm.DB {
+			return db.Where("confessions.is_approved = ?", true).Scopes(notBlocked("confessions.user_id", viewerID))
+		},
+	},
+	models.SearchTypeEvent: {
+		table: "events", columns: "events.title, events.description",
+		title: "events.title", body: "events.description",
+		scope: func(db *gorm.DB, viewerID uint) *gorm.DB {
+			return db.Where("events.is_active = ?", true).Scopes(notBlocked("events.creator_id", viewerID))
+		},
+	},
+	models.SearchTypePartner: {
+		table: "partners", columns: "partners.title, partners.description",
+		title: "partners.title", body: "partners.description",
+		scope: func(db *gorm.DB, viewerID uint) *gorm.DB {
+			return db.Where("partners.deleted_at IS NULL").Scopes(notBlockedText("partners.author_id", viewerID))
+		},
+	},
+	models.SearchTypeListing: {
+		table: "marketplaces", columns: "marketplaces.title, marketplaces.description",
+		title: "marketplaces.title", body: "marketplaces.description",
+		scope: func(db *gorm.DB, viewerID uint) *gorm.DB {
+			return db.Where("marketplaces.status <> ?", "deleted").Scopes(notBlocked("marketplaces.seller_id", viewerID))
+		},
+	},
+	models.SearchTypeLostFound: {
+		table: "lost_founds", columns: "lost_founds.title, lost_founds.description",
+		title: "lost_founds.title", body: "lost_founds.description",
+		scope: func(db *gorm.DB, viewerID uint) *gorm.DB {
+			return db.Scopes(notBlocked("lost_founds.user_id", viewerID))
+		},
+	},
+	models.SearchTypeCourse: {
+		table: "courses", columns: "courses.name, courses.description",
+		title: "courses.name", body: "courses.description",
+	},
+	models.SearchTypeUser: {
+		table: "users", columns: "users.username, users.full_name, users.bio",
+		title: "users.username", body: "CONCAT_WS(' ', users.full_name, users.bio)",
+		scope: func(db *gorm.DB, viewerID uint) *gorm.DB {
+			return db.Where("users.is_active = ?", true).Scopes(notBlocked("users.id", viewerID))
+		},
+	},
+}
+
+// searchScoreDigits is how many decimals of relevance are kept. MySQL computes relevance as a
+// float, so it is rounded before it is ranked on or compared against a cursor; otherwise equal
+// scores might not compare equal and a page could skip or repeat a hit.
+const searchScoreDigits = 6
+
+type mysqlSearchIndex struct {
+	db *gorm.DB
+}
+
+// NewMySQLSearchIndex creates a SearchIndex backed by MySQL FULLTEXT ngram indexes
+func NewMySQLSearchIndex(db *gorm.DB) SearchIndex {
+	return &mysqlSearchIndex{db: db}
+}
+
+type searchRow struct {
+	ID        string
+	Title     string
+	Body      string
+	Score     float64
+	CreatedAt time.Time
+}
+
+// Search queries every requested type for one hit more than the page size and merges
+// the results by relevance, which is enough to fill the page and to know whether
+// another page exists. Totals are not supported.
+func (s *mysqlSearchIndex) Search(query models.SearchQuery) (models.Page[models.SearchHit], error) {
+	var result models.Page[models.SearchHit]
+	types := query.Types
+	if len(types) == 0 {
+		types = models.SearchTypes
+	}
+
+	var hits []models.SearchHit
+	for _, searchType := range types {
+		source, ok := searchSources[searchType]
+		if !ok {
+			continue
+		}
+		rows, err := s.searchSource(source, searchType, query)
+		if err != nil {
+			return result, err
+		}
+		for _, row := range rows {
+			hits = append(hits, models.SearchHit{
+				Type:      searchType,
+				ID:        row.ID,
+				Title:     row.Title,
+				Score:     row.Score,
+				CreatedAt: row.CreatedAt,
+				Body:      row.Body,
+			})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		return searchHitBefore(hits[i], hits[j])
+	})
+	if len(hits) > query.Page.Limit {
+		hits = hits[:query.Page.Limit]
+		result.HasMore = true
+		result.NextCursor = hits[len(hits)-1].ScoreKey().Encode()
+	}
+	if hits == nil {
+		hits = []models.SearchHit{}
+	}
+	result.Items = hits
+	return result, nil
+}
+
+func (s *mysqlSearchIndex) searchSource(source searchSource, searchType string, query models.SearchQuery) ([]searchRow, error) {
+	match := "MATCH(" + source.columns + ") AGAINST(? IN NATURAL LANGUAGE MODE)"
+	score := "ROUND(" + match + ", " + strconv.Itoa(searchScoreDigits) + ")"
+	db := s.db.Table(source.table).
+		Select(source.table+".id AS id, "+source.title+" AS title, "+source.body+" AS body, "+
+			source.table+".created_at AS created_at, "+score+" AS score", query.Keyword).
+		Where(match, query.Keyword)
+	if source.scope != nil {
+		db = source.scope(db, query.ViewerID)
+	}
+
+	// Skip everything up to and including the cursor; on equal relevance a lower-ranked
+	// type comes after the cursor's type, like the merge order in searchHitBefore.
+	if cursor := query.Page.Cursor; cursor != nil {
+		cursorType, cursorID, _ := models.SplitSearchCursor(cursor)
+		rank, cursorRank := models.SearchRank(searchType), models.SearchRank(cursorType)
+		switch {
+		case rank < cursorRank:
+			db = db.Where(score+" <= ?", query.Keyword, cursor.Score)
+		case rank == cursorRank:
+			db = db.Where("("+score+" < ? OR ("+score+" = ? AND "+source.table+".id < ?))",
+				query.Keyword, cursor.Score, query.Keyword, cursor.Score, cursorID)
+		default:
+			db = db.Where(score+" < ?", query.Keyword, cursor.Score)
+		}
+	}
+
+	var rows []searchRow
+	err := db.Order("score DESC").Order(source.table + ".id DESC").
+		Limit(query.Page.Limit + 1).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// searchHitBefore reports whether a ranks above b: by relevance, then type rank, then ID descending.
+func searchHitBefore(a, b models.SearchHit) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	if a.Type != b.Type {
+		return models.SearchRank(a.Type) > models.SearchRank(b.Type)
+	}
+	// 数字ID按数值比较，合伙人的UUID按字符串比较
+	aID, aErr := strconv.ParseUint(a.ID, 10, 64)
+	bID, bErr := strconv.ParseUint(b.ID, 10, 64)
+	if aErr == nil && bErr == nil {
+		return aID > bID
+	}
+	return a.ID > b.ID
+}
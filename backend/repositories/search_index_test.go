@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"testing"
+)
+
+// Confessions waiting for review never show up in search, whoever searches and however they page
+func TestSearchSkipsUnapprovedConfessions(t *testing.T) {
+	confessions := []string{models.SearchTypeConfession}
+	tests := []struct {
+		name     string
+		viewerID uint
+		cursor   *models.Cursor
+	}{
+		{"anonymous", 0, nil},
+		{"signed in", 7, nil},
+		{"next page", 7, &models.Cursor{Score: 1.5, ID: models.SearchTypeConfession + ":3"}},
+		{"next page after another type", 7, &models.Cursor{Score: 1.5, ID: models.SearchTypePost + ":3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			// A dry run cannot scan rows, so Search gives up after the first type it queries
+			NewMySQLSearchIndex(db).Search(models.SearchQuery{Keyword: "crush", Types: confessions, ViewerID: tt.viewerID,
+				Page: models.PageQuery{Limit: 10, Cursor: tt.cursor}})
+
+			sql := recorder.take()
+			if !strings.Contains(sql, "FROM `confessions`") || !strings.Contains(sql, "confessions.is_approved = true") {
+				t.Fatalf("unapproved confessions are searched:\n%s", sql)
+			}
+		})
+	}
+}
+
+// Pages continue after the cursor on the rounded relevance, then the ID, so hits with equal scores are neither skipped nor repeated
+func TestSearchCursor(t *testing.T) {
+	const (
+		postScore = "ROUND(MATCH(posts.title, posts.content) AGAINST('exam' IN NATURAL LANGUAGE MODE), 6)"
+		userScore = "ROUND(MATCH(users.username, users.full_name, users.bio) AGAINST('exam' IN NATURAL LANGUAGE MODE), 6)"
+	)
+	tests := []struct {
+		name       string
+		searchType string
+		cursor     string
+		want       string
+	}{
+		{"same type", models.SearchTypePost, models.SearchTypePost + ":3",
+			"(" + postScore + " < 1.5 OR (" + postScore + " = 1.5 AND posts.id < '3'))"},
+		// on equal relevance a type ranked below the cursor's comes after it, and one ranked above before it
+		{"type ranked below", models.SearchTypeUser, models.SearchTypePost + ":3", userScore + " <= 1.5"},
+		{"type ranked above", models.SearchTypePost, models.SearchTypeUser + ":3", postScore + " < 1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			NewMySQLSearchIndex(db).Search(models.SearchQuery{Keyword: "exam", Types: []string{tt.searchType},
+				Page: models.PageQuery{Limit: 10, Cursor: &models.Cursor{Score: 1.5, ID: tt.cursor}}})
+
+			sql := recorder.take()
+			if !strings.Contains(sql, " AS score") || !strings.Contains(sql, tt.want) {
+				t.Fatalf("search query lacks %q:\n%s", tt.want, sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SessionRepository defines the data operations for sign-in sessions
+type SessionRepository interface {
+	Create(session *models.Session) error
+	FindByID(id string) (*models.Session, error)
+	// Rotate replaces the current refresh token of an active session, but only if it is still oldTokenID.
+	// It reports false when another refresh got there first or the session is no longer active.
+	Rotate(id, oldTokenID, newTokenID string, expiresAt time.Time) (bool, error)
+	Revoke(id string) error
+	RevokeAllForUser(userID uint) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository creates a new instance of SessionRepository
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *sessionRepository) FindByID(id string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) Rotate(id, oldTokenID, newTokenID string, expiresAt time.Time) (bool, error) {
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND token_id = ? AND revoked_at IS NULL AND expires_at > ?", id, oldTokenID, time.Now()).
+		Updates(map[string]interface{}{"token_id": newTokenID, "expires_at": expiresAt})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *sessionRepository) Revoke(id string) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeAllForUser(userID uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TrendingRepository defines the data operations behind hot ranking
+type TrendingRepository interface {
+	RecomputeHotScores(now time.Time) error
+	FindTrendingPosts(viewerID uint, page models.PageQuery) (models.Page[models.Post], error)
+	// FindTrendingConfessions and FindTrendingListings leave out items of users viewerID has a block with
+	FindTrendingConfessions(viewerID uint, page models.PageQuery) (models.Page[models.Confession], error)
+	FindTrendingListings(viewerID uint, page models.PageQuery) (models.Page[models.Marketplace], error)
+}
+
+type trendingRepository struct {
+	db *gorm.DB
+}
+
+// NewTrendingRepository creates a new instance of TrendingRepository
+func NewTrendingRepository(db *gorm.DB) TrendingRepository {
+	return &trendingRepository{db: db}
+}
+
+// hotScoreBatchSize is how many items a single statement of RecomputeHotScores rewrites
+const hotScoreBatchSize = 500
+
+// hotScoreRow is the engagement of an item that goes into its hot score
+type hotScoreRow struct {
+	ID            uint
+	LikesCount    int
+	CommentsCount int
+	ViewsCount    int
+	CreatedAt     time.Time
+}
+
+// RecomputeHotScores refreshes the stored hot score of every item created within models.HotScoreWindow
+// and clears the score of items that have fallen out of it.
+func (r *trendingRepository) RecomputeHotScores(now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return recomputeHotScores(tx, now)
+	})
+}
+
+// recomputeHotScores runs the updates of RecomputeHotScores on tx
+func recomputeHotScores(tx *gorm.DB, now time.Time) error {
+	since := now.Add(-models.HotScoreWindow)
+
+	sources := []struct {
+		model   interface{}
+		columns string
+	}{
+		{&models.Post{}, "id, likes_count, comments_count, views_count, created_at"},
+		{&models.Confession{}, "id, likes_count, comments_count, views_count, created_at"},
+		// 二手商品没有点赞和评论，只按浏览量计算
+		{&models.Marketplace{}, "id, views AS views_count, created_at"},
+	}
+	for _, source := range sources {
+		for lastID := uint(0); ; {
+			var rows []hotScoreRow
+			err := tx.Model(source.model).Select(source.columns).
+				Where("created_at >= ? AND id > ?", since, lastID).
+				Order("id").Limit(hotScoreBatchSize).
+				Find(&rows).Error
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				break
+			}
+			if err := updateHotScores(tx, source.model, rows, now); err != nil {
+				return err
+			}
+			lastID = rows[len(rows)-1].ID
+		}
+	}
+
+	for _, model := range []interface{}{&models.Post{}, &models.Confession{}, &models.Marketplace{}} {
+		err := tx.Model(model).Where("created_at < ? AND hot_score <> 0", since).
+			UpdateColumn("hot_score", 0).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateHotScores stores the models.HotScore of rows as of now in a single statement
+func updateHotScores(tx *gorm.DB, model interface{}, rows []hotScoreRow, now time.Time) error {
+	ids := make([]uint, len(rows))
+	args := make([]interface{}, 0, 2*len(rows))
+	scores := "CASE id" + strings.Repeat(" WHEN ? THEN ?", len(rows)) + " END"
+	for i, row := range rows {
+		ids[i] = row.ID
+		args = append(args, row.ID, models.HotScore(row.LikesCount, row.CommentsCount, row.ViewsCount, row.CreatedAt, now))
+	}
+	return tx.Model(model).Where("id IN ?", ids).UpdateColumn("hot_score", gorm.Expr(scores, args...)).Error
+}
+
+func (r *trendingRepository) FindTrendingPosts(viewerID uint, page models.PageQuery) (models.Page[models.Post], error) {
+	query := r.db.Model(&models.Post{}).
+		Scopes(visibleTo(viewerID)).
+		Where("posts.hot_score > 0").
+		Preload("User").Scopes(preloadMedia)
+	return paginateByScore[models.Post](query, "posts", page)
+}
+
+func (r *trendingRepository) FindTrendingConfessions(viewerID uint, page models.PageQuery) (models.Page[models.Confession], error) {
+	query := r.db.Model(&models.Confession{}).
+		Where("confessions.is_approved = ? AND confessions.hot_score > 0", true).
+		Scopes(notBlocked("confessions.user_id", viewerID)).
+		Preload("User")
+	return paginateByScore[models.Confession](query, "confessions", page)
+}
+
+func (r *trendingRepository) FindTrendingListings(viewerID uint, page models.PageQuery) (models.Page[models.Marketplace], error) {
+	query := r.db.Model(&models.Marketplace{}).
+		Where("marketplaces.status = ? AND marketplaces.hot_score > 0", "active").
+		Scopes(notBlocked("marketplaces.seller_id", viewerID)).
+		Preload("Seller").Scopes(preloadMedia)
+	return paginateByScore[models.Marketplace](query, "marketplaces", page)
+}
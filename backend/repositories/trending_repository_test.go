@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestRecomputeHotScores(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	// RecomputeHotScores runs the statements in its own transaction
+	db = db.Session(&gorm.Session{SkipDefaultTransaction: true})
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	if err := recomputeHotScores(db, now); err != nil {
+		t.Fatal(err)
+	}
+	sql := recorder.take()
+
+	const window = " WHERE created_at >= '2024-05-01 12:00:00' AND id > 0 ORDER BY id LIMIT 500"
+	for _, want := range []string{
+		"SELECT id, likes_count, comments_count, views_count, created_at FROM `posts`" + window,
+		"SELECT id, likes_count, comments_count, views_count, created_at FROM `confessions`" + window,
+		"SELECT id, views AS views_count, created_at FROM `marketplaces`" + window,
+		// items older than the window drop out of trending
+		"UPDATE `posts` SET `hot_score`=0 WHERE created_at < '2024-05-01 12:00:00'",
+		"UPDATE `confessions` SET `hot_score`=0 WHERE created_at < '2024-05-01 12:00:00'",
+		"UPDATE `marketplaces` SET `hot_score`=0 WHERE created_at < '2024-05-01 12:00:00'",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("recompute lacks %q:\n%s", want, sql)
+		}
+	}
+
+	rows := []hotScoreRow{
+		{ID: 3, LikesCount: 4, CommentsCount: 1, ViewsCount: 20, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: 5, ViewsCount: 10, CreatedAt: now.Add(-7 * time.Hour)},
+	}
+	if err := updateHotScores(db, &models.Post{}, rows, now); err != nil {
+		t.Fatal(err)
+	}
+	// (4 + 2 + 2) / 4^1.5 and 1 / 9^1.5
+	want := "UPDATE `posts` SET `hot_score`=CASE id WHEN 3 THEN 1 WHEN 5 THEN 0.037037037037037035 END WHERE id IN (3,5)"
+	if sql := recorder.take(); sql != want {
+		t.Errorf("score update is\n%s\nwant\n%s", sql, want)
+	}
+}
+
+// With the configured weights, age wears down engagement so that fresh items overtake old ones
+func TestHotScoreOrder(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	score := func(likes, comments, views int, age time.Duration) float64 {
+		return models.HotScore(likes, comments, views, now.Add(-age), now)
+	}
+	tests := []struct {
+		name   string
+		ahead  float64
+		behind float64
+	}{
+		{"same engagement, newer first", score(10, 2, 100, time.Hour), score(10, 2, 100, 5*time.Hour)},
+		{"much more engagement beats a few hours", score(100, 20, 1000, 6*time.Hour), score(10, 2, 100, time.Hour)},
+		{"a two-day-old hit falls behind a fresh post", score(20, 5, 200, time.Hour), score(50, 10, 500, 2*24*time.Hour)},
+		{"comments weigh more than likes", score(0, 5, 0, time.Hour), score(5, 0, 0, time.Hour)},
+		{"created in the future counts as new", score(1, 0, 0, -time.Hour), score(1, 0, 0, time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ahead <= tt.behind {
+				t.Fatalf("score %v is not ahead of %v", tt.ahead, tt.behind)
+			}
+		})
+	}
+}
+
+// Trending pages continue strictly below the cursor's score, breaking ties by ID
+func TestTrendingOrder(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	NewTrendingRepository(db).FindTrendingPosts(0, models.PageQuery{Limit: 2, Cursor: &models.Cursor{Score: 3.5, ID: "9"}})
+	sql := recorder.take()
+	for _, want := range []string{
+		"posts.hot_score > 0",
+		"(posts.hot_score < 3.5 OR (posts.hot_score = 3.5 AND posts.id < '9'))",
+		"ORDER BY posts.hot_score DESC,posts.id DESC LIMIT 3",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("trending query lacks %q:\n%s", want, sql)
+		}
+	}
+}
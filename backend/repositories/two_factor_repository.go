@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TwoFactorRepository defines the data operations for TOTP secrets and recovery codes
+type TwoFactorRepository interface {
+	Find(userID uint) (*models.TwoFactor, error)
+	// Save stores a new, not yet enabled secret, replacing any earlier one
+	Save(twoFactor *models.TwoFactor) error
+	// Enable turns on two-factor authentication and replaces the recovery codes
+	Enable(userID uint, step int64, codeHashes []string) error
+	// Delete turns off two-factor authentication and removes the recovery codes
+	Delete(userID uint) error
+	// UseStep records that the code of a time step was accepted. It reports false if that step,
+	// or a later one, was already used, so that each code works once.
+	UseStep(userID uint, step int64) (bool, error)
+	// UseRecoveryCode spends an unused recovery code, reporting false if there is none with that hash
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	CountRecoveryCodes(userID uint) (int64, error)
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+// NewTwoFactorRepository creates a new instance of TwoFactorRepository
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+func (r *twoFactorRepository) Find(userID uint) (*models.TwoFactor, error) {
+	var twoFactor models.TwoFactor
+	if err := r.db.Where("user_id = ?", userID).First(&twoFactor).Error; err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+func (r *twoFactorRepository) Save(twoFactor *models.TwoFactor) error {
+	return r.db.Save(twoFactor).Error
+}
+
+func (r *twoFactorRepository) Enable(userID uint, step int64, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.TwoFactor{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"enabled_at": time.Now(), "last_used_step": step}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (r *twoFactorRepository) Delete(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error
+	})
+}
+
+func (r *twoFactorRepository) UseStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&models.TwoFactor{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Limit(1).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (r *twoFactorRepository) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]models.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return tx.Create(&codes).Error
+}
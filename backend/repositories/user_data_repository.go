@@ -0,0 +1,419 @@
+package repositories
+
+import (
+	"fmt"
+	"nhcommunity/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserDataRepository defines the data operations for exporting and deleting everything stored about a user
+type UserDataRepository interface {
+	Export(userID uint) (*models.UserDataExport, error)
+	// ScheduleDeletion sets when the account is deleted; nil cancels a scheduled deletion
+	ScheduleDeletion(userID uint, at *time.Time) error
+	// FindDueDeletions returns the accounts whose deletion was scheduled for before now
+	FindDueDeletions(now time.Time) ([]uint, error)
+	// Anonymize removes the personal data of a user and turns the account into a placeholder that keeps
+	// their posts, comments, confessions, reviews, events and messages. It returns the media it removed.
+	Anonymize(userID uint) ([]models.Media, error)
+	// Delete removes a user and everything they created. It returns the media it removed.
+	Delete(userID uint) ([]models.Media, error)
+}
+
+type userDataRepository struct {
+	db *gorm.DB
+}
+
+// NewUserDataRepository creates a new instance of UserDataRepository
+func NewUserDataRepository(db *gorm.DB) UserDataRepository {
+	return &userDataRepository{db: db}
+}
+
+func (r *userDataRepository) Export(userID uint) (*models.UserDataExport, error) {
+	export := &models.UserDataExport{ExportedAt: time.Now()}
+	if err := r.db.First(&export.Profile, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var likes []models.Like
+	var confessionLikes []models.ConfessionLike
+	var conversations []models.Conversation
+	var notifications []models.Notification
+	authorID := strconv.FormatUint(uint64(userID), 10)
+
+	steps := []func() error{
+		func() error {
+			return r.db.Preload("User").Scopes(preloadMedia).Where("user_id = ?", userID).Order("id").Find(&export.Posts).Error
+		},
+		func() error {
+			return r.db.Preload("User").Where("user_id = ?", userID).Order("id").Find(&export.Comments).Error
+		},
+		func() error { return r.db.Where("user_id = ?", userID).Order("id").Find(&likes).Error },
+		func() error { return r.db.Where("user_id = ?", userID).Order("id").Find(&confessionLikes).Error },
+		func() error {
+			return r.db.Preload("User").Where("user_id = ?", userID).Order("id").Find(&export.Confessions).Error
+		},
+		func() error {
+			return r.db.Preload("User").Where("user_id = ?", userID).Order("id").Find(&export.ConfessionComments).Error
+		},
+		func() error {
+			return r.db.Preload("Creator").Where("creator_id = ?", userID).Order("id").Find(&export.Events).Error
+		},
+		func() error {
+			return r.db.Preload("User").Where("user_id = ?", userID).Order("id").Find(&export.EventAttendances).Error
+		},
+		func() error {
+			return r.db.Preload("Seller").Scopes(preloadMedia).Where("seller_id = ?", userID).Order("id").Find(&export.Listings).Error
+		},
+		func() error {
+			return r.db.Preload("User").Scopes(preloadMedia).Where("user_id = ?", userID).Order("id").Find(&export.LostFound).Error
+		},
+		func() error {
+			return r.db.Preload("User").Where("user_id = ?", userID).Order("id").Find(&export.CourseReviews).Error
+		},
+		func() error {
+			return r.db.Unscoped().Preload("Author").Preload("Tags").Where("author_id = ?", authorID).Order("created_at").Find(&export.Partners).Error
+		},
+		func() error {
+			return r.db.Table("partner_participants").Where("user_id = ?", userID).Pluck("partner_id", &export.JoinedPartnerIDs).Error
+		},
+		func() error { return r.db.Where("owner_id = ?", userID).Order("id").Find(&export.Media).Error },
+		func() error {
+			return r.db.Joins("JOIN conversation_participants cp ON cp.conversation_id = conversations.id AND cp.user_id = ?", userID).
+				Order("conversations.id").Find(&conversations).Error
+		},
+		func() error {
+			return r.db.Preload("Sender").Where("user_id = ?", userID).Order("id").Find(&notifications).Error
+		},
+		func() error {
+			return r.db.Table("user_follows").Where("follower_id = ?", userID).Pluck("following_id", &export.FollowingIDs).Error
+		},
+		func() error {
+			return r.db.Table("user_follows").Where("following_id = ?", userID).Pluck("follower_id", &export.FollowerIDs).Error
+		},
+		func() error { return r.db.Where("blocker_id = ?", userID).Find(&export.Blocks).Error },
+		func() error { return r.db.Where("muter_id = ?", userID).Find(&export.Mutes).Error },
+		func() error {
+			return r.db.Where("user_id = ?", userID).Order("created_at").Find(&export.Sessions).Error
+		},
+		func() error { return r.db.Where("user_id = ?", userID).Order("id").Find(&export.Verifications).Error },
+		func() error {
+			return r.db.Where("user_id = ?", userID).Order("id").Find(&export.ExternalIdentities).Error
+		},
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, like := range likes {
+		export.Likes = append(export.Likes, models.ExportedLike{ResourceType: "post", ResourceID: like.PostID, CreatedAt: like.CreatedAt})
+	}
+	for _, like := range confessionLikes {
+		export.Likes = append(export.Likes, models.ExportedLike{ResourceType: "confession", ResourceID: like.ConfessionID, CreatedAt: like.CreatedAt})
+	}
+	for _, notification := range notifications {
+		export.Notifications = append(export.Notifications, notification.ToResponse())
+	}
+	for _, conversation := range conversations {
+		exported := models.ExportedConversation{
+			ID:        conversation.ID,
+			Type:      conversation.Type,
+			Name:      conversation.Name,
+			CreatedAt: conversation.CreatedAt,
+		}
+		err := r.db.Table("conversation_participants").Where("conversation_id = ?", conversation.ID).
+			Order("user_id").Pluck("user_id", &exported.ParticipantIDs).Error
+		if err != nil {
+			return nil, err
+		}
+		if err := r.db.Where("conversation_id = ?", conversation.ID).Order("id").Find(&exported.Messages).Error; err != nil {
+			return nil, err
+		}
+		export.Conversations = append(export.Conversations, exported)
+	}
+	return export, nil
+}
+
+func (r *userDataRepository) ScheduleDeletion(userID uint, at *time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("deletion_scheduled_at", at).Error
+}
+
+func (r *userDataRepository) FindDueDeletions(now time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.User{}).Where("deletion_scheduled_at <= ?", now).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *userDataRepository) Anonymize(userID uint) ([]models.Media, error) {
+	var removed []models.Media
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 头像和认证材料属于个人信息；其余文件仍被保留下来的内容引用
+		err := tx.Where("owner_id = ?", userID).
+			Where("(id IN (SELECT avatar_media_id FROM users WHERE id = ?) OR id IN (SELECT evidence_media_id FROM student_verifications WHERE user_id = ?))", userID, userID).
+			Find(&removed).Error
+		if err != nil {
+			return err
+		}
+
+		// 二手和失物招领带有联系方式和交易信息，找搭子是进行中的约定，账号注销后都没有保留的意义
+		for _, step := range []func(*gorm.DB, uint) error{deleteListings, deletePartners, deleteParticipation, deleteAccountData} {
+			if err := step(tx, userID); err != nil {
+				return err
+			}
+		}
+		if err := deleteMedia(tx, removed); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+			"username":              fmt.Sprintf("deleted_user_%d", userID),
+			"email":                 fmt.Sprintf("deleted_user_%d@deleted.invalid", userID),
+			"password":              "", // no bcrypt hash matches an empty string
+			"full_name":             "",
+			"bio":                   "",
+			"avatar_url":            "",
+			"avatar_media_id":       nil,
+			"student_id":            nil,
+			"role":                  models.RoleUser,
+			"is_active":             false,
+			"email_verified_at":     nil,
+			"student_verified_at":   nil,
+			"deletion_scheduled_at": nil,
+			"last_seen_at":          nil,
+		}).Error
+	})
+	return removed, err
+}
+
+func (r *userDataRepository) Delete(userID uint) ([]models.Media, error) {
+	var removed []models.Media
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_id = ?", userID).Find(&removed).Error; err != nil {
+			return err
+		}
+
+		steps := []func(*gorm.DB, uint) error{
+			deletePosts, deleteConfessions, deleteEvents, deleteCourseReviews,
+			deleteListings, deletePartners, deleteParticipation, deleteConversations, deleteAccountData,
+		}
+		for _, step := range steps {
+			if err := step(tx, userID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.StudentVerification{}).Where("reviewer_id = ?", userID).Update("reviewer_id", nil).Error; err != nil {
+			return err
+		}
+		if err := deleteMedia(tx, removed); err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, userID).Error
+	})
+	return removed, err
+}
+
+// execAll runs statements in order, stopping at the first error
+func execAll(tx *gorm.DB, statements ...func() error) error {
+	for _, statement := range statements {
+		if err := statement(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePosts removes the posts of a user with their comments, likes and media links, and the
+// comments and likes the user left on other posts. Comments are deleted one by one, so that the
+// hooks keep the comment counts of the remaining posts right.
+func deletePosts(tx *gorm.DB, userID uint) error {
+	posts := tx.Model(&models.Post{}).Select("id").Where("user_id = ?", userID)
+	var comments []models.Comment
+	return execAll(tx,
+		func() error { return tx.Where("post_id IN (?)", posts).Delete(&models.Like{}).Error },
+		func() error { return tx.Exec("DELETE FROM comments WHERE post_id IN (?)", posts).Error },
+		func() error { return tx.Exec("DELETE FROM post_media WHERE post_id IN (?)", posts).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.Post{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.Like{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Find(&comments).Error },
+		func() error { return deleteEach(tx, comments) },
+	)
+}
+
+// deleteConfessions removes the confessions of a user with their comments and likes, and the
+// comments and likes the user left on other confessions, keeping the counts right through the hooks
+func deleteConfessions(tx *gorm.DB, userID uint) error {
+	confessions := tx.Model(&models.Confession{}).Select("id").Where("user_id = ?", userID)
+	var comments []models.ConfessionComment
+	var likes []models.ConfessionLike
+	return execAll(tx,
+		func() error {
+			return tx.Exec("DELETE FROM confession_likes WHERE confession_id IN (?)", confessions).Error
+		},
+		func() error {
+			return tx.Exec("DELETE FROM confession_comments WHERE confession_id IN (?)", confessions).Error
+		},
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.Confession{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Find(&comments).Error },
+		func() error { return deleteEach(tx, comments) },
+		func() error { return tx.Where("user_id = ?", userID).Find(&likes).Error },
+		func() error { return deleteEach(tx, likes) },
+	)
+}
+
+// deleteEvents removes the events a user created together with their attendees
+func deleteEvents(tx *gorm.DB, userID uint) error {
+	events := tx.Model(&models.Event{}).Select("id").Where("creator_id = ?", userID)
+	return execAll(tx,
+		func() error { return tx.Where("event_id IN (?)", events).Delete(&models.EventAttendee{}).Error },
+		func() error { return tx.Where("creator_id = ?", userID).Delete(&models.Event{}).Error },
+	)
+}
+
+// deleteCourseReviews removes the reviews of a user one by one, so that the hooks update the course ratings
+func deleteCourseReviews(tx *gorm.DB, userID uint) error {
+	var reviews []models.CourseReview
+	if err := tx.Where("user_id = ?", userID).Find(&reviews).Error; err != nil {
+		return err
+	}
+	return deleteEach(tx, reviews)
+}
+
+// deleteListings removes the marketplace listings and lost & found items of a user
+func deleteListings(tx *gorm.DB, userID uint) error {
+	listings := tx.Model(&models.Marketplace{}).Select("id").Where("seller_id = ?", userID)
+	items := tx.Model(&models.LostFound{}).Select("id").Where("user_id = ?", userID)
+	return execAll(tx,
+		func() error {
+			return tx.Exec("DELETE FROM marketplace_media WHERE marketplace_id IN (?)", listings).Error
+		},
+		func() error { return tx.Where("seller_id = ?", userID).Delete(&models.Marketplace{}).Error },
+		func() error { return tx.Exec("DELETE FROM lost_found_media WHERE lost_found_id IN (?)", items).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.LostFound{}).Error },
+	)
+}
+
+// deletePartners removes the partner requests a user posted, including soft-deleted ones
+func deletePartners(tx *gorm.DB, userID uint) error {
+	authorID := strconv.FormatUint(uint64(userID), 10)
+	partners := tx.Unscoped().Model(&models.Partner{}).Select("id").Where("author_id = ?", authorID)
+	return execAll(tx,
+		func() error { return tx.Where("partner_id IN (?)", partners).Delete(&models.PartnerTag{}).Error },
+		func() error {
+			return tx.Exec("DELETE FROM partner_participants WHERE partner_id IN (?)", partners).Error
+		},
+		func() error { return tx.Unscoped().Where("author_id = ?", authorID).Delete(&models.Partner{}).Error },
+	)
+}
+
+// deleteParticipation takes a user out of the events and partner requests of others
+func deleteParticipation(tx *gorm.DB, userID uint) error {
+	return execAll(tx,
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.EventAttendee{}).Error },
+		func() error {
+			return tx.Unscoped().Model(&models.Partner{}).
+				Where("id IN (SELECT partner_id FROM partner_participants WHERE user_id = ?)", userID).
+				UpdateColumn("current_participants", gorm.Expr("current_participants - 1")).Error
+		},
+		func() error { return tx.Exec("DELETE FROM partner_participants WHERE user_id = ?", userID).Error },
+	)
+}
+
+// deleteConversations removes the direct conversations of a user. In group conversations the user's own
+// messages are emptied and lose their sender rather than being removed, so that the seq numbering the
+// other members sync by has no gaps, and ownership is handed over.
+func deleteConversations(tx *gorm.DB, userID uint) error {
+	var direct, shared []uint
+	err := tx.Model(&models.Conversation{}).
+		Joins("JOIN conversation_participants cp ON cp.conversation_id = conversations.id AND cp.user_id = ?", userID).
+		Where("conversations.type = ?", models.ConversationDirect).Pluck("conversations.id", &direct).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Table("conversation_participants").Where("user_id = ? AND conversation_id NOT IN ?", userID, append(direct, 0)).
+		Pluck("conversation_id", &shared).Error
+	if err != nil {
+		return err
+	}
+
+	return execAll(tx,
+		func() error {
+			return tx.Where("conversation_id IN ?", append(direct, 0)).Delete(&models.Message{}).Error
+		},
+		func() error {
+			return tx.Where("conversation_id IN ?", append(direct, 0)).Delete(&models.ConversationParticipant{}).Error
+		},
+		func() error { return tx.Where("id IN ?", append(direct, 0)).Delete(&models.Conversation{}).Error },
+		func() error {
+			return tx.Model(&models.Message{}).Where("sender_id = ?", userID).UpdateColumns(map[string]interface{}{
+				"sender_id":         nil,
+				"content":           "",
+				"client_message_id": nil,
+			}).Error
+		},
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.ConversationParticipant{}).Error },
+		func() error {
+			for _, conversationID := range shared {
+				if err := ensureOwner(tx, conversationID); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	)
+}
+
+// deleteAccountData removes what belongs to the account itself rather than to its content: sign-in data,
+// verifications, notifications, relations to other users and moderator scopes
+func deleteAccountData(tx *gorm.DB, userID uint) error {
+	return execAll(tx,
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.ExternalIdentity{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.StudentVerification{}).Error },
+		func() error { return tx.Where("user_id = ?", userID).Delete(&models.ModeratorScope{}).Error },
+		// 通知内容里带有发送者的用户名，所以发出的通知也一并删除
+		func() error {
+			return tx.Where("user_id = ? OR sender_id = ?", userID, userID).Delete(&models.Notification{}).Error
+		},
+		func() error {
+			return tx.Exec("DELETE FROM user_follows WHERE follower_id = ? OR following_id = ?", userID, userID).Error
+		},
+		func() error {
+			return tx.Where("blocker_id = ? OR blocked_id = ?", userID, userID).Delete(&models.UserBlock{}).Error
+		},
+		func() error {
+			return tx.Where("muter_id = ? OR muted_id = ?", userID, userID).Delete(&models.UserMute{}).Error
+		},
+	)
+}
+
+// deleteMedia removes media records along with the links that attach them to content
+func deleteMedia(tx *gorm.DB, media []models.Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(media))
+	for i, m := range media {
+		ids[i] = m.ID
+	}
+	return execAll(tx,
+		func() error { return tx.Exec("DELETE FROM post_media WHERE media_id IN ?", ids).Error },
+		func() error { return tx.Exec("DELETE FROM marketplace_media WHERE media_id IN ?", ids).Error },
+		func() error { return tx.Exec("DELETE FROM lost_found_media WHERE media_id IN ?", ids).Error },
+		func() error { return tx.Delete(&models.Media{}, ids).Error },
+	)
+}
+
+// deleteEach deletes loaded records so that their delete hooks run for each of them
+func deleteEach[T any](tx *gorm.DB, records []T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return tx.Delete(&records).Error
+}
@@ -0,0 +1,28 @@
+package repositories
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Deleting an account keeps its group messages as emptied placeholders, so the seq numbers stay gapless
+func TestDeleteConversationsKeepsGroupMessages(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	// Delete runs the steps in its own transaction
+	if err := deleteConversations(db.Session(&gorm.Session{SkipDefaultTransaction: true}), 7); err != nil {
+		t.Fatal(err)
+	}
+	sql := recorder.take()
+
+	want := "UPDATE `messages` SET `client_message_id`=NULL,`content`='',`sender_id`=NULL WHERE sender_id = 7"
+	if !strings.Contains(sql, want) {
+		t.Fatalf("group messages are not emptied:\n%s", sql)
+	}
+	for _, statement := range strings.Split(sql, "\n") {
+		if strings.HasPrefix(statement, "DELETE FROM `messages`") && !strings.Contains(statement, "conversation_id IN") {
+			t.Fatalf("messages deleted outside direct conversations: %s", statement)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -23,11 +24,23 @@ type UserRepository interface {
 	FindByID(id uint) (*models.User, error)
 	Create(user *models.User) (*models.User, error)
 	Update(user *models.User, cols ...string) (*models.User, error)
-	FollowUser(follower *models.User, following *models.User) error
+	// FollowUser records the follow and reports whether it is new
+	FollowUser(follower *models.User, following *models.User) (bool, error)
 	UnfollowUser(follower *models.User, following *models.User) error
 	LoadFollowers(user *models.User) error
+	// FindFollowers lists the users following userID, most recent follow first, without the users viewerID has a block with
+	FindFollowers(userID, viewerID uint, page models.PageQuery) (models.Page[models.FollowedUser], error)
+	// FindFollowing lists the users userID follows, most recent follow first, without the users viewerID has a block with
+	FindFollowing(userID, viewerID uint, page models.PageQuery) (models.Page[models.FollowedUser], error)
+	// FindStats returns the profile counters of each user as seen by viewerID
+	FindStats(viewerID uint, userIDs []uint) (map[uint]models.UserStats, error)
 	CountUsers() (int64, error)
 	FindAll() ([]models.User, error)
+	// FindModeratorSections returns the sections the user's role permissions are limited to, empty if unscoped
+	FindModeratorSections(userID uint) ([]string, error)
+	ReplaceModeratorSections(userID uint, sections []string) error
+	// FindActiveIDsByRoles returns the IDs of the active users holding one of the roles
+	FindActiveIDsByRoles(roles []string) ([]uint, error)
 	GetDB() *gorm.DB
 }
 
@@ -116,8 +129,10 @@ func (r *userRepository) Update(user *models.User, cols ...string) (*models.User
 	return user, nil
 }
 
-func (r *userRepository) FollowUser(follower *models.User, following *models.User) error {
-	return r.db.Model(follower).Association("Following").Append(following)
+func (r *userRepository) FollowUser(follower *models.User, following *models.User) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserFollow{FollowerID: follower.ID, FollowingID: following.ID})
+	return result.RowsAffected > 0, result.Error
 }
 
 func (r *userRepository) UnfollowUser(follower *models.User, following *models.User) error {
@@ -128,6 +143,84 @@ func (r *userRepository) LoadFollowers(user *models.User) error {
 	return r.db.Model(user).Association("Followers").Find(&user.Followers)
 }
 
+func (r *userRepository) FindFollowers(userID, viewerID uint, page models.PageQuery) (models.Page[models.FollowedUser], error) {
+	query := r.db.Model(&models.User{}).Select("users.*, uf.created_at AS followed_at").
+		Joins("JOIN user_follows uf ON uf.follower_id = users.id").
+		Where("uf.following_id = ?", userID).
+		Scopes(notBlocked("users.id", viewerID))
+	return paginateOn[models.FollowedUser](query, "uf.created_at", "users.id", page)
+}
+
+func (r *userRepository) FindFollowing(userID, viewerID uint, page models.PageQuery) (models.Page[models.FollowedUser], error) {
+	query := r.db.Model(&models.User{}).Select("users.*, uf.created_at AS followed_at").
+		Joins("JOIN user_follows uf ON uf.following_id = users.id").
+		Where("uf.follower_id = ?", userID).
+		Scopes(notBlocked("users.id", viewerID))
+	return paginateOn[models.FollowedUser](query, "uf.created_at", "users.id", page)
+}
+
+// userCount is one row of a per-user COUNT(*) query
+type userCount struct {
+	UserID uint
+	Count  int
+}
+
+func (r *userRepository) FindStats(viewerID uint, userIDs []uint) (map[uint]models.UserStats, error) {
+	stats := make(map[uint]models.UserStats, len(userIDs))
+	if len(userIDs) == 0 {
+		return stats, nil
+	}
+
+	var followers, following, posts []userCount
+	err := r.db.Table("user_follows").Select("following_id AS user_id, COUNT(*) AS count").
+		Where("following_id IN ?", userIDs).Group("following_id").Scan(&followers).Error
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Table("user_follows").Select("follower_id AS user_id, COUNT(*) AS count").
+		Where("follower_id IN ?", userIDs).Group("follower_id").Scan(&following).Error
+	if err != nil {
+		return nil, err
+	}
+	// 只统计浏览者可见的帖子，与用户主页的帖子列表保持一致
+	err = r.db.Model(&models.Post{}).Scopes(visibleTo(viewerID)).Select("posts.user_id AS user_id, COUNT(*) AS count").
+		Where("posts.user_id IN ?", userIDs).Group("posts.user_id").Scan(&posts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var followed []uint
+	if viewerID != 0 {
+		err = r.db.Table("user_follows").Where("follower_id = ? AND following_id IN ?", viewerID, userIDs).
+			Pluck("following_id", &followed).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range followers {
+		s := stats[row.UserID]
+		s.FollowerCount = row.Count
+		stats[row.UserID] = s
+	}
+	for _, row := range following {
+		s := stats[row.UserID]
+		s.FollowingCount = row.Count
+		stats[row.UserID] = s
+	}
+	for _, row := range posts {
+		s := stats[row.UserID]
+		s.PostCount = row.Count
+		stats[row.UserID] = s
+	}
+	for _, id := range followed {
+		s := stats[id]
+		s.IsFollowing = true
+		stats[id] = s
+	}
+	return stats, nil
+}
+
 // CountUsers 计算用户总数
 func (r *userRepository) CountUsers() (int64, error) {
 	var count int64
@@ -153,6 +246,37 @@ func (r *userRepository) FindAll() ([]models.User, error) {
 	return users, result.Error
 }
 
+func (r *userRepository) FindModeratorSections(userID uint) ([]string, error) {
+	var sections []string
+	err := r.db.Model(&models.ModeratorScope{}).Where("user_id = ?", userID).Order("section").Pluck("section", &sections).Error
+	return sections, err
+}
+
+func (r *userRepository) ReplaceModeratorSections(userID uint, sections []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.ModeratorScope{}).Error; err != nil {
+			return err
+		}
+		if len(sections) == 0 {
+			return nil
+		}
+		scopes := make([]models.ModeratorScope, len(sections))
+		for i, section := range sections {
+			scopes[i] = models.ModeratorScope{UserID: userID, Section: section}
+		}
+		return tx.Create(&scopes).Error
+	})
+}
+
+func (r *userRepository) FindActiveIDsByRoles(roles []string) ([]uint, error) {
+	var ids []uint
+	if len(roles) == 0 {
+		return ids, nil
+	}
+	err := r.db.Model(&models.User{}).Where("role IN ? AND is_active = ?", roles, true).Pluck("id", &ids).Error
+	return ids, err
+}
+
 // GetDB 返回数据库连接以供调试
 func (r *userRepository) GetDB() *gorm.DB {
 	return r.db
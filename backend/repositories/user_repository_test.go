@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFollowLists(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	repo := NewUserRepository(db)
+	page := models.PageQuery{Limit: 20}
+
+	repo.FindFollowers(3, 0, page)
+	if sql := recorder.take(); !strings.Contains(sql, "JOIN user_follows uf ON uf.follower_id = users.id WHERE uf.following_id = 3") {
+		t.Errorf("followers of 3 are not the users following them:\n%s", sql)
+	}
+	// the lists are in the order the follows were made, not the order the accounts were created
+	cursor := models.Cursor{CreatedAt: time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC), ID: "9"}
+	repo.FindFollowers(3, 0, models.PageQuery{Limit: 20, Cursor: &cursor})
+	sql := recorder.take()
+	if !strings.Contains(sql, "SELECT users.*, uf.created_at AS followed_at FROM `users`") ||
+		!strings.Contains(sql, "(uf.created_at < '2024-05-08 12:00:00' OR (uf.created_at = '2024-05-08 12:00:00' AND users.id < '9'))") ||
+		!strings.Contains(sql, "ORDER BY uf.created_at DESC,users.id DESC") {
+		t.Errorf("followers are not paged by follow time:\n%s", sql)
+	}
+	repo.FindFollowing(3, 0, page)
+	if sql := recorder.take(); !strings.Contains(sql, "JOIN user_follows uf ON uf.following_id = users.id WHERE uf.follower_id = 3") {
+		t.Errorf("following of 3 are not the users they follow:\n%s", sql)
+	}
+}
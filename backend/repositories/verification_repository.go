@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"nhcommunity/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// VerificationRepository defines the data operations for student verification requests
+type VerificationRepository interface {
+	Create(verification *models.StudentVerification) error
+	FindByID(id uint) (*models.StudentVerification, error)
+	// FindLatestByUser returns the most recent request of a user
+	FindLatestByUser(userID uint) (*models.StudentVerification, error)
+	// FindByStatus lists requests with the given status, or all requests when status is empty
+	FindByStatus(status string, page models.PageQuery) (models.Page[models.StudentVerification], error)
+	// Approve marks a pending request approved and copies its student ID onto the user.
+	// It fails with ErrStudentIdExists when another verified user holds the student ID;
+	// an unverified claim to it is cleared.
+	Approve(verification *models.StudentVerification, reviewerID *uint, note string) error
+	// Reject marks a pending request rejected; reviewerID is nil when the system withdraws it
+	Reject(verification *models.StudentVerification, reviewerID *uint, note string) error
+}
+
+type verificationRepository struct {
+	db *gorm.DB
+}
+
+// NewVerificationRepository creates a new instance of VerificationRepository
+func NewVerificationRepository(db *gorm.DB) VerificationRepository {
+	return &verificationRepository{db: db}
+}
+
+func (r *verificationRepository) Create(verification *models.StudentVerification) error {
+	return r.db.Create(verification).Error
+}
+
+func (r *verificationRepository) FindByID(id uint) (*models.StudentVerification, error) {
+	var verification models.StudentVerification
+	err := r.db.Preload("User").Preload("Evidence").First(&verification, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+func (r *verificationRepository) FindLatestByUser(userID uint) (*models.StudentVerification, error) {
+	var verification models.StudentVerification
+	err := r.db.Preload("Evidence").
+		Where("user_id = ?", userID).
+		Order("created_at DESC").Order("id DESC").
+		First(&verification).Error
+	if err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+func (r *verificationRepository) FindByStatus(status string, page models.PageQuery) (models.Page[models.StudentVerification], error) {
+	query := r.db.Model(&models.StudentVerification{}).Preload("User").Preload("Evidence")
+	if status != "" {
+		query = query.Where("student_verifications.status = ?", status)
+	}
+	return paginate[models.StudentVerification](query, "student_verifications", page)
+}
+
+func (r *verificationRepository) Approve(verification *models.StudentVerification, reviewerID *uint, note string) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var holder int64
+		err := tx.Model(&models.User{}).
+			Where("student_id = ? AND id <> ? AND student_verified_at IS NOT NULL", verification.StudentID, verification.UserID).
+			Count(&holder).Error
+		if err != nil {
+			return err
+		}
+		if holder > 0 {
+			return ErrStudentIdExists
+		}
+		// 未经认证的学号让给认证通过的用户
+		err = tx.Model(&models.User{}).
+			Where("student_id = ? AND id <> ? AND student_verified_at IS NULL", verification.StudentID, verification.UserID).
+			UpdateColumn("student_id", nil).Error
+		if err != nil {
+			return err
+		}
+
+		if err := decideVerification(tx, verification, models.VerificationApproved, reviewerID, note, now); err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", verification.UserID).
+			UpdateColumns(map[string]interface{}{
+				"student_id":          verification.StudentID,
+				"student_verified_at": now,
+			}).Error
+	})
+}
+
+func (r *verificationRepository) Reject(verification *models.StudentVerification, reviewerID *uint, note string) error {
+	return decideVerification(r.db, verification, models.VerificationRejected, reviewerID, note, time.Now())
+}
+
+// decideVerification records the outcome of a request, guarding against it having been decided concurrently
+func decideVerification(db *gorm.DB, verification *models.StudentVerification, status string, reviewerID *uint, note string, now time.Time) error {
+	result := db.Model(&models.StudentVerification{}).
+		Where("id = ? AND status = ?", verification.ID, models.VerificationPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewer_id": reviewerID,
+			"review_note": note,
+			"reviewed_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrVerificationNotPending
+	}
+	verification.Status, verification.ReviewerID, verification.ReviewNote, verification.ReviewedAt = status, reviewerID, note, &now
+	return nil
+}
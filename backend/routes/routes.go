@@ -1,19 +1,31 @@
 package routes
 
 import (
+	"context"
 	"nhcommunity/config"
 	"nhcommunity/controllers"
 	"nhcommunity/middlewares"
+	"nhcommunity/models"
 	"nhcommunity/repositories"
 	"nhcommunity/services"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// SetupRoutes initializes all API routes
-func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
+// userStatusCacheTTL bounds how long a role change or ban made on another instance takes to apply
+const userStatusCacheTTL = 30 * time.Second
+
+// sessionStatusCacheTTL bounds how long access tokens of a session revoked on another instance keep working
+const sessionStatusCacheTTL = 30 * time.Second
+
+// viewCountWindow is how long repeated views of a post, confession or listing by one viewer count once
+const viewCountWindow = time.Hour
+
+// SetupRoutes initializes all API routes; background jobs stop once ctx is done
+func SetupRoutes(ctx context.Context, router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 	// Configure CORS
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{config.GetConfig().ClientOrigin}
@@ -23,6 +35,38 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 
 	router.Use(cors.New(corsConfig))
 
+	// Configure upload storage
+	appConfig := config.GetConfig()
+	var blobStore repositories.BlobStore
+	if appConfig.StorageDriver == "s3" {
+		blobStore = repositories.NewS3BlobStore(repositories.S3Config{
+			Endpoint:  appConfig.S3Endpoint,
+			Region:    appConfig.S3Region,
+			Bucket:    appConfig.S3Bucket,
+			AccessKey: appConfig.S3AccessKey,
+			SecretKey: appConfig.S3SecretKey,
+			PublicURL: appConfig.S3PublicURL,
+		})
+	} else {
+		blobStore = repositories.NewLocalBlobStore(appConfig.UploadDir, appConfig.UploadBaseURL)
+		router.Static(appConfig.UploadBaseURL, appConfig.UploadDir)
+	}
+	uploadMaxSize := int64(appConfig.UploadMaxSizeMB) << 20
+
+	// Configure outgoing mail
+	var mailer services.Mailer
+	if appConfig.MailDriver == "smtp" {
+		mailer = services.NewSMTPMailer(services.SMTPConfig{
+			Host:     appConfig.SMTPHost,
+			Port:     appConfig.SMTPPort,
+			Username: appConfig.SMTPUsername,
+			Password: appConfig.SMTPPassword,
+			From:     appConfig.MailFrom,
+		})
+	} else {
+		mailer = services.NewFileMailer(appConfig.MailDir, appConfig.MailFrom)
+	}
+
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(db)
 	confessionRepo := repositories.NewConfessionRepository(db)
@@ -34,22 +78,74 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 	notificationRepo := repositories.NewNotificationRepository(db)
 	partnerRepo := repositories.NewPartnerRepository(db)
 	chatRepo := repositories.NewChatRepository(db)
+	feedRepo := repositories.NewFeedRepository(db)
+	trendingRepo := repositories.NewTrendingRepository(db)
+	searchIndex := repositories.NewMySQLSearchIndex(db)
+	mediaRepo := repositories.NewMediaRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	verificationRepo := repositories.NewVerificationRepository(db)
+	externalIdentityRepo := repositories.NewExternalIdentityRepository(db)
+	twoFactorRepo := repositories.NewTwoFactorRepository(db)
+	blockRepo := repositories.NewBlockRepository(db)
+	userDataRepo := repositories.NewUserDataRepository(db)
+	var loginAttempts repositories.LoginAttemptStore
+	if appConfig.LoginAttemptStore == "redis" {
+		loginAttempts = repositories.NewRedisLoginAttemptStore(repositories.RedisConfig{
+			Addr:     appConfig.RedisAddr,
+			Password: appConfig.RedisPassword,
+			DB:       appConfig.RedisDB,
+		})
+	} else {
+		loginAttempts = repositories.NewMemoryLoginAttemptStore()
+	}
 
 	// Initialize services
-	userService := services.NewUserService(userRepo)
-	confessionService := services.NewConfessionService(confessionRepo)
-	postService := services.NewPostService(postRepo)
-	eventService := services.NewEventService(eventRepo)
-	courseService := services.NewCourseService(courseRepo)
-	marketplaceService := services.NewMarketplaceService(marketplaceRepo)
-	lostFoundService := services.NewLostFoundService(lostFoundRepo)
-	notificationService := services.NewNotificationService(notificationRepo)
-	partnerService := services.NewPartnerService(partnerRepo)
-	chatService := services.NewChatService(db, chatRepo)
+	// The notification service is created first because other services emit notifications through it
+	notificationService := services.NewNotificationService(notificationRepo, blockRepo, hub)
+	mediaService := services.NewMediaService(mediaRepo, blobStore, uploadMaxSize)
+	userStatusCache := services.NewUserStatusCache(userRepo, userStatusCacheTTL)
+	authorizer := services.NewAuthorizer(userStatusCache, appConfig.RolePermissions)
+	userService := services.NewUserService(userRepo, blockRepo, mediaService, notificationService, userStatusCache, authorizer)
+	sessionStatusCache := services.NewSessionStatusCache(sessionRepo, sessionStatusCacheTTL)
+	sessionService := services.NewSessionService(sessionRepo, userRepo, sessionStatusCache)
+	accountService := services.NewAccountService(userRepo, sessionService, mailer, appConfig.ClientOrigin)
+	loginGuard := services.NewLoginGuard(loginAttempts)
+	ssoService := services.NewSSOService(services.OIDCConfig{
+		Issuer:         appConfig.OIDCIssuer,
+		ClientID:       appConfig.OIDCClientID,
+		ClientSecret:   appConfig.OIDCClientSecret,
+		RedirectURL:    appConfig.OIDCRedirectURL,
+		Scopes:         appConfig.OIDCScopes,
+		UsernameClaim:  appConfig.OIDCUsernameClaim,
+		EmailClaim:     appConfig.OIDCEmailClaim,
+		NameClaim:      appConfig.OIDCNameClaim,
+		StudentIdClaim: appConfig.OIDCStudentIdClaim,
+	}, externalIdentityRepo, userRepo, userStatusCache)
+	twoFactorService := services.NewTwoFactorService(twoFactorRepo, userRepo, appConfig.TwoFactorIssuer, appConfig.TwoFactorRequiredForAdmins)
+	viewCounter := services.NewViewCounter(viewCountWindow)
+	confessionService := services.NewConfessionService(confessionRepo, blockRepo, notificationService, authorizer, viewCounter)
+	postService := services.NewPostService(postRepo, mediaService, notificationService, authorizer, viewCounter)
+	eventService := services.NewEventService(eventRepo, notificationService, authorizer)
+	courseService := services.NewCourseService(courseRepo, authorizer)
+	marketplaceService := services.NewMarketplaceService(marketplaceRepo, mediaService, authorizer, viewCounter)
+	lostFoundService := services.NewLostFoundService(lostFoundRepo, mediaService, authorizer)
+	partnerService := services.NewPartnerService(partnerRepo, notificationService, authorizer)
+	chatService := services.NewChatService(db, chatRepo, blockRepo, notificationService)
+	presenceService := services.NewPresenceService(hub, userRepo, chatRepo, blockRepo)
+	presenceService.Start()
+	feedService := services.NewFeedService(feedRepo)
+	trendingService := services.NewTrendingService(trendingRepo)
+	trendingService.Start(ctx, time.Duration(appConfig.HotScoreInterval)*time.Minute)
+	searchService := services.NewSearchService(searchIndex)
+	userDataService := services.NewUserDataService(userDataRepo, userRepo, externalIdentityRepo, sessionRepo, sessionService,
+		twoFactorService, mediaService, mailer, userStatusCache, appConfig.AccountDeletionMode, time.Duration(appConfig.AccountDeletionGraceDays)*24*time.Hour)
+	userDataService.Start()
+	verificationService := services.NewVerificationService(verificationRepo, userRepo, mediaService, mailer,
+		notificationService, userStatusCache, appConfig.CampusEmailDomains, appConfig.ClientOrigin)
 
 	// Create controller instances
 	userController := controllers.NewUserController(userService)
-	authController := controllers.NewAuthController(userService, db)
+	authController := controllers.NewAuthController(userService, sessionService, accountService, loginGuard, ssoService, twoFactorService)
 	postController := controllers.NewPostController(postService)
 	eventController := controllers.NewEventController(eventService)
 	courseController := controllers.NewCourseController(courseService)
@@ -59,6 +155,18 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 	notificationController := controllers.NewNotificationController(notificationService)
 	partnerController := controllers.NewPartnerController(partnerService)
 	chatController := controllers.NewChatController(chatService, hub)
+	presenceController := controllers.NewPresenceController(presenceService)
+	feedController := controllers.NewFeedController(feedService)
+	trendingController := controllers.NewTrendingController(trendingService)
+	searchController := controllers.NewSearchController(searchService)
+	uploadController := controllers.NewUploadController(mediaService, uploadMaxSize)
+	verificationController := controllers.NewVerificationController(verificationService)
+	twoFactorController := controllers.NewTwoFactorController(twoFactorService, loginGuard)
+	userDataController := controllers.NewUserDataController(userDataService)
+
+	// verifiedOnly guards actions that VERIFIED_ONLY_ACTIONS limits to verified students. The actions are
+	// post.create, event.create, marketplace.create, lost_found.create, confession.create and partner.create.
+	verifiedOnly := middlewares.VerifiedOnly(userStatusCache, appConfig.VerifiedOnlyActions)
 
 	// API v1 group
 	api := router.Group("/api/v1")
@@ -69,35 +177,48 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 		auth := api.Group("/auth")
 		auth.POST("/register", authController.Register)
 		auth.POST("/login", authController.Login)
-		auth.GET("/refresh", authController.RefreshToken)
+		auth.POST("/refresh", authController.RefreshToken)
+		auth.POST("/logout", middlewares.AuthMiddleware(sessionStatusCache, userStatusCache), authController.Logout)
+		auth.POST("/logout/all", middlewares.AuthMiddleware(sessionStatusCache, userStatusCache), authController.LogoutAll)
+		auth.POST("/verify-email", authController.VerifyEmail)
+		auth.POST("/resend-verification", authController.ResendVerification)
+		auth.POST("/forgot-password", authController.ForgotPassword)
+		auth.POST("/reset-password", authController.ResetPassword)
+		auth.POST("/verify-student-email", verificationController.ConfirmCampusEmail)
+		auth.POST("/2fa/setup", authController.TwoFactorSetup)
+		auth.POST("/2fa/verify", authController.TwoFactorVerify)
+		auth.GET("/sso/login", authController.SSOLogin)
+		auth.POST("/sso/callback", authController.SSOCallback)
 
 		// Search routes
 		search := api.Group("/search")
-		search.GET("/posts", postController.SearchPosts)
+		search.GET("", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), searchController.Search)
+		search.GET("/posts", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), postController.SearchPosts)
 
 		// Public data routes
-		api.GET("/posts", postController.GetPosts)
-		api.GET("/posts/:id", postController.GetPostByID)
-		api.GET("/events", eventController.GetEvents)
-		api.GET("/events/:id", eventController.GetEventByID)
+		api.GET("/posts", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), postController.GetPosts)
+		api.GET("/posts/:id", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), postController.GetPostByID)
+		api.GET("/trending", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), trendingController.GetTrending)
+		api.GET("/events", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), eventController.GetEvents)
+		api.GET("/events/:id", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), eventController.GetEventByID)
 		api.GET("/events/categories", eventController.GetCategories)
 		api.GET("/courses", courseController.GetCourses)
 		api.GET("/courses/:id", courseController.GetCourseByID)
-		api.GET("/marketplace", marketplaceController.GetListings)
-		api.GET("/marketplace/:id", marketplaceController.GetListingByID)
-		api.GET("/lost-found", lostFoundController.GetItems)
-		api.GET("/lost-found/:id", lostFoundController.GetItemByID)
-		api.GET("/confessions", confessionController.GetConfessions)
-		api.GET("/confessions/:id", confessionController.GetConfessionByID)
-		api.GET("/partners", partnerController.GetPartners)
+		api.GET("/marketplace", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), marketplaceController.GetListings)
+		api.GET("/marketplace/:id", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), marketplaceController.GetListingByID)
+		api.GET("/lost-found", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), lostFoundController.GetItems)
+		api.GET("/lost-found/:id", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), lostFoundController.GetItemByID)
+		api.GET("/confessions", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), confessionController.GetConfessions)
+		api.GET("/confessions/:id", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), confessionController.GetConfessionByID)
+		api.GET("/partners", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), partnerController.GetPartners)
 		api.GET("/partners/categories", partnerController.GetPartnerCategories)
 		api.GET("/partners/types", partnerController.GetPartnerTypes)
-		api.GET("/partners/:id", partnerController.GetPartnerByID)
+		api.GET("/partners/:id", middlewares.OptionalAuthMiddleware(sessionStatusCache, userStatusCache), partnerController.GetPartnerByID)
 	}
 
 	// Protected routes (require authentication)
 	authorized := api.Group("/")
-	authorized.Use(middlewares.AuthMiddleware())
+	authorized.Use(middlewares.AuthMiddleware(sessionStatusCache, userStatusCache))
 	{
 		// WebSocket chat route
 		authorized.GET("/ws/chat", chatController.ServeWs)
@@ -105,18 +226,52 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 		// Chat routes
 		authorized.GET("/conversations", chatController.GetConversations)
 		authorized.GET("/conversations/:id/messages", chatController.GetMessages)
+		authorized.POST("/conversations/:id/read", chatController.MarkRead)
 		authorized.POST("/chats", chatController.CreateChatSession)
+		authorized.POST("/conversations/groups", chatController.CreateGroup)
+		authorized.PUT("/conversations/:id", chatController.UpdateGroup)
+		authorized.POST("/conversations/:id/members", chatController.AddMembers)
+		authorized.PUT("/conversations/:id/members/:userId", chatController.UpdateMemberRole)
+		authorized.DELETE("/conversations/:id/members/:userId", chatController.RemoveMember)
 
 		// User routes
 		user := authorized.Group("/users")
 		user.GET("/me", userController.GetCurrentUser)
 		user.PUT("/me", userController.UpdateCurrentUser)
+		user.DELETE("/me", userDataController.DeleteAccount)
+		user.GET("/me/export", userDataController.Export)
+		user.GET("/me/permissions", userController.GetMyPermissions)
+		user.PUT("/me/presence", presenceController.UpdateMyPresence)
+		user.GET("/me/2fa", twoFactorController.GetStatus)
+		user.POST("/me/2fa/setup", twoFactorController.Setup)
+		user.POST("/me/2fa/enable", twoFactorController.Enable)
+		user.POST("/me/2fa/disable", twoFactorController.Disable)
+		user.POST("/me/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+		user.GET("/me/verification", verificationController.GetMine)
+		user.POST("/me/verification", verificationController.Submit)
 		user.GET("/:id", userController.GetUserByID)
+		user.GET("/:id/followers", userController.GetFollowers)
+		user.GET("/:id/following", userController.GetFollowing)
+		user.GET("/:id/presence", presenceController.GetPresence)
+		user.GET("/:id/posts", postController.GetUserPosts)
+		user.GET("/:id/events", eventController.GetUserEvents)
+		user.GET("/:id/listings", marketplaceController.GetUserListings)
+		user.GET("/:id/partners", partnerController.GetUserPartners)
 		user.POST("/:id/follow", userController.Follow)
 		user.DELETE("/:id/follow", userController.Unfollow)
+		user.POST("/:id/block", userController.Block)
+		user.DELETE("/:id/block", userController.Unblock)
+		user.POST("/:id/mute", userController.Mute)
+		user.DELETE("/:id/mute", userController.Unmute)
+
+		// Feed routes
+		authorized.GET("/feed", feedController.GetFeed)
+
+		// Upload routes
+		authorized.POST("/uploads", uploadController.Upload)
 
 		// Post routes
-		authorized.POST("/posts", postController.CreatePost)
+		authorized.POST("/posts", verifiedOnly("post.create"), postController.CreatePost)
 		authorized.PUT("/posts/:id", postController.UpdatePost)
 		authorized.DELETE("/posts/:id", postController.DeletePost)
 		authorized.POST("/posts/:id/like", postController.LikePost)
@@ -128,7 +283,7 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 		authorized.DELETE("/comments/:id", postController.DeleteComment)
 
 		// Event routes
-		authorized.POST("/events", eventController.CreateEvent)
+		authorized.POST("/events", verifiedOnly("event.create"), eventController.CreateEvent)
 		authorized.PUT("/events/:id", eventController.UpdateEvent)
 		authorized.DELETE("/events/:id", eventController.DeleteEvent)
 		authorized.POST("/events/:id/join", eventController.JoinEvent)
@@ -144,17 +299,17 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 		authorized.DELETE("/courses/reviews/:reviewId", courseController.DeleteCourseReview)
 
 		// Marketplace routes
-		authorized.POST("/marketplace", marketplaceController.CreateListing)
+		authorized.POST("/marketplace", verifiedOnly("marketplace.create"), marketplaceController.CreateListing)
 		authorized.PUT("/marketplace/:id", marketplaceController.UpdateListing)
 		authorized.DELETE("/marketplace/:id", marketplaceController.DeleteListing)
 
 		// Lost & Found routes
-		authorized.POST("/lost-found", lostFoundController.CreateItem)
+		authorized.POST("/lost-found", verifiedOnly("lost_found.create"), lostFoundController.CreateItem)
 		authorized.PUT("/lost-found/:id", lostFoundController.UpdateItem)
 		authorized.DELETE("/lost-found/:id", lostFoundController.DeleteItem)
 
 		// Confession routes
-		authorized.POST("/confessions", confessionController.CreateConfession)
+		authorized.POST("/confessions", verifiedOnly("confession.create"), confessionController.CreateConfession)
 		authorized.PUT("/confessions/:id", confessionController.UpdateConfession)
 		authorized.DELETE("/confessions/:id", confessionController.DeleteConfession)
 		authorized.POST("/confessions/:id/like", confessionController.LikeConfession)
@@ -170,7 +325,7 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 
 		// Partner routes
 		partner := authorized.Group("/partners")
-		partner.POST("", partnerController.CreatePartner)
+		partner.POST("", verifiedOnly("partner.create"), partnerController.CreatePartner)
 		partner.PUT("/:id", partnerController.UpdatePartner)
 		partner.DELETE("/:id", partnerController.DeletePartner)
 		partner.POST("/:id/join", partnerController.JoinPartner)
@@ -179,24 +334,32 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, hub *services.Hub) {
 
 	// 在 authorized 路由组后添加管理员路由组
 
-	// 管理员路由 (需要管理员权限)
+	// 管理员路由 (每个接口需要对应的权限，版主也可访问其权限范围内的接口)
 	admin := api.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	admin.Use(middlewares.AuthMiddleware(sessionStatusCache, userStatusCache))
+	can := func(permission models.Permission) gin.HandlerFunc {
+		return middlewares.RequirePermission(authorizer, permission)
+	}
 	{
 		// 调试接口
-		admin.GET("/debug/users", userController.DebugUserDatabase)
+		admin.GET("/debug/users", can(models.PermUserView), userController.DebugUserDatabase)
 
 		// 管理员统计数据
-		admin.GET("/stats", confessionController.GetAdminStats)
+		admin.GET("/stats", can(models.PermStatsView), confessionController.GetAdminStats)
 
 		// 树洞管理
-		admin.GET("/confessions", confessionController.GetAdminConfessions)
-		admin.PUT("/confessions/:id/status", confessionController.UpdateConfessionStatus)
+		admin.GET("/confessions", can(models.PermConfessionReview), confessionController.GetAdminConfessions)
+		admin.PUT("/confessions/:id/status", can(models.PermConfessionReview), confessionController.UpdateConfessionStatus)
 
 		// 用户管理
-		admin.GET("/users", userController.GetAllUsers)
-		admin.PUT("/users/:id/status", userController.UpdateUserStatus)
-		admin.PUT("/users/:id/role", userController.UpdateUserRole) // 添加用户角色管理API
+		admin.GET("/users", can(models.PermUserView), userController.GetAllUsers)
+		admin.PUT("/users/:id/status", can(models.PermUserBan), userController.UpdateUserStatus)
+		admin.PUT("/users/:id/role", can(models.PermUserRole), userController.UpdateUserRole) // 添加用户角色管理API
+		admin.PUT("/users/:id/sections", can(models.PermUserRole), userController.UpdateUserSections)
+
+		// 学生身份认证审核
+		admin.GET("/verifications", can(models.PermVerificationReview), verificationController.GetRequests)
+		admin.PUT("/verifications/:id", can(models.PermVerificationReview), verificationController.Review)
 
 		// 系统设置
 		// TODO: 实现系统设置控制器和方法
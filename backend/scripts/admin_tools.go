@@ -20,7 +20,7 @@ type User struct {
 	FullName     string    `gorm:"size:100"`
 	AvatarURL    string    `gorm:"size:500"`
 	Bio          string    `gorm:"size:500"`
-	StudentId    string    `gorm:"size:50;uniqueIndex"`
+	StudentId    *string   `gorm:"size:50;uniqueIndex"` // NULL until verified
 	RefreshToken string    `gorm:"size:500"`
 	Role         string    `gorm:"size:20;default:user"`
 	IsActive     bool      `gorm:"default:true"`
@@ -67,12 +67,15 @@ func main() {
 		Username:  adminUsername,
 		Email:     adminEmail,
 		Password:  string(hashedPassword),
-		StudentId: adminStudentId,
 		Role:      "admin", // 设置为管理员角色
 		IsActive:  true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	// 学号为空时保存为 NULL，唯一索引允许多个 NULL
+	if adminStudentId != "" {
+		admin.StudentId = &adminStudentId
+	}
 
 	// 保存管理员用户到数据库
 	createdAdmin, err := userRepo.Create(admin)
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/utils"
+	"strings"
+	"time"
+)
+
+// AccountService defines the interface for email verification and password recovery
+type AccountService interface {
+	// SendVerificationEmail mails a verification link to a user whose address is not yet verified
+	SendVerificationEmail(user *models.User) error
+	// ResendVerification mails a new verification link to the account with the given address, if any
+	ResendVerification(email string)
+	VerifyEmail(token string) error
+	// ForgotPassword mails a reset link to the account with the given address, if any.
+	// It behaves the same whether or not the account exists.
+	ForgotPassword(email string)
+	// ResetPassword sets a new password and signs the user out on every device
+	ResetPassword(token, password string) error
+}
+
+type accountService struct {
+	userRepo repositories.UserRepository
+	sessions SessionService
+	mailer   Mailer
+	// clientOrigin is the frontend that the links in the emails point to
+	clientOrigin string
+}
+
+// NewAccountService creates a new instance of AccountService
+func NewAccountService(userRepo repositories.UserRepository, sessions SessionService, mailer Mailer, clientOrigin string) AccountService {
+	return &accountService{
+		userRepo:     userRepo,
+		sessions:     sessions,
+		mailer:       mailer,
+		clientOrigin: strings.TrimRight(clientOrigin, "/"),
+	}
+}
+
+func (s *accountService) SendVerificationEmail(user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	token, err := utils.GenerateAccountToken(user.ID, user.Email, utils.EmailVerificationToken, "")
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s，你好：\n\n请打开下面的链接验证你的邮箱，链接24小时内有效：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件。\n",
+		user.Username, s.link("/verify-email", token))
+	return s.mailer.Send(user.Email, "验证你的邮箱", body)
+}
+
+func (s *accountService) ResendVerification(email string) {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return
+	}
+	// 异步发送，避免响应时间暴露账号是否存在
+	go func() {
+		if err := s.SendVerificationEmail(user); err != nil {
+			log.Printf("AccountService: failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}()
+}
+
+func (s *accountService) VerifyEmail(token string) error {
+	claims, err := utils.ValidateToken(token)
+	if err != nil || claims.Type != string(utils.EmailVerificationToken) {
+		return models.ErrInvalidAccountToken
+	}
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return models.ErrInvalidAccountToken
+	}
+	// 邮箱已变更的旧链接不再有效
+	if !strings.EqualFold(user.Email, claims.Email) {
+		return models.ErrInvalidAccountToken
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	_, err = s.userRepo.Update(user, "email_verified_at")
+	return err
+}
+
+func (s *accountService) ForgotPassword(email string) {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		if !errors.Is(err, repositories.ErrUserNotFound) {
+			log.Printf("AccountService: failed to look up %q for password reset: %v", email, err)
+		}
+		return
+	}
+	if !user.IsActive {
+		return
+	}
+
+	go func() {
+		token, err := utils.GenerateAccountToken(user.ID, user.Email, utils.PasswordResetToken, passwordStamp(user))
+		if err == nil {
+			body := fmt.Sprintf("%s，你好：\n\n我们收到了重置你账号密码的请求。请打开下面的链接设置新密码，链接30分钟内有效且只能使用一次：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件，你的密码不会改变。\n",
+				user.Username, s.link("/reset-password", token))
+			err = s.mailer.Send(user.Email, "重置你的密码", body)
+		}
+		if err != nil {
+			log.Printf("AccountService: failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}()
+}
+
+func (s *accountService) ResetPassword(token, password string) error {
+	claims, err := utils.ValidateToken(token)
+	if err != nil || claims.Type != string(utils.PasswordResetToken) {
+		return models.ErrInvalidAccountToken
+	}
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil || !user.IsActive {
+		return models.ErrInvalidAccountToken
+	}
+	// 密码修改后 stamp 随之变化，保证链接只能使用一次
+	if !strings.EqualFold(user.Email, claims.Email) || claims.Stamp != passwordStamp(user) {
+		return models.ErrInvalidAccountToken
+	}
+
+	user.Password = password
+	if err := user.HashPassword(); err != nil {
+		return errors.New("failed to hash password")
+	}
+	cols := []string{"password"}
+	if user.EmailVerifiedAt == nil {
+		// 能收到重置邮件说明邮箱属于该用户
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		cols = append(cols, "email_verified_at")
+	}
+	if _, err := s.userRepo.Update(user, cols...); err != nil {
+		return err
+	}
+
+	return s.sessions.EndAll(user.ID)
+}
+
+// link builds a frontend URL carrying a token
+func (s *accountService) link(path, token string) string {
+	return s.clientOrigin + path + "?token=" + url.QueryEscape(token)
+}
+
+// passwordStamp fingerprints the current password hash without revealing it
+func passwordStamp(user *models.User) string {
+	sum := sha256.Sum256([]byte(user.Password))
+	return hex.EncodeToString(sum[:8])
+}
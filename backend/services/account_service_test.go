@@ -0,0 +1,243 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"nhcommunity/config"
+	"nhcommunity/models"
+	"nhcommunity/utils"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// chanMailer hands every email it is asked to send to the test
+type chanMailer chan string
+
+func (m chanMailer) Send(to, subject, body string) error {
+	m <- body
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// token waits for the next email and returns the token in its link
+func (m chanMailer) token(t *testing.T) string {
+	t.Helper()
+	select {
+	case body := <-m:
+		match := linkToken.FindStringSubmatch(body)
+		if match == nil {
+			t.Fatalf("no link in %q", body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	case <-time.After(time.Second):
+		t.Fatal("no email sent")
+		return ""
+	}
+}
+
+// expiredAccountToken signs an account token that expired a minute ago
+func expiredAccountToken(t *testing.T, user *models.User, tokenType utils.TokenType, stamp string) string {
+	t.Helper()
+	issued := time.Now().Add(-time.Hour)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &utils.JWTClaims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Type:   string(tokenType),
+		Stamp:  stamp,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(issued),
+			NotBefore: jwt.NewNumericDate(issued),
+			Issuer:    "nhcommunity",
+		},
+	}).SignedString([]byte(config.AppConfig.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func unverifiedUser(id uint, username string) *models.User {
+	user := testUser(id, username)
+	user.EmailVerifiedAt = nil
+	return user
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		// token returns the token to present; it may change the user first
+		token   func(t *testing.T, users *fakeUserRepo, mails chanMailer, service AccountService) string
+		wantErr error
+	}{
+		{"link from the email", func(t *testing.T, users *fakeUserRepo, mails chanMailer, service AccountService) string {
+			user, _ := users.FindByID(1)
+			if err := service.SendVerificationEmail(user); err != nil {
+				t.Fatal(err)
+			}
+			return mails.token(t)
+		}, nil},
+		{"expired", func(t *testing.T, users *fakeUserRepo, mails chanMailer, service AccountService) string {
+			user, _ := users.FindByID(1)
+			return expiredAccountToken(t, user, utils.EmailVerificationToken, "")
+		}, models.ErrInvalidAccountToken},
+		{"password reset token", func(t *testing.T, users *fakeUserRepo, mails chanMailer, service AccountService) string {
+			user, _ := users.FindByID(1)
+			token, _ := utils.GenerateAccountToken(user.ID, user.Email, utils.PasswordResetToken, passwordStamp(user))
+			return token
+		}, models.ErrInvalidAccountToken},
+		{"email changed since", func(t *testing.T, users *fakeUserRepo, mails chanMailer, service AccountService) string {
+			user, _ := users.FindByID(1)
+			token, _ := utils.GenerateAccountToken(user.ID, user.Email, utils.EmailVerificationToken, "")
+			user.Email = "new@example.com"
+			users.Update(user, "email")
+			return token
+		}, models.ErrInvalidAccountToken},
+		{"tampered", func(t *testing.T, users *fakeUserRepo, mails chanMailer, service AccountService) string {
+			user, _ := users.FindByID(1)
+			token, _ := utils.GenerateAccountToken(user.ID, user.Email, utils.EmailVerificationToken, "")
+			return token[:len(token)-2] + "xx"
+		}, models.ErrInvalidAccountToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newFakeUserRepo(unverifiedUser(1, "alice"))
+			mails := make(chanMailer, 1)
+			service := NewAccountService(users, nil, mails, "https://example.com/")
+
+			token := tt.token(t, users, mails, service)
+			if err := service.VerifyEmail(token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyEmail error = %v, want %v", err, tt.wantErr)
+			}
+			user, _ := users.FindByID(1)
+			if verified := user.EmailVerifiedAt != nil; verified != (tt.wantErr == nil) {
+				t.Fatalf("verified = %v", verified)
+			}
+			if tt.wantErr == nil {
+				// opening the link again does no harm
+				if err := service.VerifyEmail(token); err != nil {
+					t.Fatalf("second VerifyEmail: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestResendVerificationSkipsVerifiedAccounts(t *testing.T) {
+	users := newFakeUserRepo(testUser(1, "alice"), unverifiedUser(2, "bob"))
+	mails := make(chanMailer, 2)
+	service := NewAccountService(users, nil, mails, "https://example.com")
+
+	service.ResendVerification("alice@example.com")
+	service.ResendVerification("nobody@example.com")
+	service.ResendVerification("bob@example.com")
+	claims, err := utils.ValidateToken(mails.token(t))
+	if err != nil || claims.UserID != 2 || claims.Type != string(utils.EmailVerificationToken) {
+		t.Fatalf("claims = %+v, %v", claims, err)
+	}
+	select {
+	case body := <-mails:
+		t.Fatalf("unexpected email %q", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	f := newSessionFixture(unverifiedUser(1, "alice"), testUser(2, "bob"))
+	mails := make(chanMailer, 1)
+	service := NewAccountService(f.users, f.service, mails, "https://example.com")
+	_, alice := f.start(t, 1)
+	_, bob := f.start(t, 2)
+
+	service.ForgotPassword("  Alice@Example.com ")
+	token := mails.token(t)
+	if err := service.ResetPassword(token, "new password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	user, _ := f.users.FindByID(1)
+	if user.CheckPassword("new password") != nil || user.CheckPassword("password") == nil {
+		t.Fatal("password not changed")
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Fatal("resetting through the emailed link does not verify the address")
+	}
+	if !f.repo.revoked(alice.SessionID) {
+		t.Fatal("sessions survive a password reset")
+	}
+	if f.repo.revoked(bob.SessionID) {
+		t.Fatal("another user's session was ended")
+	}
+
+	// the link works once
+	if err := service.ResetPassword(token, "another password"); !errors.Is(err, models.ErrInvalidAccountToken) {
+		t.Fatalf("second use error = %v", err)
+	}
+	if user, _ := f.users.FindByID(1); user.CheckPassword("new password") != nil {
+		t.Fatal("second use changed the password")
+	}
+}
+
+func TestResetPasswordRejectsTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, user *models.User) string
+	}{
+		{"expired", func(t *testing.T, user *models.User) string {
+			return expiredAccountToken(t, user, utils.PasswordResetToken, passwordStamp(user))
+		}},
+		{"verification token", func(t *testing.T, user *models.User) string {
+			token, _ := utils.GenerateAccountToken(user.ID, user.Email, utils.EmailVerificationToken, passwordStamp(user))
+			return token
+		}},
+		{"issued before the password changed", func(t *testing.T, user *models.User) string {
+			token, _ := utils.GenerateAccountToken(user.ID, user.Email, utils.PasswordResetToken, "0123456789abcdef")
+			return token
+		}},
+		{"access token", func(t *testing.T, user *models.User) string {
+			token, _ := utils.GenerateAccessToken(user.ID)
+			return token
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture(testUser(1, "alice"))
+			service := NewAccountService(f.users, f.service, discardMailer{}, "https://example.com")
+			_, claims := f.start(t, 1)
+			user, _ := f.users.FindByID(1)
+
+			if err := service.ResetPassword(tt.token(t, user), "new password"); !errors.Is(err, models.ErrInvalidAccountToken) {
+				t.Fatalf("error = %v", err)
+			}
+			if user, _ := f.users.FindByID(1); user.CheckPassword("password") != nil {
+				t.Fatal("password changed")
+			}
+			if f.repo.revoked(claims.SessionID) {
+				t.Fatal("session ended")
+			}
+		})
+	}
+}
+
+func TestForgotPasswordSkipsInactiveAccounts(t *testing.T) {
+	user := testUser(1, "alice")
+	user.IsActive = false
+	mails := make(chanMailer, 1)
+	service := NewAccountService(newFakeUserRepo(user), nil, mails, "https://example.com")
+
+	service.ForgotPassword("alice@example.com")
+	service.ForgotPassword("nobody@example.com")
+	select {
+	case body := <-mails:
+		t.Fatalf("unexpected email %q", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
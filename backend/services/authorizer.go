@@ -0,0 +1,97 @@
+package services
+
+import (
+	"log"
+	"nhcommunity/models"
+	"slices"
+	"strings"
+)
+
+// Authorizer decides what a user may do beyond acting on their own content
+type Authorizer interface {
+	// Can reports whether the user currently holds the permission. Inactive users hold none,
+	// and failures to load the user deny.
+	Can(userID uint, permission models.Permission) bool
+	// Permissions lists every permission the user currently holds
+	Permissions(userID uint) ([]models.Permission, error)
+	// IsRole reports whether role is one of the configured roles
+	IsRole(role string) bool
+	// RolesWith lists the configured roles that grant the permission
+	RolesWith(permission models.Permission) []string
+}
+
+type authorizer struct {
+	statuses UserStatusCache
+	roles    map[string]map[models.Permission]bool
+}
+
+// NewAuthorizer creates an Authorizer from a map of role to permission names, as in ROLE_PERMISSIONS.
+// Unknown permission names are logged and ignored so that a typo does not grant anything.
+func NewAuthorizer(statuses UserStatusCache, rolePermissions map[string][]string) Authorizer {
+	roles := make(map[string]map[models.Permission]bool, len(rolePermissions))
+	for role, names := range rolePermissions {
+		granted := make(map[models.Permission]bool)
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				for _, permission := range models.AllPermissions {
+					granted[permission] = true
+				}
+				continue
+			}
+			if !slices.Contains(models.AllPermissions, models.Permission(name)) {
+				log.Printf("Authorizer: ignoring unknown permission %q of role %s", name, role)
+				continue
+			}
+			granted[models.Permission(name)] = true
+		}
+		// viper 读取配置文件时会把键转为小写
+		roles[strings.ToLower(role)] = granted
+	}
+	return &authorizer{statuses: statuses, roles: roles}
+}
+
+func (a *authorizer) Can(userID uint, permission models.Permission) bool {
+	status, err := a.statuses.Get(userID)
+	if err != nil {
+		log.Printf("Authorizer: failed to load user %d: %v", userID, err)
+		return false
+	}
+	return a.grants(status, permission)
+}
+
+func (a *authorizer) Permissions(userID uint) ([]models.Permission, error) {
+	status, err := a.statuses.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := []models.Permission{}
+	for _, permission := range models.AllPermissions {
+		if a.grants(status, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, nil
+}
+
+func (a *authorizer) IsRole(role string) bool {
+	_, ok := a.roles[role]
+	return ok
+}
+
+func (a *authorizer) RolesWith(permission models.Permission) []string {
+	var roles []string
+	for role, granted := range a.roles {
+		if granted[permission] {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func (a *authorizer) grants(status UserStatus, permission models.Permission) bool {
+	if !status.IsActive || !a.roles[status.Role][permission] {
+		return false
+	}
+	return len(status.Sections) == 0 || slices.Contains(status.Sections, permission.Section())
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"nhcommunity/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuthorizerCan(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		sections   []string
+		inactive   bool
+		permission models.Permission
+		want       bool
+	}{
+		{"user cannot delete others' posts", models.RoleUser, nil, false, models.PermPostDeleteAny, false},
+		{"moderator deletes posts", models.RoleModerator, nil, false, models.PermPostDeleteAny, true},
+		{"moderator cannot edit posts", models.RoleModerator, nil, false, models.PermPostUpdateAny, false},
+		{"moderator cannot ban", models.RoleModerator, nil, false, models.PermUserBan, false},
+		{"scoped moderator in their section", models.RoleModerator, []string{"confession"}, false, models.PermConfessionReview, true},
+		{"scoped moderator outside their section", models.RoleModerator, []string{"confession"}, false, models.PermPostDeleteAny, false},
+		{"moderator of several sections", models.RoleModerator, []string{"confession", "post"}, false, models.PermPostCommentDeleteAny, true},
+		{"scope does not add permissions", models.RoleModerator, []string{"user"}, false, models.PermUserBan, false},
+		{"admin holds everything", models.RoleAdmin, nil, false, models.PermStatsView, true},
+		{"inactive admin holds nothing", models.RoleAdmin, nil, true, models.PermStatsView, false},
+		{"unconfigured role holds nothing", "janitor", nil, false, models.PermPostDeleteAny, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testUser(1, "someone")
+			user.Role = tt.role
+			user.IsActive = !tt.inactive
+			users := newFakeUserRepo(user)
+			users.sections[1] = tt.sections
+			authz := NewAuthorizer(NewUserStatusCache(users, time.Minute), models.DefaultRolePermissions)
+			if got := authz.Can(1, tt.permission); got != tt.want {
+				t.Fatalf("Can(%s) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizerMissingUser(t *testing.T) {
+	authz := NewAuthorizer(NewUserStatusCache(newFakeUserRepo(), time.Minute), models.DefaultRolePermissions)
+	if authz.Can(1, models.PermPostDeleteAny) {
+		t.Fatal("missing user holds a permission")
+	}
+	if _, err := authz.Permissions(1); err == nil {
+		t.Fatal("Permissions of a missing user did not fail")
+	}
+}
+
+func TestAuthorizerConfiguredRoles(t *testing.T) {
+	user := testUser(1, "helper")
+	user.Role = "helper"
+	users := newFakeUserRepo(user)
+	authz := NewAuthorizer(NewUserStatusCache(users, time.Minute), map[string][]string{
+		// viper lowercases the keys of a config file, so roles are matched in lowercase
+		"Helper": {" event.delete.any", "event.delete.all"},
+		"user":   {},
+	})
+
+	if !authz.IsRole("helper") || !authz.IsRole("user") || authz.IsRole("admin") {
+		t.Fatal("configured roles not recognised")
+	}
+	permissions, err := authz.Permissions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The misspelt permission is ignored rather than granting anything
+	if want := []models.Permission{models.PermEventDeleteAny}; !slices.Equal(permissions, want) {
+		t.Fatalf("Permissions = %v, want %v", permissions, want)
+	}
+}
+
+// Role and section changes apply to the next request, without waiting for a new token
+func TestRoleChangesApplyImmediately(t *testing.T) {
+	admin := testUser(1, "root")
+	admin.Role = models.RoleAdmin
+	users := newFakeUserRepo(admin, testUser(2, "mod"))
+	statuses := NewUserStatusCache(users, time.Hour)
+	authz := NewAuthorizer(statuses, models.DefaultRolePermissions)
+	service := NewUserService(users, nil, nil, nil, statuses, authz)
+
+	if authz.Can(2, models.PermPostDeleteAny) {
+		t.Fatal("user holds a moderator permission")
+	}
+	if err := service.UpdateUserRole(2, models.RoleModerator, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !authz.Can(2, models.PermPostDeleteAny) {
+		t.Fatal("promotion not applied")
+	}
+
+	if err := service.UpdateUserSections(2, []string{"event", " event"}); err != nil {
+		t.Fatal(err)
+	}
+	if authz.Can(2, models.PermPostDeleteAny) || !authz.Can(2, models.PermEventDeleteAny) {
+		t.Fatal("section scope not applied")
+	}
+	if got := users.sections[2]; !slices.Equal(got, []string{"event"}) {
+		t.Fatalf("stored sections = %v", got)
+	}
+
+	if err := service.UpdateUserSections(2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !authz.Can(2, models.PermPostDeleteAny) {
+		t.Fatal("lifting the scope not applied")
+	}
+
+	if err := service.UpdateUserRole(2, models.RoleUser, 1); err != nil {
+		t.Fatal(err)
+	}
+	if authz.Can(2, models.PermEventDeleteAny) {
+		t.Fatal("demotion not applied")
+	}
+}
+
+func TestUpdateUserRoleAndSectionsValidation(t *testing.T) {
+	users := newFakeUserRepo(testUser(1, "alice"))
+	statuses := NewUserStatusCache(users, time.Minute)
+	service := NewUserService(users, nil, nil, nil, statuses, NewAuthorizer(statuses, models.DefaultRolePermissions))
+
+	if err := service.UpdateUserRole(1, "superuser", 2); !errors.Is(err, models.ErrUnknownRole) {
+		t.Fatalf("UpdateUserRole error = %v, want %v", err, models.ErrUnknownRole)
+	}
+	if err := service.UpdateUserSections(1, []string{"post", "kitchen"}); !errors.Is(err, models.ErrUnknownSection) {
+		t.Fatalf("UpdateUserSections error = %v, want %v", err, models.ErrUnknownSection)
+	}
+	if users.sections[1] != nil {
+		t.Fatalf("invalid sections stored: %v", users.sections[1])
+	}
+	if err := service.UpdateUserSections(99, nil); err == nil {
+		t.Fatal("UpdateUserSections of a missing user did not fail")
+	}
+}
@@ -2,10 +2,12 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -25,20 +27,48 @@ var upgrader = websocket.Upgrader{
 type ChatService interface {
 	ServeWs(hub *Hub, c *gin.Context)
 	GetConversations(userID uint) ([]models.Conversation, error)
-	GetMessages(conversationID uint, limit, offset int) ([]models.Message, error)
+	// GetMessages returns the messages of a conversation the user is a member of
+	GetMessages(conversationID, userID uint, limit, offset int) ([]models.Message, error)
+	// GetMessagesAfterSeq returns the messages after a sequence number, oldest first, to fill a gap.
+	// Messages from before the user joined are left out.
+	GetMessagesAfterSeq(conversationID, userID uint, afterSeq uint64, limit int) ([]models.Message, error)
+	// Sync returns the messages of every conversation of the user that come after the client's cursors
+	// and after the user joined
+	Sync(userID uint, cursors []models.SyncCursor) (*models.SyncResult, error)
 	GetOrCreateConversation(userID1, userID2 uint) (*models.Conversation, error)
-	CreateMessage(message *models.Message) (*models.Message, error)
+	// CreateMessage stores a message. A retransmitted message, with a ClientMessageID the sender
+	// already used in the conversation, is not stored again; the original is returned and created is false.
+	CreateMessage(message *models.Message) (saved *models.Message, created bool, err error)
+	// MarkRead moves the user's read watermark in the conversation; it returns the receipt and the
+	// users to send it to, which are the senders of the newly read messages
+	MarkRead(conversationID, userID, messageID uint) (*models.ReadReceipt, []uint, error)
+	// GetTypingRecipients returns who a typing indicator of userID in the conversation is relayed to
+	GetTypingRecipients(conversationID, userID uint) ([]uint, error)
+	// GetParticipantIDs returns the users a message in the conversation is delivered to
+	GetParticipantIDs(conversationID uint) ([]uint, error)
+
+	// CreateGroup creates a named group conversation owned by ownerID
+	CreateGroup(ownerID uint, req *models.CreateGroupRequest) (*models.Conversation, error)
+	RenameGroup(conversationID, userID uint, name string) error
+	AddMembers(conversationID, userID uint, memberIDs []uint) error
+	// RemoveMember removes memberID from the group; members may always remove themselves to leave
+	RemoveMember(conversationID, userID, memberID uint) error
+	UpdateMemberRole(conversationID, userID, memberID uint, role string) error
 }
 
 type chatService struct {
-	db   *gorm.DB
-	repo repositories.ChatRepository
+	db            *gorm.DB
+	repo          repositories.ChatRepository
+	blocks        repositories.BlockRepository
+	notifications NotificationService
 }
 
-func NewChatService(db *gorm.DB, repo repositories.ChatRepository) ChatService {
+func NewChatService(db *gorm.DB, repo repositories.ChatRepository, blocks repositories.BlockRepository, notifications NotificationService) ChatService {
 	return &chatService{
-		db:   db,
-		repo: repo,
+		db:            db,
+		repo:          repo,
+		blocks:        blocks,
+		notifications: notifications,
 	}
 }
 
@@ -92,11 +122,72 @@ func (s *chatService) GetConversations(userID uint) ([]models.Conversation, erro
 	return s.repo.GetConversationsByUserID(userID)
 }
 
-func (s *chatService) GetMessages(conversationID uint, limit, offset int) ([]models.Message, error) {
-	return s.repo.GetMessagesByConversationID(conversationID, limit, offset)
+func (s *chatService) GetMessages(conversationID, userID uint, limit, offset int) ([]models.Message, error) {
+	// 非成员与不存在的会话返回相同的错误，避免通过 ID 探测他人会话
+	member, err := s.repo.FindParticipant(conversationID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ErrConversationNotFound
+		}
+		return nil, err
+	}
+	// 加入之前的消息不可见
+	return s.repo.GetMessagesByConversationID(conversationID, member.JoinedSeq, limit, offset)
+}
+
+func (s *chatService) GetMessagesAfterSeq(conversationID, userID uint, afterSeq uint64, limit int) ([]models.Message, error) {
+	member, err := s.repo.FindParticipant(conversationID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ErrConversationNotFound
+		}
+		return nil, err
+	}
+	return s.repo.GetMessagesAfterSeq(conversationID, max(afterSeq, member.JoinedSeq), limit)
+}
+
+func (s *chatService) Sync(userID uint, cursors []models.SyncCursor) (*models.SyncResult, error) {
+	known := make(map[uint]uint64, len(cursors))
+	for _, cursor := range cursors {
+		known[cursor.ConversationID] = cursor.LastSeq
+	}
+
+	current, err := s.repo.GetConversationSeqs(userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.SyncResult{Conversations: []models.SyncedConversation{}}
+	for _, conversation := range current {
+		// 加入之前的消息不补发
+		lastSeq := max(known[conversation.ConversationID], conversation.JoinedSeq)
+		if conversation.LastSeq <= lastSeq {
+			continue
+		}
+		// 多取一条用于判断是否还有更多消息
+		messages, err := s.repo.GetMessagesAfterSeq(conversation.ConversationID, lastSeq, models.MaxSyncMessages+1)
+		if err != nil {
+			return nil, err
+		}
+		synced := models.SyncedConversation{ConversationID: conversation.ConversationID, LastSeq: conversation.LastSeq}
+		if len(messages) > models.MaxSyncMessages {
+			messages = messages[:models.MaxSyncMessages]
+			synced.HasMore = true
+		}
+		synced.Messages = messages
+		result.Conversations = append(result.Conversations, synced)
+	}
+	return result, nil
 }
 
 func (s *chatService) GetOrCreateConversation(userID1, userID2 uint) (*models.Conversation, error) {
+	blocked, err := s.blocks.IsBlocked(userID1, userID2)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, models.ErrUserBlocked
+	}
+
 	convo, err := s.repo.FindConversationBetweenUsers(userID1, userID2)
 	if err == nil && convo != nil {
 		return convo, nil // Found existing conversation
@@ -104,15 +195,323 @@ func (s *chatService) GetOrCreateConversation(userID1, userID2 uint) (*models.Co
 
 	// If not found, create a new one
 	if errors.Is(err, gorm.ErrRecordNotFound) || convo == nil {
-		newConvo := &models.Conversation{
-			Participants: []models.User{{ID: userID1}, {ID: userID2}},
+		newConvo := &models.Conversation{Type: models.ConversationDirect}
+		members := []models.ConversationParticipant{
+			{UserID: userID1, Role: models.ConversationRoleMember},
+			{UserID: userID2, Role: models.ConversationRoleMember},
 		}
-		return s.repo.CreateConversation(newConvo)
+		return s.repo.CreateConversation(newConvo, members)
 	}
 
 	return nil, err // Other database error
 }
 
-func (s *chatService) CreateMessage(message *models.Message) (*models.Message, error) {
-	return s.repo.CreateMessage(message)
+func (s *chatService) CreateMessage(message *models.Message) (*models.Message, bool, error) {
+	if message.ClientMessageID != nil && len(*message.ClientMessageID) > models.MaxClientMessageIDLength {
+		return nil, false, models.ErrClientMessageIDTooLong
+	}
+	convo, err := s.repo.GetConversationByID(message.ConversationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, models.ErrConversationNotFound
+		}
+		return nil, false, err
+	}
+	// 非成员（包括已退出群聊的成员）不能发送消息
+	if _, ok := convo.Member(message.SenderID); !ok {
+		return nil, false, models.ErrConversationNotFound
+	}
+	// 任意一方拉黑后，已有私聊中也不能再发送消息；群聊不受影响
+	for _, participant := range convo.Participants {
+		if participant.ID == message.SenderID || convo.Type == models.ConversationGroup {
+			continue
+		}
+		blocked, err := s.blocks.IsBlocked(message.SenderID, participant.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		if blocked {
+			return nil, false, models.ErrUserBlocked
+		}
+	}
+
+	savedMessage, created, err := s.repo.CreateMessage(message)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		// 重发的消息已经通知过了
+		return savedMessage, false, nil
+	}
+
+	// 群聊消息只计入会话的未读数，不为每个成员生成通知
+	if convo.Type == models.ConversationGroup {
+		return savedMessage, true, nil
+	}
+	for _, participant := range convo.Participants {
+		if participant.ID == savedMessage.SenderID {
+			continue
+		}
+		// 未读消息已有通知时不再重复提醒，会话本身记录未读数
+		notification := &models.Notification{
+			UserID:       participant.ID,
+			SenderID:     &savedMessage.SenderID,
+			Title:        "New message",
+			Message:      savedMessage.Content,
+			Type:         models.NotificationMessage,
+			ResourceType: "conversation",
+			ResourceID:   convo.ID,
+		}
+		if err := s.notifications.NotifyOnce(notification); err != nil {
+			log.Printf("ChatService: failed to create notification for user %d: %v", participant.ID, err)
+		}
+	}
+	return savedMessage, true, nil
+}
+
+func (s *chatService) MarkRead(conversationID, userID, messageID uint) (*models.ReadReceipt, []uint, error) {
+	previous, current, err := s.repo.MarkRead(conversationID, userID, messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, models.ErrConversationNotFound
+		}
+		return nil, nil, err
+	}
+	receipt := &models.ReadReceipt{
+		ConversationID:    conversationID,
+		UserID:            userID,
+		LastReadMessageID: current,
+		ReadAt:            time.Now(),
+	}
+	if current == previous {
+		return receipt, nil, nil
+	}
+
+	senderIDs, err := s.repo.FindSenderIDs(conversationID, previous, current, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return receipt, senderIDs, nil
+}
+
+func (s *chatService) GetTypingRecipients(conversationID, userID uint) ([]uint, error) {
+	convo, err := s.repo.GetConversationByID(conversationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ErrConversationNotFound
+		}
+		return nil, err
+	}
+	if _, ok := convo.Member(userID); !ok {
+		return nil, models.ErrConversationNotFound
+	}
+
+	var recipientIDs []uint
+	for _, member := range convo.Members {
+		if member.UserID == userID {
+			continue
+		}
+		if convo.Type == models.ConversationDirect {
+			blocked, err := s.blocks.IsBlocked(userID, member.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if blocked {
+				return nil, models.ErrUserBlocked
+			}
+		}
+		recipientIDs = append(recipientIDs, member.UserID)
+	}
+	return recipientIDs, nil
+}
+
+func (s *chatService) GetParticipantIDs(conversationID uint) ([]uint, error) {
+	return s.repo.GetParticipantIDs(conversationID)
+}
+
+func (s *chatService) CreateGroup(ownerID uint, req *models.CreateGroupRequest) (*models.Conversation, error) {
+	memberIDs := uniqueMemberIDs(req.MemberIDs, ownerID)
+	if len(memberIDs)+1 > models.MaxGroupMembers {
+		return nil, models.ErrGroupFull
+	}
+	if err := s.checkNewMembers(ownerID, memberIDs); err != nil {
+		return nil, err
+	}
+
+	convo := &models.Conversation{Type: models.ConversationGroup, Name: req.Name}
+	members := []models.ConversationParticipant{{UserID: ownerID, Role: models.ConversationRoleOwner}}
+	for _, memberID := range memberIDs {
+		members = append(members, models.ConversationParticipant{UserID: memberID, Role: models.ConversationRoleMember})
+	}
+	if _, err := s.repo.CreateConversation(convo, members); err != nil {
+		return nil, err
+	}
+
+	s.notifyAdded(convo, ownerID, memberIDs)
+	return s.repo.GetConversationByID(convo.ID)
+}
+
+func (s *chatService) RenameGroup(conversationID, userID uint, name string) error {
+	convo, member, err := s.getGroupMember(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !member.CanManage() {
+		return errors.New("permission denied")
+	}
+	return s.repo.RenameConversation(convo.ID, name)
+}
+
+func (s *chatService) AddMembers(conversationID, userID uint, memberIDs []uint) error {
+	convo, member, err := s.getGroupMember(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !member.CanManage() {
+		return errors.New("permission denied")
+	}
+
+	var newIDs []uint
+	for _, memberID := range uniqueMemberIDs(memberIDs, userID) {
+		if _, ok := convo.Member(memberID); !ok {
+			newIDs = append(newIDs, memberID)
+		}
+	}
+	if len(newIDs) == 0 {
+		return nil
+	}
+	if len(convo.Members)+len(newIDs) > models.MaxGroupMembers {
+		return models.ErrGroupFull
+	}
+	if err := s.checkNewMembers(userID, newIDs); err != nil {
+		return err
+	}
+	if err := s.repo.AddParticipants(convo.ID, newIDs, models.ConversationRoleMember); err != nil {
+		return err
+	}
+
+	s.notifyAdded(convo, userID, newIDs)
+	return nil
+}
+
+func (s *chatService) RemoveMember(conversationID, userID, memberID uint) error {
+	convo, member, err := s.getGroupMember(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if memberID == userID {
+		return s.repo.RemoveParticipant(convo.ID, memberID)
+	}
+
+	target, ok := convo.Member(memberID)
+	if !ok {
+		return errors.New("user not found")
+	}
+	// 管理员只能移除普通成员，群主可以移除任何人
+	if !member.CanManage() || (member.Role == models.ConversationRoleAdmin && target.Role != models.ConversationRoleMember) {
+		return errors.New("permission denied")
+	}
+	return s.repo.RemoveParticipant(convo.ID, memberID)
+}
+
+func (s *chatService) UpdateMemberRole(conversationID, userID, memberID uint, role string) error {
+	convo, member, err := s.getGroupMember(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.ConversationRoleOwner {
+		return errors.New("permission denied")
+	}
+	if _, ok := convo.Member(memberID); !ok {
+		return errors.New("user not found")
+	}
+	if memberID == userID {
+		// 群主只能通过转让群主身份来更换角色
+		return errors.New("permission denied")
+	}
+
+	switch role {
+	case models.ConversationRoleOwner:
+		return s.repo.TransferOwnership(convo.ID, userID, memberID)
+	case models.ConversationRoleAdmin, models.ConversationRoleMember:
+		return s.repo.UpdateParticipantRole(convo.ID, memberID, role)
+	default:
+		return models.ErrInvalidConversationRole
+	}
+}
+
+// getGroupMember loads a group conversation and the membership of userID in it. Conversations the
+// user is not a member of are reported as not found.
+func (s *chatService) getGroupMember(conversationID, userID uint) (*models.Conversation, models.ConversationParticipant, error) {
+	convo, err := s.repo.GetConversationByID(conversationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ConversationParticipant{}, models.ErrConversationNotFound
+		}
+		return nil, models.ConversationParticipant{}, err
+	}
+	member, ok := convo.Member(userID)
+	if !ok {
+		return nil, models.ConversationParticipant{}, models.ErrConversationNotFound
+	}
+	if convo.Type != models.ConversationGroup {
+		return nil, models.ConversationParticipant{}, models.ErrNotGroupConversation
+	}
+	return convo, member, nil
+}
+
+// checkNewMembers makes sure the users exist and that none of them has a block with the user adding them
+func (s *chatService) checkNewMembers(userID uint, memberIDs []uint) error {
+	existing, err := s.repo.FindUserIDs(memberIDs)
+	if err != nil {
+		return err
+	}
+	if len(existing) != len(memberIDs) {
+		return errors.New("user not found")
+	}
+	for _, memberID := range memberIDs {
+		blocked, err := s.blocks.IsBlocked(userID, memberID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return models.ErrUserBlocked
+		}
+	}
+	return nil
+}
+
+// notifyAdded tells the new members of a group who added them
+func (s *chatService) notifyAdded(convo *models.Conversation, userID uint, memberIDs []uint) {
+	for _, memberID := range memberIDs {
+		s.notify(&models.Notification{
+			UserID:       memberID,
+			SenderID:     &userID,
+			Title:        "Added to group",
+			Message:      fmt.Sprintf("You were added to %s", convo.Name),
+			Type:         models.NotificationMessage,
+			ResourceType: "conversation",
+			ResourceID:   convo.ID,
+		})
+	}
+}
+
+// notify delivers a notification without failing the action that triggered it.
+func (s *chatService) notify(notification *models.Notification) {
+	if err := s.notifications.Notify(notification); err != nil {
+		log.Printf("ChatService: failed to create notification for user %d: %v", notification.UserID, err)
+	}
+}
+
+// uniqueMemberIDs drops duplicates, zero IDs and userID itself from a list of members to add
+func uniqueMemberIDs(memberIDs []uint, userID uint) []uint {
+	seen := map[uint]bool{0: true, userID: true}
+	unique := make([]uint, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		if !seen[memberID] {
+			seen[memberID] = true
+			unique = append(unique, memberID)
+		}
+	}
+	return unique
 }
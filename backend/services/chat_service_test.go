@@ -0,0 +1,503 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// fakeChatRepo keeps conversations in memory. Methods the tests do not need are left to the embedded
+// interface, so calling them panics.
+type fakeChatRepo struct {
+	repositories.ChatRepository
+
+	mu       sync.Mutex
+	types    map[uint]string                                  // conversation type by conversation
+	members  map[uint]map[uint]models.ConversationParticipant // current members by conversation
+	messages map[uint][]models.Message                        // messages by conversation, oldest first
+	nextID   uint
+}
+
+func newFakeChatRepo() *fakeChatRepo {
+	return &fakeChatRepo{
+		types:    make(map[uint]string),
+		members:  make(map[uint]map[uint]models.ConversationParticipant),
+		messages: make(map[uint][]models.Message),
+	}
+}
+
+// join adds users to a conversation, which is a group unless it is created with exactly two members
+func (r *fakeChatRepo) join(conversationID uint, userIDs ...uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.members[conversationID] == nil {
+		r.members[conversationID] = make(map[uint]models.ConversationParticipant)
+		r.types[conversationID] = models.ConversationGroup
+		if len(userIDs) == 2 {
+			r.types[conversationID] = models.ConversationDirect
+		}
+	}
+	for _, userID := range userIDs {
+		r.members[conversationID][userID] = models.ConversationParticipant{
+			ConversationID: conversationID,
+			UserID:         userID,
+			Role:           models.ConversationRoleMember,
+		}
+	}
+}
+
+func (r *fakeChatRepo) send(conversationID, senderID uint, content string) {
+	r.CreateMessage(&models.Message{ConversationID: conversationID, SenderID: senderID, Content: content})
+}
+
+func (r *fakeChatRepo) GetConversationByID(conversationID uint) (*models.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members, ok := r.members[conversationID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	conversation := &models.Conversation{ID: conversationID, Type: r.types[conversationID]}
+	for userID, member := range members {
+		conversation.Participants = append(conversation.Participants, models.User{ID: userID})
+		conversation.Members = append(conversation.Members, member)
+	}
+	return conversation, nil
+}
+
+func (r *fakeChatRepo) FindConversationBetweenUsers(userID1, userID2 uint) (*models.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for conversationID, members := range r.members {
+		_, ok1 := members[userID1]
+		_, ok2 := members[userID2]
+		if r.types[conversationID] == models.ConversationDirect && ok1 && ok2 {
+			return &models.Conversation{ID: conversationID, Type: models.ConversationDirect}, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeChatRepo) GetParticipantIDs(conversationID uint) ([]uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var userIDs []uint
+	for userID := range r.members[conversationID] {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+func (r *fakeChatRepo) RemoveParticipant(conversationID, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.members[conversationID], userID)
+	return nil
+}
+
+// setRole gives a member of a conversation a role
+func (r *fakeChatRepo) setRole(conversationID, userID uint, role string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	member := r.members[conversationID][userID]
+	member.Role = role
+	r.members[conversationID][userID] = member
+}
+
+// role returns the role of a member of a conversation, or "" for users who are not a member
+func (r *fakeChatRepo) role(conversationID, userID uint) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.members[conversationID][userID].Role
+}
+
+func (r *fakeChatRepo) UpdateParticipantRole(conversationID, userID uint, role string) error {
+	r.setRole(conversationID, userID, role)
+	return nil
+}
+
+func (r *fakeChatRepo) TransferOwnership(conversationID, fromID, toID uint) error {
+	r.setRole(conversationID, fromID, models.ConversationRoleAdmin)
+	r.setRole(conversationID, toID, models.ConversationRoleOwner)
+	return nil
+}
+
+func (r *fakeChatRepo) CreateMessage(message *models.Message) (*models.Message, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	message.ID = r.nextID
+	message.Seq = uint64(len(r.messages[message.ConversationID])) + 1
+	message.CreatedAt = time.Now()
+	r.messages[message.ConversationID] = append(r.messages[message.ConversationID], *message)
+	return message, true, nil
+}
+
+func (r *fakeChatRepo) MarkRead(conversationID, userID, messageID uint) (previous, current uint, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	member, ok := r.members[conversationID][userID]
+	if !ok {
+		return 0, 0, gorm.ErrRecordNotFound
+	}
+	var latest uint
+	for _, message := range r.messages[conversationID] {
+		latest = max(latest, message.ID)
+	}
+	target := latest
+	if messageID != 0 && messageID < latest {
+		target = messageID
+	}
+	previous = member.LastReadMessageID
+	member.LastReadMessageID = max(previous, target)
+	r.members[conversationID][userID] = member
+	return previous, member.LastReadMessageID, nil
+}
+
+func (r *fakeChatRepo) FindSenderIDs(conversationID, afterID, uptoID, userID uint) ([]uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := map[uint]bool{userID: true}
+	var senderIDs []uint
+	for _, message := range r.messages[conversationID] {
+		if message.ID > afterID && message.ID <= uptoID && !seen[message.SenderID] {
+			seen[message.SenderID] = true
+			senderIDs = append(senderIDs, message.SenderID)
+		}
+	}
+	return senderIDs, nil
+}
+
+// fakeBlocks is a block list holding pairs of blocker and blocked user
+type fakeBlocks struct {
+	repositories.BlockRepository
+	pairs [][2]uint
+}
+
+func (b fakeBlocks) IsBlocked(userID, otherID uint) (bool, error) {
+	for _, pair := range b.pairs {
+		if pair == [2]uint{userID, otherID} || pair == [2]uint{otherID, userID} {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (fakeBlocks) IsMuted(muterID, mutedID uint) (bool, error) { return false, nil }
+
+// discardNotifications drops the notifications of new messages
+type discardNotifications struct {
+	NotificationService
+}
+
+func (discardNotifications) Notify(notification *models.Notification) error     { return nil }
+func (discardNotifications) NotifyOnce(notification *models.Notification) error { return nil }
+
+// newChatServer serves the websocket of the chat service on a running hub; the X-User header
+// stands in for the user the auth middleware would set
+func newChatServer(t *testing.T, service ChatService) (*Hub, *httptest.Server) {
+	t.Helper()
+	hub := NewHub()
+	go hub.Run()
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		userID, _ := strconv.ParseUint(c.GetHeader("X-User"), 10, 64)
+		c.Set("user_id", uint(userID))
+		service.ServeWs(hub, c)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return hub, server
+}
+
+// connections returns how many connections of the user are registered with the hub
+func (h *Hub) connections(userID uint) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[userID])
+}
+
+// connect opens a websocket of the user and waits until the hub has registered it, so that it
+// receives everything sent afterwards
+func connect(t *testing.T, hub *Hub, server *httptest.Server, userID uint) *websocket.Conn {
+	t.Helper()
+	registered := hub.connections(userID) + 1
+	header := http.Header{"X-User": []string{strconv.FormatUint(uint64(userID), 10)}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	for deadline := time.Now().Add(5 * time.Second); hub.connections(userID) < registered; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection of user %d is not registered", userID)
+		}
+	}
+	return conn
+}
+
+func writeFrame(t *testing.T, conn *websocket.Conn, frameType string, payload interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(models.WebsocketMessage{Type: frameType, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads the next frame, which must be of the given type, into payload
+func readFrame(t *testing.T, conn *websocket.Conn, frameType string, payload interface{}) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("waiting for %s: %v", frameType, err)
+	}
+	if frame.Type != frameType {
+		t.Fatalf("received %s %s, want %s", frame.Type, frame.Payload, frameType)
+	}
+	if err := json.Unmarshal(frame.Payload, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A member who left a group no longer receives what is said in it
+func TestGroupMessagesSkipMembersWhoLeft(t *testing.T) {
+	const alice, bob, carol = 1, 2, 3
+	repo := newFakeChatRepo()
+	repo.join(1, alice, carol)
+	repo.join(2, alice, bob, carol)
+	service := NewChatService(nil, repo, fakeBlocks{}, discardNotifications{})
+	hub, server := newChatServer(t, service)
+	sender, member, leaver := connect(t, hub, server, alice), connect(t, hub, server, bob), connect(t, hub, server, carol)
+
+	if err := service.RemoveMember(2, carol, carol); err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(t, sender, models.WSTypeGroupMessage, models.GroupMessagePayload{ConversationID: 2, Content: "carol is gone"})
+	var message models.Message
+	readFrame(t, member, models.WSTypeIncomingGroupMessage, &message)
+	if message.ConversationID != 2 || message.Content != "carol is gone" {
+		t.Fatalf("bob received %+v", message)
+	}
+
+	// Messages are delivered in order, so if the group message had reached carol it would come first
+	writeFrame(t, sender, models.WSTypePrivateMessage, models.PrivateMessagePayload{RecipientID: carol, Content: "just you"})
+	readFrame(t, leaver, models.WSTypeIncomingPrivateMessage, &message)
+	if message.Content != "just you" {
+		t.Fatalf("carol received %+v", message)
+	}
+}
+
+// A read receipt goes to whoever sent the messages that were just read
+func TestReadReceipts(t *testing.T) {
+	const alice, bob, carol = 1, 2, 3
+	repo := newFakeChatRepo()
+	repo.join(2, alice, bob, carol)
+	repo.send(2, alice, "one")
+	repo.send(2, carol, "two")
+	repo.send(2, alice, "three")
+	hub, server := newChatServer(t, NewChatService(nil, repo, fakeBlocks{}, discardNotifications{}))
+	sockets := map[uint]*websocket.Conn{}
+	for _, userID := range []uint{alice, bob, carol} {
+		sockets[userID] = connect(t, hub, server, userID)
+	}
+
+	steps := []struct {
+		name      string
+		reader    uint
+		messageID uint
+		// receipts are the users who get a receipt, which must be the next frame they receive
+		receipts []uint
+		want     uint
+	}{
+		{"up to a message", bob, 1, []uint{alice}, 1},
+		// only the messages after the watermark count, so alice is told again but carol for the first time
+		{"everything", bob, 0, []uint{alice, carol}, 3},
+		{"another reader", carol, 0, []uint{alice}, 3},
+	}
+	for _, step := range steps {
+		writeFrame(t, sockets[step.reader], models.WSTypeMarkRead, models.MarkReadPayload{ConversationID: 2, MessageID: step.messageID})
+		for _, userID := range step.receipts {
+			var receipt models.ReadReceipt
+			readFrame(t, sockets[userID], models.WSTypeReadReceipt, &receipt)
+			if receipt.ConversationID != 2 || receipt.UserID != step.reader || receipt.LastReadMessageID != step.want {
+				t.Fatalf("%s: user %d received %+v, want user %d read up to %d", step.name, userID, receipt, step.reader, step.want)
+			}
+		}
+	}
+}
+
+// Replying reads the conversation, so whoever wrote the messages before the reply gets a receipt
+func TestReplyingSendsReadReceipt(t *testing.T) {
+	const alice, bob = 1, 2
+	repo := newFakeChatRepo()
+	repo.join(1, alice, bob)
+	hub, server := newChatServer(t, NewChatService(nil, repo, fakeBlocks{}, discardNotifications{}))
+	replier, sender := connect(t, hub, server, alice), connect(t, hub, server, bob)
+
+	writeFrame(t, sender, models.WSTypePrivateMessage, models.PrivateMessagePayload{RecipientID: alice, Content: "lunch?"})
+	var ack models.MessageAck
+	readFrame(t, sender, models.WSTypeAck, &ack)
+	var message models.Message
+	readFrame(t, replier, models.WSTypeIncomingPrivateMessage, &message)
+	// alice answers without sending mark_read first
+	writeFrame(t, replier, models.WSTypePrivateMessage, models.PrivateMessagePayload{RecipientID: bob, Content: "sure"})
+
+	readFrame(t, sender, models.WSTypeIncomingPrivateMessage, &message)
+	if message.Content != "sure" {
+		t.Fatalf("bob received %+v", message)
+	}
+	var receipt models.ReadReceipt
+	readFrame(t, sender, models.WSTypeReadReceipt, &receipt)
+	if receipt.ConversationID != 1 || receipt.UserID != alice || receipt.LastReadMessageID != message.ID {
+		t.Fatalf("bob received %+v, want alice read up to %d", receipt, message.ID)
+	}
+}
+
+// A block in either direction stops new direct conversations and messages in existing ones
+func TestChatRefusedWhenBlocked(t *testing.T) {
+	const alice, bob = 1, 2
+	for _, pair := range [][2]uint{{alice, bob}, {bob, alice}} {
+		repo := newFakeChatRepo()
+		repo.join(1, alice, bob)
+		service := NewChatService(nil, repo, fakeBlocks{pairs: [][2]uint{pair}}, discardNotifications{})
+
+		if _, err := service.GetOrCreateConversation(alice, bob); !errors.Is(err, models.ErrUserBlocked) {
+			t.Fatalf("%d blocked %d: GetOrCreateConversation error = %v, want %v", pair[0], pair[1], err, models.ErrUserBlocked)
+		}
+		for _, sender := range []uint{alice, bob} {
+			_, _, err := service.CreateMessage(&models.Message{ConversationID: 1, SenderID: sender, Content: "hi"})
+			if !errors.Is(err, models.ErrUserBlocked) {
+				t.Fatalf("%d blocked %d: message from %d error = %v, want %v", pair[0], pair[1], sender, err, models.ErrUserBlocked)
+			}
+		}
+		if len(repo.messages[1]) != 0 {
+			t.Fatalf("%d blocked %d: messages stored", pair[0], pair[1])
+		}
+	}
+
+	// group conversations are not affected
+	repo := newFakeChatRepo()
+	repo.join(1, alice, bob, 3)
+	service := NewChatService(nil, repo, fakeBlocks{pairs: [][2]uint{{alice, bob}}}, discardNotifications{})
+	if _, _, err := service.CreateMessage(&models.Message{ConversationID: 1, SenderID: alice, Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Only direct messages create notifications; group messages are counted as unread in the conversation
+func TestGroupMessagesAreNotNotified(t *testing.T) {
+	const alice, bob, carol = 1, 2, 3
+	repo := newFakeChatRepo()
+	repo.join(1, alice, bob)
+	repo.join(2, alice, bob, carol)
+	notifications := &recordedNotifications{}
+	service := NewChatService(nil, repo, fakeBlocks{}, notifications)
+
+	for _, conversationID := range []uint{2, 1, 2} {
+		if _, _, err := service.CreateMessage(&models.Message{ConversationID: conversationID, SenderID: alice, Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifications.sent) != 1 {
+		t.Fatalf("%d notifications sent, want 1: %+v", len(notifications.sent), notifications.sent)
+	}
+	if sent := notifications.sent[0]; sent.UserID != bob || sent.ResourceID != 1 || sent.Type != models.NotificationMessage {
+		t.Fatalf("sent %+v", sent)
+	}
+}
+
+// Admins manage plain members, only the owner manages admins and roles, and nobody promotes themselves
+func TestGroupMemberPermissions(t *testing.T) {
+	const owner, admin, otherAdmin, member, otherMember, outsider = 1, 2, 3, 4, 5, 6
+	denied := errors.New("permission denied")
+	tests := []struct {
+		name    string
+		act     func(service ChatService) error
+		wantErr error
+		// roles are the expected roles afterwards, "" for users who are no longer members
+		roles map[uint]string
+	}{
+		{"admin removes the owner", func(s ChatService) error { return s.RemoveMember(1, admin, owner) }, denied,
+			map[uint]string{owner: models.ConversationRoleOwner}},
+		{"admin removes another admin", func(s ChatService) error { return s.RemoveMember(1, admin, otherAdmin) }, denied,
+			map[uint]string{otherAdmin: models.ConversationRoleAdmin}},
+		{"admin removes a member", func(s ChatService) error { return s.RemoveMember(1, admin, member) }, nil,
+			map[uint]string{member: ""}},
+		{"member removes a member", func(s ChatService) error { return s.RemoveMember(1, member, otherMember) }, denied,
+			map[uint]string{otherMember: models.ConversationRoleMember}},
+		{"owner removes an admin", func(s ChatService) error { return s.RemoveMember(1, owner, admin) }, nil,
+			map[uint]string{admin: ""}},
+		{"member leaves", func(s ChatService) error { return s.RemoveMember(1, member, member) }, nil,
+			map[uint]string{member: ""}},
+		{"outsider removes a member", func(s ChatService) error { return s.RemoveMember(1, outsider, member) }, models.ErrConversationNotFound,
+			map[uint]string{member: models.ConversationRoleMember}},
+		{"member promotes themselves", func(s ChatService) error {
+			return s.UpdateMemberRole(1, member, member, models.ConversationRoleAdmin)
+		}, denied, map[uint]string{member: models.ConversationRoleMember}},
+		{"admin promotes a member", func(s ChatService) error {
+			return s.UpdateMemberRole(1, admin, member, models.ConversationRoleAdmin)
+		}, denied, map[uint]string{member: models.ConversationRoleMember}},
+		{"admin demotes the owner", func(s ChatService) error {
+			return s.UpdateMemberRole(1, admin, owner, models.ConversationRoleMember)
+		}, denied, map[uint]string{owner: models.ConversationRoleOwner}},
+		{"owner promotes a member", func(s ChatService) error {
+			return s.UpdateMemberRole(1, owner, member, models.ConversationRoleAdmin)
+		}, nil, map[uint]string{member: models.ConversationRoleAdmin}},
+		{"owner demotes an admin", func(s ChatService) error {
+			return s.UpdateMemberRole(1, owner, admin, models.ConversationRoleMember)
+		}, nil, map[uint]string{admin: models.ConversationRoleMember}},
+		{"owner demotes themselves", func(s ChatService) error {
+			return s.UpdateMemberRole(1, owner, owner, models.ConversationRoleMember)
+		}, denied, map[uint]string{owner: models.ConversationRoleOwner}},
+		{"owner gives an unknown role", func(s ChatService) error {
+			return s.UpdateMemberRole(1, owner, member, "moderator")
+		}, models.ErrInvalidConversationRole, map[uint]string{member: models.ConversationRoleMember}},
+		{"owner transfers ownership", func(s ChatService) error {
+			return s.UpdateMemberRole(1, owner, member, models.ConversationRoleOwner)
+		}, nil, map[uint]string{owner: models.ConversationRoleAdmin, member: models.ConversationRoleOwner}},
+		{"admin transfers ownership to themselves", func(s ChatService) error {
+			return s.UpdateMemberRole(1, admin, admin, models.ConversationRoleOwner)
+		}, denied, map[uint]string{owner: models.ConversationRoleOwner, admin: models.ConversationRoleAdmin}},
+		{"member takes ownership", func(s ChatService) error {
+			return s.UpdateMemberRole(1, member, member, models.ConversationRoleOwner)
+		}, denied, map[uint]string{owner: models.ConversationRoleOwner, member: models.ConversationRoleMember}},
+		{"owner transfers ownership to an outsider", func(s ChatService) error {
+			return s.UpdateMemberRole(1, owner, outsider, models.ConversationRoleOwner)
+		}, errors.New("user not found"), map[uint]string{owner: models.ConversationRoleOwner, outsider: ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeChatRepo()
+			repo.join(1, owner, admin, otherAdmin, member, otherMember)
+			repo.setRole(1, owner, models.ConversationRoleOwner)
+			repo.setRole(1, admin, models.ConversationRoleAdmin)
+			repo.setRole(1, otherAdmin, models.ConversationRoleAdmin)
+			service := NewChatService(nil, repo, fakeBlocks{}, discardNotifications{})
+
+			err := tt.act(service)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			for userID, want := range tt.roles {
+				if got := repo.role(1, userID); got != want {
+					t.Fatalf("user %d has role %q, want %q", userID, got, want)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
 
@@ -10,58 +12,74 @@ import (
 
 // ConfessionService defines the interface for confession business logic
 type ConfessionService interface {
-	GetApprovedConfessions(limit, offset int) ([]models.ConfessionResponse, error)
-	GetConfessionByID(id, currentUserID uint) (*models.ConfessionResponse, error)
+	// GetApprovedConfessions lists approved confessions; viewerID is 0 for anonymous visitors
+	GetApprovedConfessions(viewerID uint, page models.PageQuery) (models.Page[models.ConfessionResponse], error)
+	// GetConfessionByID returns the confession and counts a view of it by viewer, see ViewCounter
+	GetConfessionByID(id, currentUserID uint, viewer string) (*models.ConfessionResponse, error)
 	CreateConfession(req *models.Confession, userID uint) (*models.ConfessionResponse, error)
 	UpdateConfessionStatus(id uint, status string, isApproved bool) error
-	DeleteConfession(id, userID uint, userRole string) error
+	DeleteConfession(id, userID uint) error
 
 	LikeConfession(confessionID, userID uint) error
 	UnlikeConfession(confessionID, userID uint) error
 
 	CreateComment(confessionID, userID uint, content string, isAnonymous bool) (*models.ConfessionCommentResponse, error)
 	UpdateComment(commentID, userID uint, content string, isAnonymous bool) (*models.ConfessionCommentResponse, error)
-	DeleteComment(commentID, userID uint, userRole string) error
+	DeleteComment(commentID, userID uint) error
 
 	// 管理员相关函数
-	GetConfessionsByStatus(status string, limit, offset int) ([]models.Confession, error)
+	GetConfessionsByStatus(status string, page models.PageQuery) (models.Page[models.Confession], error)
 	GetConfessionStats() (int64, int64, int64, error) // 返回待审核、已批准、已拒绝的数量
 	GetDB() *gorm.DB
 }
 
 type confessionService struct {
-	repo repositories.ConfessionRepository
-	db   *gorm.DB
+	repo          repositories.ConfessionRepository
+	db            *gorm.DB
+	blocks        repositories.BlockRepository
+	notifications NotificationService
+	authz         Authorizer
+	views         ViewCounter
 }
 
 // NewConfessionService creates a new instance of ConfessionService
-func NewConfessionService(repo repositories.ConfessionRepository) ConfessionService {
+func NewConfessionService(repo repositories.ConfessionRepository, blocks repositories.BlockRepository, notifications NotificationService, authz Authorizer, views ViewCounter) ConfessionService {
 	return &confessionService{
-		repo: repo,
-		db:   repo.GetDB(),
+		repo:          repo,
+		db:            repo.GetDB(),
+		blocks:        blocks,
+		notifications: notifications,
+		authz:         authz,
+		views:         views,
 	}
 }
 
-func (s *confessionService) GetApprovedConfessions(limit, offset int) ([]models.ConfessionResponse, error) {
-	confessions, err := s.repo.FindApproved(limit, offset)
+func (s *confessionService) GetApprovedConfessions(viewerID uint, page models.PageQuery) (models.Page[models.ConfessionResponse], error) {
+	confessions, err := s.repo.FindApproved(viewerID, page)
 	if err != nil {
-		return nil, err
-	}
-	var responses []models.ConfessionResponse
-	for _, c := range confessions {
-		responses = append(responses, c.ToResponse(0)) // User not logged in, so no like status
+		return models.Page[models.ConfessionResponse]{}, err
 	}
-	return responses, nil
+	return models.MapPage(confessions, func(c models.Confession) models.ConfessionResponse {
+		return c.ToResponse(0) // Likes are not loaded for lists, so no like status
+	}), nil
 }
 
-func (s *confessionService) GetConfessionByID(id, currentUserID uint) (*models.ConfessionResponse, error) {
-	confession, err := s.repo.FindByID(id)
+func (s *confessionService) GetConfessionByID(id, currentUserID uint, viewer string) (*models.ConfessionResponse, error) {
+	confession, err := s.repo.FindVisibleByID(id, currentUserID)
 	if err != nil {
 		return nil, err
 	}
 	if !confession.IsApproved {
 		return nil, errors.New("confession not found or not approved")
 	}
+	// 同一访客短时间内重复打开只计一次浏览
+	if s.views.Count(models.TrendingTypeConfessions, confession.ID, viewer) {
+		if err := s.repo.IncrementViews(confession.ID); err != nil {
+			log.Printf("ConfessionService: failed to count view of confession %d: %v", confession.ID, err)
+		} else {
+			confession.ViewsCount++
+		}
+	}
 	response := confession.ToResponse(currentUserID)
 	return &response, nil
 }
@@ -89,12 +107,12 @@ func (s *confessionService) UpdateConfessionStatus(id uint, status string, isApp
 	return err
 }
 
-func (s *confessionService) DeleteConfession(id, userID uint, userRole string) error {
+func (s *confessionService) DeleteConfession(id, userID uint) error {
 	confession, err := s.repo.FindByID(id)
 	if err != nil {
 		return err
 	}
-	if confession.UserID != userID && userRole != "admin" {
+	if confession.UserID != userID && !s.authz.Can(userID, models.PermConfessionDeleteAny) {
 		return errors.New("permission denied")
 	}
 	return s.repo.Delete(confession)
@@ -109,7 +127,25 @@ func (s *confessionService) LikeConfession(confessionID, userID uint) error {
 		UserID:       userID,
 		ConfessionID: confessionID,
 	}
-	return s.repo.CreateLike(like)
+	if err := s.repo.CreateLike(like); err != nil {
+		return err
+	}
+
+	confession, err := s.repo.FindByID(confessionID)
+	if err != nil {
+		log.Printf("ConfessionService: failed to load confession %d for like notification: %v", confessionID, err)
+		return nil
+	}
+	s.notify(&models.Notification{
+		UserID:       confession.UserID,
+		SenderID:     &userID,
+		Title:        "New like",
+		Message:      "Your confession received a new like",
+		Type:         models.NotificationLike,
+		ResourceType: "confession",
+		ResourceID:   confession.ID,
+	})
+	return nil
 }
 
 func (s *confessionService) UnlikeConfession(confessionID, userID uint) error {
@@ -127,10 +163,44 @@ func (s *confessionService) CreateComment(confessionID, userID uint, content str
 	if err != nil {
 		return nil, err
 	}
+
+	if confession, err := s.repo.FindByID(confessionID); err != nil {
+		log.Printf("ConfessionService: failed to load confession %d for comment notification: %v", confessionID, err)
+	} else if confession.UserID != userID && !s.blockedAnonymously(confession.UserID, userID, isAnonymous) {
+		// Anonymous comments must not reveal who wrote them
+		var senderID *uint
+		if !isAnonymous {
+			senderID = &userID
+		}
+		s.notify(&models.Notification{
+			UserID:       confession.UserID,
+			SenderID:     senderID,
+			Title:        "New comment",
+			Message:      fmt.Sprintf("New comment on your confession: %s", content),
+			Type:         models.NotificationComment,
+			ResourceType: "confession",
+			ResourceID:   confession.ID,
+		})
+	}
+
 	response := newComment.ToResponse()
 	return &response, nil
 }
 
+// blockedAnonymously reports whether an anonymous comment comes from a user the author has a block with.
+// Notify filters blocked senders itself, but anonymous notifications carry no sender to check.
+// Interactions with confessions are not refused outright, as that would reveal who wrote them.
+func (s *confessionService) blockedAnonymously(authorID, userID uint, isAnonymous bool) bool {
+	if !isAnonymous {
+		return false
+	}
+	blocked, err := s.blocks.IsBlocked(authorID, userID)
+	if err != nil {
+		log.Printf("ConfessionService: failed to check blocks between users %d and %d: %v", authorID, userID, err)
+	}
+	return blocked
+}
+
 func (s *confessionService) UpdateComment(commentID, userID uint, content string, isAnonymous bool) (*models.ConfessionCommentResponse, error) {
 	comment, err := s.repo.FindCommentByID(commentID)
 	if err != nil {
@@ -149,12 +219,12 @@ func (s *confessionService) UpdateComment(commentID, userID uint, content string
 	return &response, nil
 }
 
-func (s *confessionService) DeleteComment(commentID, userID uint, userRole string) error {
+func (s *confessionService) DeleteComment(commentID, userID uint) error {
 	comment, err := s.repo.FindCommentByID(commentID)
 	if err != nil {
 		return err
 	}
-	if comment.UserID != userID && userRole != "admin" {
+	if comment.UserID != userID && !s.authz.Can(userID, models.PermConfessionCommentDeleteAny) {
 		return errors.New("permission denied")
 	}
 	return s.repo.DeleteComment(comment)
@@ -166,11 +236,11 @@ func (s *confessionService) GetDB() *gorm.DB {
 }
 
 // GetConfessionsByStatus 根据状态获取树洞列表
-func (s *confessionService) GetConfessionsByStatus(status string, limit, offset int) ([]models.Confession, error) {
+func (s *confessionService) GetConfessionsByStatus(status string, page models.PageQuery) (models.Page[models.Confession], error) {
 	if status == "" {
-		return s.repo.FindAll(limit, offset, true)
+		return s.repo.FindAll(page, true)
 	}
-	return s.repo.FindByStatus(status, limit, offset)
+	return s.repo.FindByStatus(status, page)
 }
 
 // GetConfessionStats 获取树洞状态统计
@@ -192,3 +262,10 @@ func (s *confessionService) GetConfessionStats() (int64, int64, int64, error) {
 
 	return pendingCount, approvedCount, rejectedCount, nil
 }
+
+// notify delivers a notification without failing the action that triggered it.
+func (s *confessionService) notify(notification *models.Notification) {
+	if err := s.notifications.Notify(notification); err != nil {
+		log.Printf("ConfessionService: failed to create notification for user %d: %v", notification.UserID, err)
+	}
+}
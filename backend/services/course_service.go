@@ -8,37 +8,36 @@ import (
 
 // CourseService defines the interface for course business logic
 type CourseService interface {
-	GetCourses(limit, offset int) ([]models.CourseResponse, error)
+	GetCourses(page models.PageQuery) (models.Page[models.CourseResponse], error)
 	GetCourseByID(id uint) (*models.Course, error)
 	CreateCourse(course *models.Course) (*models.CourseResponse, error)
-	UpdateCourse(id uint, req *models.UpdateCourseRequest, userRole string) (*models.CourseResponse, error)
-	DeleteCourse(id uint, userRole string) error
+	UpdateCourse(id, userID uint, req *models.UpdateCourseRequest) (*models.CourseResponse, error)
+	DeleteCourse(id, userID uint) error
 
 	GetCourseReviews(courseID uint) ([]models.CourseReviewResponse, error)
 	CreateCourseReview(courseID, userID uint, req *models.CreateCourseReviewRequest) (*models.CourseReviewResponse, error)
-	UpdateCourseReview(reviewID, userID uint, req *models.UpdateCourseReviewRequest, userRole string) (*models.CourseReviewResponse, error)
-	DeleteCourseReview(reviewID, userID uint, userRole string) error
+	UpdateCourseReview(reviewID, userID uint, req *models.UpdateCourseReviewRequest) (*models.CourseReviewResponse, error)
+	DeleteCourseReview(reviewID, userID uint) error
 }
 
 type courseService struct {
-	repo repositories.CourseRepository
+	repo  repositories.CourseRepository
+	authz Authorizer
 }
 
 // NewCourseService creates a new instance of CourseService
-func NewCourseService(repo repositories.CourseRepository) CourseService {
-	return &courseService{repo: repo}
+func NewCourseService(repo repositories.CourseRepository, authz Authorizer) CourseService {
+	return &courseService{repo: repo, authz: authz}
 }
 
-func (s *courseService) GetCourses(limit, offset int) ([]models.CourseResponse, error) {
-	courses, err := s.repo.FindAll(limit, offset)
+func (s *courseService) GetCourses(page models.PageQuery) (models.Page[models.CourseResponse], error) {
+	courses, err := s.repo.FindAll(page)
 	if err != nil {
-		return nil, err
-	}
-	var responses []models.CourseResponse
-	for _, c := range courses {
-		responses = append(responses, c.ToResponse())
+		return models.Page[models.CourseResponse]{}, err
 	}
-	return responses, nil
+	return models.MapPage(courses, func(c models.Course) models.CourseResponse {
+		return c.ToResponse()
+	}), nil
 }
 
 func (s *courseService) GetCourseByID(id uint) (*models.Course, error) {
@@ -54,8 +53,8 @@ func (s *courseService) CreateCourse(course *models.Course) (*models.CourseRespo
 	return &response, nil
 }
 
-func (s *courseService) UpdateCourse(id uint, req *models.UpdateCourseRequest, userRole string) (*models.CourseResponse, error) {
-	if userRole != "admin" {
+func (s *courseService) UpdateCourse(id, userID uint, req *models.UpdateCourseRequest) (*models.CourseResponse, error) {
+	if !s.authz.Can(userID, models.PermCourseManage) {
 		return nil, errors.New("permission denied")
 	}
 	course, err := s.repo.FindByID(id)
@@ -94,8 +93,8 @@ func (s *courseService) UpdateCourse(id uint, req *models.UpdateCourseRequest, u
 	return &response, nil
 }
 
-func (s *courseService) DeleteCourse(id uint, userRole string) error {
-	if userRole != "admin" {
+func (s *courseService) DeleteCourse(id, userID uint) error {
+	if !s.authz.Can(userID, models.PermCourseManage) {
 		return errors.New("permission denied")
 	}
 	course, err := s.repo.FindByID(id)
@@ -137,13 +136,13 @@ func (s *courseService) CreateCourseReview(courseID, userID uint, req *models.Cr
 	return &response, nil
 }
 
-func (s *courseService) UpdateCourseReview(reviewID, userID uint, req *models.UpdateCourseReviewRequest, userRole string) (*models.CourseReviewResponse, error) {
+func (s *courseService) UpdateCourseReview(reviewID, userID uint, req *models.UpdateCourseReviewRequest) (*models.CourseReviewResponse, error) {
 	review, err := s.repo.FindReviewByID(reviewID)
 	if err != nil {
 		return nil, errors.New("review not found")
 	}
 
-	if review.UserID != userID && userRole != "admin" {
+	if review.UserID != userID && !s.authz.Can(userID, models.PermCourseReviewUpdateAny) {
 		return nil, errors.New("permission denied")
 	}
 
@@ -176,13 +175,13 @@ func (s *courseService) UpdateCourseReview(reviewID, userID uint, req *models.Up
 	return &response, nil
 }
 
-func (s *courseService) DeleteCourseReview(reviewID, userID uint, userRole string) error {
+func (s *courseService) DeleteCourseReview(reviewID, userID uint) error {
 	review, err := s.repo.FindReviewByID(reviewID)
 	if err != nil {
 		return errors.New("review not found")
 	}
 
-	if review.UserID != userID && userRole != "admin" {
+	if review.UserID != userID && !s.authz.Can(userID, models.PermCourseReviewDeleteAny) {
 		return errors.New("permission denied")
 	}
 
@@ -2,17 +2,22 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
 )
 
 // EventService defines the interface for event business logic
 type EventService interface {
-	GetEvents(limit, offset int) ([]models.EventResponse, error)
+	// GetEvents lists events; viewerID is 0 for anonymous visitors
+	GetEvents(viewerID uint, page models.PageQuery) (models.Page[models.EventResponse], error)
+	// GetUserEvents lists the events created by userID
+	GetUserEvents(userID, currentUserID uint, page models.PageQuery) (models.Page[models.EventResponse], error)
 	GetEventByID(id, currentUserID uint) (*models.EventResponse, error)
 	CreateEvent(event *models.Event, userID uint) (*models.EventResponse, error)
-	UpdateEvent(id, userID uint, req *models.UpdateEventRequest, userRole string) (*models.EventResponse, error)
-	DeleteEvent(id, userID uint, userRole string) error
+	UpdateEvent(id, userID uint, req *models.UpdateEventRequest) (*models.EventResponse, error)
+	DeleteEvent(id, userID uint) error
 	GetCategories() ([]string, error)
 
 	JoinEvent(eventID, userID uint) error
@@ -20,28 +25,38 @@ type EventService interface {
 }
 
 type eventService struct {
-	repo repositories.EventRepository
+	repo          repositories.EventRepository
+	notifications NotificationService
+	authz         Authorizer
 }
 
 // NewEventService creates a new instance of EventService
-func NewEventService(repo repositories.EventRepository) EventService {
-	return &eventService{repo: repo}
+func NewEventService(repo repositories.EventRepository, notifications NotificationService, authz Authorizer) EventService {
+	return &eventService{repo: repo, notifications: notifications, authz: authz}
 }
 
-func (s *eventService) GetEvents(limit, offset int) ([]models.EventResponse, error) {
-	events, err := s.repo.FindAll(limit, offset)
+func (s *eventService) GetEvents(viewerID uint, page models.PageQuery) (models.Page[models.EventResponse], error) {
+	events, err := s.repo.FindAll(viewerID, page)
 	if err != nil {
-		return nil, err
+		return models.Page[models.EventResponse]{}, err
 	}
-	var responses []models.EventResponse
-	for _, e := range events {
-		responses = append(responses, e.ToResponse(0)) // User not logged in
+	return models.MapPage(events, func(e models.Event) models.EventResponse {
+		return e.ToResponse(viewerID)
+	}), nil
+}
+
+func (s *eventService) GetUserEvents(userID, currentUserID uint, page models.PageQuery) (models.Page[models.EventResponse], error) {
+	events, err := s.repo.FindByCreator(userID, currentUserID, page)
+	if err != nil {
+		return models.Page[models.EventResponse]{}, err
 	}
-	return responses, nil
+	return models.MapPage(events, func(e models.Event) models.EventResponse {
+		return e.ToResponse(currentUserID)
+	}), nil
 }
 
 func (s *eventService) GetEventByID(id, currentUserID uint) (*models.EventResponse, error) {
-	event, err := s.repo.FindByID(id)
+	event, err := s.repo.FindVisibleByID(id, currentUserID)
 	if err != nil {
 		return nil, err
 	}
@@ -59,12 +74,12 @@ func (s *eventService) CreateEvent(event *models.Event, userID uint) (*models.Ev
 	return &response, nil
 }
 
-func (s *eventService) UpdateEvent(id, userID uint, req *models.UpdateEventRequest, userRole string) (*models.EventResponse, error) {
+func (s *eventService) UpdateEvent(id, userID uint, req *models.UpdateEventRequest) (*models.EventResponse, error) {
 	event, err := s.repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
-	if event.CreatorID != userID && userRole != "admin" {
+	if event.CreatorID != userID && !s.authz.Can(userID, models.PermEventUpdateAny) {
 		return nil, errors.New("permission denied")
 	}
 
@@ -98,12 +113,12 @@ func (s *eventService) UpdateEvent(id, userID uint, req *models.UpdateEventReque
 	return &response, nil
 }
 
-func (s *eventService) DeleteEvent(id, userID uint, userRole string) error {
+func (s *eventService) DeleteEvent(id, userID uint) error {
 	event, err := s.repo.FindByID(id)
 	if err != nil {
 		return err
 	}
-	if event.CreatorID != userID && userRole != "admin" {
+	if event.CreatorID != userID && !s.authz.Can(userID, models.PermEventDeleteAny) {
 		return errors.New("permission denied")
 	}
 	return s.repo.Delete(event)
@@ -116,7 +131,11 @@ func (s *eventService) GetCategories() ([]string, error) {
 }
 
 func (s *eventService) JoinEvent(eventID, userID uint) error {
-	_, err := s.repo.FindAttendee(userID, eventID)
+	event, err := s.repo.FindByID(eventID)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.FindAttendee(userID, eventID)
 	if err == nil {
 		return errors.New("already joined")
 	}
@@ -124,9 +143,29 @@ func (s *eventService) JoinEvent(eventID, userID uint) error {
 		UserID:  userID,
 		EventID: eventID,
 	}
-	return s.repo.CreateAttendee(attendee)
+	if err := s.repo.CreateAttendee(attendee); err != nil {
+		return err
+	}
+
+	s.notify(&models.Notification{
+		UserID:       event.CreatorID,
+		SenderID:     &userID,
+		Title:        "New attendee",
+		Message:      fmt.Sprintf("Someone joined your event \"%s\"", event.Title),
+		Type:         models.NotificationEvent,
+		ResourceType: "event",
+		ResourceID:   event.ID,
+	})
+	return nil
 }
 
 func (s *eventService) LeaveEvent(eventID, userID uint) error {
 	return s.repo.DeleteAttendee(userID, eventID)
 }
+
+// notify delivers a notification without failing the action that triggered it.
+func (s *eventService) notify(notification *models.Notification) {
+	if err := s.notifications.Notify(notification); err != nil {
+		log.Printf("EventService: failed to create notification for user %d: %v", notification.UserID, err)
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"sort"
+	"strconv"
+)
+
+// FeedService defines the interface for the personalized following feed
+type FeedService interface {
+	GetFeed(userID uint, page models.PageQuery) (models.Page[models.FeedItem], error)
+}
+
+type feedService struct {
+	repo repositories.FeedRepository
+}
+
+// NewFeedService creates a new instance of FeedService
+func NewFeedService(repo repositories.FeedRepository) FeedService {
+	return &feedService{repo: repo}
+}
+
+// GetFeed merges posts, events, partner requests and listings of followed users into one timeline.
+// Every source is asked for one entry more than the page size; after merging, that is enough
+// to fill the page and to know whether another page exists. Totals are not supported.
+func (s *feedService) GetFeed(userID uint, page models.PageQuery) (models.Page[models.FeedItem], error) {
+	var result models.Page[models.FeedItem]
+	if page.Cursor != nil {
+		if _, _, err := models.SplitFeedCursor(page.Cursor); err != nil {
+			return result, err
+		}
+	}
+	fetch := page.Limit + 1
+	items := make([]models.FeedItem, 0, fetch*len(models.FeedTypes))
+
+	posts, err := s.repo.FindPosts(userID, page.Cursor, fetch)
+	if err != nil {
+		return result, err
+	}
+	for _, p := range posts {
+		items = append(items, models.FeedItem{
+			Type:      models.FeedTypePost,
+			ID:        strconv.FormatUint(uint64(p.ID), 10),
+			CreatedAt: p.CreatedAt,
+			Payload:   p.ToResponse(userID),
+		})
+	}
+
+	events, err := s.repo.FindEvents(userID, page.Cursor, fetch)
+	if err != nil {
+		return result, err
+	}
+	for _, e := range events {
+		items = append(items, models.FeedItem{
+			Type:      models.FeedTypeEvent,
+			ID:        strconv.FormatUint(uint64(e.ID), 10),
+			CreatedAt: e.CreatedAt,
+			Payload:   e.ToResponse(userID),
+		})
+	}
+
+	partners, err := s.repo.FindPartners(userID, page.Cursor, fetch)
+	if err != nil {
+		return result, err
+	}
+	for _, p := range partners {
+		items = append(items, models.FeedItem{
+			Type:      models.FeedTypePartner,
+			ID:        p.ID,
+			CreatedAt: p.CreatedAt,
+			Payload:   p.ToResponse(),
+		})
+	}
+
+	listings, err := s.repo.FindListings(userID, page.Cursor, fetch)
+	if err != nil {
+		return result, err
+	}
+	for _, l := range listings {
+		items = append(items, models.FeedItem{
+			Type:      models.FeedTypeListing,
+			ID:        strconv.FormatUint(uint64(l.ID), 10),
+			CreatedAt: l.CreatedAt,
+			Payload:   l.ToResponse(),
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return feedItemBefore(items[i], items[j])
+	})
+	if len(items) > page.Limit {
+		items = items[:page.Limit]
+		result.HasMore = true
+		result.NextCursor = items[len(items)-1].CursorKey().Encode()
+	}
+	result.Items = items
+	return result, nil
+}
+
+// feedItemBefore reports whether a comes before b in the feed, matching the SQL ordering:
+// newest first, then by type rank, then by ID descending.
+func feedItemBefore(a, b models.FeedItem) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	if a.Type != b.Type {
+		return models.FeedRank(a.Type) > models.FeedRank(b.Type)
+	}
+	// 数字ID按数值比较，合伙人的UUID按字符串比较
+	aID, aErr := strconv.ParseUint(a.ID, 10, 64)
+	bID, bErr := strconv.ParseUint(b.ID, 10, 64)
+	if aErr == nil && bErr == nil {
+		return aID > bID
+	}
+	return a.ID > b.ID
+}
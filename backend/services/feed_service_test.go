@@ -0,0 +1,106 @@
+package services
+
+import (
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFeedRepo serves fixed entries of every type the way the SQL queries do: newest first and
+// strictly after the cursor in feed order
+type fakeFeedRepo struct {
+	repositories.FeedRepository
+	posts    []models.Post
+	events   []models.Event
+	partners []models.Partner
+	listings []models.Marketplace
+}
+
+// afterCursor reports whether an entry comes after the cursor in feed order
+func afterCursor(feedType, id string, createdAt time.Time, cursor *models.Cursor) bool {
+	if cursor == nil {
+		return true
+	}
+	cursorType, cursorID, _ := models.SplitFeedCursor(cursor)
+	return feedItemBefore(models.FeedItem{Type: cursorType, ID: cursorID, CreatedAt: cursor.CreatedAt},
+		models.FeedItem{Type: feedType, ID: id, CreatedAt: createdAt})
+}
+
+// feedSource pages one source; entries must be stored newest first
+func feedSource[T any](entries []T, key func(T) (string, time.Time), feedType string, cursor *models.Cursor, limit int) []T {
+	var page []T
+	for _, entry := range entries {
+		id, createdAt := key(entry)
+		if len(page) < limit && afterCursor(feedType, id, createdAt, cursor) {
+			page = append(page, entry)
+		}
+	}
+	return page
+}
+
+func (r *fakeFeedRepo) FindPosts(userID uint, cursor *models.Cursor, limit int) ([]models.Post, error) {
+	return feedSource(r.posts, func(p models.Post) (string, time.Time) {
+		return strconv.FormatUint(uint64(p.ID), 10), p.CreatedAt
+	}, models.FeedTypePost, cursor, limit), nil
+}
+
+func (r *fakeFeedRepo) FindEvents(userID uint, cursor *models.Cursor, limit int) ([]models.Event, error) {
+	return feedSource(r.events, func(e models.Event) (string, time.Time) {
+		return strconv.FormatUint(uint64(e.ID), 10), e.CreatedAt
+	}, models.FeedTypeEvent, cursor, limit), nil
+}
+
+func (r *fakeFeedRepo) FindPartners(userID uint, cursor *models.Cursor, limit int) ([]models.Partner, error) {
+	return feedSource(r.partners, func(p models.Partner) (string, time.Time) {
+		return p.ID, p.CreatedAt
+	}, models.FeedTypePartner, cursor, limit), nil
+}
+
+func (r *fakeFeedRepo) FindListings(userID uint, cursor *models.Cursor, limit int) ([]models.Marketplace, error) {
+	return feedSource(r.listings, func(l models.Marketplace) (string, time.Time) {
+		return strconv.FormatUint(uint64(l.ID), 10), l.CreatedAt
+	}, models.FeedTypeListing, cursor, limit), nil
+}
+
+// Paging through a feed where entries of several types share a timestamp returns each entry once, in order
+func TestFeedPagingAcrossTypes(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	earlier := now.Add(-time.Minute)
+	repo := &fakeFeedRepo{
+		posts:    []models.Post{{ID: 12, CreatedAt: now}, {ID: 11, CreatedAt: now}, {ID: 10, CreatedAt: earlier}},
+		events:   []models.Event{{ID: 9, CreatedAt: now}, {ID: 3, CreatedAt: earlier}},
+		partners: []models.Partner{{ID: "b", CreatedAt: now}, {ID: "a", CreatedAt: now}},
+		listings: []models.Marketplace{{ID: 5, CreatedAt: now}, {ID: 4, CreatedAt: earlier}},
+	}
+	want := "post:12 post:11 event:9 partner:b partner:a listing:5 post:10 event:3 listing:4"
+	service := NewFeedService(repo)
+
+	for limit := 1; limit <= 4; limit++ {
+		var got []string
+		page := models.PageQuery{Limit: limit}
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("limit %d: feed does not end, got %v", limit, got)
+			}
+			result, err := service.GetFeed(1, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range result.Items {
+				got = append(got, item.Type+":"+item.ID)
+			}
+			if !result.HasMore {
+				break
+			}
+			if page.Cursor, err = models.DecodeCursor(result.NextCursor); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("limit %d: feed = %v, want %s", limit, got, want)
+		}
+	}
+}
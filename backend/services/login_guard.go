@@ -0,0 +1,131 @@
+package services
+
+import (
+	"log"
+	"nhcommunity/repositories"
+	"strings"
+	"time"
+)
+
+// LoginThrottle describes how failed sign-ins against one key are slowed down.
+// After FreeAttempts failures every further failure blocks the key for BaseDelay, doubling each time
+// up to MaxDelay; LockoutAfter failures lock the key for Lockout.
+type LoginThrottle struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+	// Window is how long failures are remembered
+	Window time.Duration
+}
+
+var (
+	// identifierThrottle protects a single account from password guessing
+	identifierThrottle = LoginThrottle{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockoutAfter: 10,
+		Lockout:      15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+	// ipThrottle slows down a single client spraying passwords over many accounts;
+	// it is looser because a campus network shares few public IPs
+	ipThrottle = LoginThrottle{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockoutAfter: 100,
+		Lockout:      15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+)
+
+// delayAfter returns how long to block a key that has failed the given number of times
+func (t LoginThrottle) delayAfter(failures int) time.Duration {
+	if failures >= t.LockoutAfter {
+		return t.Lockout
+	}
+	if failures <= t.FreeAttempts {
+		return 0
+	}
+	delay := t.BaseDelay
+	for i := t.FreeAttempts + 1; i < failures && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.MaxDelay {
+		delay = t.MaxDelay
+	}
+	return delay
+}
+
+// LoginGuard tracks failed sign-ins per identifier and per client IP
+type LoginGuard interface {
+	// Check returns how long the caller must wait before another attempt, or 0 if it may try now
+	Check(identifier, ip string) time.Duration
+	Failure(identifier, ip string)
+	// Success clears the failures of the identifier; the IP keeps its count
+	Success(identifier string)
+}
+
+type loginGuard struct {
+	store repositories.LoginAttemptStore
+}
+
+// NewLoginGuard creates a new instance of LoginGuard.
+// Errors of the store are logged and never lock users out.
+func NewLoginGuard(store repositories.LoginAttemptStore) LoginGuard {
+	return &loginGuard{store: store}
+}
+
+func (g *loginGuard) Check(identifier, ip string) time.Duration {
+	var wait time.Duration
+	for _, key := range []string{identifierKey(identifier), ipKey(ip)} {
+		until, err := g.store.BlockedUntil(key)
+		if err != nil {
+			log.Printf("LoginGuard: failed to read attempts of %s: %v", key, err)
+			continue
+		}
+		if remaining := time.Until(until); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+func (g *loginGuard) Failure(identifier, ip string) {
+	g.record(identifierKey(identifier), identifierThrottle)
+	g.record(ipKey(ip), ipThrottle)
+}
+
+func (g *loginGuard) Success(identifier string) {
+	if err := g.store.Reset(identifierKey(identifier)); err != nil {
+		log.Printf("LoginGuard: failed to reset attempts of %s: %v", identifier, err)
+	}
+}
+
+func (g *loginGuard) record(key string, throttle LoginThrottle) {
+	failures, err := g.store.RecordFailure(key, throttle.Window)
+	if err != nil {
+		log.Printf("LoginGuard: failed to record attempt of %s: %v", key, err)
+		return
+	}
+	if delay := throttle.delayAfter(failures); delay > 0 {
+		if failures == throttle.LockoutAfter {
+			log.Printf("LoginGuard: %s locked out for %s after %d failed attempts", key, throttle.Lockout, failures)
+		}
+		if err := g.store.Block(key, time.Now().Add(delay)); err != nil {
+			log.Printf("LoginGuard: failed to block %s: %v", key, err)
+		}
+	}
+}
+
+// identifierKey normalizes the identifier so that "Alice" and "alice " share a counter
+func identifierKey(identifier string) string {
+	return "id:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
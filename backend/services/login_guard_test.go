@@ -0,0 +1,154 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"nhcommunity/repositories"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleDelay(t *testing.T) {
+	capped := LoginThrottle{FreeAttempts: 0, BaseDelay: time.Second, MaxDelay: 5 * time.Second, LockoutAfter: 100, Lockout: time.Hour}
+	tests := []struct {
+		throttle LoginThrottle
+		failures int
+		want     time.Duration
+	}{
+		{identifierThrottle, 0, 0},
+		{identifierThrottle, 3, 0},
+		{identifierThrottle, 4, time.Second},
+		{identifierThrottle, 5, 2 * time.Second},
+		{identifierThrottle, 6, 4 * time.Second},
+		{identifierThrottle, 9, 32 * time.Second},
+		{identifierThrottle, 10, 15 * time.Minute},
+		{identifierThrottle, 50, 15 * time.Minute},
+		{ipThrottle, 20, 0},
+		{ipThrottle, 21, time.Second},
+		{ipThrottle, 100, 15 * time.Minute},
+		{capped, 1, time.Second},
+		{capped, 3, 4 * time.Second},
+		{capped, 4, 5 * time.Second},
+		{capped, 99, 5 * time.Second},
+		{capped, 100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := tt.throttle.delayAfter(tt.failures); got != tt.want {
+			t.Errorf("delayAfter(%d) with %+v = %v, want %v", tt.failures, tt.throttle, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuard(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, guard LoginGuard)
+	}{
+		{
+			name: "free attempts are not delayed",
+			run: func(t *testing.T, guard LoginGuard) {
+				for i := 0; i < identifierThrottle.FreeAttempts; i++ {
+					guard.Failure("alice", "10.0.0.1")
+				}
+				if wait := guard.Check("alice", "10.0.0.1"); wait != 0 {
+					t.Fatalf("wait = %v, want 0", wait)
+				}
+			},
+		},
+		{
+			name: "backoff after the free attempts",
+			run: func(t *testing.T, guard LoginGuard) {
+				for i := 0; i <= identifierThrottle.FreeAttempts; i++ {
+					guard.Failure("alice", "10.0.0.1")
+				}
+				if wait := guard.Check("alice", "10.0.0.2"); wait <= 0 || wait > time.Second {
+					t.Fatalf("wait = %v, want up to 1s", wait)
+				}
+				if wait := guard.Check("bob", "10.0.0.2"); wait != 0 {
+					t.Fatalf("other account waits %v", wait)
+				}
+			},
+		},
+		{
+			name: "lockout",
+			run: func(t *testing.T, guard LoginGuard) {
+				for i := 0; i < identifierThrottle.LockoutAfter; i++ {
+					guard.Failure("alice", fmt.Sprintf("10.0.0.%d", i))
+				}
+				if wait := guard.Check("alice", "10.0.1.1"); wait <= time.Minute {
+					t.Fatalf("wait = %v, want the lockout", wait)
+				}
+			},
+		},
+		{
+			name: "identifier is case and space insensitive",
+			run: func(t *testing.T, guard LoginGuard) {
+				for i := 0; i <= identifierThrottle.FreeAttempts; i++ {
+					guard.Failure(" Alice", "10.0.0.1")
+				}
+				if wait := guard.Check("alice ", "10.0.0.2"); wait == 0 {
+					t.Fatal("differently written identifier is not delayed")
+				}
+			},
+		},
+		{
+			name: "success clears the identifier",
+			run: func(t *testing.T, guard LoginGuard) {
+				for i := 0; i <= identifierThrottle.FreeAttempts; i++ {
+					guard.Failure("alice", "10.0.0.1")
+				}
+				guard.Success("alice")
+				if wait := guard.Check("alice", "10.0.0.2"); wait != 0 {
+					t.Fatalf("wait after success = %v", wait)
+				}
+			},
+		},
+		{
+			name: "spraying many accounts from one IP",
+			run: func(t *testing.T, guard LoginGuard) {
+				for i := 0; i <= ipThrottle.FreeAttempts; i++ {
+					guard.Failure(fmt.Sprintf("user%d", i), "10.0.0.1")
+				}
+				if wait := guard.Check("someone-else", "10.0.0.1"); wait == 0 {
+					t.Fatal("spraying IP is not delayed")
+				}
+				if wait := guard.Check("someone-else", "10.0.0.2"); wait != 0 {
+					t.Fatalf("other IP waits %v", wait)
+				}
+				// A successful login does not reset the count of the IP
+				guard.Success("user0")
+				if wait := guard.Check("user0", "10.0.0.1"); wait == 0 {
+					t.Fatal("success cleared the IP")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, NewLoginGuard(repositories.NewMemoryLoginAttemptStore()))
+		})
+	}
+}
+
+// failingAttemptStore fails every operation, like an unreachable Redis
+type failingAttemptStore struct{}
+
+var errStoreDown = errors.New("store down")
+
+func (failingAttemptStore) BlockedUntil(string) (time.Time, error) {
+	return time.Now().Add(time.Hour), errStoreDown
+}
+func (failingAttemptStore) RecordFailure(string, time.Duration) (int, error) {
+	return 1000, errStoreDown
+}
+func (failingAttemptStore) Block(string, time.Time) error { return errStoreDown }
+func (failingAttemptStore) Reset(string) error            { return errStoreDown }
+
+func TestLoginGuardStoreFailure(t *testing.T) {
+	guard := NewLoginGuard(failingAttemptStore{})
+	guard.Failure("alice", "10.0.0.1")
+	guard.Success("alice")
+	if wait := guard.Check("alice", "10.0.0.1"); wait != 0 {
+		t.Fatalf("unavailable store locked the user out for %v", wait)
+	}
+}
@@ -7,36 +7,37 @@ import (
 
 // LostFoundService defines the interface for lost and found business logic
 type LostFoundService interface {
-	GetItems(limit, offset int) ([]models.LostFoundResponse, error)
-	GetItemByID(id uint) (*models.LostFoundResponse, error)
-	CreateItem(item *models.LostFound, userID uint) (*models.LostFoundResponse, error)
-	UpdateItem(id, userID uint, req *models.UpdateLostFoundRequest, userRole string) (*models.LostFoundResponse, error)
-	DeleteItem(id, userID uint, userRole string) error
+	// GetItems lists items; viewerID is 0 for anonymous visitors
+	GetItems(viewerID uint, page models.PageQuery) (models.Page[models.LostFoundResponse], error)
+	GetItemByID(id, viewerID uint) (*models.LostFoundResponse, error)
+	CreateItem(item *models.LostFound, mediaIDs []uint, userID uint) (*models.LostFoundResponse, error)
+	UpdateItem(id, userID uint, req *models.UpdateLostFoundRequest) (*models.LostFoundResponse, error)
+	DeleteItem(id, userID uint) error
 }
 
 type lostFoundService struct {
-	repo repositories.LostFoundRepository
+	repo  repositories.LostFoundRepository
+	media MediaService
+	authz Authorizer
 }
 
 // NewLostFoundService creates a new instance of LostFoundService
-func NewLostFoundService(repo repositories.LostFoundRepository) LostFoundService {
-	return &lostFoundService{repo: repo}
+func NewLostFoundService(repo repositories.LostFoundRepository, media MediaService, authz Authorizer) LostFoundService {
+	return &lostFoundService{repo: repo, media: media, authz: authz}
 }
 
-func (s *lostFoundService) GetItems(limit, offset int) ([]models.LostFoundResponse, error) {
-	items, err := s.repo.FindAll(limit, offset)
+func (s *lostFoundService) GetItems(viewerID uint, page models.PageQuery) (models.Page[models.LostFoundResponse], error) {
+	items, err := s.repo.FindAll(viewerID, page)
 	if err != nil {
-		return nil, err
-	}
-	var responses []models.LostFoundResponse
-	for _, i := range items {
-		responses = append(responses, i.ToResponse())
+		return models.Page[models.LostFoundResponse]{}, err
 	}
-	return responses, nil
+	return models.MapPage(items, func(i models.LostFound) models.LostFoundResponse {
+		return i.ToResponse()
+	}), nil
 }
 
-func (s *lostFoundService) GetItemByID(id uint) (*models.LostFoundResponse, error) {
-	item, err := s.repo.FindByID(id)
+func (s *lostFoundService) GetItemByID(id, viewerID uint) (*models.LostFoundResponse, error) {
+	item, err := s.repo.FindVisibleByID(id, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -44,8 +45,13 @@ func (s *lostFoundService) GetItemByID(id uint) (*models.LostFoundResponse, erro
 	return &response, nil
 }
 
-func (s *lostFoundService) CreateItem(item *models.LostFound, userID uint) (*models.LostFoundResponse, error) {
+func (s *lostFoundService) CreateItem(item *models.LostFound, mediaIDs []uint, userID uint) (*models.LostFoundResponse, error) {
+	media, err := s.media.ResolveOwned(userID, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
 	item.UserID = userID
+	item.Media = media
 	newItem, err := s.repo.Create(item)
 	if err != nil {
 		return nil, err
@@ -54,12 +60,12 @@ func (s *lostFoundService) CreateItem(item *models.LostFound, userID uint) (*mod
 	return &response, nil
 }
 
-func (s *lostFoundService) UpdateItem(id, userID uint, req *models.UpdateLostFoundRequest, userRole string) (*models.LostFoundResponse, error) {
+func (s *lostFoundService) UpdateItem(id, userID uint, req *models.UpdateLostFoundRequest) (*models.LostFoundResponse, error) {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
-	if item.UserID != userID && userRole != "admin" {
+	if item.UserID != userID && !s.authz.Can(userID, models.PermLostFoundUpdateAny) {
 		return nil, errors.New("permission denied")
 	}
 
@@ -75,9 +81,6 @@ func (s *lostFoundService) UpdateItem(id, userID uint, req *models.UpdateLostFou
 	if req.Category != "" {
 		item.Category = req.Category
 	}
-	if req.ImageURLs != "" {
-		item.ImageURLs = req.ImageURLs
-	}
 	if req.Location != "" {
 		item.Location = req.Location
 	}
@@ -90,21 +93,33 @@ func (s *lostFoundService) UpdateItem(id, userID uint, req *models.UpdateLostFou
 	if req.Contact != "" {
 		item.Contact = req.Contact
 	}
+	var media []models.Media
+	if req.MediaIDs != nil {
+		if media, err = s.media.ResolveOwned(item.UserID, *req.MediaIDs); err != nil {
+			return nil, err
+		}
+	}
 
 	updatedItem, err := s.repo.Update(item)
 	if err != nil {
 		return nil, err
 	}
+	if req.MediaIDs != nil {
+		if err := s.repo.ReplaceMedia(updatedItem, media); err != nil {
+			return nil, err
+		}
+		updatedItem.Media = media
+	}
 	response := updatedItem.ToResponse()
 	return &response, nil
 }
 
-func (s *lostFoundService) DeleteItem(id, userID uint, userRole string) error {
+func (s *lostFoundService) DeleteItem(id, userID uint) error {
 	item, err := s.repo.FindByID(id)
 	if err != nil {
 		return err
 	}
-	if item.UserID != userID && userRole != "admin" {
+	if item.UserID != userID && !s.authz.Can(userID, models.PermLostFoundDeleteAny) {
 		return errors.New("permission denied")
 	}
 	return s.repo.Delete(item)
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPConfig configures a Mailer that delivers through an SMTP server
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer creates a Mailer that delivers through an SMTP server,
+// authenticating with PLAIN auth when a username is configured
+func NewSMTPMailer(cfg SMTPConfig) Mailer {
+	return &smtpMailer{cfg: cfg}
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+	addr := net.JoinHostPort(m.cfg.Host, fmt.Sprint(m.cfg.Port))
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{to}, buildMessage(m.cfg.From, to, subject, body))
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a Mailer that drops every email as an .eml file into dir
+// instead of sending it, for development and tests
+func NewFileMailer(dir, from string) Mailer {
+	return &fileMailer{dir: dir, from: from}
+}
+
+func (m *fileMailer) Send(to, subject, body string) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := time.Now().Format("20060102T150405") + "-" + uuid.NewString()[:8] + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, to, subject, body), 0o644)
+}
+
+// buildMessage formats an RFC 5322 message with a UTF-8 plain text body
+func buildMessage(from, to, subject, body string) []byte {
+	// 防止邮件头注入
+	strip := strings.NewReplacer("\r", "", "\n", "")
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", strip.Replace(from))
+	fmt.Fprintf(&msg, "To: %s\r\n", strip.Replace(to))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strip.Replace(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return msg.Bytes()
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"nhcommunity/config"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	config.AppConfig = config.Config{
+		JWTSecret:            "test-secret",
+		AccessTokenExpiresIn: 15,
+		TokenExpiresIn:       60 * 24,
+	}
+	os.Exit(m.Run())
+}
+
+// testPasswordHash is the hash of "password" at the lowest bcrypt cost, to keep the tests fast
+var testPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+// testUser returns an active user with a verified email address and the password "password"
+func testUser(id uint, username string) *models.User {
+	verifiedAt := time.Now().Add(-time.Hour)
+	return &models.User{
+		ID:              id,
+		Username:        username,
+		Email:           username + "@example.com",
+		Password:        string(testPasswordHash),
+		Role:            models.RoleUser,
+		IsActive:        true,
+		EmailVerifiedAt: &verifiedAt,
+	}
+}
+
+// fakeUserRepo keeps users in memory. Methods the tests do not need are left to the embedded
+// interface, so calling them panics.
+type fakeUserRepo struct {
+	repositories.UserRepository
+
+	mu       sync.Mutex
+	users    map[uint]*models.User
+	sections map[uint][]string
+	follows  [][2]uint // follower and followed user
+	nextID   uint
+}
+
+func newFakeUserRepo(users ...*models.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: make(map[uint]*models.User), sections: make(map[uint][]string)}
+	for _, user := range users {
+		r.Create(user)
+	}
+	return r
+}
+
+func (r *fakeUserRepo) find(match func(*models.User) bool) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, repositories.ErrUserNotFound
+}
+
+func (r *fakeUserRepo) FindByID(id uint) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (r *fakeUserRepo) FindByEmail(email string) (*models.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	return r.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (r *fakeUserRepo) FindByUsername(username string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Username == username })
+}
+
+func (r *fakeUserRepo) FindByStudentId(studentId string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.StudentId != nil && *u.StudentId == studentId })
+}
+
+func (r *fakeUserRepo) Create(user *models.User) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return nil, repositories.ErrEmailExists
+		}
+		if existing.Username == user.Username {
+			return nil, repositories.ErrUsernameExists
+		}
+	}
+	if user.ID == 0 {
+		r.nextID++
+		user.ID = r.nextID
+	} else if user.ID > r.nextID {
+		r.nextID = user.ID
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	stored := *user
+	r.users[user.ID] = &stored
+	return user, nil
+}
+
+func (r *fakeUserRepo) Update(user *models.User, cols ...string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.ID]; !ok {
+		return nil, repositories.ErrUserNotFound
+	}
+	stored := *user
+	r.users[user.ID] = &stored
+	return user, nil
+}
+
+func (r *fakeUserRepo) FindModeratorSections(userID uint) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sections[userID], nil
+}
+
+// get returns the stored copy of a user, for assertions
+func (r *fakeUserRepo) get(id uint) *models.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.users[id]
+}
+
+func (r *fakeUserRepo) ReplaceModeratorSections(userID uint, sections []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sections[userID] = sections
+	return nil
+}
+
+func (r *fakeUserRepo) follow(followerID, followingID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.follows = append(r.follows, [2]uint{followerID, followingID})
+}
+
+func (r *fakeUserRepo) FollowUser(follower, following *models.User) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.Contains(r.follows, [2]uint{follower.ID, following.ID}) {
+		return false, nil
+	}
+	r.follows = append(r.follows, [2]uint{follower.ID, following.ID})
+	return true, nil
+}
+
+// FindFollowers returns every follower on one page, most recent follow first
+func (r *fakeUserRepo) FindFollowers(userID, viewerID uint, page models.PageQuery) (models.Page[models.FollowedUser], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result models.Page[models.FollowedUser]
+	for _, follow := range slices.Backward(r.follows) {
+		if follow[1] == userID {
+			result.Items = append(result.Items, models.FollowedUser{User: *r.users[follow[0]]})
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeUserRepo) FindStats(viewerID uint, userIDs []uint) (map[uint]models.UserStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[uint]models.UserStats, len(userIDs))
+	for _, id := range userIDs {
+		var s models.UserStats
+		for _, follow := range r.follows {
+			if follow[1] == id {
+				s.FollowerCount++
+				s.IsFollowing = s.IsFollowing || follow[0] == viewerID
+			}
+			if follow[0] == id {
+				s.FollowingCount++
+			}
+		}
+		stats[id] = s
+	}
+	return stats, nil
+}
+
+func (r *fakeUserRepo) FindActiveIDsByRoles(roles []string) ([]uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []uint
+	for _, user := range r.users {
+		if user.IsActive && slices.Contains(roles, user.Role) {
+			ids = append(ids, user.ID)
+		}
+	}
+	return ids, nil
+}
+
+// recordedNotifications keeps the notifications it is given instead of storing them
+type recordedNotifications struct {
+	NotificationService
+	mu   sync.Mutex
+	sent []models.Notification
+}
+
+func (r *recordedNotifications) Notify(notification *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, *notification)
+	return nil
+}
+
+func (r *recordedNotifications) NotifyOnce(notification *models.Notification) error {
+	return r.Notify(notification)
+}
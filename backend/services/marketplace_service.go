@@ -1,51 +1,80 @@
 package services
 import (
 	"errors"
+	"log"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
 )
 
 // MarketplaceService defines the interface for marketplace business logic
 type MarketplaceService interface {
-	GetListings(limit, offset int) ([]models.MarketplaceResponse, error)
-	GetListingByID(id uint) (*models.MarketplaceResponse, error)
-	CreateListing(listing *models.Marketplace, sellerID uint) (*models.MarketplaceResponse, error)
-	UpdateListing(id, sellerID uint, req *models.UpdateListingRequest, userRole string) (*models.MarketplaceResponse, error)
-	DeleteListing(id, sellerID uint, userRole string) error
+	// GetListings lists listings; viewerID is 0 for anonymous visitors
+	GetListings(viewerID uint, page models.PageQuery) (models.Page[models.MarketplaceResponse], error)
+	// GetUserListings lists the listings of sellerID
+	GetUserListings(sellerID, viewerID uint, page models.PageQuery) (models.Page[models.MarketplaceResponse], error)
+	// GetListingByID returns the listing and counts a view of it by viewer, see ViewCounter
+	GetListingByID(id, viewerID uint, viewer string) (*models.MarketplaceResponse, error)
+	CreateListing(listing *models.Marketplace, mediaIDs []uint, sellerID uint) (*models.MarketplaceResponse, error)
+	UpdateListing(id, sellerID uint, req *models.UpdateListingRequest) (*models.MarketplaceResponse, error)
+	DeleteListing(id, sellerID uint) error
 }
 
 type marketplaceService struct {
-	repo repositories.MarketplaceRepository
+	repo  repositories.MarketplaceRepository
+	media MediaService
+	authz Authorizer
+	views ViewCounter
 }
 
 // NewMarketplaceService creates a new instance of MarketplaceService
-func NewMarketplaceService(repo repositories.MarketplaceRepository) MarketplaceService {
-	return &marketplaceService{repo: repo}
+func NewMarketplaceService(repo repositories.MarketplaceRepository, media MediaService, authz Authorizer, views ViewCounter) MarketplaceService {
+	return &marketplaceService{repo: repo, media: media, authz: authz, views: views}
 }
 
-func (s *marketplaceService) GetListings(limit, offset int) ([]models.MarketplaceResponse, error) {
-	listings, err := s.repo.FindAll(limit, offset)
+func (s *marketplaceService) GetListings(viewerID uint, page models.PageQuery) (models.Page[models.MarketplaceResponse], error) {
+	listings, err := s.repo.FindAll(viewerID, page)
 	if err != nil {
-		return nil, err
+		return models.Page[models.MarketplaceResponse]{}, err
 	}
-	var responses []models.MarketplaceResponse
-	for _, l := range listings {
-		responses = append(responses, l.ToResponse())
+	return models.MapPage(listings, func(l models.Marketplace) models.MarketplaceResponse {
+		return l.ToResponse()
+	}), nil
+}
+
+func (s *marketplaceService) GetUserListings(sellerID, viewerID uint, page models.PageQuery) (models.Page[models.MarketplaceResponse], error) {
+	listings, err := s.repo.FindBySeller(sellerID, viewerID, page)
+	if err != nil {
+		return models.Page[models.MarketplaceResponse]{}, err
 	}
-	return responses, nil
+	return models.MapPage(listings, func(l models.Marketplace) models.MarketplaceResponse {
+		return l.ToResponse()
+	}), nil
 }
 
-func (s *marketplaceService) GetListingByID(id uint) (*models.MarketplaceResponse, error) {
-	listing, err := s.repo.FindByID(id)
+func (s *marketplaceService) GetListingByID(id, viewerID uint, viewer string) (*models.MarketplaceResponse, error) {
+	listing, err := s.repo.FindVisibleByID(id, viewerID)
 	if err != nil {
 		return nil, err
 	}
+	// 同一访客短时间内重复打开只计一次浏览
+	if s.views.Count(models.TrendingTypeListings, listing.ID, viewer) {
+		if err := s.repo.IncrementViews(listing.ID); err != nil {
+			log.Printf("MarketplaceService: failed to count view of listing %d: %v", listing.ID, err)
+		} else {
+			listing.Views++
+		}
+	}
 	response := listing.ToResponse()
 	return &response, nil
 }
 
-func (s *marketplaceService) CreateListing(listing *models.Marketplace, sellerID uint) (*models.MarketplaceResponse, error) {
+func (s *marketplaceService) CreateListing(listing *models.Marketplace, mediaIDs []uint, sellerID uint) (*models.MarketplaceResponse, error) {
+	media, err := s.media.ResolveOwned(sellerID, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
 	listing.SellerID = sellerID
+	listing.Media = media
 	newListing, err := s.repo.Create(listing)
 	if err != nil {
 		return nil, err
@@ -54,12 +83,12 @@ func (s *marketplaceService) CreateListing(listing *models.Marketplace, sellerID
 	return &response, nil
 }
 
-func (s *marketplaceService) UpdateListing(id, sellerID uint, req *models.UpdateListingRequest, userRole string) (*models.MarketplaceResponse, error) {
+func (s *marketplaceService) UpdateListing(id, sellerID uint, req *models.UpdateListingRequest) (*models.MarketplaceResponse, error) {
 	listing, err := s.repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
-	if listing.SellerID != sellerID && userRole != "admin" {
+	if listing.SellerID != sellerID && !s.authz.Can(sellerID, models.PermMarketplaceUpdateAny) {
 		return nil, errors.New("permission denied")
 	}
 
@@ -72,9 +101,6 @@ func (s *marketplaceService) UpdateListing(id, sellerID uint, req *models.Update
 	if req.Price != nil {
 		listing.Price = *req.Price
 	}
-	if req.ImageURLs != "" {
-		listing.ImageURLs = req.ImageURLs
-	}
 	if req.Category != "" {
 		listing.Category = req.Category
 	}
@@ -87,21 +113,33 @@ func (s *marketplaceService) UpdateListing(id, sellerID uint, req *models.Update
 	if req.Location != "" {
 		listing.Location = req.Location
 	}
+	var media []models.Media
+	if req.MediaIDs != nil {
+		if media, err = s.media.ResolveOwned(listing.SellerID, *req.MediaIDs); err != nil {
+			return nil, err
+		}
+	}
 
 	updatedListing, err := s.repo.Update(listing)
 	if err != nil {
 		return nil, err
 	}
+	if req.MediaIDs != nil {
+		if err := s.repo.ReplaceMedia(updatedListing, media); err != nil {
+			return nil, err
+		}
+		updatedListing.Media = media
+	}
 	response := updatedListing.ToResponse()
 	return &response, nil
 }
 
-func (s *marketplaceService) DeleteListing(id, sellerID uint, userRole string) error {
+func (s *marketplaceService) DeleteListing(id, sellerID uint) error {
 	listing, err := s.repo.FindByID(id)
 	if err != nil {
 		return err
 	}
-	if listing.SellerID != sellerID && userRole != "admin" {
+	if listing.SellerID != sellerID && !s.authz.Can(sellerID, models.PermMarketplaceDeleteAny) {
 		return errors.New("permission denied")
 	}
 	return s.repo.Delete(listing)
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/utils"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MediaService defines the interface for file uploads
+type MediaService interface {
+	Upload(ownerID uint, r io.Reader) (*models.MediaResponse, error)
+	// ResolveOwned loads the media with the given IDs, in the given order,
+	// failing with models.ErrMediaNotFound unless every one was uploaded by ownerID.
+	ResolveOwned(ownerID uint, ids []uint) ([]models.Media, error)
+	// RemoveFiles deletes the stored files of media whose records were removed
+	RemoveFiles(media []models.Media)
+}
+
+type mediaService struct {
+	repo    repositories.MediaRepository
+	store   repositories.BlobStore
+	maxSize int64
+}
+
+// NewMediaService creates a new instance of MediaService; uploads larger than maxSize bytes are rejected
+func NewMediaService(repo repositories.MediaRepository, store repositories.BlobStore, maxSize int64) MediaService {
+	return &mediaService{repo: repo, store: store, maxSize: maxSize}
+}
+
+var uploadExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+// Upload stores a file after checking its size and its type as sniffed from the content,
+// never trusting the client supplied file name or Content-Type.
+func (s *mediaService) Upload(ownerID uint, r io.Reader) (*models.MediaResponse, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, models.ErrFileTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	if !models.AllowedUploadTypes[contentType] {
+		return nil, fmt.Errorf("%w: %s", models.ErrUnsupportedMediaType, contentType)
+	}
+
+	base := path.Join(time.Now().Format("2006/01"), uuid.NewString())
+	media := &models.Media{
+		OwnerID:     ownerID,
+		Key:         base + uploadExtensions[contentType],
+		ContentType: contentType,
+	}
+
+	var thumbnail []byte
+	var thumbnailType string
+	if strings.HasPrefix(contentType, "image/") {
+		processed, err := utils.ProcessImage(data, contentType)
+		if err != nil {
+			if errors.Is(err, utils.ErrImageTooLarge) {
+				return nil, models.ErrImageTooLarge
+			}
+			return nil, fmt.Errorf("%w: %v", models.ErrUnsupportedMediaType, err)
+		}
+		data = processed.Data
+		thumbnail, thumbnailType = processed.Thumbnail, processed.ThumbnailContentType
+		media.Width, media.Height = processed.Width, processed.Height
+		media.ThumbnailKey = base + "_thumb" + uploadExtensions[thumbnailType]
+	}
+	media.Size = int64(len(data))
+
+	ctx := context.Background()
+	if err := s.store.Put(ctx, media.Key, data, contentType); err != nil {
+		return nil, err
+	}
+	media.URL = s.store.URL(media.Key)
+	if thumbnail != nil {
+		if err := s.store.Put(ctx, media.ThumbnailKey, thumbnail, thumbnailType); err != nil {
+			s.cleanup(media)
+			return nil, err
+		}
+		media.ThumbnailURL = s.store.URL(media.ThumbnailKey)
+	}
+
+	if _, err := s.repo.Create(media); err != nil {
+		s.cleanup(media)
+		return nil, err
+	}
+	response := media.ToResponse()
+	return &response, nil
+}
+
+func (s *mediaService) ResolveOwned(ownerID uint, ids []uint) ([]models.Media, error) {
+	if len(ids) == 0 {
+		return []models.Media{}, nil
+	}
+	if len(ids) > models.MaxMediaPerItem {
+		return nil, models.ErrTooManyMedia
+	}
+	found, err := s.repo.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Media, len(found))
+	for _, m := range found {
+		byID[m.ID] = m
+	}
+
+	media := make([]models.Media, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		m, ok := byID[id]
+		if !ok || m.OwnerID != ownerID {
+			return nil, models.ErrMediaNotFound
+		}
+		if !seen[id] {
+			seen[id] = true
+			media = append(media, m)
+		}
+	}
+	return media, nil
+}
+
+func (s *mediaService) RemoveFiles(media []models.Media) {
+	for i := range media {
+		s.cleanup(&media[i])
+	}
+}
+
+// cleanup removes the stored files of an upload that could not be completed
+func (s *mediaService) cleanup(media *models.Media) {
+	ctx := context.Background()
+	for _, key := range []string{media.Key, media.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			log.Printf("MediaService: failed to remove %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"strings"
+	"testing"
+)
+
+// fakeBlobStore keeps stored files in memory
+type fakeBlobStore struct {
+	files map[string][]byte
+}
+
+func (s *fakeBlobStore) Put(_ context.Context, key string, data []byte, _ string) error {
+	s.files[key] = data
+	return nil
+}
+
+func (s *fakeBlobStore) Delete(_ context.Context, key string) error {
+	delete(s.files, key)
+	return nil
+}
+
+func (s *fakeBlobStore) URL(key string) string { return "/uploads/" + key }
+
+// fakeMediaRepo records created media. Methods the tests do not need are left to the embedded
+// interface, so calling them panics.
+type fakeMediaRepo struct {
+	repositories.MediaRepository
+	created []models.Media
+}
+
+func (r *fakeMediaRepo) Create(media *models.Media) (*models.Media, error) {
+	media.ID = uint(len(r.created) + 1)
+	r.created = append(r.created, *media)
+	return media, nil
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withDimensions rewrites the size in the header of a PNG, which is all that is read before decoding
+func withDimensions(data []byte, w, h uint32) []byte {
+	out := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(out[16:], w)
+	binary.BigEndian.PutUint32(out[20:], h)
+	binary.BigEndian.PutUint32(out[29:], crc32.ChecksumIEEE(out[12:29]))
+	return out
+}
+
+func TestUpload(t *testing.T) {
+	picture := testPNG(t, 40, 20)
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+		wantErr  error
+	}{
+		{"image", picture, "image/png", nil},
+		{"pdf", []byte("%PDF-1.4\n%âãÏÓ\n1 0 obj\n"), "application/pdf", nil},
+		// the type comes from the content, so a script cannot pass itself off as a picture
+		{"html", []byte("<!DOCTYPE html><script>alert(1)</script>"), "", models.ErrUnsupportedMediaType},
+		{"executable", append([]byte("MZ\x90\x00"), make([]byte, 64)...), "", models.ErrUnsupportedMediaType},
+		{"corrupt image", picture[:40], "", models.ErrUnsupportedMediaType},
+		{"decompression bomb", withDimensions(picture, 10000, 10000), "", models.ErrImageTooLarge},
+		{"at the limit", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("x"), 1024-9)...), "application/pdf", nil},
+		{"oversize", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("x"), 1024)...), "", models.ErrFileTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, repo := &fakeBlobStore{files: map[string][]byte{}}, &fakeMediaRepo{}
+			service := NewMediaService(repo, store, 1024)
+
+			media, err := service.Upload(7, bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Upload error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(store.files) != 0 || len(repo.created) != 0 {
+					t.Fatalf("rejected upload was stored: %d files, %d records", len(store.files), len(repo.created))
+				}
+				return
+			}
+			stored := repo.created[0]
+			if stored.ContentType != tt.wantType || stored.OwnerID != 7 || store.files[stored.Key] == nil {
+				t.Fatalf("stored %+v", stored)
+			}
+			if media.URL != "/uploads/"+stored.Key {
+				t.Fatalf("URL = %s", media.URL)
+			}
+		})
+	}
+}
+
+func TestUploadImageThumbnail(t *testing.T) {
+	store, repo := &fakeBlobStore{files: map[string][]byte{}}, &fakeMediaRepo{}
+	service := NewMediaService(repo, store, 1<<20)
+
+	if _, err := service.Upload(7, bytes.NewReader(testPNG(t, 800, 400))); err != nil {
+		t.Fatal(err)
+	}
+	stored := repo.created[0]
+	if stored.Width != 800 || stored.Height != 400 || !strings.HasSuffix(stored.ThumbnailKey, "_thumb.png") {
+		t.Fatalf("stored %+v", stored)
+	}
+	thumb, err := png.DecodeConfig(bytes.NewReader(store.files[stored.ThumbnailKey]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Width != 320 || thumb.Height != 160 {
+		t.Fatalf("thumbnail is %dx%d, want 320x160", thumb.Width, thumb.Height)
+	}
+}
@@ -1,46 +1,165 @@
 package services
 
 import (
+	"errors"
+	"log"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
+	"time"
+	"unicode/utf8"
 )
 
 // NotificationService defines the interface for notification business logic
 type NotificationService interface {
-	GetNotifications(userID uint, limit, offset int) ([]models.NotificationResponse, error)
+	GetNotifications(userID uint, page models.PageQuery) (models.Page[models.NotificationResponse], error)
 	MarkAsRead(notificationID, userID uint) error
 	MarkAllAsRead(userID uint) error
+	GetUnreadCount(userID uint) (int64, error)
+
+	// Notify stores a new notification for its recipient.
+	// Notifications a user would send to themselves, or that come from a user the
+	// recipient has muted or has a block with, are silently dropped.
+	// Connected clients of the recipient receive the notification instantly.
+	Notify(notification *models.Notification) error
+	// NotifyOnce is Notify for events that repeat, such as new messages in a conversation: while the
+	// recipient has an unread notification of the same type about the same resource, nothing is added.
+	NotifyOnce(notification *models.Notification) error
 }
 
 type notificationService struct {
-	repo repositories.NotificationRepository
+	repo   repositories.NotificationRepository
+	blocks repositories.BlockRepository
+	hub    *Hub
 }
 
-// NewNotificationService creates a new instance of NotificationService
-func NewNotificationService(repo repositories.NotificationRepository) NotificationService {
-	return &notificationService{repo: repo}
+// NewNotificationService creates a new instance of NotificationService.
+// The hub may be nil, in which case notifications are only stored.
+func NewNotificationService(repo repositories.NotificationRepository, blocks repositories.BlockRepository, hub *Hub) NotificationService {
+	return &notificationService{repo: repo, blocks: blocks, hub: hub}
 }
 
-func (s *notificationService) GetNotifications(userID uint, limit, offset int) ([]models.NotificationResponse, error) {
-	notifications, err := s.repo.FindByUserID(userID, limit, offset)
+func (s *notificationService) GetNotifications(userID uint, page models.PageQuery) (models.Page[models.NotificationResponse], error) {
+	notifications, err := s.repo.FindByUserID(userID, page)
 	if err != nil {
-		return nil, err
-	}
-	var responses []models.NotificationResponse
-	for _, n := range notifications {
-		responses = append(responses, n.ToResponse())
+		return models.Page[models.NotificationResponse]{}, err
 	}
-	return responses, nil
+	return models.MapPage(notifications, func(n models.Notification) models.NotificationResponse {
+		return n.ToResponse()
+	}), nil
 }
 
 func (s *notificationService) MarkAsRead(notificationID, userID uint) error {
-	// In a real application, you'd want to find the notification first to ensure the user owns it.
-	// For simplicity here, we'll just update it directly.
-	// This would require a FindByID method in the repository.
-	notification := &models.Notification{ID: notificationID}
-	return s.repo.MarkAsRead(notification)
+	notification, err := s.repo.FindByID(notificationID)
+	if err != nil {
+		return err
+	}
+	if notification.UserID != userID {
+		return errors.New("permission denied")
+	}
+	if err := s.repo.MarkAsRead(notification); err != nil {
+		return err
+	}
+	s.pushUnreadCount(userID)
+	return nil
 }
 
 func (s *notificationService) MarkAllAsRead(userID uint) error {
-	return s.repo.MarkAllAsRead(userID)
+	if err := s.repo.MarkAllAsRead(userID); err != nil {
+		return err
+	}
+	s.pushUnreadCount(userID)
+	return nil
+}
+
+func (s *notificationService) GetUnreadCount(userID uint) (int64, error) {
+	return s.repo.CountUnread(userID)
+}
+
+func (s *notificationService) Notify(notification *models.Notification) error {
+	if notification.UserID == 0 {
+		return nil
+	}
+	if notification.SenderID != nil {
+		if *notification.SenderID == notification.UserID {
+			return nil
+		}
+		if silenced, err := s.silenced(notification.UserID, *notification.SenderID); err != nil || silenced {
+			return err
+		}
+	}
+	notification.Title = truncateRunes(notification.Title, 100)
+	notification.Message = truncateRunes(notification.Message, 500)
+	if _, err := s.repo.Create(notification); err != nil {
+		return err
+	}
+	s.push(notification)
+	return nil
+}
+
+func (s *notificationService) NotifyOnce(notification *models.Notification) error {
+	pending, err := s.repo.HasUnread(notification.UserID, notification.Type, notification.ResourceType, notification.ResourceID)
+	if err != nil || pending {
+		return err
+	}
+	return s.Notify(notification)
+}
+
+// silenced reports whether the recipient does not want notifications from the sender
+func (s *notificationService) silenced(recipientID, senderID uint) (bool, error) {
+	muted, err := s.blocks.IsMuted(recipientID, senderID)
+	if err != nil || muted {
+		return muted, err
+	}
+	return s.blocks.IsBlocked(recipientID, senderID)
+}
+
+// push sends a freshly stored notification to the recipient's open connections.
+func (s *notificationService) push(notification *models.Notification) {
+	if s.hub == nil {
+		return
+	}
+	// Reload so the sender is included in the payload
+	loaded, err := s.repo.FindByID(notification.ID)
+	if err != nil {
+		log.Printf("NotificationService: failed to reload notification %d for push: %v", notification.ID, err)
+		loaded = notification
+	}
+	unread, err := s.repo.CountUnread(notification.UserID)
+	if err != nil {
+		log.Printf("NotificationService: failed to count unread notifications for user %d: %v", notification.UserID, err)
+	}
+	s.hub.SendToUser(notification.UserID, &models.WebsocketMessage{
+		Type: models.WSTypeNotification,
+		Payload: models.NotificationPushPayload{
+			Notification: loaded.ToResponse(),
+			UnreadCount:  unread,
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// pushUnreadCount keeps the badge of every open client in sync after notifications are read.
+func (s *notificationService) pushUnreadCount(userID uint) {
+	if s.hub == nil {
+		return
+	}
+	unread, err := s.repo.CountUnread(userID)
+	if err != nil {
+		log.Printf("NotificationService: failed to count unread notifications for user %d: %v", userID, err)
+		return
+	}
+	s.hub.SendToUser(userID, &models.WebsocketMessage{
+		Type:      models.WSTypeUnreadCount,
+		Payload:   models.UnreadCountPayload{UnreadCount: unread},
+		Timestamp: time.Now(),
+	})
+}
+
+// truncateRunes shortens s to at most max runes, marking the cut with an ellipsis.
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
 }
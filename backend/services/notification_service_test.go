@@ -0,0 +1,68 @@
+package services
+
+import (
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"testing"
+)
+
+// fakeNotificationRepo keeps notifications in memory. Methods the tests do not need are left to the
+// embedded interface, so calling them panics.
+type fakeNotificationRepo struct {
+	repositories.NotificationRepository
+	stored []models.Notification
+}
+
+func (r *fakeNotificationRepo) Create(notification *models.Notification) (*models.Notification, error) {
+	notification.ID = uint(len(r.stored) + 1)
+	r.stored = append(r.stored, *notification)
+	return notification, nil
+}
+
+func (r *fakeNotificationRepo) HasUnread(userID uint, notificationType models.NotificationType, resourceType string, resourceID uint) (bool, error) {
+	for _, n := range r.stored {
+		if n.UserID == userID && n.Type == notificationType && n.ResourceType == resourceType && n.ResourceID == resourceID && !n.IsRead {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Repeated messages in a conversation add a notification only once the earlier one was read
+func TestNotifyOnce(t *testing.T) {
+	const alice, bob = 1, 2
+	repo := &fakeNotificationRepo{}
+	service := NewNotificationService(repo, fakeBlocks{}, nil)
+	senderID := uint(alice)
+	message := func(conversationID uint) *models.Notification {
+		return &models.Notification{
+			UserID: bob, SenderID: &senderID, Title: "New message", Message: "hi",
+			Type: models.NotificationMessage, ResourceType: "conversation", ResourceID: conversationID,
+		}
+	}
+
+	for _, step := range []struct {
+		name string
+		// read marks every stored notification as read first
+		read         bool
+		conversation uint
+		want         int
+	}{
+		{"first message", false, 1, 1},
+		{"second message", false, 1, 1},
+		{"other conversation", false, 2, 2},
+		{"after reading", true, 1, 3},
+	} {
+		if step.read {
+			for i := range repo.stored {
+				repo.stored[i].IsRead = true
+			}
+		}
+		if err := service.NotifyOnce(message(step.conversation)); err != nil {
+			t.Fatal(err)
+		}
+		if len(repo.stored) != step.want {
+			t.Fatalf("%s: %d notifications stored, want %d", step.name, len(repo.stored), step.want)
+		}
+	}
+}
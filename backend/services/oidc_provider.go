@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCConfig configures the OpenID Connect provider used for campus single sign-on
+type OIDCConfig struct {
+	Issuer string
+	// ClientSecret is empty for a public client, which then relies on PKCE alone
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the page of the client the provider sends the browser back to
+	RedirectURL string
+	Scopes      []string
+
+	// Claims the account details are read from, as named by the provider
+	UsernameClaim  string
+	EmailClaim     string
+	NameClaim      string
+	StudentIdClaim string
+}
+
+// oidcDiscovery is the part of the provider metadata (/.well-known/openid-configuration) that is used
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+}
+
+// jwksRefreshInterval limits how often an unknown key ID makes the provider keys be fetched again
+const jwksRefreshInterval = time.Minute
+
+// oidcProvider speaks the OpenID Connect protocol with a single provider. The metadata is fetched
+// on first use rather than at startup, so the API still starts while the provider is unreachable.
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+func newOIDCProvider(cfg OIDCConfig) *oidcProvider {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &oidcProvider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *oidcProvider) metadata() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery oidcDiscovery
+	if err := p.do(req, &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", discovery.Issuer, p.cfg.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// authCodeURL returns the authorization request URL, with the S256 challenge of the PKCE verifier
+func (p *oidcProvider) authCodeURL(state, nonce, verifier string) (string, error) {
+	discovery, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// exchange redeems an authorization code at the token endpoint
+func (p *oidcProvider) exchange(code, verifier string) (*oidcTokenResponse, error) {
+	discovery, err := p.metadata()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens oidcTokenResponse
+	if err := p.do(req, &tokens); err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("oidc token exchange: no id_token in response")
+	}
+	return &tokens, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, lifetime and nonce of an ID token
+func (p *oidcProvider) verifyIDToken(raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithJSONNumber(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %w", err)
+	}
+	if claimString(claims, "nonce") != nonce {
+		return nil, errors.New("oidc id token: nonce mismatch")
+	}
+	if claimString(claims, "sub") == "" {
+		return nil, errors.New("oidc id token: missing subject")
+	}
+	return claims, nil
+}
+
+// userInfo fetches the claims of the userinfo endpoint, which some providers only fill there
+func (p *oidcProvider) userInfo(accessToken string) (map[string]interface{}, error) {
+	discovery, err := p.metadata()
+	if err != nil || discovery.UserinfoEndpoint == "" || accessToken == "" {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	claims := map[string]interface{}{}
+	if err := p.do(req, &claims); err != nil {
+		return nil, fmt.Errorf("oidc userinfo: %w", err)
+	}
+	return claims, nil
+}
+
+// key returns the provider signing key with the given ID, fetching the key set again if it is unknown
+func (p *oidcProvider) key(kid string) (interface{}, error) {
+	discovery, err := p.metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// 跳过无法识别的密钥类型，不影响其余密钥
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by ID; tokens without a key ID are accepted when the provider has a single key
+func (p *oidcProvider) lookupKey(kid string) (interface{}, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// do sends a request and decodes its JSON response into v, turning OAuth error responses into errors
+func (p *oidcProvider) do(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return fmt.Errorf("%s: %s (%s)", resp.Status, oauthErr.Error, oauthErr.Description)
+		}
+		return errors.New(resp.Status)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// jsonWebKey is a public key of a JWK set (RFC 7517), RSA or elliptic curve
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("jwk: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwk: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("jwk: point not on curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("jwk: unsupported key type %q", k.Kty)
+}
+
+// claimString reads a claim as a string; numeric claims such as student numbers are formatted
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
+
+// claimBool reads a boolean claim; some providers send booleans as strings
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true")
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
 	"strconv"
@@ -11,8 +13,9 @@ import (
 
 type PartnerService interface {
 	CreatePartner(req *models.CreatePartnerRequest, authorID uint) (*models.Partner, error)
-	GetPartners(params map[string]string, page, limit int) ([]models.Partner, int64, error)
-	GetPartnerByID(id string) (*models.Partner, error)
+	// GetPartners lists partner requests; viewerID is 0 for anonymous visitors
+	GetPartners(params map[string]string, viewerID uint, page models.PageQuery) (models.Page[models.Partner], error)
+	GetPartnerByID(id string, viewerID uint) (*models.Partner, error)
 	UpdatePartner(id string, req *models.UpdatePartnerRequest, userID uint) (*models.Partner, error)
 	DeletePartner(id string, userID uint) error
 	JoinPartner(partnerID string, userID uint) error
@@ -22,11 +25,13 @@ type PartnerService interface {
 }
 
 type partnerService struct {
-	repo repositories.PartnerRepository
+	repo          repositories.PartnerRepository
+	notifications NotificationService
+	authz         Authorizer
 }
 
-func NewPartnerService(repo repositories.PartnerRepository) PartnerService {
-	return &partnerService{repo: repo}
+func NewPartnerService(repo repositories.PartnerRepository, notifications NotificationService, authz Authorizer) PartnerService {
+	return &partnerService{repo: repo, notifications: notifications, authz: authz}
 }
 
 func (s *partnerService) CreatePartner(req *models.CreatePartnerRequest, authorID uint) (*models.Partner, error) {
@@ -63,12 +68,12 @@ func (s *partnerService) CreatePartner(req *models.CreatePartnerRequest, authorI
 	return s.repo.FindByID(partnerID)
 }
 
-func (s *partnerService) GetPartners(params map[string]string, page, limit int) ([]models.Partner, int64, error) {
-	return s.repo.FindAll(params, page, limit)
+func (s *partnerService) GetPartners(params map[string]string, viewerID uint, page models.PageQuery) (models.Page[models.Partner], error) {
+	return s.repo.FindAll(params, viewerID, page)
 }
 
-func (s *partnerService) GetPartnerByID(id string) (*models.Partner, error) {
-	return s.repo.FindByID(id)
+func (s *partnerService) GetPartnerByID(id string, viewerID uint) (*models.Partner, error) {
+	return s.repo.FindVisibleByID(id, viewerID)
 }
 
 func (s *partnerService) UpdatePartner(id string, req *models.UpdatePartnerRequest, userID uint) (*models.Partner, error) {
@@ -79,7 +84,7 @@ func (s *partnerService) UpdatePartner(id string, req *models.UpdatePartnerReque
 
 	// 将 userID 转换为 string 以进行比较
 	userIDStr := strconv.FormatUint(uint64(userID), 10)
-	if partner.AuthorID != userIDStr {
+	if partner.AuthorID != userIDStr && !s.authz.Can(userID, models.PermPartnerUpdateAny) {
 		return nil, errors.New("user is not the author")
 	}
 
@@ -137,7 +142,7 @@ func (s *partnerService) DeletePartner(id string, userID uint) error {
 
 	// 将 userID 转换为 string 以进行比较
 	userIDStr := strconv.FormatUint(uint64(userID), 10)
-	if partner.AuthorID != userIDStr {
+	if partner.AuthorID != userIDStr && !s.authz.Can(userID, models.PermPartnerDeleteAny) {
 		return errors.New("user is not the author")
 	}
 	return s.repo.Delete(id)
@@ -173,7 +178,26 @@ func (s *partnerService) JoinPartner(partnerID string, userID uint) error {
 		return errors.New("user already joined")
 	}
 
-	return s.repo.AddParticipant(partnerID, userIDStr)
+	if err := s.repo.AddParticipant(partnerID, userIDStr); err != nil {
+		return err
+	}
+
+	// AuthorID 以字符串形式存储，需要转换回 uint
+	authorID, err := strconv.ParseUint(partner.AuthorID, 10, 64)
+	if err != nil {
+		log.Printf("PartnerService: invalid author id %q on partner %s: %v", partner.AuthorID, partnerID, err)
+		return nil
+	}
+	s.notify(&models.Notification{
+		UserID:       uint(authorID),
+		SenderID:     &userID,
+		Title:        "New partner",
+		Message:      fmt.Sprintf("Someone joined your partner request \"%s\"", partner.Title),
+		Type:         models.NotificationEvent,
+		ResourceType: "partner",
+		ResourceRef:  partner.ID,
+	})
+	return nil
 }
 
 func (s *partnerService) LeavePartner(partnerID string, userID uint) error {
@@ -207,3 +231,10 @@ func (s *partnerService) GetPartnerCategories() ([]string, error) {
 func (s *partnerService) GetPartnerTypes() ([]string, error) {
 	return s.repo.FindTypes()
 }
+
+// notify delivers a notification without failing the action that triggered it.
+func (s *partnerService) notify(notification *models.Notification) {
+	if err := s.notifications.Notify(notification); err != nil {
+		log.Printf("PartnerService: failed to create notification for user %d: %v", notification.UserID, err)
+	}
+}
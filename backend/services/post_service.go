@@ -2,62 +2,93 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
 )
 
 // PostService defines the interface for post business logic
 type PostService interface {
-	GetPosts(limit, offset int) ([]models.PostResponse, error)
-	GetPostByID(id, currentUserID uint) (*models.PostResponse, error)
+	GetPosts(viewerID uint, page models.PageQuery) (models.Page[models.PostResponse], error)
+	// GetUserPosts lists the posts of userID that viewerID is allowed to see
+	GetUserPosts(userID, viewerID uint, page models.PageQuery) (models.Page[models.PostResponse], error)
+	// GetPostByID returns the post and counts a view of it by viewer, see ViewCounter
+	GetPostByID(id, currentUserID uint, viewer string) (*models.PostResponse, error)
 	CreatePost(req *models.CreatePostRequest, userID uint) (*models.PostResponse, error)
-	UpdatePost(id, userID uint, req *models.UpdatePostRequest, userRole string) (*models.PostResponse, error)
-	DeletePost(id, userID uint, userRole string) error
+	UpdatePost(id, userID uint, req *models.UpdatePostRequest) (*models.PostResponse, error)
+	DeletePost(id, userID uint) error
 
 	LikePost(postID, userID uint) error
 	UnlikePost(postID, userID uint) error
 
 	CreateComment(postID, userID uint, content string) (*models.CommentResponse, error)
 	UpdateComment(commentID, userID uint, content string) (*models.CommentResponse, error)
-	DeleteComment(commentID, userID uint, userRole string) error
-	SearchPosts(keyword string, page, limit int, sort string) ([]models.Post, int64, error)
+	DeleteComment(commentID, userID uint) error
+	SearchPosts(keyword, sort string, viewerID uint, page models.PageQuery) (models.Page[models.Post], error)
 }
 
 type postService struct {
-	repo repositories.PostRepository
+	repo          repositories.PostRepository
+	media         MediaService
+	notifications NotificationService
+	authz         Authorizer
+	views         ViewCounter
 }
 
 // NewPostService creates a new instance of PostService
-func NewPostService(repo repositories.PostRepository) PostService {
-	return &postService{repo: repo}
+func NewPostService(repo repositories.PostRepository, media MediaService, notifications NotificationService, authz Authorizer, views ViewCounter) PostService {
+	return &postService{repo: repo, media: media, notifications: notifications, authz: authz, views: views}
 }
 
-func (s *postService) GetPosts(limit, offset int) ([]models.PostResponse, error) {
-	posts, err := s.repo.FindAll(limit, offset)
+func (s *postService) GetPosts(viewerID uint, page models.PageQuery) (models.Page[models.PostResponse], error) {
+	posts, err := s.repo.FindAll(viewerID, page)
 	if err != nil {
-		return nil, err
+		return models.Page[models.PostResponse]{}, err
 	}
-	var responses []models.PostResponse
-	for _, p := range posts {
-		responses = append(responses, p.ToResponse(0)) // User not logged in
+	return models.MapPage(posts, func(p models.Post) models.PostResponse {
+		return p.ToResponse(viewerID)
+	}), nil
+}
+
+func (s *postService) GetUserPosts(userID, viewerID uint, page models.PageQuery) (models.Page[models.PostResponse], error) {
+	posts, err := s.repo.FindByUser(userID, viewerID, page)
+	if err != nil {
+		return models.Page[models.PostResponse]{}, err
 	}
-	return responses, nil
+	return models.MapPage(posts, func(p models.Post) models.PostResponse {
+		return p.ToResponse(viewerID)
+	}), nil
 }
 
-func (s *postService) GetPostByID(id, currentUserID uint) (*models.PostResponse, error) {
-	post, err := s.repo.FindByID(id)
+func (s *postService) GetPostByID(id, currentUserID uint, viewer string) (*models.PostResponse, error) {
+	post, err := s.repo.FindVisibleByID(id, currentUserID)
 	if err != nil {
 		return nil, err
 	}
+	// 同一访客短时间内重复打开只计一次浏览
+	if s.views.Count(models.TrendingTypePosts, post.ID, viewer) {
+		if err := s.repo.IncrementViews(post.ID); err != nil {
+			log.Printf("PostService: failed to count view of post %d: %v", post.ID, err)
+		} else {
+			post.ViewsCount++
+		}
+	}
 	response := post.ToResponse(currentUserID)
 	return &response, nil
 }
 
 func (s *postService) CreatePost(req *models.CreatePostRequest, userID uint) (*models.PostResponse, error) {
+	media, err := s.media.ResolveOwned(userID, req.MediaIDs)
+	if err != nil {
+		return nil, err
+	}
 	post := &models.Post{
-		UserID:  userID,
-		Title:   req.Title,
-		Content: req.Content,
+		UserID:     userID,
+		Title:      req.Title,
+		Content:    req.Content,
+		Visibility: normalizeVisibility(req.Visibility),
+		Media:      media,
 	}
 	newPost, err := s.repo.Create(post)
 	if err != nil {
@@ -67,12 +98,12 @@ func (s *postService) CreatePost(req *models.CreatePostRequest, userID uint) (*m
 	return &response, nil
 }
 
-func (s *postService) UpdatePost(id, userID uint, req *models.UpdatePostRequest, userRole string) (*models.PostResponse, error) {
+func (s *postService) UpdatePost(id, userID uint, req *models.UpdatePostRequest) (*models.PostResponse, error) {
 	post, err := s.repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
-	if post.UserID != userID && userRole != "admin" {
+	if post.UserID != userID && !s.authz.Can(userID, models.PermPostUpdateAny) {
 		return nil, errors.New("permission denied")
 	}
 	if req.Title != "" {
@@ -81,27 +112,47 @@ func (s *postService) UpdatePost(id, userID uint, req *models.UpdatePostRequest,
 	if req.Content != "" {
 		post.Content = req.Content
 	}
+	if req.Visibility != "" {
+		post.Visibility = normalizeVisibility(req.Visibility)
+	}
+	// Attached media must belong to the author, also when an admin edits the post
+	var media []models.Media
+	if req.MediaIDs != nil {
+		if media, err = s.media.ResolveOwned(post.UserID, *req.MediaIDs); err != nil {
+			return nil, err
+		}
+	}
 	updatedPost, err := s.repo.Update(post)
 	if err != nil {
 		return nil, err
 	}
+	if req.MediaIDs != nil {
+		if err := s.repo.ReplaceMedia(updatedPost, media); err != nil {
+			return nil, err
+		}
+		updatedPost.Media = media
+	}
 	response := updatedPost.ToResponse(userID)
 	return &response, nil
 }
 
-func (s *postService) DeletePost(id, userID uint, userRole string) error {
+func (s *postService) DeletePost(id, userID uint) error {
 	post, err := s.repo.FindByID(id)
 	if err != nil {
 		return err
 	}
-	if post.UserID != userID && userRole != "admin" {
+	if post.UserID != userID && !s.authz.Can(userID, models.PermPostDeleteAny) {
 		return errors.New("permission denied")
 	}
 	return s.repo.Delete(post)
 }
 
 func (s *postService) LikePost(postID, userID uint) error {
-	_, err := s.repo.FindLike(userID, postID)
+	post, err := s.repo.FindVisibleByID(postID, userID)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.FindLike(userID, postID)
 	if err == nil {
 		return errors.New("already liked")
 	}
@@ -109,7 +160,20 @@ func (s *postService) LikePost(postID, userID uint) error {
 		UserID: userID,
 		PostID: postID,
 	}
-	return s.repo.CreateLike(like)
+	if err := s.repo.CreateLike(like); err != nil {
+		return err
+	}
+
+	s.notify(&models.Notification{
+		UserID:       post.UserID,
+		SenderID:     &userID,
+		Title:        "New like",
+		Message:      fmt.Sprintf("Your post \"%s\" received a new like", post.Title),
+		Type:         models.NotificationLike,
+		ResourceType: "post",
+		ResourceID:   post.ID,
+	})
+	return nil
 }
 
 func (s *postService) UnlikePost(postID, userID uint) error {
@@ -117,6 +181,9 @@ func (s *postService) UnlikePost(postID, userID uint) error {
 }
 
 func (s *postService) CreateComment(postID, userID uint, content string) (*models.CommentResponse, error) {
+	if _, err := s.repo.FindVisibleByID(postID, userID); err != nil {
+		return nil, err
+	}
 	comment := &models.Comment{
 		PostID:  postID,
 		UserID:  userID,
@@ -132,6 +199,15 @@ func (s *postService) CreateComment(postID, userID uint, content string) (*model
 		return nil, err
 	}
 	newComment.Post = *loadedPost
+	s.notify(&models.Notification{
+		UserID:       loadedPost.UserID,
+		SenderID:     &userID,
+		Title:        "New comment",
+		Message:      fmt.Sprintf("New comment on \"%s\": %s", loadedPost.Title, content),
+		Type:         models.NotificationComment,
+		ResourceType: "post",
+		ResourceID:   loadedPost.ID,
+	})
 	response := newComment.ToResponse()
 	return &response, nil
 }
@@ -153,17 +229,36 @@ func (s *postService) UpdateComment(commentID, userID uint, content string) (*mo
 	return &response, nil
 }
 
-func (s *postService) DeleteComment(commentID, userID uint, userRole string) error {
+func (s *postService) DeleteComment(commentID, userID uint) error {
 	comment, err := s.repo.FindCommentByID(commentID)
 	if err != nil {
 		return err
 	}
-	if comment.UserID != userID && userRole != "admin" {
+	if comment.UserID != userID && !s.authz.Can(userID, models.PermPostCommentDeleteAny) {
 		return errors.New("permission denied")
 	}
 	return s.repo.DeleteComment(comment)
 }
 
-func (s *postService) SearchPosts(keyword string, page, limit int, sort string) ([]models.Post, int64, error) {
-	return s.repo.SearchPosts(keyword, page, limit, sort)
+func (s *postService) SearchPosts(keyword, sort string, viewerID uint, page models.PageQuery) (models.Page[models.Post], error) {
+	return s.repo.SearchPosts(keyword, sort, viewerID, page)
+}
+
+// normalizeVisibility maps the legacy "friends" value onto followers-only and defaults to public.
+func normalizeVisibility(visibility string) string {
+	switch visibility {
+	case models.PostVisibilityFollowers, models.PostVisibilityFriends:
+		return models.PostVisibilityFollowers
+	case models.PostVisibilityPrivate:
+		return models.PostVisibilityPrivate
+	default:
+		return models.PostVisibilityPublic
+	}
+}
+
+// notify delivers a notification without failing the action that triggered it.
+func (s *postService) notify(notification *models.Notification) {
+	if err := s.notifications.Notify(notification); err != nil {
+		log.Printf("PostService: failed to create notification for user %d: %v", notification.UserID, err)
+	}
 }
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestNormalizeVisibility(t *testing.T) {
+	tests := map[string]string{
+		"":                             models.PostVisibilityPublic,
+		models.PostVisibilityPublic:    models.PostVisibilityPublic,
+		models.PostVisibilityFollowers: models.PostVisibilityFollowers,
+		models.PostVisibilityFriends:   models.PostVisibilityFollowers,
+		models.PostVisibilityPrivate:   models.PostVisibilityPrivate,
+		"everyone":                     models.PostVisibilityPublic,
+	}
+	for visibility, want := range tests {
+		if got := normalizeVisibility(visibility); got != want {
+			t.Errorf("normalizeVisibility(%q) = %q, want %q", visibility, got, want)
+		}
+	}
+}
+
+// fakePostRepo holds posts in memory. Like the database, FindVisibleByID hides posts of users the
+// viewer has a block with in either direction.
+type fakePostRepo struct {
+	repositories.PostRepository
+	blocks   fakeBlocks
+	posts    map[uint]*models.Post
+	likes    []models.Like
+	comments []models.Comment
+}
+
+func (r *fakePostRepo) FindByID(id uint) (*models.Post, error) {
+	post, ok := r.posts[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *post
+	return &found, nil
+}
+
+func (r *fakePostRepo) FindVisibleByID(id, viewerID uint) (*models.Post, error) {
+	post, err := r.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if blocked, _ := r.blocks.IsBlocked(viewerID, post.UserID); blocked && viewerID != 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return post, nil
+}
+
+func (r *fakePostRepo) FindLike(userID, postID uint) (*models.Like, error) {
+	for _, like := range r.likes {
+		if like.UserID == userID && like.PostID == postID {
+			return &like, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakePostRepo) CreateLike(like *models.Like) error {
+	r.likes = append(r.likes, *like)
+	return nil
+}
+
+func (r *fakePostRepo) CreateComment(comment *models.Comment) (*models.Comment, error) {
+	comment.ID = uint(len(r.comments) + 1)
+	r.comments = append(r.comments, *comment)
+	return comment, nil
+}
+
+// A block in either direction stops likes and comments on the other user's posts
+func TestPostInteractionsRefusedWhenBlocked(t *testing.T) {
+	const alice, bob = 1, 2
+	for _, pair := range [][2]uint{{alice, bob}, {bob, alice}} {
+		repo := &fakePostRepo{blocks: fakeBlocks{pairs: [][2]uint{pair}}, posts: map[uint]*models.Post{
+			1: {ID: 1, UserID: bob, Title: "bob's post"},
+		}}
+		notifications := &recordedNotifications{}
+		service := NewPostService(repo, nil, notifications, nil, nil)
+
+		if err := service.LikePost(1, alice); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("%d blocked %d: LikePost error = %v", pair[0], pair[1], err)
+		}
+		if _, err := service.CreateComment(1, alice, "hi"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("%d blocked %d: CreateComment error = %v", pair[0], pair[1], err)
+		}
+		if len(repo.likes) != 0 || len(repo.comments) != 0 || len(notifications.sent) != 0 {
+			t.Fatalf("%d blocked %d: like or comment stored", pair[0], pair[1])
+		}
+	}
+
+	// without the block both go through
+	repo := &fakePostRepo{posts: map[uint]*models.Post{1: {ID: 1, UserID: bob, Title: "bob's post"}}}
+	service := NewPostService(repo, nil, &recordedNotifications{}, nil, nil)
+	if err := service.LikePost(1, alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.CreateComment(1, alice, "hi"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"time"
+)
+
+// PresenceService tracks who is online from the open WebSocket connections of the hub
+type PresenceService interface {
+	// Get returns the presence of userID as seen by viewerID. Users who hide their presence,
+	// or who have a block with the viewer, always appear offline without a last-seen time.
+	Get(userID, viewerID uint) (*models.Presence, error)
+	// SetHidden hides or shows the user's presence and tells their contacts
+	SetHidden(userID uint, hidden bool) (*models.Presence, error)
+	// Start subscribes to connection changes of the hub, recording last-seen times and
+	// pushing presence events to the contacts of the user
+	Start()
+}
+
+type presenceService struct {
+	hub      *Hub
+	userRepo repositories.UserRepository
+	chatRepo repositories.ChatRepository
+	blocks   repositories.BlockRepository
+}
+
+// NewPresenceService creates a new instance of PresenceService
+func NewPresenceService(hub *Hub, userRepo repositories.UserRepository, chatRepo repositories.ChatRepository, blocks repositories.BlockRepository) PresenceService {
+	return &presenceService{hub: hub, userRepo: userRepo, chatRepo: chatRepo, blocks: blocks}
+}
+
+func (s *presenceService) Get(userID, viewerID uint) (*models.Presence, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if userID == viewerID {
+		presence := s.presenceOf(user)
+		presence.Hidden = user.HidePresence
+		return presence, nil
+	}
+
+	if user.HidePresence {
+		return &models.Presence{UserID: userID, Status: models.PresenceOffline}, nil
+	}
+	blocked, err := s.blocks.IsBlocked(userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return &models.Presence{UserID: userID, Status: models.PresenceOffline}, nil
+	}
+	return s.presenceOf(user), nil
+}
+
+func (s *presenceService) SetHidden(userID uint, hidden bool) (*models.Presence, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.HidePresence != hidden {
+		user.HidePresence = hidden
+		if _, err := s.userRepo.Update(user, "hide_presence"); err != nil {
+			return nil, err
+		}
+		// 隐藏后联系人看到离线，取消隐藏后看到真实状态
+		if hidden {
+			s.push(user, &models.Presence{UserID: userID, Status: models.PresenceOffline})
+		} else {
+			s.push(user, s.presenceOf(user))
+		}
+	}
+
+	presence := s.presenceOf(user)
+	presence.Hidden = user.HidePresence
+	return presence, nil
+}
+
+func (s *presenceService) Start() {
+	s.hub.OnPresenceChange(s.changed)
+}
+
+// changed records the last-seen time of a user who went offline and tells their contacts
+func (s *presenceService) changed(userID uint) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		log.Printf("PresenceService: failed to load user %d: %v", userID, err)
+		return
+	}
+	if !s.hub.IsOnline(userID) {
+		now := time.Now()
+		user.LastSeenAt = &now
+		if _, err := s.userRepo.Update(user, "last_seen_at"); err != nil {
+			log.Printf("PresenceService: failed to record last seen time of user %d: %v", userID, err)
+		}
+	}
+	if !user.HidePresence {
+		s.push(user, s.presenceOf(user))
+	}
+}
+
+// presenceOf returns the actual presence of the user
+func (s *presenceService) presenceOf(user *models.User) *models.Presence {
+	if s.hub.IsOnline(user.ID) {
+		return &models.Presence{UserID: user.ID, Status: models.PresenceOnline}
+	}
+	return &models.Presence{UserID: user.ID, Status: models.PresenceOffline, LastSeenAt: user.LastSeenAt}
+}
+
+// push sends a presence event to the contacts of the user, except those who have a block with them
+func (s *presenceService) push(user *models.User, presence *models.Presence) {
+	contactIDs, err := s.chatRepo.FindContactIDs(user.ID)
+	if err != nil {
+		log.Printf("PresenceService: failed to load contacts of user %d: %v", user.ID, err)
+		return
+	}
+
+	message := &models.WebsocketMessage{
+		Type:      models.WSTypePresence,
+		Payload:   presence,
+		Timestamp: time.Now(),
+	}
+	for _, contactID := range contactIDs {
+		if !s.hub.IsOnline(contactID) {
+			continue
+		}
+		blocked, err := s.blocks.IsBlocked(user.ID, contactID)
+		if err != nil || blocked {
+			continue
+		}
+		s.hub.SendToUser(contactID, message)
+	}
+}
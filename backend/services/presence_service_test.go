@@ -0,0 +1,55 @@
+package services
+
+import (
+	"nhcommunity/models"
+	"testing"
+	"time"
+)
+
+// Users who hide their presence, or who have a block with the viewer, look offline without a last-seen time
+func TestPresenceSeenByOthers(t *testing.T) {
+	const alice, bob, carol = 1, 2, 3
+	lastSeen := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name   string
+		hidden bool
+		blocks [][2]uint
+		online bool
+		viewer uint
+		// wantOnline and wantLastSeen are what the viewer sees of bob
+		wantOnline   bool
+		wantLastSeen bool
+	}{
+		{"online", false, nil, true, alice, true, false},
+		{"offline", false, nil, false, alice, false, true},
+		{"hidden", true, nil, true, alice, false, false},
+		{"hidden and offline", true, nil, false, alice, false, false},
+		{"hidden, seen by the user themselves", true, nil, true, bob, true, false},
+		{"blocked the viewer", false, [][2]uint{{bob, alice}}, true, alice, false, false},
+		{"blocked by the viewer", false, [][2]uint{{alice, bob}}, false, alice, false, false},
+		{"blocked someone else", false, [][2]uint{{bob, alice}}, true, carol, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testUser(bob, "bob")
+			user.HidePresence, user.LastSeenAt = tt.hidden, &lastSeen
+			users := newFakeUserRepo(testUser(alice, "alice"), user, testUser(carol, "carol"))
+			blocks := fakeBlocks{pairs: tt.blocks}
+			hub, server := newChatServer(t, NewChatService(nil, newFakeChatRepo(), blocks, discardNotifications{}))
+			if tt.online {
+				connect(t, hub, server, bob)
+			}
+
+			presence, err := NewPresenceService(hub, users, newFakeChatRepo(), blocks).Get(bob, tt.viewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if online := presence.Status == models.PresenceOnline; online != tt.wantOnline || (presence.LastSeenAt != nil) != tt.wantLastSeen {
+				t.Fatalf("viewer %d sees %+v", tt.viewer, presence)
+			}
+			if presence.Hidden && tt.viewer != bob {
+				t.Fatalf("viewer %d is told bob is hidden", tt.viewer)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// snippetLength is the number of characters of body text shown around the first match
+	snippetLength = 120
+	// snippetLead is how many characters of context are kept before the first match
+	snippetLead = 30
+)
+
+// SearchService defines the interface for unified search
+type SearchService interface {
+	Search(query models.SearchQuery) (models.Page[models.SearchHit], error)
+}
+
+type searchService struct {
+	index repositories.SearchIndex
+}
+
+// NewSearchService creates a new instance of SearchService
+func NewSearchService(index repositories.SearchIndex) SearchService {
+	return &searchService{index: index}
+}
+
+// Search runs the query against the index and highlights the matched terms.
+// Titles and snippets are HTML-escaped, with matches wrapped in <em> tags.
+func (s *searchService) Search(query models.SearchQuery) (models.Page[models.SearchHit], error) {
+	query.Keyword = strings.TrimSpace(query.Keyword)
+	if query.Keyword == "" {
+		return models.Page[models.SearchHit]{}, models.ErrSearchKeywordRequired
+	}
+	for _, t := range query.Types {
+		if models.SearchRank(t) < 0 {
+			return models.Page[models.SearchHit]{}, fmt.Errorf("%w: %s", models.ErrUnknownSearchType, t)
+		}
+	}
+	if query.Page.Cursor != nil {
+		if _, _, err := models.SplitSearchCursor(query.Page.Cursor); err != nil {
+			return models.Page[models.SearchHit]{}, err
+		}
+	}
+
+	hits, err := s.index.Search(query)
+	if err != nil {
+		return hits, err
+	}
+	terms := searchTerms(query.Keyword)
+	for i := range hits.Items {
+		hit := &hits.Items[i]
+		hit.Title = highlight([]rune(hit.Title), terms)
+		hit.Snippet = snippet(hit.Body, terms)
+		hit.Body = ""
+	}
+	return hits, nil
+}
+
+// searchTerms splits a keyword into the terms to highlight.
+// Words are split on spaces and punctuation; runs of Chinese characters are also
+// broken into bigrams, the same way the ngram FULLTEXT parser indexes them, so that
+// partial matches are highlighted too. Longer terms come first.
+func searchTerms(keyword string) [][]rune {
+	seen := make(map[string]bool)
+	var terms [][]rune
+	add := func(term []rune) {
+		if len(term) == 0 || seen[string(term)] {
+			return
+		}
+		seen[string(term)] = true
+		terms = append(terms, term)
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(keyword), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	for _, word := range words {
+		runes := []rune(word)
+		add(runes)
+		start := -1
+		for i := 0; i <= len(runes); i++ {
+			if i < len(runes) && unicode.Is(unicode.Han, runes[i]) {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if start >= 0 && i-start > 2 {
+				for j := start; j+2 <= i; j++ {
+					add(runes[j : j+2])
+				}
+			}
+			start = -1
+		}
+	}
+
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	return terms
+}
+
+// matchAt returns the length of the longest term found at position i of lowered, or 0
+func matchAt(lowered []rune, i int, terms [][]rune) int {
+	for _, term := range terms {
+		if i+len(term) > len(lowered) {
+			continue
+		}
+		matched := true
+		for k, r := range term {
+			if lowered[i+k] != r {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return len(term)
+		}
+	}
+	return 0
+}
+
+func lowerRunes(text []rune) []rune {
+	lowered := make([]rune, len(text))
+	for i, r := range text {
+		lowered[i] = unicode.ToLower(r)
+	}
+	return lowered
+}
+
+// highlight escapes text and wraps every occurrence of a term in <em> tags
+func highlight(text []rune, terms [][]rune) string {
+	lowered := lowerRunes(text)
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if n := matchAt(lowered, i, terms); n > 0 {
+			b.WriteString("<em>")
+			b.WriteString(html.EscapeString(string(text[i : i+n])))
+			b.WriteString("</em>")
+			i += n
+			continue
+		}
+		b.WriteString(html.EscapeString(string(text[i])))
+		i++
+	}
+	return b.String()
+}
+
+// snippet cuts a window of body around the first matched term and highlights it
+func snippet(body string, terms [][]rune) string {
+	text := []rune(strings.Join(strings.Fields(body), " "))
+	lowered := lowerRunes(text)
+
+	start := 0
+	for i := range lowered {
+		if matchAt(lowered, i, terms) > 0 {
+			start = i - snippetLead
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(text) {
+		end = len(text)
+	}
+
+	result := highlight(text[start:end], terms)
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(text) {
+		result += "…"
+	}
+	return result
+}
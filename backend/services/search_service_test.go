@@ -0,0 +1,84 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    []string
+	}{
+		{"Exam", []string{"exam"}},
+		{"  final, exam!  ", []string{"final", "exam"}},
+		{"exam exam", []string{"exam"}},
+		// runs of Chinese characters are also split into bigrams, like the ngram parser does
+		{"期末考试", []string{"期末考试", "期末", "末考", "考试"}},
+		{"图书馆", []string{"图书馆", "图书", "书馆"}},
+		{"考试", []string{"考试"}},
+		{"cs101期末", []string{"cs101期末"}},
+		{"go语言入门", []string{"go语言入门", "语言", "言入", "入门"}},
+		// longer terms come first so that they win over their own bigrams
+		{"ab 食堂饭菜", []string{"食堂饭菜", "ab", "食堂", "堂饭", "饭菜"}},
+		{"", nil},
+		{"！？", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, term := range searchTerms(tt.keyword) {
+			got = append(got, string(term))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("searchTerms(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		keyword string
+		want    string
+	}{
+		{"case insensitive", "Final EXAM schedule", "exam", "Final <em>EXAM</em> schedule"},
+		{"every term and occurrence", "exam week: exam, then final", "final exam", "<em>exam</em> week: <em>exam</em>, then <em>final</em>"},
+		{"bigrams", "明天期末考，后天考试", "期末考试", "明天<em>期末</em>考，后天<em>考试</em>"},
+		{"whole phrase before its bigrams", "期末考试周", "期末考试", "<em>期末考试</em>周"},
+		{"escapes text", "<b>exam</b> & more", "exam", "&lt;b&gt;<em>exam</em>&lt;/b&gt; &amp; more"},
+		{"no match", "nothing here", "exam", "nothing here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight([]rune(tt.text), searchTerms(tt.keyword)); got != tt.want {
+				t.Fatalf("highlight = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	terms := searchTerms("exam")
+	long := strings.Repeat("x", 200)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"short body", "the exam is\n\n on  monday", "the <em>exam</em> is on monday"},
+		{"match near the start", "the exam " + long, "the <em>exam</em> " + long[:111] + "…"},
+		{"match far in", long + " exam " + long, "…" + long[:29] + " <em>exam</em> " + long[:85] + "…"},
+		{"match at the end", long + " exam", "…" + long[:29] + " <em>exam</em>"},
+		{"no match", long, long[:120] + "…"},
+		{"counts characters, not bytes", strings.Repeat("考", 40) + "exam", "…" + strings.Repeat("考", 30) + "<em>exam</em>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet(tt.body, terms); got != tt.want {
+				t.Fatalf("snippet =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
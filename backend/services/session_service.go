@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionService defines the interface for issuing, rotating and revoking sign-in sessions
+type SessionService interface {
+	// Start opens a new session for a user who has just signed in. Signing in cancels a scheduled account deletion.
+	Start(user *models.User, userAgent, ip string) (*models.TokenPair, error)
+	// Refresh exchanges a refresh token for a new token pair. Each refresh token can be used once;
+	// presenting a rotated one again revokes the whole session and fails with models.ErrRefreshTokenReused.
+	Refresh(refreshToken string) (*models.TokenPair, error)
+	// Logout ends the session of a refresh token belonging to userID
+	Logout(userID uint, refreshToken string) error
+	// End ends a session of userID by its ID
+	End(userID uint, sessionID string) error
+	// EndAll ends every session of a user, signing them out on all devices
+	EndAll(userID uint) error
+}
+
+type sessionService struct {
+	repo     repositories.SessionRepository
+	userRepo repositories.UserRepository
+	statuses SessionStatusCache
+}
+
+// NewSessionService creates a new instance of SessionService. Revoked sessions are dropped from statuses,
+// so that their access tokens stop working right away on this instance.
+func NewSessionService(repo repositories.SessionRepository, userRepo repositories.UserRepository, statuses SessionStatusCache) SessionService {
+	return &sessionService{repo: repo, userRepo: userRepo, statuses: statuses}
+}
+
+func (s *sessionService) Start(user *models.User, userAgent, ip string) (*models.TokenPair, error) {
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	if user.DeletionScheduledAt != nil {
+		user.DeletionScheduledAt = nil
+		if _, err := s.userRepo.Update(user, "deletion_scheduled_at"); err != nil {
+			return nil, err
+		}
+		log.Printf("SessionService: user %d signed in and cancelled the deletion of their account", user.ID)
+	}
+	session := &models.Session{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		TokenID:   uuid.NewString(),
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(utils.TokenLifetime(utils.RefreshToken)),
+	}
+	if err := s.repo.Create(session); err != nil {
+		return nil, err
+	}
+	return issueTokens(user, session.ID, session.TokenID)
+}
+
+func (s *sessionService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	claims, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.repo.FindByID(claims.SessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if session.UserID != claims.UserID || session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		return nil, models.ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.FindByID(session.UserID)
+	if err != nil || !user.IsActive {
+		// 用户不存在或已被禁用，会话随之失效
+		if revokeErr := s.revoke(session.ID); revokeErr != nil {
+			log.Printf("SessionService: failed to revoke session %s: %v", session.ID, revokeErr)
+		}
+		return nil, models.ErrInvalidRefreshToken
+	}
+
+	newTokenID := uuid.NewString()
+	rotated, err := s.repo.Rotate(session.ID, claims.ID, newTokenID, time.Now().Add(utils.TokenLifetime(utils.RefreshToken)))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// 已轮换过的令牌被再次使用，说明令牌可能已泄露，吊销整个会话
+		log.Printf("SessionService: refresh token reuse detected for session %s of user %d", session.ID, session.UserID)
+		if err := s.revoke(session.ID); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrRefreshTokenReused
+	}
+
+	// 使用最新的角色签发令牌，角色变更在下次刷新时生效
+	return issueTokens(user, session.ID, newTokenID)
+}
+
+func (s *sessionService) Logout(userID uint, refreshToken string) error {
+	claims, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	if claims.UserID != userID {
+		return errors.New("permission denied")
+	}
+	return s.End(userID, claims.SessionID)
+}
+
+func (s *sessionService) End(userID uint, sessionID string) error {
+	session, err := s.repo.FindByID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if session.UserID != userID {
+		return errors.New("permission denied")
+	}
+	return s.revoke(session.ID)
+}
+
+func (s *sessionService) EndAll(userID uint) error {
+	if err := s.repo.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+	s.statuses.InvalidateUser(userID)
+	return nil
+}
+
+// revoke ends a session and stops its access tokens
+func (s *sessionService) revoke(sessionID string) error {
+	if err := s.repo.Revoke(sessionID); err != nil {
+		return err
+	}
+	s.statuses.Invalidate(sessionID)
+	return nil
+}
+
+// parseRefreshToken validates the signature, expiry and type of a refresh token issued for a session
+func parseRefreshToken(refreshToken string) (*utils.JWTClaims, error) {
+	claims, err := utils.ValidateToken(refreshToken)
+	if err != nil || claims.Type != string(utils.RefreshToken) || claims.SessionID == "" || claims.ID == "" {
+		return nil, models.ErrInvalidRefreshToken
+	}
+	return claims, nil
+}
+
+func issueTokens(user *models.User, sessionID, tokenID string) (*models.TokenPair, error) {
+	accessToken, err := utils.GenerateSessionToken(user.ID, user.Email, utils.AccessToken, user.Role, sessionID, "")
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.GenerateSessionToken(user.ID, user.Email, utils.RefreshToken, user.Role, sessionID, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
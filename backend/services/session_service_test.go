@@ -0,0 +1,358 @@
+package services
+
+import (
+	"errors"
+	"nhcommunity/models"
+	"nhcommunity/utils"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fakeSessionRepo keeps sessions in memory and counts lookups, so tests can see the cache at work
+type fakeSessionRepo struct {
+	mu       sync.Mutex
+	sessions map[string]*models.Session
+	lookups  int
+}
+
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{sessions: make(map[string]*models.Session)}
+}
+
+func (r *fakeSessionRepo) Create(session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *fakeSessionRepo) FindByID(id string) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (r *fakeSessionRepo) Rotate(id, oldTokenID, newTokenID string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok || session.TokenID != oldTokenID || session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	session.TokenID, session.ExpiresAt = newTokenID, expiresAt
+	return true, nil
+}
+
+func (r *fakeSessionRepo) Revoke(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) RevokeAllForUser(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) revoked(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessions[id].RevokedAt != nil
+}
+
+type sessionFixture struct {
+	repo     *fakeSessionRepo
+	users    *fakeUserRepo
+	statuses SessionStatusCache
+	service  SessionService
+}
+
+func newSessionFixture(users ...*models.User) *sessionFixture {
+	f := &sessionFixture{repo: newFakeSessionRepo(), users: newFakeUserRepo(users...)}
+	f.statuses = NewSessionStatusCache(f.repo, time.Minute)
+	f.service = NewSessionService(f.repo, f.users, f.statuses)
+	return f
+}
+
+// start signs a user in and returns the tokens with the claims of the access token
+func (f *sessionFixture) start(t *testing.T, userID uint) (*models.TokenPair, *utils.JWTClaims) {
+	t.Helper()
+	user, err := f.users.FindByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := f.service.Start(user, "test-agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	claims, err := utils.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	return tokens, claims
+}
+
+func TestSessionRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare returns the refresh token to present
+		prepare func(t *testing.T, f *sessionFixture) string
+		wantErr error
+		// revoked reports whether the session of user 1 must end up revoked
+		revoked bool
+	}{
+		{
+			name: "current token rotates",
+			prepare: func(t *testing.T, f *sessionFixture) string {
+				tokens, _ := f.start(t, 1)
+				return tokens.RefreshToken
+			},
+		},
+		{
+			name: "rotated token is reuse and revokes the session",
+			prepare: func(t *testing.T, f *sessionFixture) string {
+				tokens, _ := f.start(t, 1)
+				if _, err := f.service.Refresh(tokens.RefreshToken); err != nil {
+					t.Fatalf("first refresh: %v", err)
+				}
+				return tokens.RefreshToken
+			},
+			wantErr: models.ErrRefreshTokenReused,
+			revoked: true,
+		},
+		{
+			name: "revoked session",
+			prepare: func(t *testing.T, f *sessionFixture) string {
+				tokens, _ := f.start(t, 1)
+				if err := f.service.EndAll(1); err != nil {
+					t.Fatal(err)
+				}
+				return tokens.RefreshToken
+			},
+			wantErr: models.ErrInvalidRefreshToken,
+			revoked: true,
+		},
+		{
+			name: "access token is not a refresh token",
+			prepare: func(t *testing.T, f *sessionFixture) string {
+				tokens, _ := f.start(t, 1)
+				return tokens.AccessToken
+			},
+			wantErr: models.ErrInvalidRefreshToken,
+		},
+		{
+			name: "deactivated user",
+			prepare: func(t *testing.T, f *sessionFixture) string {
+				tokens, _ := f.start(t, 1)
+				user := f.users.get(1)
+				user.IsActive = false
+				return tokens.RefreshToken
+			},
+			wantErr: models.ErrInvalidRefreshToken,
+			revoked: true,
+		},
+		{
+			name: "token of a session that does not exist",
+			prepare: func(t *testing.T, f *sessionFixture) string {
+				token, err := utils.GenerateSessionToken(1, "", utils.RefreshToken, "user", "missing", "jti")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: models.ErrInvalidRefreshToken,
+		},
+		{
+			name: "token naming the session of another user",
+			prepare: func(t *testing.T, f *sessionFixture) string {
+				f.start(t, 1)
+				_, claims := f.start(t, 2)
+				token, err := utils.GenerateSessionToken(1, "", utils.RefreshToken, "user", claims.SessionID, "jti")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: models.ErrInvalidRefreshToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture(testUser(1, "alice"), testUser(2, "bob"))
+			token := tt.prepare(t, f)
+
+			tokens, err := f.service.Refresh(token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Refresh error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (tokens.RefreshToken == token || tokens.AccessToken == "") {
+				t.Errorf("Refresh did not issue new tokens")
+			}
+
+			for id, session := range f.repo.sessions {
+				if session.UserID == 1 && f.repo.revoked(id) != tt.revoked {
+					t.Errorf("session revoked = %v, want %v", !tt.revoked, tt.revoked)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionLogout(t *testing.T) {
+	f := newSessionFixture(testUser(1, "alice"), testUser(2, "bob"))
+	aliceTokens, alice := f.start(t, 1)
+	bobTokens, bob := f.start(t, 2)
+
+	if err := f.service.Logout(2, aliceTokens.RefreshToken); err == nil {
+		t.Fatal("bob ended alice's session")
+	}
+	if f.repo.revoked(alice.SessionID) {
+		t.Fatal("alice's session was revoked by someone else")
+	}
+	if err := f.service.End(2, alice.SessionID); err == nil {
+		t.Fatal("bob ended alice's session by its ID")
+	}
+
+	if err := f.service.Logout(2, bobTokens.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if !f.repo.revoked(bob.SessionID) {
+		t.Fatal("Logout did not revoke the session")
+	}
+	if _, err := f.service.Refresh(bobTokens.RefreshToken); !errors.Is(err, models.ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh after logout = %v, want %v", err, models.ErrInvalidRefreshToken)
+	}
+}
+
+// Access tokens are only checked against the session through the cache, so every way of ending a session
+// has to drop it from the cache for the access tokens to stop working before they expire.
+func TestSessionRevocationStopsAccessTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(t *testing.T, f *sessionFixture, tokens *models.TokenPair, claims *utils.JWTClaims)
+	}{
+		{
+			name: "logout",
+			end: func(t *testing.T, f *sessionFixture, tokens *models.TokenPair, _ *utils.JWTClaims) {
+				if err := f.service.Logout(1, tokens.RefreshToken); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "end by ID",
+			end: func(t *testing.T, f *sessionFixture, _ *models.TokenPair, claims *utils.JWTClaims) {
+				if err := f.service.End(1, claims.SessionID); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "log out all devices",
+			end: func(t *testing.T, f *sessionFixture, _ *models.TokenPair, _ *utils.JWTClaims) {
+				if err := f.service.EndAll(1); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "refresh token reuse",
+			end: func(t *testing.T, f *sessionFixture, tokens *models.TokenPair, _ *utils.JWTClaims) {
+				if _, err := f.service.Refresh(tokens.RefreshToken); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.service.Refresh(tokens.RefreshToken); !errors.Is(err, models.ErrRefreshTokenReused) {
+					t.Fatalf("second refresh = %v, want %v", err, models.ErrRefreshTokenReused)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture(testUser(1, "alice"))
+			tokens, claims := f.start(t, 1)
+			if active, err := f.statuses.IsActive(claims.SessionID); err != nil || !active {
+				t.Fatalf("new session active = %v, %v", active, err)
+			}
+
+			tt.end(t, f, tokens, claims)
+			if active, err := f.statuses.IsActive(claims.SessionID); err != nil || active {
+				t.Fatalf("ended session active = %v, %v", active, err)
+			}
+		})
+	}
+}
+
+func TestSessionStatusCache(t *testing.T) {
+	repo := newFakeSessionRepo()
+	now := time.Now()
+	repo.Create(&models.Session{ID: "active", UserID: 1, ExpiresAt: now.Add(time.Hour)})
+	repo.Create(&models.Session{ID: "revoked", UserID: 1, ExpiresAt: now.Add(time.Hour), RevokedAt: &now})
+	repo.Create(&models.Session{ID: "expired", UserID: 1, ExpiresAt: now.Add(-time.Minute)})
+	cache := NewSessionStatusCache(repo, time.Minute)
+
+	tests := []struct {
+		sessionID string
+		want      bool
+	}{
+		{"active", true},
+		{"revoked", false},
+		{"expired", false},
+		{"missing", false},
+		{"", false}, // tokens issued without a session
+	}
+	for _, tt := range tests {
+		active, err := cache.IsActive(tt.sessionID)
+		if err != nil || active != tt.want {
+			t.Errorf("IsActive(%q) = %v, %v; want %v", tt.sessionID, active, err, tt.want)
+		}
+	}
+
+	// A cached state is used until it is invalidated
+	lookups := repo.lookups
+	repo.Revoke("active")
+	if active, _ := cache.IsActive("active"); !active || repo.lookups != lookups {
+		t.Fatalf("cached state not used: active = %v, lookups = %d", active, repo.lookups-lookups)
+	}
+	cache.InvalidateUser(1)
+	if active, _ := cache.IsActive("active"); active {
+		t.Fatal("revoked session still active after invalidation")
+	}
+}
+
+func TestSessionStatusCacheExpiry(t *testing.T) {
+	repo := newFakeSessionRepo()
+	repo.Create(&models.Session{ID: "s", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)})
+	cache := NewSessionStatusCache(repo, 10*time.Millisecond)
+
+	if active, _ := cache.IsActive("s"); !active {
+		t.Fatal("session not active")
+	}
+	// Revoked on another instance, which cannot invalidate this cache
+	repo.Revoke("s")
+	time.Sleep(20 * time.Millisecond)
+	if active, _ := cache.IsActive("s"); active {
+		t.Fatal("revocation not picked up after the TTL")
+	}
+}
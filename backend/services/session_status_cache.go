@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"nhcommunity/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SessionStatusCache tells whether the session an access token was issued for is still active, so that
+// logging out or a revoked refresh token also stops the access tokens of that session
+type SessionStatusCache interface {
+	// IsActive reports whether the session exists, has not been revoked and has not expired
+	IsActive(sessionID string) (bool, error)
+	// Invalidate drops the cached state of a session; call it whenever the session is revoked
+	Invalidate(sessionID string)
+	// InvalidateUser drops the cached state of every session of a user
+	InvalidateUser(userID uint)
+}
+
+type cachedSessionStatus struct {
+	userID uint
+	active bool
+}
+
+type sessionStatusCache struct {
+	repo    repositories.SessionRepository
+	ttl     time.Duration
+	entries *ttlCache[string, cachedSessionStatus]
+}
+
+// NewSessionStatusCache creates a SessionStatusCache that keeps session states loaded from repo for ttl.
+// The cache is per process, so with several instances a revocation takes up to ttl to reach the others.
+func NewSessionStatusCache(repo repositories.SessionRepository, ttl time.Duration) SessionStatusCache {
+	return &sessionStatusCache{repo: repo, ttl: ttl, entries: newTTLCache[string, cachedSessionStatus](ttl)}
+}
+
+func (c *sessionStatusCache) IsActive(sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	status, err := c.entries.getOrLoad(sessionID, func(now time.Time) (cachedSessionStatus, time.Time, error) {
+		var status cachedSessionStatus
+		expiresAt := now.Add(c.ttl)
+		session, err := c.repo.FindByID(sessionID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return status, expiresAt, err
+		default:
+			status.userID = session.UserID
+			status.active = session.RevokedAt == nil && session.ExpiresAt.After(now)
+			// 会话在缓存期间过期时不能继续被当作有效
+			if status.active && session.ExpiresAt.Before(expiresAt) {
+				expiresAt = session.ExpiresAt
+			}
+		}
+		return status, expiresAt, nil
+	})
+	return status.active, err
+}
+
+func (c *sessionStatusCache) Invalidate(sessionID string) {
+	c.entries.invalidate(sessionID)
+}
+
+func (c *sessionStatusCache) InvalidateUser(userID uint) {
+	c.entries.invalidateWhere(func(status cachedSessionStatus) bool { return status.userID == userID })
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SSOService signs users in with their campus account through OpenID Connect,
+// using the authorization code flow with PKCE
+type SSOService interface {
+	Enabled() bool
+	// Begin starts a sign-on and returns the provider URL to send the browser to, and a secret to
+	// keep in that browser (e.g. in a cookie) that Complete requires, so that a sign-on started in
+	// one browser cannot be finished in another.
+	Begin() (authURL, binding string, err error)
+	// Complete finishes a sign-on with the code and state the provider redirected back with and the
+	// binding Begin returned. The provider account is linked to the user whose own verified email
+	// the provider also verified, or to a new user. Deactivated users get models.ErrAccountDisabled.
+	Complete(code, state, binding string) (*models.User, error)
+}
+
+// SSOLoginTimeout is how long a started sign-on can be completed
+const SSOLoginTimeout = 10 * time.Minute
+
+// maxPendingSSOLogins bounds the sign-ons remembered at once, so that starting sign-ons in a loop
+// cannot exhaust memory
+const maxPendingSSOLogins = 10000
+
+// pendingSSOLogin is what is remembered of a started sign-on until the provider redirects back
+type pendingSSOLogin struct {
+	nonce     string
+	verifier  string
+	binding   string
+	expiresAt time.Time
+}
+
+type ssoService struct {
+	provider   *oidcProvider
+	identities repositories.ExternalIdentityRepository
+	userRepo   repositories.UserRepository
+	statuses   UserStatusCache
+
+	mu      sync.Mutex
+	pending map[string]pendingSSOLogin
+	sweptAt time.Time
+}
+
+// NewSSOService creates a new instance of SSOService; it is disabled when cfg has no issuer.
+// Started sign-ons are kept in process memory, so with several instances the callback must reach
+// the instance that started it (e.g. sticky sessions).
+func NewSSOService(cfg OIDCConfig, identities repositories.ExternalIdentityRepository, userRepo repositories.UserRepository, statuses UserStatusCache) SSOService {
+	s := &ssoService{identities: identities, userRepo: userRepo, statuses: statuses, pending: make(map[string]pendingSSOLogin)}
+	if cfg.Issuer != "" {
+		s.provider = newOIDCProvider(cfg)
+	}
+	return s
+}
+
+func (s *ssoService) Enabled() bool {
+	return s.provider != nil
+}
+
+func (s *ssoService) Begin() (string, string, error) {
+	if s.provider == nil {
+		return "", "", models.ErrSSODisabled
+	}
+	state, nonce, verifier, binding := randomURLToken(), randomURLToken(), randomURLToken(), randomURLToken()
+	authURL, err := s.provider.authCodeURL(state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 每分钟或表满时清理过期的登录
+	if now.Sub(s.sweptAt) >= time.Minute || len(s.pending) >= maxPendingSSOLogins {
+		s.sweptAt = now
+		for key, login := range s.pending {
+			if now.After(login.expiresAt) {
+				delete(s.pending, key)
+			}
+		}
+	}
+	if len(s.pending) >= maxPendingSSOLogins {
+		return "", "", models.ErrSSOBusy
+	}
+	s.pending[state] = pendingSSOLogin{nonce: nonce, verifier: verifier, binding: binding, expiresAt: now.Add(SSOLoginTimeout)}
+	return authURL, binding, nil
+}
+
+func (s *ssoService) Complete(code, state, binding string) (*models.User, error) {
+	if s.provider == nil {
+		return nil, models.ErrSSODisabled
+	}
+	// state 只能使用一次
+	s.mu.Lock()
+	login, ok := s.pending[state]
+	delete(s.pending, state)
+	s.mu.Unlock()
+	if !ok || time.Now().After(login.expiresAt) {
+		return nil, models.ErrInvalidSSOState
+	}
+	// 必须由发起登录的浏览器完成，防止攻击者把自己的登录结果塞给受害者
+	if subtle.ConstantTimeCompare([]byte(login.binding), []byte(binding)) != 1 {
+		return nil, models.ErrInvalidSSOState
+	}
+
+	tokens, err := s.provider.exchange(code, login.verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.provider.verifyIDToken(tokens.IDToken, login.nonce)
+	if err != nil {
+		return nil, err
+	}
+	subject := claimString(claims, "sub")
+	info, err := s.provider.userInfo(tokens.AccessToken)
+	if err != nil {
+		log.Printf("SSOService: failed to fetch userinfo of %s: %v", subject, err)
+	} else if claimString(info, "sub") == subject {
+		// ID token 中的声明优先
+		for name, value := range info {
+			if _, ok := claims[name]; !ok {
+				claims[name] = value
+			}
+		}
+	}
+
+	user, err := s.linkedUser(subject, claims)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, models.ErrAccountDisabled
+	}
+	if err := s.applyClaims(user, claims); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// linkedUser returns the user linked to the provider account, linking or creating one on the first sign-on
+func (s *ssoService) linkedUser(subject string, claims map[string]interface{}) (*models.User, error) {
+	issuer := s.provider.cfg.Issuer
+	identity, err := s.identities.FindBySubject(issuer, subject)
+	if err == nil {
+		return s.userRepo.FindByID(identity.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email := strings.ToLower(claimString(claims, s.provider.cfg.EmailClaim))
+	if email == "" {
+		return nil, models.ErrSSOMissingEmail
+	}
+	user, err := s.userRepo.FindByEmail(email)
+	switch {
+	case err == nil:
+		// 只有经提供方验证的邮箱才能关联已有账号，否则任何人都能冒用别人的邮箱
+		if !claimBool(claims, "email_verified") {
+			return nil, repositories.ErrEmailExists
+		}
+		// 本地账号也必须验证过邮箱，否则注册者可能并不拥有该邮箱，关联后就能登录邮箱主人的学校账号
+		if user.EmailVerifiedAt == nil {
+			return nil, models.ErrSSOUnverifiedAccount
+		}
+	case errors.Is(err, repositories.ErrUserNotFound):
+		if user, err = s.provision(email, claims); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := s.identities.Create(&models.ExternalIdentity{UserID: user.ID, Issuer: issuer, Subject: subject}); err != nil {
+		return nil, err
+	}
+	log.Printf("SSOService: linked %s account %s to user %d", issuer, subject, user.ID)
+	return user, nil
+}
+
+// provision creates the account of a first-time sign-on. It gets an unusable random password;
+// the user can still choose one through the password reset.
+func (s *ssoService) provision(email string, claims map[string]interface{}) (*models.User, error) {
+	username, err := s.availableUsername(claimString(claims, s.provider.cfg.UsernameClaim), email)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{
+		Username: username,
+		Email:    email,
+		Password: randomURLToken(),
+		FullName: claimString(claims, s.provider.cfg.NameClaim),
+		Role:     models.RoleUser,
+		IsActive: true,
+	}
+	if err := user.HashPassword(); err != nil {
+		return nil, err
+	}
+	return s.userRepo.Create(user)
+}
+
+// usernameInvalidChars matches what is stripped from provider usernames
+var usernameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// availableUsername derives a free username from the preferred one, or the local part of the email
+func (s *ssoService) availableUsername(preferred, email string) (string, error) {
+	base := usernameInvalidChars.ReplaceAllString(preferred, "")
+	if len(base) < 3 {
+		local, _, _ := strings.Cut(email, "@")
+		base = usernameInvalidChars.ReplaceAllString(local, "")
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	for i := 0; i < 10; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s%d", base, i+1)
+		}
+		_, err := s.userRepo.FindByUsername(candidate)
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return base + "_" + randomURLToken()[:6], nil
+}
+
+// applyClaims records what the campus account vouches for: the email address and the student ID
+func (s *ssoService) applyClaims(user *models.User, claims map[string]interface{}) error {
+	now := time.Now()
+	var cols []string
+
+	email := strings.ToLower(claimString(claims, s.provider.cfg.EmailClaim))
+	if user.EmailVerifiedAt == nil && email == user.Email && claimBool(claims, "email_verified") {
+		user.EmailVerifiedAt = &now
+		cols = append(cols, "email_verified_at")
+	}
+
+	studentId := claimString(claims, s.provider.cfg.StudentIdClaim)
+	if studentId != "" && user.StudentId == nil {
+		holder, err := s.userRepo.FindByStudentId(studentId)
+		switch {
+		case err == nil && holder.StudentVerifiedAt != nil:
+			log.Printf("SSOService: student id of user %d is already held by user %d", user.ID, holder.ID)
+		case err == nil:
+			// 未经认证的学号让给学校账号确认过的用户
+			holder.StudentId = nil
+			if _, err := s.userRepo.Update(holder, "student_id"); err != nil {
+				return err
+			}
+			fallthrough
+		case errors.Is(err, repositories.ErrUserNotFound):
+			user.StudentId = &studentId
+			user.StudentVerifiedAt = &now
+			cols = append(cols, "student_id", "student_verified_at")
+		default:
+			return err
+		}
+	}
+
+	if len(cols) == 0 {
+		return nil
+	}
+	if _, err := s.userRepo.Update(user, cols...); err != nil {
+		return err
+	}
+	s.statuses.Invalidate(user.ID)
+	return nil
+}
+
+// randomURLToken returns 32 random bytes encoded for use in URLs
+func randomURLToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,536 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const testClientID = "nhcommunity"
+
+// mockIdP is an in-process OpenID Connect provider serving discovery, JWKS, token and userinfo.
+// Each authorization records the PKCE challenge and nonce of the request and the claims of the account.
+type mockIdP struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]idpGrant
+}
+
+type idpGrant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+	userinfo  map[string]interface{}
+	// sign signs the ID token; nil signs it with RS256
+	sign func(claims jwt.MapClaims) string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{rsaKey: rsaKey, ecKey: ecKey, grants: make(map[string]idpGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			UserinfoEndpoint:      idp.server.URL + "/userinfo",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {
+			{Kid: "rsa", Kty: "RSA", Use: "sig", N: encode(rsaKey.N.Bytes()), E: encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{Kid: "ec", Kty: "EC", Use: "sig", Crv: "P-256", X: encode(ecKey.X.Bytes()), Y: encode(ecKey.Y.Bytes())},
+		}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		grant, ok := idp.grants[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		idp.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(grant.userinfo)
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// token redeems a code, checking the PKCE verifier against the challenge of the authorization
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	oauthError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostFormValue("code")]
+	idp.mu.Unlock()
+	if !ok || r.PostFormValue("client_id") != testClientID {
+		oauthError("invalid_grant")
+		return
+	}
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		oauthError("invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   testClientID,
+		"nonce": grant.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	sign := grant.sign
+	if sign == nil {
+		sign = idp.signRS256
+	}
+	json.NewEncoder(w).Encode(oidcTokenResponse{AccessToken: r.PostFormValue("code"), IDToken: sign(claims)})
+}
+
+func (idp *mockIdP) signRS256(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "rsa"
+	signed, _ := token.SignedString(idp.rsaKey)
+	return signed
+}
+
+func (idp *mockIdP) signES256(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = "ec"
+	signed, _ := token.SignedString(idp.ecKey)
+	return signed
+}
+
+// signHS256 signs with the public RSA modulus as an HMAC secret, the classic algorithm confusion attack
+func (idp *mockIdP) signHS256(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "rsa"
+	signed, _ := token.SignedString(idp.rsaKey.N.Bytes())
+	return signed
+}
+
+// authorize plays the user signing in at the provider for the authorization request URL and returns the code
+func (idp *mockIdP) authorize(t *testing.T, authURL string, grant idpGrant) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testClientID {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	grant.challenge = query.Get("code_challenge")
+	grant.nonce = query.Get("nonce")
+	code := randomURLToken()
+	idp.mu.Lock()
+	idp.grants[code] = grant
+	idp.mu.Unlock()
+	return code
+}
+
+// fakeIdentityRepo keeps linked provider accounts in memory
+type fakeIdentityRepo struct {
+	mu         sync.Mutex
+	identities []models.ExternalIdentity
+}
+
+func (r *fakeIdentityRepo) Create(identity *models.ExternalIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) FindBySubject(issuer, subject string) (*models.ExternalIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			found := identity
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeIdentityRepo) FindByUser(userID uint) ([]models.ExternalIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []models.ExternalIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			found = append(found, identity)
+		}
+	}
+	return found, nil
+}
+
+type ssoFixture struct {
+	idp        *mockIdP
+	users      *fakeUserRepo
+	identities *fakeIdentityRepo
+	service    SSOService
+}
+
+func newSSOFixture(t *testing.T, users ...*models.User) *ssoFixture {
+	idp := newMockIdP(t)
+	f := &ssoFixture{idp: idp, users: newFakeUserRepo(users...), identities: &fakeIdentityRepo{}}
+	f.service = NewSSOService(OIDCConfig{
+		Issuer:         idp.server.URL,
+		ClientID:       testClientID,
+		RedirectURL:    "https://community.example.com/sso/callback",
+		Scopes:         []string{"openid", "email", "profile"},
+		UsernameClaim:  "preferred_username",
+		EmailClaim:     "email",
+		NameClaim:      "name",
+		StudentIdClaim: "student_id",
+	}, f.identities, f.users, NewUserStatusCache(f.users, time.Minute))
+	return f
+}
+
+// begin starts a sign-on and returns the authorization request URL, its state and the browser binding
+func (f *ssoFixture) begin(t *testing.T) (string, string, string) {
+	t.Helper()
+	authURL, binding, err := f.service.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	return authURL, parsed.Query().Get("state"), binding
+}
+
+// signIn runs a whole sign-on of the provider account described by grant
+func (f *ssoFixture) signIn(t *testing.T, grant idpGrant) (*models.User, error) {
+	t.Helper()
+	authURL, state, binding := f.begin(t)
+	return f.service.Complete(f.idp.authorize(t, authURL, grant), state, binding)
+}
+
+func accountClaims(subject, email string, emailVerified bool) jwt.MapClaims {
+	return jwt.MapClaims{"sub": subject, "email": email, "email_verified": emailVerified, "preferred_username": subject, "name": "Campus " + subject}
+}
+
+func TestSSOTokenValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(claims jwt.MapClaims)
+		sign   func(idp *mockIdP) func(jwt.MapClaims) string
+	}{
+		{name: "wrong issuer", mutate: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "wrong audience", mutate: func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{name: "nonce mismatch", mutate: func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{name: "missing nonce", mutate: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "expired", mutate: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", mutate: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "missing subject", mutate: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "HMAC algorithm", sign: func(idp *mockIdP) func(jwt.MapClaims) string { return idp.signHS256 }},
+		{name: "unsigned", sign: func(*mockIdP) func(jwt.MapClaims) string {
+			return func(c jwt.MapClaims) string {
+				signed, _ := jwt.NewWithClaims(jwt.SigningMethodNone, c).SignedString(jwt.UnsafeAllowNoneSignatureType)
+				return signed
+			}
+		}},
+		{name: "unknown key", sign: func(idp *mockIdP) func(jwt.MapClaims) string {
+			return func(c jwt.MapClaims) string {
+				other, _ := rsa.GenerateKey(rand.Reader, 2048)
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+				token.Header["kid"] = "rotated"
+				signed, _ := token.SignedString(other)
+				return signed
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSSOFixture(t)
+			grant := idpGrant{claims: accountClaims("s1", "new@campus.edu", true)}
+			if tt.sign != nil {
+				grant.sign = tt.sign(f.idp)
+			}
+			if tt.mutate != nil {
+				sign := grant.sign
+				if sign == nil {
+					sign = f.idp.signRS256
+				}
+				grant.sign = func(c jwt.MapClaims) string {
+					tt.mutate(c)
+					return sign(c)
+				}
+			}
+			if user, err := f.signIn(t, grant); err == nil {
+				t.Fatalf("sign-on succeeded as user %d", user.ID)
+			}
+			if len(f.identities.identities) != 0 {
+				t.Fatal("a provider account was linked")
+			}
+		})
+	}
+}
+
+func TestSSOTokenSignedWithEllipticCurveKey(t *testing.T) {
+	f := newSSOFixture(t)
+	grant := idpGrant{claims: accountClaims("s1", "new@campus.edu", true), sign: f.idp.signES256}
+	if _, err := f.signIn(t, grant); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSSOStateAndPKCE(t *testing.T) {
+	grant := idpGrant{claims: accountClaims("s1", "new@campus.edu", true)}
+
+	t.Run("unknown state", func(t *testing.T) {
+		f := newSSOFixture(t)
+		authURL, _, binding := f.begin(t)
+		code := f.idp.authorize(t, authURL, grant)
+		if _, err := f.service.Complete(code, "forged", binding); !errors.Is(err, models.ErrInvalidSSOState) {
+			t.Fatalf("Complete error = %v, want %v", err, models.ErrInvalidSSOState)
+		}
+	})
+
+	t.Run("state used twice", func(t *testing.T) {
+		f := newSSOFixture(t)
+		authURL, state, binding := f.begin(t)
+		code := f.idp.authorize(t, authURL, grant)
+		if _, err := f.service.Complete(code, state, binding); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.service.Complete(code, state, binding); !errors.Is(err, models.ErrInvalidSSOState) {
+			t.Fatalf("second Complete error = %v, want %v", err, models.ErrInvalidSSOState)
+		}
+	})
+
+	// Login CSRF: the attacker signs in to their own campus account and gets the victim's browser to
+	// post the resulting code and state. The victim's browser does not hold the attacker's binding.
+	t.Run("another browser", func(t *testing.T) {
+		f := newSSOFixture(t)
+		authURL, state, _ := f.begin(t)
+		_, _, victimBinding := f.begin(t)
+		code := f.idp.authorize(t, authURL, grant)
+		for _, binding := range []string{victimBinding, ""} {
+			if _, err := f.service.Complete(code, state, binding); !errors.Is(err, models.ErrInvalidSSOState) {
+				t.Fatalf("Complete with binding %q error = %v, want %v", binding, err, models.ErrInvalidSSOState)
+			}
+		}
+		if len(f.identities.identities) != 0 {
+			t.Fatal("a provider account was linked")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		f := newSSOFixture(t)
+		authURL, state, binding := f.begin(t)
+		service := f.service.(*ssoService)
+		login := service.pending[state]
+		login.expiresAt = time.Now().Add(-time.Second)
+		service.pending[state] = login
+		code := f.idp.authorize(t, authURL, grant)
+		if _, err := f.service.Complete(code, state, binding); !errors.Is(err, models.ErrInvalidSSOState) {
+			t.Fatalf("Complete error = %v, want %v", err, models.ErrInvalidSSOState)
+		}
+	})
+
+	// A code issued to one sign-on (e.g. intercepted from the victim) cannot be redeemed by another,
+	// because the verifier of the other sign-on does not match the code's challenge
+	t.Run("verifier mismatch", func(t *testing.T) {
+		f := newSSOFixture(t)
+		victimURL, _, _ := f.begin(t)
+		_, attackerState, attackerBinding := f.begin(t)
+		code := f.idp.authorize(t, victimURL, grant)
+		_, err := f.service.Complete(code, attackerState, attackerBinding)
+		if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+			t.Fatalf("Complete error = %v, want invalid_grant", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		service := NewSSOService(OIDCConfig{}, &fakeIdentityRepo{}, newFakeUserRepo(), nil)
+		if _, _, err := service.Begin(); !errors.Is(err, models.ErrSSODisabled) {
+			t.Fatalf("Begin error = %v, want %v", err, models.ErrSSODisabled)
+		}
+		if _, err := service.Complete("code", "state", "binding"); !errors.Is(err, models.ErrSSODisabled) {
+			t.Fatalf("Complete error = %v, want %v", err, models.ErrSSODisabled)
+		}
+	})
+}
+
+func TestSSOProvisioning(t *testing.T) {
+	f := newSSOFixture(t, testUser(1, "student"))
+	grant := idpGrant{
+		claims: accountClaims("student", "New@Campus.edu", true),
+		// Some providers only share the student number through userinfo
+		userinfo: map[string]interface{}{"sub": "student", "student_id": 20230001},
+	}
+
+	user, err := f.signIn(t, grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := f.users.get(user.ID)
+	switch {
+	case stored.Email != "new@campus.edu":
+		t.Errorf("email = %q", stored.Email)
+	case stored.Username != "student2":
+		t.Errorf("username = %q, want student2 as student is taken", stored.Username)
+	case stored.FullName != "Campus student":
+		t.Errorf("full name = %q", stored.FullName)
+	case stored.EmailVerifiedAt == nil:
+		t.Error("email not verified")
+	case stored.StudentId == nil || *stored.StudentId != "20230001" || stored.StudentVerifiedAt == nil:
+		t.Errorf("student id = %v, verified at %v", stored.StudentId, stored.StudentVerifiedAt)
+	case !stored.IsActive || stored.Role != models.RoleUser:
+		t.Errorf("active = %v, role = %q", stored.IsActive, stored.Role)
+	}
+	if stored.CheckPassword("") == nil {
+		t.Error("provisioned account has an empty password")
+	}
+
+	// The next sign-on finds the account by its subject, even after the provider email changes
+	again, err := f.signIn(t, idpGrant{claims: accountClaims("student", "renamed@campus.edu", true)})
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("second sign-on = %v, %v; want user %d", again, err, user.ID)
+	}
+	if len(f.identities.identities) != 1 {
+		t.Fatalf("%d identities linked, want 1", len(f.identities.identities))
+	}
+}
+
+func TestSSOLinking(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified bool
+		email         string
+		wantErr       error
+		wantUser      uint
+	}{
+		{"verified email links the existing account", true, "alice@example.com", nil, 1},
+		{"email case is ignored", true, "ALICE@example.com", nil, 1},
+		{"unverified email is refused", false, "alice@example.com", repositories.ErrEmailExists, 0},
+		{"account that has not verified its email is refused", true, "newbie@example.com", models.ErrSSOUnverifiedAccount, 0},
+		{"missing email is refused", true, "", models.ErrSSOMissingEmail, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// newbie registered without confirming the address, so may not own it
+			newbie := testUser(2, "newbie")
+			newbie.EmailVerifiedAt = nil
+			f := newSSOFixture(t, testUser(1, "alice"), newbie)
+			user, err := f.signIn(t, idpGrant{claims: accountClaims("campus-42", tt.email, tt.emailVerified)})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Complete error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(f.identities.identities) != 0 {
+					t.Fatal("a provider account was linked")
+				}
+				return
+			}
+			if user.ID != tt.wantUser || f.identities.identities[0].UserID != tt.wantUser {
+				t.Fatalf("signed in as user %d, want %d", user.ID, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestSSODeactivatedAccount(t *testing.T) {
+	banned := testUser(1, "banned")
+	banned.IsActive = false
+	f := newSSOFixture(t, banned)
+	grant := idpGrant{claims: accountClaims("campus-42", "banned@example.com", true)}
+
+	// Neither on the sign-on that links the account nor on any later one
+	for i := 0; i < 2; i++ {
+		if _, err := f.signIn(t, grant); !errors.Is(err, models.ErrAccountDisabled) {
+			t.Fatalf("sign-on %d error = %v, want %v", i+1, err, models.ErrAccountDisabled)
+		}
+	}
+}
+
+func TestSSOStudentIdHeldByAnotherUser(t *testing.T) {
+	verifiedAt := time.Now()
+	for _, verified := range []bool{true, false} {
+		holder := testUser(1, "holder")
+		studentId := "20230001"
+		holder.StudentId = &studentId
+		if verified {
+			holder.StudentVerifiedAt = &verifiedAt
+		}
+		f := newSSOFixture(t, holder)
+		grant := idpGrant{claims: accountClaims("student", "new@campus.edu", true)}
+		grant.claims["student_id"] = studentId
+
+		user, err := f.signIn(t, grant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only a verified holder keeps the student ID; an unverified claim goes to the campus account
+		kept := f.users.get(1).StudentId != nil
+		got := f.users.get(user.ID).StudentId != nil
+		if kept != verified || got == verified {
+			t.Errorf("holder verified = %v: holder keeps id = %v, campus account gets it = %v", verified, kept, got)
+		}
+	}
+}
+
+func TestSSOPendingLoginsAreBounded(t *testing.T) {
+	f := newSSOFixture(t)
+	service := f.service.(*ssoService)
+	for i := 0; i < maxPendingSSOLogins; i++ {
+		service.pending[fmt.Sprint(i)] = pendingSSOLogin{expiresAt: time.Now().Add(SSOLoginTimeout)}
+	}
+	if _, _, err := f.service.Begin(); !errors.Is(err, models.ErrSSOBusy) {
+		t.Fatalf("Begin error = %v, want %v", err, models.ErrSSOBusy)
+	}
+
+	// expired sign-ons make room again
+	for i := 0; i < 10; i++ {
+		service.pending[fmt.Sprint(i)] = pendingSSOLogin{expiresAt: time.Now().Add(-time.Second)}
+	}
+	if _, _, err := f.service.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if len(service.pending) != maxPendingSSOLogins-9 {
+		t.Fatalf("%d sign-ons pending, want %d", len(service.pending), maxPendingSSOLogins-9)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890"
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC vectors have 8 digits; a 6 digit code is their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode([]byte("12345678901234567890"), totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+	secret, _ := totpEncoding.DecodeString(rfc6238Secret)
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, totpCode(secret, step), step, true},
+		{"previous step", rfc6238Secret, totpCode(secret, step-1), step - 1, true},
+		{"next step", rfc6238Secret, totpCode(secret, step+1), step + 1, true},
+		{"two steps behind", rfc6238Secret, totpCode(secret, step-2), 0, false},
+		{"two steps ahead", rfc6238Secret, totpCode(secret, step+2), 0, false},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), totpCode(secret, step), step, true},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"short code", rfc6238Secret, totpCode(secret, step)[:5], 0, false},
+		{"invalid secret", "not base32!", totpCode(secret, step), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := matchTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Fatalf("matchTOTP = %d, %v; want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	got := totpProvisioningURI("NH Community", "alice@example.com", "JBSWY3DP")
+	want := "otpauth://totp/NH%20Community:alice@example.com?algorithm=SHA1&digits=6&issuer=NH%20Community&period=30&secret=JBSWY3DP"
+	if got != want {
+		t.Fatalf("URI = %s, want %s", got, want)
+	}
+}
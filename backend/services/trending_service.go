@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"log"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"time"
+)
+
+const defaultHotScoreInterval = 10 * time.Minute
+
+// TrendingService defines the interface for hot ranking and trending lists
+type TrendingService interface {
+	GetTrendingPosts(viewerID uint, page models.PageQuery) (models.Page[models.PostResponse], error)
+	GetTrendingConfessions(viewerID uint, page models.PageQuery) (models.Page[models.ConfessionResponse], error)
+	GetTrendingListings(viewerID uint, page models.PageQuery) (models.Page[models.MarketplaceResponse], error)
+	RecomputeHotScores() error
+	Start(ctx context.Context, interval time.Duration)
+}
+
+type trendingService struct {
+	repo repositories.TrendingRepository
+}
+
+// NewTrendingService creates a new instance of TrendingService
+func NewTrendingService(repo repositories.TrendingRepository) TrendingService {
+	return &trendingService{repo: repo}
+}
+
+func (s *trendingService) GetTrendingPosts(viewerID uint, page models.PageQuery) (models.Page[models.PostResponse], error) {
+	posts, err := s.repo.FindTrendingPosts(viewerID, page)
+	if err != nil {
+		return models.Page[models.PostResponse]{}, err
+	}
+	return models.MapPage(posts, func(p models.Post) models.PostResponse {
+		return p.ToResponse(viewerID)
+	}), nil
+}
+
+func (s *trendingService) GetTrendingConfessions(viewerID uint, page models.PageQuery) (models.Page[models.ConfessionResponse], error) {
+	confessions, err := s.repo.FindTrendingConfessions(viewerID, page)
+	if err != nil {
+		return models.Page[models.ConfessionResponse]{}, err
+	}
+	return models.MapPage(confessions, func(c models.Confession) models.ConfessionResponse {
+		return c.ToResponse(viewerID)
+	}), nil
+}
+
+func (s *trendingService) GetTrendingListings(viewerID uint, page models.PageQuery) (models.Page[models.MarketplaceResponse], error) {
+	listings, err := s.repo.FindTrendingListings(viewerID, page)
+	if err != nil {
+		return models.Page[models.MarketplaceResponse]{}, err
+	}
+	return models.MapPage(listings, func(m models.Marketplace) models.MarketplaceResponse {
+		return m.ToResponse()
+	}), nil
+}
+
+func (s *trendingService) RecomputeHotScores() error {
+	return s.repo.RecomputeHotScores(time.Now())
+}
+
+// Start recomputes the hot scores right away and then once every interval in the background,
+// until ctx is done.
+func (s *trendingService) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHotScoreInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.RecomputeHotScores(); err != nil {
+				log.Printf("TrendingService: failed to recompute hot scores: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
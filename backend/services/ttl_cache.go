@@ -0,0 +1,88 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// ttlCache keeps loaded values until they expire. Expired entries are swept at most once per ttl,
+// so a lookup costs O(1) amortized however many entries the cache holds.
+type ttlCache[K comparable, V any] struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[K]ttlEntry[V]
+	nextSweep time.Time
+	// version changes on every invalidation so that a load racing with it is not cached
+	version uint64
+}
+
+func newTTLCache[K comparable, V any](ttl time.Duration) *ttlCache[K, V] {
+	return &ttlCache[K, V]{ttl: ttl, entries: make(map[K]ttlEntry[V])}
+}
+
+// getOrLoad returns the cached value of key, calling load when there is none or it expired. load
+// returns the value and when it expires, normally now plus the ttl of the cache.
+func (c *ttlCache[K, V]) getOrLoad(key K, load func(now time.Time) (V, time.Time, error)) (V, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	version := c.version
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	value, expiresAt, err := load(now)
+	if err != nil {
+		return value, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version {
+		return value, nil
+	}
+	if !now.Before(c.nextSweep) {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: expiresAt}
+	return value, nil
+}
+
+// invalidate drops the cached value of key
+func (c *ttlCache[K, V]) invalidate(key K) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.version++
+	c.mu.Unlock()
+}
+
+// invalidateWhere drops every cached value that matches
+func (c *ttlCache[K, V]) invalidateWhere(match func(V) bool) {
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if match(e.value) {
+			delete(c.entries, k)
+		}
+	}
+	c.version++
+	c.mu.Unlock()
+}
+
+// size returns how many entries are held, expired ones included
+func (c *ttlCache[K, V]) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	cache := newTTLCache[int, int](time.Hour)
+	loads := 0
+	load := func(value int, ttl time.Duration) func(now time.Time) (int, time.Time, error) {
+		return func(now time.Time) (int, time.Time, error) {
+			loads++
+			return value, now.Add(ttl), nil
+		}
+	}
+
+	if got, _ := cache.getOrLoad(1, load(10, time.Hour)); got != 10 {
+		t.Fatalf("first load = %d", got)
+	}
+	if got, _ := cache.getOrLoad(1, load(11, time.Hour)); got != 10 || loads != 1 {
+		t.Fatalf("cached value = %d after %d loads", got, loads)
+	}
+
+	// 加载期间被失效的值不能留在缓存里
+	cache.getOrLoad(2, func(now time.Time) (int, time.Time, error) {
+		cache.invalidate(2)
+		return 20, now.Add(time.Hour), nil
+	})
+	if got, _ := cache.getOrLoad(2, load(21, time.Hour)); got != 21 {
+		t.Fatalf("value loaded across an invalidation was cached: %d", got)
+	}
+
+	cache.invalidateWhere(func(value int) bool { return value == 10 })
+	if got, _ := cache.getOrLoad(1, load(12, time.Hour)); got != 12 {
+		t.Fatalf("value after invalidateWhere = %d", got)
+	}
+
+	// 条目可以比缓存本身更早过期
+	cache.getOrLoad(3, load(30, -time.Second))
+	if got, _ := cache.getOrLoad(3, load(31, time.Hour)); got != 31 {
+		t.Fatalf("expired value = %d", got)
+	}
+}
+
+// Expired entries are swept on a miss, but only once per ttl
+func TestTTLCacheSweep(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	cache := newTTLCache[int, int](ttl)
+	load := func(now time.Time) (int, time.Time, error) { return 0, now.Add(ttl), nil }
+	for key := 0; key < 3; key++ {
+		cache.getOrLoad(key, load)
+	}
+	if n := cache.size(); n != 3 {
+		t.Fatalf("size = %d, want 3", n)
+	}
+
+	time.Sleep(ttl)
+	cache.getOrLoad(3, load)
+	if n := cache.size(); n != 1 {
+		t.Fatalf("size after the sweep = %d, want 1", n)
+	}
+	// the next sweep is not due yet, so entries expiring before it stay around until then
+	cache.getOrLoad(4, func(now time.Time) (int, time.Time, error) { return 0, now, nil })
+	cache.getOrLoad(5, load)
+	if n := cache.size(); n != 3 {
+		t.Fatalf("size before the next sweep = %d, want 3", n)
+	}
+}
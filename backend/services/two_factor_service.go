@@ -0,0 +1,289 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount is how many recovery codes are handed out at a time
+const recoveryCodeCount = 10
+
+// twoFactorSetupInterval is how long a pending secret is kept before Setup may replace it, so that
+// whoever holds a login challenge cannot keep swapping the secret the user is scanning
+const twoFactorSetupInterval = time.Minute
+
+// TwoFactorService manages TOTP two-factor authentication and the second step of login
+type TwoFactorService interface {
+	// Challenge returns the second login step the user must pass, or nil if they can sign in directly
+	Challenge(user *models.User) (*models.TwoFactorChallenge, error)
+	// ParseChallenge returns the user a two-factor login token was issued to; users deactivated since
+	// the first step get models.ErrAccountDisabled
+	ParseChallenge(token string) (*models.User, error)
+	// CompleteLogin checks the code of the second login step. For an account that had to set up
+	// two-factor authentication first, the code enables it and the new recovery codes are returned.
+	CompleteLogin(userID uint, code string) ([]string, error)
+
+	Status(userID uint) (*models.TwoFactorStatusResponse, error)
+	// Setup creates a new secret; it takes effect once Enable confirms a code generated from it.
+	// A pending secret younger than twoFactorSetupInterval is not replaced.
+	Setup(userID uint) (*models.TwoFactorSetupResponse, error)
+	Enable(userID uint, code string) ([]string, error)
+	Disable(userID uint, password, code string) error
+	RegenerateRecoveryCodes(userID uint, code string) ([]string, error)
+	// Verify confirms a sensitive action with a current authenticator code or an unused recovery code;
+	// accounts without two-factor authentication get models.ErrTwoFactorNotEnabled
+	Verify(userID uint, code string) error
+}
+
+type twoFactorService struct {
+	repo     repositories.TwoFactorRepository
+	userRepo repositories.UserRepository
+	issuer   string
+	// requiredForAdmins makes admins set up two-factor authentication before they can sign in
+	requiredForAdmins bool
+}
+
+// NewTwoFactorService creates a new instance of TwoFactorService; issuer names the site in authenticator apps
+func NewTwoFactorService(repo repositories.TwoFactorRepository, userRepo repositories.UserRepository, issuer string, requiredForAdmins bool) TwoFactorService {
+	return &twoFactorService{repo: repo, userRepo: userRepo, issuer: issuer, requiredForAdmins: requiredForAdmins}
+}
+
+func (s *twoFactorService) Challenge(user *models.User) (*models.TwoFactorChallenge, error) {
+	enabled, err := s.enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && !s.required(user) {
+		return nil, nil
+	}
+	// 修改密码后未完成的第二步随之失效
+	token, err := utils.GenerateAccountToken(user.ID, user.Email, utils.TwoFactorToken, passwordStamp(user))
+	if err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorChallenge{Required: true, SetupRequired: !enabled, Token: token}, nil
+}
+
+func (s *twoFactorService) ParseChallenge(token string) (*models.User, error) {
+	claims, err := utils.ValidateToken(token)
+	if err != nil || claims.Type != string(utils.TwoFactorToken) {
+		return nil, models.ErrInvalidTwoFactorToken
+	}
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, models.ErrInvalidTwoFactorToken
+		}
+		return nil, err
+	}
+	if claims.Stamp != passwordStamp(user) {
+		return nil, models.ErrInvalidTwoFactorToken
+	}
+	if !user.IsActive {
+		return nil, models.ErrAccountDisabled
+	}
+	return user, nil
+}
+
+func (s *twoFactorService) CompleteLogin(userID uint, code string) ([]string, error) {
+	enabled, err := s.enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return s.Enable(userID, code)
+	}
+	return nil, s.Verify(userID, code)
+}
+
+func (s *twoFactorService) Status(userID uint) (*models.TwoFactorStatusResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &models.TwoFactorStatusResponse{Enabled: enabled, Required: s.required(user)}
+	if enabled {
+		remaining, err := s.repo.CountRecoveryCodes(userID)
+		if err != nil {
+			return nil, err
+		}
+		status.RecoveryCodesRemaining = int(remaining)
+	}
+	return status, nil
+}
+
+func (s *twoFactorService) Setup(userID uint) (*models.TwoFactorSetupResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.repo.Find(userID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return nil, err
+	case pending.EnabledAt != nil:
+		return nil, models.ErrTwoFactorEnabled
+	case time.Since(pending.UpdatedAt) < twoFactorSetupInterval:
+		return nil, models.ErrTwoFactorSetupPending
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encoded := totpEncoding.EncodeToString(secret)
+	if err := s.repo.Save(&models.TwoFactor{UserID: userID, Secret: encoded}); err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorSetupResponse{
+		Secret:          encoded,
+		ProvisioningURI: totpProvisioningURI(s.issuer, user.Email, encoded),
+	}, nil
+}
+
+func (s *twoFactorService) Enable(userID uint, code string) ([]string, error) {
+	twoFactor, err := s.repo.Find(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrTwoFactorNotSetUp
+	}
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.EnabledAt != nil {
+		return nil, models.ErrTwoFactorEnabled
+	}
+
+	step, ok := matchTOTP(twoFactor.Secret, normalizeTwoFactorCode(code), time.Now())
+	if !ok {
+		return nil, models.ErrInvalidTwoFactorCode
+	}
+	codes, hashes := newRecoveryCodes()
+	if err := s.repo.Enable(userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) Disable(userID uint, password, code string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if s.required(user) {
+		return models.ErrTwoFactorRequired
+	}
+	if err := user.CheckPassword(password); err != nil {
+		return models.ErrIncorrectPassword
+	}
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+	return s.repo.Delete(userID)
+}
+
+func (s *twoFactorService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := s.Verify(userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes := newRecoveryCodes()
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) Verify(userID uint, code string) error {
+	twoFactor, err := s.repo.Find(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && twoFactor.EnabledAt == nil) {
+		return models.ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	code = normalizeTwoFactorCode(code)
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return models.ErrInvalidTwoFactorCode
+		}
+		// 同一个验证码只能使用一次
+		used, err := s.repo.UseStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return models.ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return models.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *twoFactorService) enabled(userID uint) (bool, error) {
+	twoFactor, err := s.repo.Find(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return twoFactor.EnabledAt != nil, nil
+}
+
+func (s *twoFactorService) required(user *models.User) bool {
+	return s.requiredForAdmins && user.Role == models.RoleAdmin
+}
+
+// normalizeTwoFactorCode drops the spaces and dashes people type or copy along with codes
+func normalizeTwoFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// recoveryCodeAlphabet is Crockford's base32, which leaves out letters easily confused when written down
+const recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// newRecoveryCodes returns fresh recovery codes, formatted like "abcde-fghjk", and their hashes
+func newRecoveryCodes() ([]string, []string) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			panic(err)
+		}
+		for j, b := range raw {
+			raw[j] = recoveryCodeAlphabet[b&31]
+		}
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+		hashes[i] = hashRecoveryCode(string(raw))
+	}
+	return codes, hashes
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"errors"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/utils"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// fakeTwoFactorRepo keeps secrets and recovery code hashes in memory
+type fakeTwoFactorRepo struct {
+	mu      sync.Mutex
+	secrets map[uint]*models.TwoFactor
+	codes   map[uint]map[string]bool // hash -> used
+}
+
+func newFakeTwoFactorRepo() *fakeTwoFactorRepo {
+	return &fakeTwoFactorRepo{secrets: make(map[uint]*models.TwoFactor), codes: make(map[uint]map[string]bool)}
+}
+
+var _ repositories.TwoFactorRepository = (*fakeTwoFactorRepo)(nil)
+
+func (r *fakeTwoFactorRepo) Find(userID uint) (*models.TwoFactor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	twoFactor, ok := r.secrets[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *twoFactor
+	return &found, nil
+}
+
+func (r *fakeTwoFactorRepo) Save(twoFactor *models.TwoFactor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *twoFactor
+	stored.UpdatedAt = time.Now()
+	r.secrets[twoFactor.UserID] = &stored
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) Enable(userID uint, step int64, codeHashes []string) error {
+	r.mu.Lock()
+	now := time.Now()
+	r.secrets[userID].EnabledAt = &now
+	r.secrets[userID].LastUsedStep = step
+	r.mu.Unlock()
+	return r.ReplaceRecoveryCodes(userID, codeHashes)
+}
+
+func (r *fakeTwoFactorRepo) Delete(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.secrets, userID)
+	delete(r.codes, userID)
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) UseStep(userID uint, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	twoFactor := r.secrets[userID]
+	if twoFactor.LastUsedStep >= step {
+		return false, nil
+	}
+	twoFactor.LastUsedStep = step
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepo) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	used, ok := r.codes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.codes[userID][codeHash] = true
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepo) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codes[userID] = make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		r.codes[userID][hash] = false
+	}
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) CountRecoveryCodes(userID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, used := range r.codes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// age makes the secret of the user look as if it was saved that long ago
+func (r *fakeTwoFactorRepo) age(userID uint, by time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets[userID].UpdatedAt = r.secrets[userID].UpdatedAt.Add(-by)
+}
+
+// codeAt returns the authenticator code of a secret, offset steps from now
+func codeAt(t *testing.T, encodedSecret string, offset int64) string {
+	t.Helper()
+	secret, err := totpEncoding.DecodeString(encodedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(secret, totpStep(time.Now())+offset)
+}
+
+// awaitFreshStep waits for a new time step if the current one ends within a few seconds, so that
+// a test comparing codes of neighbouring steps does not straddle two steps
+func awaitFreshStep() {
+	left := time.Duration(totpPeriod-time.Now().Unix()%totpPeriod) * time.Second
+	if left <= 3*time.Second {
+		time.Sleep(left)
+	}
+}
+
+type twoFactorFixture struct {
+	users   *fakeUserRepo
+	repo    *fakeTwoFactorRepo
+	service TwoFactorService
+}
+
+func newTwoFactorFixture(users ...*models.User) *twoFactorFixture {
+	f := &twoFactorFixture{users: newFakeUserRepo(users...), repo: newFakeTwoFactorRepo()}
+	f.service = NewTwoFactorService(f.repo, f.users, "NH Community", true)
+	return f
+}
+
+// enable sets up two-factor authentication for the user and returns the secret and recovery codes
+func (f *twoFactorFixture) enable(t *testing.T, userID uint) (string, []string) {
+	t.Helper()
+	setup, err := f.service.Setup(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := f.service.Enable(userID, codeAt(t, setup.Secret, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setup.Secret, codes
+}
+
+func TestTwoFactorSetup(t *testing.T) {
+	f := newTwoFactorFixture(testUser(1, "alice"))
+
+	if _, err := f.service.Enable(1, "123456"); !errors.Is(err, models.ErrTwoFactorNotSetUp) {
+		t.Fatalf("Enable before Setup error = %v, want %v", err, models.ErrTwoFactorNotSetUp)
+	}
+	first, err := f.service.Setup(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first.ProvisioningURI, "otpauth://totp/NH%20Community:alice@example.com?") {
+		t.Fatalf("provisioning URI = %s", first.ProvisioningURI)
+	}
+
+	// A fresh pending secret is kept, so a challenge token cannot be used to swap it under the user
+	if _, err := f.service.Setup(1); !errors.Is(err, models.ErrTwoFactorSetupPending) {
+		t.Fatalf("second Setup error = %v, want %v", err, models.ErrTwoFactorSetupPending)
+	}
+	f.repo.age(1, twoFactorSetupInterval)
+	second, err := f.service.Setup(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Secret == first.Secret {
+		t.Fatal("Setup after the interval returned the same secret")
+	}
+
+	// Only the latest secret enables two-factor authentication
+	if _, err := f.service.Enable(1, codeAt(t, first.Secret, 0)); !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		t.Fatalf("Enable with the replaced secret error = %v, want %v", err, models.ErrInvalidTwoFactorCode)
+	}
+	codes, err := f.service.Enable(1, codeAt(t, second.Secret, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	f.repo.age(1, time.Hour)
+	if _, err := f.service.Setup(1); !errors.Is(err, models.ErrTwoFactorEnabled) {
+		t.Fatalf("Setup once enabled error = %v, want %v", err, models.ErrTwoFactorEnabled)
+	}
+}
+
+func TestTwoFactorCodeReuse(t *testing.T) {
+	awaitFreshStep()
+	f := newTwoFactorFixture(testUser(1, "alice"))
+	secret, _ := f.enable(t, 1)
+
+	tests := []struct {
+		name    string
+		offset  int64
+		wantErr error
+	}{
+		// The code that enabled two-factor authentication was used already
+		{"code used to enable", 0, models.ErrInvalidTwoFactorCode},
+		{"next step", 1, nil},
+		{"same step again", 1, models.ErrInvalidTwoFactorCode},
+		// An older code is not accepted after a later one, though it is still within the skew
+		{"earlier step", -1, models.ErrInvalidTwoFactorCode},
+		{"beyond the skew", 2, models.ErrInvalidTwoFactorCode},
+	}
+	for _, tt := range tests {
+		if _, err := f.service.CompleteLogin(1, codeAt(t, secret, tt.offset)); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: CompleteLogin error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTwoFactorRecoveryCodes(t *testing.T) {
+	f := newTwoFactorFixture(testUser(1, "alice"))
+	secret, codes := f.enable(t, 1)
+
+	// Codes are accepted however they are typed, but only once
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if _, err := f.service.CompleteLogin(1, typed); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := f.service.CompleteLogin(1, codes[0]); !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		t.Fatalf("second use error = %v, want %v", err, models.ErrInvalidTwoFactorCode)
+	}
+	if _, err := f.service.CompleteLogin(1, "abcde-fghjk"); !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		t.Fatalf("unknown code error = %v, want %v", err, models.ErrInvalidTwoFactorCode)
+	}
+	status, _ := f.service.Status(1)
+	if status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Fatalf("%d codes remaining, want %d", status.RecoveryCodesRemaining, recoveryCodeCount-1)
+	}
+
+	// Regenerating invalidates the codes handed out before
+	fresh, err := f.service.RegenerateRecoveryCodes(1, codes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.CompleteLogin(1, codes[2]); !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		t.Fatalf("old code after regenerating error = %v, want %v", err, models.ErrInvalidTwoFactorCode)
+	}
+	if _, err := f.service.CompleteLogin(1, fresh[0]); err != nil {
+		t.Fatalf("new code: %v", err)
+	}
+
+	// Disabling takes the password and a code
+	if err := f.service.Disable(1, "wrong", codeAt(t, secret, 1)); !errors.Is(err, models.ErrIncorrectPassword) {
+		t.Fatalf("Disable error = %v, want %v", err, models.ErrIncorrectPassword)
+	}
+	if err := f.service.Disable(1, "password", fresh[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.CompleteLogin(1, fresh[2]); !errors.Is(err, models.ErrTwoFactorNotSetUp) {
+		t.Fatalf("CompleteLogin after Disable error = %v, want %v", err, models.ErrTwoFactorNotSetUp)
+	}
+}
+
+func TestTwoFactorChallenge(t *testing.T) {
+	admin := testUser(2, "root")
+	admin.Role = models.RoleAdmin
+	f := newTwoFactorFixture(testUser(1, "alice"), admin, testUser(3, "bob"))
+	f.enable(t, 3)
+
+	tests := []struct {
+		name      string
+		userID    uint
+		wantNil   bool
+		wantSetup bool
+	}{
+		{"without two-factor authentication", 1, true, false},
+		{"admin must set it up", 2, false, true},
+		{"enabled", 3, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, err := f.service.Challenge(f.users.get(tt.userID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if challenge != nil {
+					t.Fatalf("challenge = %+v, want none", challenge)
+				}
+				return
+			}
+			if challenge == nil || challenge.SetupRequired != tt.wantSetup {
+				t.Fatalf("challenge = %+v, want setup required %v", challenge, tt.wantSetup)
+			}
+			user, err := f.service.ParseChallenge(challenge.Token)
+			if err != nil || user.ID != tt.userID {
+				t.Fatalf("ParseChallenge = %v, %v", user, err)
+			}
+		})
+	}
+
+	// An admin cannot turn off what their role requires
+	f.enable(t, 2)
+	if err := f.service.Disable(2, "password", "anything"); !errors.Is(err, models.ErrTwoFactorRequired) {
+		t.Fatalf("Disable error = %v, want %v", err, models.ErrTwoFactorRequired)
+	}
+}
+
+func TestTwoFactorChallengeToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(t *testing.T, f *twoFactorFixture, token string) string
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			token: func(t *testing.T, f *twoFactorFixture, token string) string { return token },
+		},
+		{
+			name: "password changed since",
+			token: func(t *testing.T, f *twoFactorFixture, token string) string {
+				hash, _ := bcrypt.GenerateFromPassword([]byte("new password"), bcrypt.MinCost)
+				user := f.users.get(1)
+				user.Password = string(hash)
+				f.users.Update(user, "password")
+				return token
+			},
+			wantErr: models.ErrInvalidTwoFactorToken,
+		},
+		{
+			name: "deactivated since",
+			token: func(t *testing.T, f *twoFactorFixture, token string) string {
+				f.users.get(1).IsActive = false
+				return token
+			},
+			wantErr: models.ErrAccountDisabled,
+		},
+		{
+			name: "access token",
+			token: func(t *testing.T, f *twoFactorFixture, _ string) string {
+				token, _ := utils.GenerateSessionToken(1, "alice@example.com", utils.AccessToken, models.RoleUser, "sid", "")
+				return token
+			},
+			wantErr: models.ErrInvalidTwoFactorToken,
+		},
+		{
+			name: "password reset token",
+			token: func(t *testing.T, f *twoFactorFixture, _ string) string {
+				token, _ := utils.GenerateAccountToken(1, "alice@example.com", utils.PasswordResetToken, passwordStamp(f.users.get(1)))
+				return token
+			},
+			wantErr: models.ErrInvalidTwoFactorToken,
+		},
+		{
+			name:    "garbage",
+			token:   func(t *testing.T, f *twoFactorFixture, _ string) string { return "not-a-token" },
+			wantErr: models.ErrInvalidTwoFactorToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTwoFactorFixture(testUser(1, "alice"))
+			f.enable(t, 1)
+			challenge, err := f.service.Challenge(f.users.get(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.service.ParseChallenge(tt.token(t, f, challenge.Token))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseChallenge error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// accountDeletionInterval is how often accounts whose grace period is over are looked for
+const accountDeletionInterval = time.Hour
+
+// recentSignInWindow is how long after signing in an account without a password of its own may ask to be
+// deleted without confirming again
+const recentSignInWindow = 10 * time.Minute
+
+// UserDataService lets users take their data with them and delete their account
+type UserDataService interface {
+	// Export collects everything stored about a user
+	Export(userID uint) (*models.UserDataExport, error)
+	// RequestDeletion schedules the account for deletion after the grace period and signs the user
+	// out on every device; signing in again before then cancels the deletion. The request is confirmed
+	// with the password, or for accounts with a single sign-on identity with a two-factor code or by
+	// coming from a session started within recentSignInWindow.
+	RequestDeletion(userID uint, sessionID string, req models.DeleteAccountRequest) (*models.AccountDeletionResponse, error)
+	// DeleteDue deletes or anonymizes the accounts whose grace period is over
+	DeleteDue() error
+	// Start runs DeleteDue right away and then periodically in the background
+	Start()
+}
+
+type userDataService struct {
+	repo        repositories.UserDataRepository
+	userRepo    repositories.UserRepository
+	identities  repositories.ExternalIdentityRepository
+	sessionRepo repositories.SessionRepository
+	sessions    SessionService
+	twoFactor   TwoFactorService
+	media       MediaService
+	mailer      Mailer
+	statuses    UserStatusCache
+	// mode is models.AccountDeletionAnonymize or models.AccountDeletionHardDelete
+	mode        string
+	gracePeriod time.Duration
+}
+
+// NewUserDataService creates a new instance of UserDataService. Accounts are kept for gracePeriod after
+// a deletion request and then handled according to mode; unknown modes fall back to anonymizing.
+func NewUserDataService(repo repositories.UserDataRepository, userRepo repositories.UserRepository,
+	identities repositories.ExternalIdentityRepository, sessionRepo repositories.SessionRepository, sessions SessionService,
+	twoFactor TwoFactorService, media MediaService, mailer Mailer, statuses UserStatusCache, mode string,
+	gracePeriod time.Duration) UserDataService {
+	if mode != models.AccountDeletionHardDelete {
+		mode = models.AccountDeletionAnonymize
+	}
+	return &userDataService{
+		repo:        repo,
+		userRepo:    userRepo,
+		identities:  identities,
+		sessionRepo: sessionRepo,
+		sessions:    sessions,
+		twoFactor:   twoFactor,
+		media:       media,
+		mailer:      mailer,
+		statuses:    statuses,
+		mode:        mode,
+		gracePeriod: gracePeriod,
+	}
+}
+
+func (s *userDataService) Export(userID uint) (*models.UserDataExport, error) {
+	return s.repo.Export(userID)
+}
+
+func (s *userDataService) RequestDeletion(userID uint, sessionID string, req models.DeleteAccountRequest) (*models.AccountDeletionResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.confirmDeletion(user, sessionID, req); err != nil {
+		return nil, err
+	}
+
+	scheduledAt := time.Now().Add(s.gracePeriod)
+	if err := s.repo.ScheduleDeletion(userID, &scheduledAt); err != nil {
+		return nil, err
+	}
+	if err := s.sessions.EndAll(userID); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		body := fmt.Sprintf("%s，你好：\n\n你的账号已申请注销，将于 %s 删除。\n\n在此之前重新登录即可撤销注销。如果这不是你本人的操作，请尽快登录并修改密码。\n",
+			user.Username, scheduledAt.Format("2006-01-02 15:04"))
+		if err := s.mailer.Send(user.Email, "账号注销申请", body); err != nil {
+			log.Printf("UserDataService: failed to send deletion email to user %d: %v", userID, err)
+		}
+	}()
+	return &models.AccountDeletionResponse{ScheduledAt: scheduledAt}, nil
+}
+
+// confirmDeletion checks that a deletion request comes from the account holder
+func (s *userDataService) confirmDeletion(user *models.User, sessionID string, req models.DeleteAccountRequest) error {
+	if req.Password != "" {
+		if err := user.CheckPassword(req.Password); err != nil {
+			return models.ErrIncorrectPassword
+		}
+		return nil
+	}
+
+	// 通过单点登录注册的账号只有随机生成的密码，改用两步验证码或刚刚的登录来确认
+	identities, err := s.identities.FindByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if len(identities) == 0 {
+		return models.ErrIncorrectPassword
+	}
+	if req.Code != "" {
+		return s.twoFactor.Verify(user.ID, req.Code)
+	}
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.ErrReauthenticationRequired
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != user.ID || time.Since(session.CreatedAt) > recentSignInWindow {
+		return models.ErrReauthenticationRequired
+	}
+	return nil
+}
+
+func (s *userDataService) DeleteDue() error {
+	userIDs, err := s.repo.FindDueDeletions(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		var removed []models.Media
+		if s.mode == models.AccountDeletionHardDelete {
+			removed, err = s.repo.Delete(userID)
+		} else {
+			removed, err = s.repo.Anonymize(userID)
+		}
+		if err != nil {
+			// 继续处理其他账号，失败的账号下次重试
+			log.Printf("UserDataService: failed to delete user %d: %v", userID, err)
+			continue
+		}
+		s.media.RemoveFiles(removed)
+		s.statuses.Invalidate(userID)
+		log.Printf("UserDataService: deleted user %d (%s)", userID, s.mode)
+	}
+	return nil
+}
+
+func (s *userDataService) Start() {
+	go func() {
+		ticker := time.NewTicker(accountDeletionInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.DeleteDue(); err != nil {
+				log.Printf("UserDataService: failed to delete accounts: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// WriteExportArchive writes an export as a ZIP archive with one JSON file per section
+func WriteExportArchive(w io.Writer, export *models.UserDataExport) error {
+	encoded, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &sections); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	archive := zip.NewWriter(w)
+	for _, name := range names {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, sections[name], "", "  "); err != nil {
+			return err
+		}
+		file, err := archive.Create(name + ".json")
+		if err != nil {
+			return err
+		}
+		if _, err := indented.WriteTo(file); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
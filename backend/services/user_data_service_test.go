@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUserDataRepo records scheduled deletions
+type fakeUserDataRepo struct {
+	repositories.UserDataRepository
+
+	mu        sync.Mutex
+	scheduled map[uint]time.Time
+}
+
+func (r *fakeUserDataRepo) ScheduleDeletion(userID uint, at *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at == nil {
+		delete(r.scheduled, userID)
+	} else {
+		r.scheduled[userID] = *at
+	}
+	return nil
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(to, subject, body string) error { return nil }
+
+type userDataFixture struct {
+	repo      *fakeUserDataRepo
+	sessions  *fakeSessionRepo
+	twoFactor *twoFactorFixture
+	service   UserDataService
+	// recovery holds the recovery codes of the users with two-factor authentication
+	recovery map[uint][]string
+}
+
+// newUserDataFixture knows alice (1), who signed up with a password, and bob (2) and carol (3), who
+// signed up through single sign-on; only bob has two-factor authentication
+func newUserDataFixture(t *testing.T) *userDataFixture {
+	f := &userDataFixture{
+		repo:      &fakeUserDataRepo{scheduled: make(map[uint]time.Time)},
+		sessions:  newFakeSessionRepo(),
+		twoFactor: newTwoFactorFixture(testUser(1, "alice"), testUser(2, "bob"), testUser(3, "carol")),
+		recovery:  make(map[uint][]string),
+	}
+	identities := &fakeIdentityRepo{}
+	identities.Create(&models.ExternalIdentity{UserID: 2, Issuer: "https://idp.example.com", Subject: "bob"})
+	identities.Create(&models.ExternalIdentity{UserID: 3, Issuer: "https://idp.example.com", Subject: "carol"})
+	_, f.recovery[2] = f.twoFactor.enable(t, 2)
+
+	sessionService := NewSessionService(f.sessions, f.twoFactor.users, NewSessionStatusCache(f.sessions, time.Minute))
+	f.service = NewUserDataService(f.repo, f.twoFactor.users, identities, f.sessions, sessionService, f.twoFactor.service,
+		nil, discardMailer{}, nil, models.AccountDeletionAnonymize, 7*24*time.Hour)
+	return f
+}
+
+// signIn stores a session of the user that started the given time ago and returns its ID
+func (f *userDataFixture) signIn(userID uint, ago time.Duration) string {
+	id := randomURLToken()
+	f.sessions.Create(&models.Session{ID: id, UserID: userID, ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now().Add(-ago)})
+	return id
+}
+
+func TestRequestDeletionConfirmation(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  uint
+		session func(f *userDataFixture) string
+		req     func(f *userDataFixture) models.DeleteAccountRequest
+		want    error
+	}{
+		{
+			name:   "password",
+			userID: 1,
+			req: func(*userDataFixture) models.DeleteAccountRequest {
+				return models.DeleteAccountRequest{Password: "password"}
+			},
+		},
+		{
+			name:   "wrong password",
+			userID: 1,
+			req: func(*userDataFixture) models.DeleteAccountRequest {
+				return models.DeleteAccountRequest{Password: "wrong"}
+			},
+			want: models.ErrIncorrectPassword,
+		},
+		{
+			name:    "password account right after signing in",
+			userID:  1,
+			session: func(f *userDataFixture) string { return f.signIn(1, time.Minute) },
+			want:    models.ErrIncorrectPassword,
+		},
+		{
+			name:   "password account with a two-factor code",
+			userID: 1,
+			req:    func(*userDataFixture) models.DeleteAccountRequest { return models.DeleteAccountRequest{Code: "123456"} },
+			want:   models.ErrIncorrectPassword,
+		},
+		{
+			name:    "single sign-on right after signing in",
+			userID:  3,
+			session: func(f *userDataFixture) string { return f.signIn(3, time.Minute) },
+		},
+		{
+			name:    "single sign-on long after signing in",
+			userID:  3,
+			session: func(f *userDataFixture) string { return f.signIn(3, recentSignInWindow+time.Minute) },
+			want:    models.ErrReauthenticationRequired,
+		},
+		{
+			name:    "single sign-on with the fresh session of another user",
+			userID:  3,
+			session: func(f *userDataFixture) string { return f.signIn(2, time.Minute) },
+			want:    models.ErrReauthenticationRequired,
+		},
+		{
+			name:   "single sign-on without a session",
+			userID: 3,
+			want:   models.ErrReauthenticationRequired,
+		},
+		{
+			name:   "single sign-on with a recovery code",
+			userID: 2,
+			req: func(f *userDataFixture) models.DeleteAccountRequest {
+				return models.DeleteAccountRequest{Code: f.recovery[2][0]}
+			},
+		},
+		{
+			name:   "single sign-on with a wrong code",
+			userID: 2,
+			req:    func(*userDataFixture) models.DeleteAccountRequest { return models.DeleteAccountRequest{Code: "000000"} },
+			want:   models.ErrInvalidTwoFactorCode,
+		},
+		{
+			name:   "single sign-on with a code but no two-factor authentication",
+			userID: 3,
+			req:    func(*userDataFixture) models.DeleteAccountRequest { return models.DeleteAccountRequest{Code: "123456"} },
+			want:   models.ErrTwoFactorNotEnabled,
+		},
+		{
+			name:    "single sign-on with the password nobody knows",
+			userID:  3,
+			session: func(f *userDataFixture) string { return f.signIn(3, time.Minute) },
+			req: func(*userDataFixture) models.DeleteAccountRequest {
+				return models.DeleteAccountRequest{Password: "guess"}
+			},
+			want: models.ErrIncorrectPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newUserDataFixture(t)
+			other := f.signIn(tt.userID, time.Hour)
+			var sessionID string
+			if tt.session != nil {
+				sessionID = tt.session(f)
+			}
+			var req models.DeleteAccountRequest
+			if tt.req != nil {
+				req = tt.req(f)
+			}
+
+			deletion, err := f.service.RequestDeletion(tt.userID, sessionID, req)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			_, scheduled := f.repo.scheduled[tt.userID]
+			if scheduled != (tt.want == nil) || f.sessions.revoked(other) != (tt.want == nil) {
+				t.Fatalf("scheduled = %v, signed out = %v, want both %v", scheduled, f.sessions.revoked(other), tt.want == nil)
+			}
+			if tt.want == nil && deletion.ScheduledAt.Before(time.Now().Add(6*24*time.Hour)) {
+				t.Fatalf("deletion scheduled at %v, want after the grace period", deletion.ScheduledAt)
+			}
+		})
+	}
+}
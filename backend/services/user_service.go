@@ -2,38 +2,59 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"nhcommunity/models"
 	"nhcommunity/repositories"
-	"nhcommunity/utils"
+	"slices"
 	"strings"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 // UserService defines the interface for user business logic
 type UserService interface {
 	Register(user *models.User) (*models.User, error)
-	Login(email, password string) (*models.User, string, string, error)
-	RefreshToken(refreshToken string) (string, error)
+	Login(identifier, password string) (*models.User, error)
 	GetUserByID(id, currentUserID uint) (*models.UserResponse, error)
+	// GetFollowers lists the public profiles of the users following userID, most recent follow first,
+	// with their counters as seen by viewerID
+	GetFollowers(userID, viewerID uint, page models.PageQuery) (models.Page[models.PublicUserResponse], error)
+	// GetFollowing lists the public profiles of the users userID follows, most recent follow first,
+	// with their counters as seen by viewerID
+	GetFollowing(userID, viewerID uint, page models.PageQuery) (models.Page[models.PublicUserResponse], error)
 	GetUserByUsername(username string) (*models.User, error)
 	UpdateCurrentUser(id uint, req *models.UpdateUserRequest) (*models.UserResponse, error)
 	Follow(followerID, followingID uint) error
 	Unfollow(followerID, followingID uint) error
+	// Block stops both users from interacting and hides their content from each other
+	Block(blockerID, blockedID uint) error
+	Unblock(blockerID, blockedID uint) error
+	// Mute hides the muted user from the muter's feed and notifications
+	Mute(muterID, mutedID uint) error
+	Unmute(muterID, mutedID uint) error
 	GetAllUsers() ([]models.User, error)
 	UpdateUserStatus(userId uint, isActive bool) error
 	UpdateUserRole(userId uint, role string, adminId uint) error
+	// UpdateUserSections limits the user's role permissions to the given sections; none lifts the limit
+	UpdateUserSections(userId uint, sections []string) error
+	GetPermissions(userId uint) ([]models.Permission, error)
 	GetDB() *gorm.DB
 }
 
 type userService struct {
-	userRepo repositories.UserRepository
+	userRepo      repositories.UserRepository
+	blocks        repositories.BlockRepository
+	media         MediaService
+	notifications NotificationService
+	statuses      UserStatusCache
+	authz         Authorizer
 }
 
 // NewUserService creates a new instance of UserService
-func NewUserService(userRepo repositories.UserRepository) UserService {
-	return &userService{userRepo: userRepo}
+func NewUserService(userRepo repositories.UserRepository, blocks repositories.BlockRepository, media MediaService, notifications NotificationService, statuses UserStatusCache, authz Authorizer) UserService {
+	return &userService{userRepo: userRepo, blocks: blocks, media: media, notifications: notifications, statuses: statuses, authz: authz}
 }
 
 func (s *userService) GetUserByID(id uint, currentUserID uint) (*models.UserResponse, error) {
@@ -41,14 +62,52 @@ func (s *userService) GetUserByID(id uint, currentUserID uint) (*models.UserResp
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
-	// We need to load the followers to check if the current user is following
-	// This might be inefficient and could be optimized later.
-	s.userRepo.LoadFollowers(user)
+	stats, err := s.userRepo.FindStats(currentUserID, []uint{user.ID})
+	if err != nil {
+		return nil, err
+	}
 
-	response := user.ToResponse(currentUserID)
+	response := user.ToResponse().WithStats(stats[user.ID])
 	return &response, nil
 }
 
+func (s *userService) GetFollowers(userID, viewerID uint, page models.PageQuery) (models.Page[models.PublicUserResponse], error) {
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		return models.Page[models.PublicUserResponse]{}, errors.New("user not found")
+	}
+	users, err := s.userRepo.FindFollowers(userID, viewerID, page)
+	if err != nil {
+		return models.Page[models.PublicUserResponse]{}, err
+	}
+	return s.withStats(users, viewerID)
+}
+
+func (s *userService) GetFollowing(userID, viewerID uint, page models.PageQuery) (models.Page[models.PublicUserResponse], error) {
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		return models.Page[models.PublicUserResponse]{}, errors.New("user not found")
+	}
+	users, err := s.userRepo.FindFollowing(userID, viewerID, page)
+	if err != nil {
+		return models.Page[models.PublicUserResponse]{}, err
+	}
+	return s.withStats(users, viewerID)
+}
+
+// withStats converts a page of users to public profiles carrying their counters, loaded in one batch
+func (s *userService) withStats(users models.Page[models.FollowedUser], viewerID uint) (models.Page[models.PublicUserResponse], error) {
+	ids := make([]uint, len(users.Items))
+	for i, user := range users.Items {
+		ids[i] = user.ID
+	}
+	stats, err := s.userRepo.FindStats(viewerID, ids)
+	if err != nil {
+		return models.Page[models.PublicUserResponse]{}, err
+	}
+	return models.MapPage(users, func(u models.FollowedUser) models.PublicUserResponse {
+		return u.ToResponse().WithStats(stats[u.ID]).Public()
+	}), nil
+}
+
 func (s *userService) UpdateCurrentUser(id uint, req *models.UpdateUserRequest) (*models.UserResponse, error) {
 	user, err := s.userRepo.FindByID(id)
 	if err != nil {
@@ -58,8 +117,17 @@ func (s *userService) UpdateCurrentUser(id uint, req *models.UpdateUserRequest)
 	if req.FullName != "" {
 		user.FullName = req.FullName
 	}
-	if req.AvatarURL != "" {
-		user.AvatarURL = req.AvatarURL
+	if req.AvatarMediaID != nil {
+		media, err := s.media.ResolveOwned(id, []uint{*req.AvatarMediaID})
+		if err != nil {
+			return nil, err
+		}
+		// 头像只能使用图片，使用缩略图作为头像地址
+		if media[0].ThumbnailURL == "" {
+			return nil, models.ErrUnsupportedMediaType
+		}
+		user.AvatarMediaID = &media[0].ID
+		user.AvatarURL = media[0].ThumbnailURL
 	}
 	if req.Bio != "" {
 		user.Bio = req.Bio
@@ -101,17 +169,8 @@ func (s *userService) Register(user *models.User) (*models.User, error) {
 		return nil, err
 	}
 
-	// Check if student id is already taken if provided
-	if user.StudentId != "" {
-		_, err = s.userRepo.FindByStudentId(user.StudentId)
-		if err == nil {
-			return nil, repositories.ErrStudentIdExists
-		}
-		if !errors.Is(err, repositories.ErrUserNotFound) {
-			// A different error occurred
-			return nil, err
-		}
-	}
+	// The student ID is only set through an approved StudentVerification
+	user.StudentId = nil
 
 	// Hash the password
 	if err := user.HashPassword(); err != nil {
@@ -122,42 +181,42 @@ func (s *userService) Register(user *models.User) (*models.User, error) {
 	return s.userRepo.Create(user)
 }
 
-func (s *userService) Login(email, password string) (*models.User, string, string, error) {
-	// Normalize email
-	email = strings.ToLower(strings.TrimSpace(email))
+// dummyPasswordHash is compared against when the account does not exist,
+// so that unknown and known identifiers take the same time to reject
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("nhcommunity-dummy-password"), bcrypt.DefaultCost)
 
-	user, err := s.userRepo.FindByEmail(email)
+// Login checks the credentials of an email or username; tokens are issued by SessionService
+func (s *userService) Login(identifier, password string) (*models.User, error) {
+	identifier = strings.TrimSpace(identifier)
+
+	var user *models.User
+	var err error
+	if strings.Contains(identifier, "@") {
+		user, err = s.userRepo.FindByEmail(strings.ToLower(identifier))
+	} else {
+		user, err = s.userRepo.FindByUsername(identifier)
+	}
 	if err != nil {
 		if errors.Is(err, repositories.ErrUserNotFound) {
-			return nil, "", "", errors.New("invalid credentials")
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+			return nil, errors.New("invalid credentials")
 		}
-		return nil, "", "", err
+		return nil, err
 	}
 
 	// Check if the password is correct
 	if err := user.CheckPassword(password); err != nil {
-		return nil, "", "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
 	}
-
-	// Generate tokens
-	accessToken, err := utils.GenerateAccessToken(user.ID)
-	if err != nil {
-		return nil, "", "", err
+	// 只在密码正确后才提示账号被禁用，避免泄露账号状态
+	if !user.IsActive {
+		return nil, models.ErrAccountDisabled
 	}
-
-	refreshToken, err := utils.GenerateRefreshToken(user.ID)
-	if err != nil {
-		return nil, "", "", err
-	}
-
-	// Save refresh token to database
-	user.RefreshToken = refreshToken
-	_, err = s.userRepo.Update(user)
-	if err != nil {
-		return nil, "", "", err
+	if user.EmailVerifiedAt == nil {
+		return nil, models.ErrEmailNotVerified
 	}
 
-	return user, accessToken, refreshToken, nil
+	return user, nil
 }
 
 func (s *userService) Follow(followerID, followingID uint) error {
@@ -175,7 +234,30 @@ func (s *userService) Follow(followerID, followingID uint) error {
 		return errors.New("user to follow not found")
 	}
 
-	return s.userRepo.FollowUser(follower, following)
+	blocked, err := s.blocks.IsBlocked(followerID, followingID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return models.ErrUserBlocked
+	}
+
+	created, err := s.userRepo.FollowUser(follower, following)
+	if err != nil || !created {
+		// 重复关注不再通知
+		return err
+	}
+
+	s.notify(&models.Notification{
+		UserID:       following.ID,
+		SenderID:     &follower.ID,
+		Title:        "New follower",
+		Message:      fmt.Sprintf("%s started following you", follower.Username),
+		Type:         models.NotificationFollow,
+		ResourceType: "user",
+		ResourceID:   follower.ID,
+	})
+	return nil
 }
 
 func (s *userService) Unfollow(followerID, followingID uint) error {
@@ -196,6 +278,34 @@ func (s *userService) Unfollow(followerID, followingID uint) error {
 	return s.userRepo.UnfollowUser(follower, following)
 }
 
+func (s *userService) Block(blockerID, blockedID uint) error {
+	if blockerID == blockedID {
+		return models.ErrCannotBlockSelf
+	}
+	if _, err := s.userRepo.FindByID(blockedID); err != nil {
+		return errors.New("user not found")
+	}
+	return s.blocks.Block(blockerID, blockedID)
+}
+
+func (s *userService) Unblock(blockerID, blockedID uint) error {
+	return s.blocks.Unblock(blockerID, blockedID)
+}
+
+func (s *userService) Mute(muterID, mutedID uint) error {
+	if muterID == mutedID {
+		return models.ErrCannotBlockSelf
+	}
+	if _, err := s.userRepo.FindByID(mutedID); err != nil {
+		return errors.New("user not found")
+	}
+	return s.blocks.Mute(muterID, mutedID)
+}
+
+func (s *userService) Unmute(muterID, mutedID uint) error {
+	return s.blocks.Unmute(muterID, mutedID)
+}
+
 // GetAllUsers 获取所有用户
 func (s *userService) GetAllUsers() ([]models.User, error) {
 	log.Println("UserService: 开始获取所有用户")
@@ -224,8 +334,16 @@ func (s *userService) UpdateUserStatus(userId uint, isActive bool) error {
 		return err
 	}
 
+	// 禁用最后一个能管理角色的用户同样会让角色无人可分配
+	if !isActive && s.authz.Can(userId, models.PermUserRole) {
+		if err := s.ensureOtherRoleManager(userId); err != nil {
+			return err
+		}
+	}
+
 	user.IsActive = isActive
 	_, err = s.userRepo.Update(user, "is_active")
+	s.statuses.Invalidate(userId)
 	return err
 }
 
@@ -236,53 +354,71 @@ func (s *userService) UpdateUserRole(userId uint, role string, adminId uint) err
 		return err
 	}
 
-	// 检查是否有效的角色
-	validRoles := map[string]bool{
-		"user":      true,
-		"moderator": true,
-		"admin":     true,
+	// 角色必须在 ROLE_PERMISSIONS 中配置
+	if !s.authz.IsRole(role) {
+		return models.ErrUnknownRole
 	}
 
-	if !validRoles[role] {
-		return errors.New("无效的角色值")
-	}
-
-	// 不允许最后一个管理员降级自己
-	if userId == adminId && user.Role == "admin" && role != "admin" {
-		// TODO: 检查是否还有其他管理员
+	// 不允许移除最后一个能管理角色的用户的权限，否则再也没人能分配角色
+	if s.authz.Can(userId, models.PermUserRole) && !slices.Contains(s.authz.RolesWith(models.PermUserRole), role) {
+		if err := s.ensureOtherRoleManager(userId); err != nil {
+			return err
+		}
 	}
 
 	user.Role = role
 	_, err = s.userRepo.Update(user, "role")
+	s.statuses.Invalidate(userId)
 	return err
 }
 
-// RefreshToken 使用刷新令牌获取新的访问令牌
-func (s *userService) RefreshToken(refreshToken string) (string, error) {
-	// 验证刷新令牌
-	userId, err := utils.ValidateRefreshToken(refreshToken)
+// ensureOtherRoleManager returns models.ErrLastRoleManager unless an active user other than userId can manage roles
+func (s *userService) ensureOtherRoleManager(userId uint) error {
+	ids, err := s.userRepo.FindActiveIDsByRoles(s.authz.RolesWith(models.PermUserRole))
 	if err != nil {
-		return "", errors.New("invalid refresh token")
+		return err
+	}
+	for _, id := range ids {
+		// 板块范围也会限制角色的权限，所以逐个确认
+		if id != userId && s.authz.Can(id, models.PermUserRole) {
+			return nil
+		}
 	}
+	return models.ErrLastRoleManager
+}
 
-	// 获取用户
-	user, err := s.userRepo.FindByID(userId)
-	if err != nil {
-		return "", errors.New("user not found")
+// UpdateUserSections 设置版主负责的板块
+func (s *userService) UpdateUserSections(userId uint, sections []string) error {
+	if _, err := s.userRepo.FindByID(userId); err != nil {
+		return err
 	}
 
-	// 验证令牌与数据库中存储的是否匹配
-	if user.RefreshToken != refreshToken {
-		return "", errors.New("refresh token mismatch")
+	unique := make([]string, 0, len(sections))
+	for _, section := range sections {
+		section = strings.TrimSpace(section)
+		if !models.IsSection(section) {
+			return fmt.Errorf("%w: %s", models.ErrUnknownSection, section)
+		}
+		if !slices.Contains(unique, section) {
+			unique = append(unique, section)
+		}
 	}
 
-	// 生成新的访问令牌
-	accessToken, err := utils.GenerateAccessToken(user.ID)
-	if err != nil {
-		return "", err
+	// 限定板块后若不再包含用户管理，也可能拿走最后一个角色管理者的权限
+	if len(unique) > 0 && !slices.Contains(unique, models.PermUserRole.Section()) && s.authz.Can(userId, models.PermUserRole) {
+		if err := s.ensureOtherRoleManager(userId); err != nil {
+			return err
+		}
 	}
 
-	return accessToken, nil
+	err := s.userRepo.ReplaceModeratorSections(userId, unique)
+	s.statuses.Invalidate(userId)
+	return err
+}
+
+// GetPermissions 获取用户当前拥有的权限
+func (s *userService) GetPermissions(userId uint) ([]models.Permission, error) {
+	return s.authz.Permissions(userId)
 }
 
 // GetUserByUsername 通过用户名获取用户
@@ -294,3 +430,10 @@ func (s *userService) GetUserByUsername(username string) (*models.User, error) {
 func (s *userService) GetDB() *gorm.DB {
 	return s.userRepo.GetDB()
 }
+
+// notify delivers a notification without failing the action that triggered it.
+func (s *userService) notify(notification *models.Notification) {
+	if err := s.notifications.Notify(notification); err != nil {
+		log.Printf("UserService: failed to create notification for user %d: %v", notification.UserID, err)
+	}
+}
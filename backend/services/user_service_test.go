@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"nhcommunity/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogin(t *testing.T) {
+	disabled := testUser(2, "banned")
+	disabled.IsActive = false
+	unverified := testUser(3, "newbie")
+	unverified.EmailVerifiedAt = nil
+	disabledUnverified := testUser(4, "gone")
+	disabledUnverified.IsActive = false
+	disabledUnverified.EmailVerifiedAt = nil
+	service := NewUserService(newFakeUserRepo(testUser(1, "alice"), disabled, unverified, disabledUnverified), nil, nil, nil, nil, nil)
+
+	invalid := errors.New("invalid credentials")
+	tests := []struct {
+		name       string
+		identifier string
+		password   string
+		wantID     uint
+		wantErr    error
+	}{
+		{"email", "alice@example.com", "password", 1, nil},
+		{"surrounding spaces", "  Alice@example.com ", "password", 1, nil},
+		{"wrong password", "alice@example.com", "nope", 0, invalid},
+		{"unknown user", "nobody@example.com", "password", 0, invalid},
+		{"disabled account", "banned@example.com", "password", 0, models.ErrAccountDisabled},
+		// The account state is only revealed to someone who knows the password
+		{"disabled account with wrong password", "banned@example.com", "nope", 0, invalid},
+		{"username", "alice", "password", 1, nil},
+		{"username with surrounding spaces", "  alice ", "password", 1, nil},
+		{"wrong password by username", "alice", "nope", 0, invalid},
+		{"unknown username", "nobody", "password", 0, invalid},
+		{"disabled account by username", "banned", "password", 0, models.ErrAccountDisabled},
+		{"disabled account by username with wrong password", "banned", "nope", 0, invalid},
+		{"unverified email", "newbie", "password", 0, models.ErrEmailNotVerified},
+		{"disabled before unverified", "gone", "password", 0, models.ErrAccountDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := service.Login(tt.identifier, tt.password)
+			switch {
+			case tt.wantErr == invalid:
+				if err == nil || err.Error() != invalid.Error() {
+					t.Fatalf("Login error = %v, want %v", err, invalid)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("Login error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && user.ID != tt.wantID {
+				t.Fatalf("Login user = %d, want %d", user.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+// Roles cannot be taken away from the last active user who can still hand them out
+func TestUpdateUserRoleKeepsARoleManager(t *testing.T) {
+	user := func(id uint, username, role string, active bool) *models.User {
+		u := testUser(id, username)
+		u.Role, u.IsActive = role, active
+		return u
+	}
+	tests := []struct {
+		name string
+		// others are the users besides the admin (1) who is demoted
+		others   []*models.User
+		sections map[uint][]string
+		role     string
+		wantErr  error
+	}{
+		{"last admin", nil, nil, models.RoleUser, models.ErrLastRoleManager},
+		{"last admin to moderator", nil, nil, models.RoleModerator, models.ErrLastRoleManager},
+		{"another admin", []*models.User{user(2, "root", models.RoleAdmin, true)}, nil, models.RoleUser, nil},
+		{"another admin who is banned", []*models.User{user(2, "root", models.RoleAdmin, false)}, nil, models.RoleUser, models.ErrLastRoleManager},
+		{"another admin scoped away from users", []*models.User{user(2, "root", models.RoleAdmin, true)}, map[uint][]string{2: {"post"}}, models.RoleUser, models.ErrLastRoleManager},
+		{"only moderators left", []*models.User{user(2, "mod", models.RoleModerator, true)}, nil, models.RoleUser, models.ErrLastRoleManager},
+		{"keeping the role", nil, nil, models.RoleAdmin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newFakeUserRepo(append([]*models.User{user(1, "admin", models.RoleAdmin, true)}, tt.others...)...)
+			for id, sections := range tt.sections {
+				users.sections[id] = sections
+			}
+			statuses := NewUserStatusCache(users, time.Minute)
+			service := NewUserService(users, nil, nil, nil, statuses, NewAuthorizer(statuses, models.DefaultRolePermissions))
+
+			if err := service.UpdateUserRole(1, tt.role, 1); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateUserRole error = %v, want %v", err, tt.wantErr)
+			}
+			want := models.RoleAdmin
+			if tt.wantErr == nil {
+				want = tt.role
+			}
+			if got := users.get(1).Role; got != want {
+				t.Fatalf("stored role = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// Banning or scoping the last role manager would take roles out of reach just like demoting them
+func TestUserStatusAndSectionsKeepARoleManager(t *testing.T) {
+	admin := func(id uint, username string) *models.User {
+		u := testUser(id, username)
+		u.Role = models.RoleAdmin
+		return u
+	}
+	tests := []struct {
+		name    string
+		others  []*models.User
+		update  func(service UserService) error
+		wantErr error
+	}{
+		{"ban the last admin", nil, func(s UserService) error { return s.UpdateUserStatus(1, false) }, models.ErrLastRoleManager},
+		{"ban with another admin", []*models.User{admin(2, "root")}, func(s UserService) error { return s.UpdateUserStatus(1, false) }, nil},
+		{"reactivate the last admin", nil, func(s UserService) error { return s.UpdateUserStatus(1, true) }, nil},
+		{"scope the last admin away from users", nil, func(s UserService) error { return s.UpdateUserSections(1, []string{"post"}) }, models.ErrLastRoleManager},
+		{"scope with another admin", []*models.User{admin(2, "root")}, func(s UserService) error { return s.UpdateUserSections(1, []string{"post"}) }, nil},
+		{"scope the last admin to users", nil, func(s UserService) error { return s.UpdateUserSections(1, []string{"post", "user"}) }, nil},
+		{"unscope the last admin", nil, func(s UserService) error { return s.UpdateUserSections(1, nil) }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newFakeUserRepo(append([]*models.User{admin(1, "admin")}, tt.others...)...)
+			statuses := NewUserStatusCache(users, time.Minute)
+			authz := NewAuthorizer(statuses, models.DefaultRolePermissions)
+			service := NewUserService(users, nil, nil, nil, statuses, authz)
+
+			if err := tt.update(service); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && !authz.Can(1, models.PermUserRole) {
+				t.Fatal("the last admin lost the user.role permission")
+			}
+		})
+	}
+}
+
+// Profiles and follower lists carry each user's counters and whether the viewer follows them
+func TestProfileCounters(t *testing.T) {
+	const alice, bob, carol = 1, 2, 3
+	users := newFakeUserRepo(testUser(alice, "alice"), testUser(bob, "bob"), testUser(carol, "carol"))
+	users.follow(bob, alice)
+	users.follow(carol, alice)
+	users.follow(alice, bob)
+	service := NewUserService(users, nil, nil, nil, nil, nil)
+
+	profile, err := service.GetUserByID(alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.FollowerCount != 2 || profile.FollowingCount != 1 || !profile.IsFollowing {
+		t.Fatalf("alice as seen by bob = %+v", profile)
+	}
+	for viewerID, want := range map[uint]bool{0: false, carol: true, alice: false} {
+		profile, err := service.GetUserByID(alice, viewerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.IsFollowing != want {
+			t.Fatalf("viewer %d: isFollowing = %v, want %v", viewerID, profile.IsFollowing, want)
+		}
+	}
+
+	followers, err := service.GetFollowers(alice, alice, models.PageQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[uint]models.PublicUserResponse{}
+	for _, follower := range followers.Items {
+		got[follower.ID] = follower
+	}
+	// alice follows bob back but not carol
+	if len(got) != 2 || !got[bob].IsFollowing || got[bob].FollowerCount != 1 || got[bob].FollowingCount != 1 ||
+		got[carol].IsFollowing || got[carol].FollowerCount != 0 || got[carol].FollowingCount != 1 {
+		t.Fatalf("followers of alice = %+v", followers.Items)
+	}
+	// follower lists are seen by everyone, so they leave out what only the user and admins see
+	if data, _ := json.Marshal(followers.Items); strings.Contains(string(data), "@example.com") || strings.Contains(string(data), "is_active") {
+		t.Fatalf("followers of alice expose account details: %s", data)
+	}
+	if _, err := service.GetFollowers(99, alice, models.PageQuery{Limit: 10}); err == nil {
+		t.Fatal("followers of a missing user did not fail")
+	}
+}
+
+// Following someone again does not notify them again
+func TestFollowNotifiesOnce(t *testing.T) {
+	const alice, bob = 1, 2
+	notifications := &recordedNotifications{}
+	service := NewUserService(newFakeUserRepo(testUser(alice, "alice"), testUser(bob, "bob")), fakeBlocks{}, nil, notifications, nil, nil)
+
+	for i := 0; i < 3; i++ {
+		if err := service.Follow(alice, bob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifications.sent) != 1 {
+		t.Fatalf("%d notifications sent, want 1", len(notifications.sent))
+	}
+	if sent := notifications.sent[0]; sent.UserID != bob || sent.Type != models.NotificationFollow || *sent.SenderID != alice {
+		t.Fatalf("sent %+v", sent)
+	}
+}
+
+// A block in either direction stops the follow
+func TestFollowRefusedWhenBlocked(t *testing.T) {
+	const alice, bob = 1, 2
+	for _, pair := range [][2]uint{{alice, bob}, {bob, alice}} {
+		users := newFakeUserRepo(testUser(alice, "alice"), testUser(bob, "bob"))
+		notifications := &recordedNotifications{}
+		service := NewUserService(users, fakeBlocks{pairs: [][2]uint{pair}}, nil, notifications, nil, nil)
+
+		if err := service.Follow(alice, bob); !errors.Is(err, models.ErrUserBlocked) {
+			t.Fatalf("%d blocked %d: Follow error = %v, want %v", pair[0], pair[1], err, models.ErrUserBlocked)
+		}
+		if len(users.follows) != 0 || len(notifications.sent) != 0 {
+			t.Fatalf("%d blocked %d: follow recorded", pair[0], pair[1])
+		}
+	}
+}
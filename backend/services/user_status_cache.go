@@ -0,0 +1,54 @@
+package services
+
+import (
+	"nhcommunity/repositories"
+	"time"
+)
+
+// UserStatus is the current role and activation state of a user, as opposed to the role frozen into a JWT
+type UserStatus struct {
+	Role     string
+	IsActive bool
+	// Verified reports whether the user's student identity has been confirmed
+	Verified bool
+	// Sections limits the permissions of the role to these sections; empty means everywhere
+	Sections []string
+}
+
+// UserStatusCache resolves the current UserStatus of users for authorization checks
+type UserStatusCache interface {
+	Get(userID uint) (UserStatus, error)
+	// Invalidate drops the cached status of a user; call it whenever their role, sections, activation or verification changes
+	Invalidate(userID uint)
+}
+
+type userStatusCache struct {
+	userRepo repositories.UserRepository
+	ttl      time.Duration
+	entries  *ttlCache[uint, UserStatus]
+}
+
+// NewUserStatusCache creates a UserStatusCache that keeps statuses loaded from userRepo for ttl.
+// The cache is per process, so with several instances a change takes up to ttl to reach the others.
+func NewUserStatusCache(userRepo repositories.UserRepository, ttl time.Duration) UserStatusCache {
+	return &userStatusCache{userRepo: userRepo, ttl: ttl, entries: newTTLCache[uint, UserStatus](ttl)}
+}
+
+func (c *userStatusCache) Get(userID uint) (UserStatus, error) {
+	return c.entries.getOrLoad(userID, func(now time.Time) (UserStatus, time.Time, error) {
+		user, err := c.userRepo.FindByID(userID)
+		if err != nil {
+			return UserStatus{}, now, err
+		}
+		sections, err := c.userRepo.FindModeratorSections(userID)
+		if err != nil {
+			return UserStatus{}, now, err
+		}
+		status := UserStatus{Role: user.Role, IsActive: user.IsActive, Verified: user.StudentVerifiedAt != nil, Sections: sections}
+		return status, now.Add(c.ttl), nil
+	})
+}
+
+func (c *userStatusCache) Invalidate(userID uint) {
+	c.entries.invalidate(userID)
+}
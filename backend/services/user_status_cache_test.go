@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserStatusCache(t *testing.T) {
+	admin := testUser(1, "root")
+	admin.Role = "admin"
+	users := newFakeUserRepo(admin)
+	cache := NewUserStatusCache(users, time.Minute)
+
+	status, err := cache.Get(1)
+	if err != nil || status.Role != "admin" || !status.IsActive {
+		t.Fatalf("Get = %+v, %v", status, err)
+	}
+
+	// A demotion is picked up as soon as the cache entry is invalidated, whatever the JWT says
+	users.get(1).Role = "user"
+	users.get(1).IsActive = false
+	if status, _ := cache.Get(1); status.Role != "admin" {
+		t.Fatalf("cached role = %q before invalidation", status.Role)
+	}
+	cache.Invalidate(1)
+	status, _ = cache.Get(1)
+	if status.Role != "user" || status.IsActive {
+		t.Fatalf("Get after invalidation = %+v", status)
+	}
+
+	if _, err := cache.Get(99); err == nil {
+		t.Fatal("Get of a missing user did not fail")
+	}
+}
+
+func TestUserStatusCacheExpiry(t *testing.T) {
+	users := newFakeUserRepo(testUser(1, "alice"))
+	cache := NewUserStatusCache(users, 10*time.Millisecond)
+	if status, _ := cache.Get(1); !status.IsActive {
+		t.Fatal("user not active")
+	}
+
+	// Banned on another instance, which cannot invalidate this cache
+	users.get(1).IsActive = false
+	time.Sleep(20 * time.Millisecond)
+	if status, _ := cache.Get(1); status.IsActive {
+		t.Fatal("ban not picked up after the TTL")
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"nhcommunity/utils"
+	"strconv"
+	"strings"
+)
+
+// VerificationService defines the interface for student identity verification
+type VerificationService interface {
+	// Submit starts a verification request. Evidence requests wait for an admin;
+	// campus email requests are approved once the user follows the link mailed to that address.
+	Submit(userID uint, req *models.SubmitVerificationRequest) (*models.StudentVerificationResponse, error)
+	// GetLatest returns the most recent request of a user
+	GetLatest(userID uint) (*models.StudentVerificationResponse, error)
+	ConfirmCampusEmail(token string) error
+	ListRequests(status string, page models.PageQuery) (models.Page[models.StudentVerificationResponse], error)
+	Review(id, reviewerID uint, req *models.ReviewVerificationRequest) error
+}
+
+type verificationService struct {
+	repo          repositories.VerificationRepository
+	userRepo      repositories.UserRepository
+	media         MediaService
+	mailer        Mailer
+	notifications NotificationService
+	statuses      UserStatusCache
+	// campusDomains are the email domains accepted for campus email verification, e.g. "nhu.edu.cn"
+	campusDomains []string
+	clientOrigin  string
+}
+
+// NewVerificationService creates a new instance of VerificationService
+func NewVerificationService(
+	repo repositories.VerificationRepository,
+	userRepo repositories.UserRepository,
+	media MediaService,
+	mailer Mailer,
+	notifications NotificationService,
+	statuses UserStatusCache,
+	campusDomains []string,
+	clientOrigin string,
+) VerificationService {
+	domains := make([]string, 0, len(campusDomains))
+	for _, domain := range campusDomains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, strings.TrimPrefix(domain, "@"))
+		}
+	}
+	return &verificationService{
+		repo:          repo,
+		userRepo:      userRepo,
+		media:         media,
+		mailer:        mailer,
+		notifications: notifications,
+		statuses:      statuses,
+		campusDomains: domains,
+		clientOrigin:  strings.TrimRight(clientOrigin, "/"),
+	}
+}
+
+func (s *verificationService) Submit(userID uint, req *models.SubmitVerificationRequest) (*models.StudentVerificationResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.StudentVerifiedAt != nil {
+		return nil, models.ErrAlreadyVerified
+	}
+	latest, err := s.repo.FindLatestByUser(userID)
+	if err == nil && latest.Status == models.VerificationPending {
+		if latest.Method != models.VerificationMethodCampusEmail {
+			return nil, models.ErrVerificationPending
+		}
+		// 校园邮箱的确认邮件可能丢失或过期，允许重新提交并作废旧的申请
+		if err := s.repo.Reject(latest, nil, "superseded by a new request"); err != nil && !errors.Is(err, models.ErrVerificationNotPending) {
+			return nil, err
+		}
+	}
+
+	studentID := strings.TrimSpace(req.StudentID)
+	if holder, err := s.userRepo.FindByStudentId(studentID); err == nil && holder.ID != userID && holder.StudentVerifiedAt != nil {
+		return nil, repositories.ErrStudentIdExists
+	}
+
+	verification := &models.StudentVerification{
+		UserID:    userID,
+		StudentID: studentID,
+		Method:    req.Method,
+		Status:    models.VerificationPending,
+	}
+	switch req.Method {
+	case models.VerificationMethodEvidence:
+		if req.EvidenceMediaID == nil {
+			return nil, models.ErrEvidenceRequired
+		}
+		media, err := s.media.ResolveOwned(userID, []uint{*req.EvidenceMediaID})
+		if err != nil {
+			return nil, err
+		}
+		// 证明材料必须是图片
+		if !strings.HasPrefix(media[0].ContentType, "image/") {
+			return nil, models.ErrUnsupportedMediaType
+		}
+		verification.EvidenceMediaID = &media[0].ID
+		verification.Evidence = &media[0]
+	case models.VerificationMethodCampusEmail:
+		email := strings.ToLower(strings.TrimSpace(req.CampusEmail))
+		if !s.isCampusEmail(email) {
+			return nil, models.ErrNotCampusEmail
+		}
+		verification.CampusEmail = email
+	}
+
+	if err := s.repo.Create(verification); err != nil {
+		return nil, err
+	}
+	if verification.Method == models.VerificationMethodCampusEmail {
+		if err := s.sendCampusEmail(user, verification); err != nil {
+			log.Printf("VerificationService: failed to mail campus email confirmation for request %d: %v", verification.ID, err)
+		}
+	}
+
+	response := verification.ToResponse(false)
+	return &response, nil
+}
+
+func (s *verificationService) GetLatest(userID uint) (*models.StudentVerificationResponse, error) {
+	verification, err := s.repo.FindLatestByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	response := verification.ToResponse(false)
+	return &response, nil
+}
+
+func (s *verificationService) ConfirmCampusEmail(token string) error {
+	claims, err := utils.ValidateToken(token)
+	if err != nil || claims.Type != string(utils.CampusEmailToken) {
+		return models.ErrInvalidAccountToken
+	}
+	id, err := strconv.ParseUint(claims.Stamp, 10, 64)
+	if err != nil {
+		return models.ErrInvalidAccountToken
+	}
+	verification, err := s.repo.FindByID(uint(id))
+	if err != nil {
+		return models.ErrInvalidAccountToken
+	}
+	if verification.UserID != claims.UserID || verification.CampusEmail != claims.Email ||
+		verification.Method != models.VerificationMethodCampusEmail {
+		return models.ErrInvalidAccountToken
+	}
+	if verification.Status != models.VerificationPending {
+		return models.ErrVerificationNotPending
+	}
+
+	if err := s.repo.Approve(verification, nil, "campus email confirmed"); err != nil {
+		return err
+	}
+	s.statuses.Invalidate(verification.UserID)
+	s.notifyDecision(verification)
+	return nil
+}
+
+func (s *verificationService) ListRequests(status string, page models.PageQuery) (models.Page[models.StudentVerificationResponse], error) {
+	verifications, err := s.repo.FindByStatus(status, page)
+	if err != nil {
+		return models.Page[models.StudentVerificationResponse]{}, err
+	}
+	return models.MapPage(verifications, func(v models.StudentVerification) models.StudentVerificationResponse {
+		return v.ToResponse(true)
+	}), nil
+}
+
+func (s *verificationService) Review(id, reviewerID uint, req *models.ReviewVerificationRequest) error {
+	verification, err := s.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if verification.Status != models.VerificationPending {
+		return models.ErrVerificationNotPending
+	}
+
+	if req.Status == models.VerificationApproved {
+		err = s.repo.Approve(verification, &reviewerID, req.Note)
+	} else {
+		err = s.repo.Reject(verification, &reviewerID, req.Note)
+	}
+	if err != nil {
+		return err
+	}
+	s.statuses.Invalidate(verification.UserID)
+	s.notifyDecision(verification)
+	return nil
+}
+
+func (s *verificationService) isCampusEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, campus := range s.campusDomains {
+		// 允许院系子域名，例如 cs.nhu.edu.cn
+		if domain == campus || strings.HasSuffix(domain, "."+campus) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *verificationService) sendCampusEmail(user *models.User, verification *models.StudentVerification) error {
+	token, err := utils.GenerateAccountToken(user.ID, verification.CampusEmail, utils.CampusEmailToken, strconv.FormatUint(uint64(verification.ID), 10))
+	if err != nil {
+		return err
+	}
+	link := s.clientOrigin + "/verify-student?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("%s，你好：\n\n你正在使用这个校园邮箱认证学号 %s。请打开下面的链接完成认证，链接24小时内有效：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件。\n",
+		user.Username, verification.StudentID, link)
+	return s.mailer.Send(verification.CampusEmail, "学生身份认证", body)
+}
+
+// notifyDecision tells the user the outcome of their request
+func (s *verificationService) notifyDecision(verification *models.StudentVerification) {
+	notification := &models.Notification{
+		UserID:       verification.UserID,
+		Type:         models.NotificationSystem,
+		ResourceType: "student_verification",
+		ResourceID:   verification.ID,
+	}
+	if verification.Status == models.VerificationApproved {
+		notification.Title = "学生身份认证已通过"
+		notification.Message = fmt.Sprintf("你的学号 %s 已认证通过", verification.StudentID)
+	} else {
+		notification.Title = "学生身份认证未通过"
+		notification.Message = "你的学生身份认证未通过"
+		if verification.ReviewNote != "" {
+			notification.Message = truncateRunes(notification.Message+"："+verification.ReviewNote, 500)
+		}
+	}
+	if err := s.notifications.Notify(notification); err != nil {
+		log.Printf("VerificationService: failed to notify user %d about request %d: %v", verification.UserID, verification.ID, err)
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"errors"
+	"nhcommunity/models"
+	"nhcommunity/repositories"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fakeVerificationRepo keeps requests in memory and, like the database, copies an approved
+// student ID onto the user in users
+type fakeVerificationRepo struct {
+	users         *fakeUserRepo
+	verifications []*models.StudentVerification
+}
+
+func (r *fakeVerificationRepo) Create(verification *models.StudentVerification) error {
+	verification.ID = uint(len(r.verifications) + 1)
+	verification.CreatedAt = time.Now()
+	stored := *verification
+	r.verifications = append(r.verifications, &stored)
+	return nil
+}
+
+func (r *fakeVerificationRepo) FindByID(id uint) (*models.StudentVerification, error) {
+	if id == 0 || int(id) > len(r.verifications) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *r.verifications[id-1]
+	return &found, nil
+}
+
+func (r *fakeVerificationRepo) FindLatestByUser(userID uint) (*models.StudentVerification, error) {
+	for i := len(r.verifications) - 1; i >= 0; i-- {
+		if r.verifications[i].UserID == userID {
+			found := *r.verifications[i]
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeVerificationRepo) FindByStatus(status string, page models.PageQuery) (models.Page[models.StudentVerification], error) {
+	var result models.Page[models.StudentVerification]
+	for _, verification := range r.verifications {
+		if status == "" || verification.Status == status {
+			result.Items = append(result.Items, *verification)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeVerificationRepo) Approve(verification *models.StudentVerification, reviewerID *uint, note string) error {
+	holder, err := r.users.FindByStudentId(verification.StudentID)
+	if err == nil && holder.ID != verification.UserID {
+		if holder.StudentVerifiedAt != nil {
+			return repositories.ErrStudentIdExists
+		}
+		holder.StudentId = nil
+		r.users.Update(holder, "student_id")
+	}
+	if err := r.decide(verification, models.VerificationApproved, reviewerID, note); err != nil {
+		return err
+	}
+	user, _ := r.users.FindByID(verification.UserID)
+	user.StudentId, user.StudentVerifiedAt = &verification.StudentID, verification.ReviewedAt
+	_, err = r.users.Update(user, "student_id", "student_verified_at")
+	return err
+}
+
+func (r *fakeVerificationRepo) Reject(verification *models.StudentVerification, reviewerID *uint, note string) error {
+	return r.decide(verification, models.VerificationRejected, reviewerID, note)
+}
+
+func (r *fakeVerificationRepo) decide(verification *models.StudentVerification, status string, reviewerID *uint, note string) error {
+	stored := r.verifications[verification.ID-1]
+	if stored.Status != models.VerificationPending {
+		return models.ErrVerificationNotPending
+	}
+	now := time.Now()
+	stored.Status, stored.ReviewerID, stored.ReviewNote, stored.ReviewedAt = status, reviewerID, note, &now
+	verification.Status, verification.ReviewerID, verification.ReviewNote, verification.ReviewedAt = status, reviewerID, note, &now
+	return nil
+}
+
+// fakeUploads resolves the media in it like MediaService.ResolveOwned
+type fakeUploads struct {
+	MediaService
+	media []models.Media
+}
+
+func (f fakeUploads) ResolveOwned(ownerID uint, ids []uint) ([]models.Media, error) {
+	var found []models.Media
+	for _, id := range ids {
+		for _, m := range f.media {
+			if m.ID == id && m.OwnerID == ownerID {
+				found = append(found, m)
+			}
+		}
+	}
+	if len(found) != len(ids) {
+		return nil, models.ErrMediaNotFound
+	}
+	return found, nil
+}
+
+type verificationFixture struct {
+	users         *fakeUserRepo
+	repo          *fakeVerificationRepo
+	notifications *recordedNotifications
+	statuses      UserStatusCache
+	service       VerificationService
+}
+
+func newVerificationFixture(users ...*models.User) *verificationFixture {
+	f := &verificationFixture{users: newFakeUserRepo(users...), notifications: &recordedNotifications{}}
+	f.repo = &fakeVerificationRepo{users: f.users}
+	f.statuses = NewUserStatusCache(f.users, time.Minute)
+	uploads := fakeUploads{media: []models.Media{
+		{ID: 1, OwnerID: 1, ContentType: "image/jpeg"},
+		{ID: 2, OwnerID: 1, ContentType: "application/pdf"},
+		{ID: 3, OwnerID: 2, ContentType: "image/png"},
+	}}
+	f.service = NewVerificationService(f.repo, f.users, uploads, discardMailer{}, f.notifications, f.statuses,
+		[]string{"campus.edu"}, "https://example.com")
+	return f
+}
+
+func evidenceRequest(studentID string, mediaID uint) *models.SubmitVerificationRequest {
+	return &models.SubmitVerificationRequest{StudentID: studentID, Method: models.VerificationMethodEvidence, EvidenceMediaID: &mediaID}
+}
+
+func TestVerificationSubmit(t *testing.T) {
+	campusEmail := func(email string) *models.SubmitVerificationRequest {
+		return &models.SubmitVerificationRequest{StudentID: "2023001", Method: models.VerificationMethodCampusEmail, CampusEmail: email}
+	}
+	tests := []struct {
+		name    string
+		req     *models.SubmitVerificationRequest
+		wantErr error
+	}{
+		{"image evidence", evidenceRequest(" 2023001 ", 1), nil},
+		{"evidence that is not an image", evidenceRequest("2023001", 2), models.ErrUnsupportedMediaType},
+		{"someone else's upload", evidenceRequest("2023001", 3), models.ErrMediaNotFound},
+		{"no evidence", &models.SubmitVerificationRequest{StudentID: "2023001", Method: models.VerificationMethodEvidence}, models.ErrEvidenceRequired},
+		{"campus email", campusEmail("Alice@CS.Campus.edu"), nil},
+		{"other email", campusEmail("alice@example.com"), models.ErrNotCampusEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newVerificationFixture(testUser(1, "alice"))
+			response, err := f.service.Submit(1, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Submit error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(f.repo.verifications) != 0 {
+					t.Fatal("request stored")
+				}
+				return
+			}
+			if response.Status != models.VerificationPending || response.StudentID != "2023001" {
+				t.Fatalf("response = %+v", response)
+			}
+		})
+	}
+}
+
+func TestVerificationSubmitTwice(t *testing.T) {
+	f := newVerificationFixture(testUser(1, "alice"))
+	if _, err := f.service.Submit(1, evidenceRequest("2023001", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.Submit(1, evidenceRequest("2023001", 1)); !errors.Is(err, models.ErrVerificationPending) {
+		t.Fatalf("second Submit error = %v, want %v", err, models.ErrVerificationPending)
+	}
+
+	if err := f.service.Review(1, 9, &models.ReviewVerificationRequest{Status: models.VerificationApproved}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.Submit(1, evidenceRequest("2023001", 1)); !errors.Is(err, models.ErrAlreadyVerified) {
+		t.Fatalf("Submit after approval error = %v, want %v", err, models.ErrAlreadyVerified)
+	}
+}
+
+func TestVerificationReview(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       string
+		wantVerified bool
+		wantTitle    string
+	}{
+		{"approve", models.VerificationApproved, true, "学生身份认证已通过"},
+		{"reject", models.VerificationRejected, false, "学生身份认证未通过"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newVerificationFixture(testUser(1, "alice"))
+			if _, err := f.service.Submit(1, evidenceRequest("2023001", 1)); err != nil {
+				t.Fatal(err)
+			}
+			// the cached status is replaced once the request is decided
+			if status, _ := f.statuses.Get(1); status.Verified {
+				t.Fatal("verified before review")
+			}
+
+			err := f.service.Review(1, 9, &models.ReviewVerificationRequest{Status: tt.status, Note: "blurry"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status, _ := f.statuses.Get(1); status.Verified != tt.wantVerified {
+				t.Fatalf("verified = %v, want %v", status.Verified, tt.wantVerified)
+			}
+			user := f.users.get(1)
+			if hasID := user.StudentId != nil && *user.StudentId == "2023001"; hasID != tt.wantVerified {
+				t.Fatalf("student id = %v", user.StudentId)
+			}
+			if len(f.notifications.sent) != 1 || f.notifications.sent[0].Title != tt.wantTitle || f.notifications.sent[0].UserID != 1 {
+				t.Fatalf("notifications = %+v", f.notifications.sent)
+			}
+
+			if err := f.service.Review(1, 9, &models.ReviewVerificationRequest{Status: models.VerificationApproved}); !errors.Is(err, models.ErrVerificationNotPending) {
+				t.Fatalf("second Review error = %v, want %v", err, models.ErrVerificationNotPending)
+			}
+		})
+	}
+}
+
+func TestVerificationDuplicateStudentID(t *testing.T) {
+	verifiedAt := time.Now()
+	held := "2023001"
+	holder := testUser(2, "bob")
+	holder.StudentId, holder.StudentVerifiedAt = &held, &verifiedAt
+
+	t.Run("held by a verified student", func(t *testing.T) {
+		f := newVerificationFixture(testUser(1, "alice"), holder)
+		if _, err := f.service.Submit(1, evidenceRequest("2023001", 1)); !errors.Is(err, repositories.ErrStudentIdExists) {
+			t.Fatalf("Submit error = %v, want %v", err, repositories.ErrStudentIdExists)
+		}
+	})
+
+	// A student ID someone typed in without proof does not keep its owner from verifying it
+	t.Run("claimed without verification", func(t *testing.T) {
+		claimant := *holder
+		claimant.StudentVerifiedAt = nil
+		f := newVerificationFixture(testUser(1, "alice"), &claimant)
+		if _, err := f.service.Submit(1, evidenceRequest("2023001", 1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.service.Review(1, 9, &models.ReviewVerificationRequest{Status: models.VerificationApproved}); err != nil {
+			t.Fatal(err)
+		}
+		if f.users.get(2).StudentId != nil {
+			t.Fatal("unverified claim kept")
+		}
+		if id := f.users.get(1).StudentId; id == nil || *id != "2023001" {
+			t.Fatalf("student id = %v", id)
+		}
+	})
+
+	t.Run("verified while the request waited", func(t *testing.T) {
+		f := newVerificationFixture(testUser(1, "alice"), testUser(2, "bob"))
+		if _, err := f.service.Submit(1, evidenceRequest("2023001", 1)); err != nil {
+			t.Fatal(err)
+		}
+		f.users.Update(holder, "student_id", "student_verified_at")
+		err := f.service.Review(1, 9, &models.ReviewVerificationRequest{Status: models.VerificationApproved})
+		if !errors.Is(err, repositories.ErrStudentIdExists) {
+			t.Fatalf("Review error = %v, want %v", err, repositories.ErrStudentIdExists)
+		}
+		if f.users.get(1).StudentVerifiedAt != nil || len(f.notifications.sent) != 0 {
+			t.Fatal("request approved")
+		}
+	})
+}
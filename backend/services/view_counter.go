@@ -0,0 +1,40 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultViewWindow is how long repeated views of an item by the same viewer count once
+const defaultViewWindow = time.Hour
+
+// ViewCounter decides which views count towards the views count of an item, so that reloading a
+// page over and over does not push it up the trending lists.
+type ViewCounter interface {
+	// Count records a view of the item by viewer and reports whether it counts, which only the first
+	// view per viewer within the window does. viewer identifies a signed-in user or an address.
+	Count(itemType string, itemID uint, viewer string) bool
+}
+
+type viewCounter struct {
+	window time.Duration
+	views  *ttlCache[string, struct{}]
+}
+
+// NewViewCounter creates a ViewCounter that counts one view per viewer and item within window.
+// Views are remembered per process, so behind several instances a viewer may count once on each.
+func NewViewCounter(window time.Duration) ViewCounter {
+	if window <= 0 {
+		window = defaultViewWindow
+	}
+	return &viewCounter{window: window, views: newTTLCache[string, struct{}](window)}
+}
+
+func (c *viewCounter) Count(itemType string, itemID uint, viewer string) bool {
+	counted := false
+	c.views.getOrLoad(fmt.Sprintf("%s:%d:%s", itemType, itemID, viewer), func(now time.Time) (struct{}, time.Time, error) {
+		counted = true
+		return struct{}{}, now.Add(c.window), nil
+	})
+	return counted
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"nhcommunity/models"
+	"testing"
+	"time"
+)
+
+func TestViewCounter(t *testing.T) {
+	const window = 20 * time.Millisecond
+	views := NewViewCounter(window)
+	steps := []struct {
+		name     string
+		itemType string
+		itemID   uint
+		viewer   string
+		want     bool
+	}{
+		{"first view", models.TrendingTypePosts, 1, "user:7", true},
+		{"reload", models.TrendingTypePosts, 1, "user:7", false},
+		{"another viewer", models.TrendingTypePosts, 1, "ip:10.0.0.1", true},
+		{"another post", models.TrendingTypePosts, 2, "user:7", true},
+		{"a listing with the same ID", models.TrendingTypeListings, 1, "user:7", true},
+	}
+	for _, step := range steps {
+		if got := views.Count(step.itemType, step.itemID, step.viewer); got != step.want {
+			t.Fatalf("%s: counted = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	time.Sleep(window)
+	if !views.Count(models.TrendingTypePosts, 1, "user:7") {
+		t.Fatal("a view after the window does not count")
+	}
+}
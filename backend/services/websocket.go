@@ -2,6 +2,7 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"nhcommunity/models"
 	"sync"
@@ -20,8 +21,8 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 1024
+	// Maximum message size allowed from peer. Sync frames carry a cursor per conversation.
+	maxMessageSize = 8192
 )
 
 // Client is a middleman between the websocket connection and the hub.
@@ -60,6 +61,9 @@ type Hub struct {
 
 	// Mutex to protect the clients map
 	mu sync.Mutex
+
+	// presenceChanged is called when a user's first connection opens or last connection closes
+	presenceChanged func(userID uint)
 }
 
 func NewHub() *Hub {
@@ -98,7 +102,7 @@ func (c *Client) readPump() {
 
 		wsMsg.Timestamp = time.Now()
 
-		if wsMsg.Type == "private_message" {
+		if wsMsg.Type == models.WSTypePrivateMessage {
 			var payload models.PrivateMessagePayload
 			payloadBytes, _ := json.Marshal(wsMsg.Payload)
 			if err := json.Unmarshal(payloadBytes, &payload); err != nil {
@@ -109,27 +113,166 @@ func (c *Client) readPump() {
 			convo, err := c.service.GetOrCreateConversation(c.userID, payload.RecipientID)
 			if err != nil {
 				log.Printf("error getting or creating conversation: %v", err)
+				c.nack(payload.ClientMessageID, err)
 				continue
 			}
 
 			dbMessage := payload.ToMessage(c.userID, convo.ID)
-			savedMessage, err := c.service.CreateMessage(dbMessage)
+			savedMessage, created, err := c.service.CreateMessage(dbMessage)
 			if err != nil {
 				log.Printf("error saving message to db: %v", err)
+				c.nack(payload.ClientMessageID, err)
+				continue
+			}
+			c.ack(savedMessage)
+			if !created {
+				// A retransmission: only the ack got lost, everyone else already has the message
 				continue
 			}
 
 			responseMsg := models.WebsocketMessage{
-				Type:      "incoming_private_message",
+				Type:      models.WSTypeIncomingPrivateMessage,
 				Payload:   savedMessage,
 				Timestamp: time.Now(),
 			}
 
 			c.hub.forwardPrivateMessage(&responseMsg, payload.RecipientID)
+			// Echo to the sender's other devices; the sending connection already got the ack
+			c.hub.SendToUserExcept(c.userID, c, &responseMsg)
+			// Replying means the sender has read what came before
+			c.markRead(savedMessage.ConversationID, savedMessage.ID)
+		}
+
+		if wsMsg.Type == models.WSTypeSync {
+			var payload models.SyncPayload
+			payloadBytes, _ := json.Marshal(wsMsg.Payload)
+			if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+				log.Printf("error unmarshalling sync payload: %v", err)
+				continue
+			}
+
+			result, err := c.service.Sync(c.userID, payload.Cursors)
+			if err != nil {
+				log.Printf("error syncing conversations: %v", err)
+				continue
+			}
+			c.hub.sendToClient(c, &models.WebsocketMessage{
+				Type:      models.WSTypeSync,
+				Payload:   result,
+				Timestamp: time.Now(),
+			})
+		}
+
+		if wsMsg.Type == models.WSTypeMarkRead {
+			var payload models.MarkReadPayload
+			payloadBytes, _ := json.Marshal(wsMsg.Payload)
+			if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+				log.Printf("error unmarshalling mark read payload: %v", err)
+				continue
+			}
+
+			c.markRead(payload.ConversationID, payload.MessageID)
+		}
+
+		if wsMsg.Type == models.WSTypeTyping {
+			var payload models.TypingPayload
+			payloadBytes, _ := json.Marshal(wsMsg.Payload)
+			if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+				log.Printf("error unmarshalling typing payload: %v", err)
+				continue
+			}
+
+			// Typing frames are only relayed, never stored
+			recipientIDs, err := c.service.GetTypingRecipients(payload.ConversationID, c.userID)
+			if err != nil {
+				continue
+			}
+			event := models.WebsocketMessage{
+				Type:      models.WSTypeTyping,
+				Payload:   models.TypingEvent{ConversationID: payload.ConversationID, UserID: c.userID, IsTyping: payload.IsTyping},
+				Timestamp: time.Now(),
+			}
+			for _, recipientID := range recipientIDs {
+				c.hub.SendToUser(recipientID, &event)
+			}
+		}
+
+		if wsMsg.Type == models.WSTypeGroupMessage {
+			var payload models.GroupMessagePayload
+			payloadBytes, _ := json.Marshal(wsMsg.Payload)
+			if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+				log.Printf("error unmarshalling group message payload: %v", err)
+				continue
+			}
+
+			// CreateMessage rejects senders that are not (or no longer) members of the group
+			savedMessage, created, err := c.service.CreateMessage(payload.ToMessage(c.userID))
+			if err != nil {
+				log.Printf("error saving group message to db: %v", err)
+				c.nack(payload.ClientMessageID, err)
+				continue
+			}
+			c.ack(savedMessage)
+			if !created {
+				continue
+			}
+
+			// Look up the members after saving, so that members who left no longer receive it
+			participantIDs, err := c.service.GetParticipantIDs(savedMessage.ConversationID)
+			if err != nil {
+				log.Printf("error loading group members: %v", err)
+				continue
+			}
+
+			responseMsg := models.WebsocketMessage{
+				Type:      models.WSTypeIncomingGroupMessage,
+				Payload:   savedMessage,
+				Timestamp: time.Now(),
+			}
+
+			// The sender's other devices get the message too; the sending connection already got the ack
+			for _, participantID := range participantIDs {
+				c.hub.SendToUserExcept(participantID, c, &responseMsg)
+			}
+			c.markRead(savedMessage.ConversationID, savedMessage.ID)
 		}
 	}
 }
 
+// markRead moves the user's read watermark in a conversation up to messageID, or to the latest
+// message when it is 0, and sends a receipt to the senders of the messages that were read
+func (c *Client) markRead(conversationID, messageID uint) {
+	receipt, senderIDs, err := c.service.MarkRead(conversationID, c.userID, messageID)
+	if err != nil {
+		log.Printf("error marking conversation as read: %v", err)
+		return
+	}
+	c.hub.SendReadReceipt(receipt, senderIDs)
+}
+
+// ack confirms to this connection that a message it sent was stored
+func (c *Client) ack(message *models.Message) {
+	c.hub.sendToClient(c, &models.WebsocketMessage{
+		Type:      models.WSTypeAck,
+		Payload:   models.NewMessageAck(message),
+		Timestamp: time.Now(),
+	})
+}
+
+// nack tells this connection that a message it sent was rejected, so the client stops retransmitting it
+func (c *Client) nack(clientMessageID string, err error) {
+	reason := "failed to send message"
+	if errors.Is(err, models.ErrUserBlocked) || errors.Is(err, models.ErrConversationNotFound) ||
+		errors.Is(err, models.ErrClientMessageIDTooLong) {
+		reason = err.Error()
+	}
+	c.hub.sendToClient(c, &models.WebsocketMessage{
+		Type:      models.WSTypeAck,
+		Payload:   models.MessageAck{ClientMessageID: clientMessageID, Error: reason},
+		Timestamp: time.Now(),
+	})
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
@@ -172,6 +315,7 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			if _, ok := h.clients[client.userID]; !ok {
 				h.clients[client.userID] = make(map[*Client]bool)
+				h.notifyPresence(client.userID)
 			}
 			h.clients[client.userID][client] = true
 			log.Printf("Client connected: UserID %d", client.userID)
@@ -185,6 +329,7 @@ func (h *Hub) Run() {
 					close(client.send)
 					if len(userClients) == 0 {
 						delete(h.clients, client.userID)
+						h.notifyPresence(client.userID)
 					}
 					log.Printf("Client disconnected: UserID %d", client.userID)
 				}
@@ -199,11 +344,26 @@ func (h *Hub) Run() {
 
 // forwardPrivateMessage sends a message to a specific user.
 func (h *Hub) forwardPrivateMessage(message *models.WebsocketMessage, recipientID uint) {
+	h.SendToUser(recipientID, message)
+}
+
+// SendToUser delivers a message to every open connection of the given user.
+// It is safe to call from any goroutine; offline users are skipped.
+func (h *Hub) SendToUser(recipientID uint, message *models.WebsocketMessage) {
+	h.SendToUserExcept(recipientID, nil, message)
+}
+
+// SendToUserExcept delivers a message to every open connection of the given user except one,
+// e.g. to show a message on the sender's other devices but not on the one it was sent from.
+func (h *Hub) SendToUserExcept(recipientID uint, except *Client, message *models.WebsocketMessage) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	if userClients, ok := h.clients[recipientID]; ok {
 		for client := range userClients {
+			if client == except {
+				continue
+			}
 			select {
 			case client.send <- message:
 			default:
@@ -211,6 +371,7 @@ func (h *Hub) forwardPrivateMessage(message *models.WebsocketMessage, recipientI
 				delete(userClients, client)
 				if len(userClients) == 0 {
 					delete(h.clients, recipientID)
+					h.notifyPresence(recipientID)
 				}
 			}
 		}
@@ -218,4 +379,59 @@ func (h *Hub) forwardPrivateMessage(message *models.WebsocketMessage, recipientI
 	} else {
 		log.Printf("Recipient UserID %d not found or not connected.", recipientID)
 	}
-} 
\ No newline at end of file
+} 
+
+// SendReadReceipt delivers a read receipt to the given users.
+func (h *Hub) SendReadReceipt(receipt *models.ReadReceipt, recipientIDs []uint) {
+	message := &models.WebsocketMessage{
+		Type:      models.WSTypeReadReceipt,
+		Payload:   receipt,
+		Timestamp: time.Now(),
+	}
+	for _, recipientID := range recipientIDs {
+		h.SendToUser(recipientID, message)
+	}
+}
+
+// OnPresenceChange registers fn to be called, on its own goroutine, whenever a user comes online
+// or goes offline. fn should check IsOnline, since changes may be reported out of order.
+func (h *Hub) OnPresenceChange(fn func(userID uint)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.presenceChanged = fn
+}
+
+// notifyPresence reports a presence change of userID. The caller must hold h.mu.
+func (h *Hub) notifyPresence(userID uint) {
+	if h.presenceChanged != nil {
+		go h.presenceChanged(userID)
+	}
+}
+
+// IsOnline reports whether the user has at least one open connection
+func (h *Hub) IsOnline(userID uint) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[userID]) > 0
+}
+
+// sendToClient delivers a message to a single connection, if it is still registered
+func (h *Hub) sendToClient(client *Client, message *models.WebsocketMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userClients, ok := h.clients[client.userID]
+	if !ok || !userClients[client] {
+		return
+	}
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(userClients, client)
+		if len(userClients) == 0 {
+			delete(h.clients, client.userID)
+			h.notifyPresence(client.userID)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errMalformedGIF = errors.New("malformed GIF")
+
+// gifAnimationExtensions are the application extensions that control looping; every other one
+// (XMP packets, ICC profiles, editor data) is metadata
+var gifAnimationExtensions = [][]byte{[]byte("NETSCAPE2.0"), []byte("ANIMEXTS1.0")}
+
+// stripGIFMetadata removes comment extensions and application extensions other than the looping
+// ones from a GIF. The image data is copied byte for byte, so animation and timing are unchanged
+// and nothing has to be decoded.
+func stripGIFMetadata(data []byte) ([]byte, error) {
+	if len(data) < 13 || !bytes.HasPrefix(data, []byte("GIF8")) {
+		return nil, errMalformedGIF
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1) // global color table
+	}
+	if pos > len(data) {
+		return nil, errMalformedGIF
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:pos]...)
+
+	for pos < len(data) {
+		start := pos
+		switch data[pos] {
+		case 0x3B: // trailer
+			return append(out, 0x3B), nil
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return nil, errMalformedGIF
+			}
+			pos += 10
+			if flags := data[pos-1]; flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1) // local color table
+			}
+			pos++ // LZW minimum code size
+			end, err := skipGIFSubBlocks(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data[start:end]...)
+			pos = end
+		case 0x21: // extension
+			if pos+2 > len(data) {
+				return nil, errMalformedGIF
+			}
+			label := data[pos+1]
+			end, err := skipGIFSubBlocks(data, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			if keepGIFExtension(label, data[pos+2:end]) {
+				out = append(out, data[start:end]...)
+			}
+			pos = end
+		default:
+			return nil, errMalformedGIF
+		}
+	}
+	// 缺少结尾标记的文件浏览器也能显示，补上即可
+	return append(out, 0x3B), nil
+}
+
+// skipGIFSubBlocks returns the position after the data sub-blocks starting at pos
+func skipGIFSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errMalformedGIF
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+// keepGIFExtension reports whether an extension with the given label and sub-blocks affects how the image displays
+func keepGIFExtension(label byte, blocks []byte) bool {
+	switch label {
+	case 0xFE: // comment
+		return false
+	case 0xFF: // application
+		if len(blocks) < 12 || blocks[0] != 11 {
+			return false
+		}
+		for _, id := range gifAnimationExtensions {
+			if bytes.Equal(blocks[1:12], id) {
+				return true
+			}
+		}
+		return false
+	default: // graphic control and plain text
+		return true
+	}
+}
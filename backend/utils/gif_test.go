@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// animatedGIF encodes a looping two-frame GIF and inserts a comment and an XMP extension holding
+// secret in front of the first frame, where editors put them
+func animatedGIF(t *testing.T, secret string) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	frames := []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 4, 4), palette), image.NewPaletted(image.Rect(0, 0, 4, 4), palette)}
+	frames[1].SetColorIndex(1, 1, 1)
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{Image: frames, Delay: []int{10, 20}, LoopCount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	comment := append([]byte{0x21, 0xFE, byte(len(secret))}, secret...)
+	comment = append(comment, 0)
+	xmp := append([]byte{0x21, 0xFF, 11}, "XMP DataXMP"...)
+	xmp = append(append(xmp, byte(len(secret))), secret...)
+	xmp = append(xmp, 0)
+
+	// after the header, the screen descriptor and the global color table if there is one
+	head := 13
+	if data[10]&0x80 != 0 {
+		head += 3 << (data[10]&0x07 + 1)
+	}
+	out := append([]byte{}, data[:head]...)
+	out = append(out, comment...)
+	out = append(out, xmp...)
+	return append(out, data[head:]...)
+}
+
+func TestProcessImageStripsGIFMetadata(t *testing.T) {
+	data := animatedGIF(t, "taken at 22.5N 114.1E")
+	if !bytes.Contains(data, []byte("22.5N")) {
+		t.Fatal("test GIF lacks the metadata")
+	}
+
+	processed, err := ProcessImage(data, "image/gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(processed.Data, []byte("22.5N")) || bytes.Contains(processed.Data, []byte("XMP DataXMP")) {
+		t.Fatalf("metadata left in %q", processed.Data)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(processed.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 2 || g.Delay[0] != 10 || g.Delay[1] != 20 || g.LoopCount != 3 {
+		t.Fatalf("animation changed: %d frames, delays %v, loop count %d", len(g.Image), g.Delay, g.LoopCount)
+	}
+	if g.Image[1].ColorIndexAt(1, 1) != 1 {
+		t.Fatal("second frame changed")
+	}
+}
+
+func TestStripGIFMetadataRejectsTruncatedFiles(t *testing.T) {
+	data := animatedGIF(t, "comment")
+	for _, n := range []int{5, 15, len(data) - 10} {
+		if _, err := stripGIFMetadata(data[:n]); err == nil {
+			t.Errorf("GIF cut at %d bytes of %d is accepted", n, len(data))
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // Registers the GIF decoder with image.Decode
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	// MaxImagePixels guards against decompression bombs: images with more pixels are rejected before decoding
+	MaxImagePixels = 40_000_000
+	// ThumbnailSize is the longest side of generated thumbnails, in pixels
+	ThumbnailSize = 320
+	jpegQuality   = 90
+)
+
+// ErrImageTooLarge is returned when an image has more than MaxImagePixels pixels
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// ProcessedImage is an uploaded image with its metadata removed and a thumbnail generated
+type ProcessedImage struct {
+	Data                 []byte
+	Thumbnail            []byte
+	ThumbnailContentType string
+	Width                int
+	Height               int
+}
+
+// ProcessImage re-encodes an uploaded image so that EXIF and other metadata are not stored,
+// applying the EXIF orientation first so the picture still displays the right way up,
+// and renders a thumbnail. GIFs are not re-encoded, which would lose their animation; their comment
+// and metadata extensions are cut out instead.
+func ProcessImage(data []byte, contentType string) (*ProcessedImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProcessedImage{}
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/jpeg":
+		img = orient(img, jpegOrientation(data))
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		result.Data = buf.Bytes()
+	case "image/png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		result.Data = buf.Bytes()
+	case "image/gif":
+		if result.Data, err = stripGIFMetadata(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported image type: " + contentType)
+	}
+	bounds := img.Bounds()
+	result.Width, result.Height = bounds.Dx(), bounds.Dy()
+
+	thumb := resize(img, ThumbnailSize)
+	var thumbBuf bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&thumbBuf, thumb, &jpeg.Options{Quality: jpegQuality})
+		result.ThumbnailContentType = "image/jpeg"
+	} else {
+		// PNG keeps the transparency of PNG and GIF sources
+		err = png.Encode(&thumbBuf, thumb)
+		result.ThumbnailContentType = "image/png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Thumbnail = thumbBuf.Bytes()
+	return result, nil
+}
+
+// resize scales img down so that its longest side is at most size, averaging the source
+// pixels that fall into each target pixel. Smaller images are copied unchanged.
+func resize(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	dstW, dstH := srcW, srcH
+	if srcW > size || srcH > size {
+		if srcW >= srcH {
+			dstW, dstH = size, max(1, srcH*size/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*size/srcH), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	if dstW == srcW && dstH == srcH {
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+		return dst
+	}
+
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, max((x+1)*srcW/dstW, x*srcW/dstW+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// orient returns img transformed according to an EXIF orientation value
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	// source returns the source pixel shown at (x, y) of the oriented image
+	source := func(x, y int) (int, int) {
+		switch orientation {
+		case 2: // mirrored horizontally
+			return w - 1 - x, y
+		case 3: // rotated 180°
+			return w - 1 - x, h - 1 - y
+		case 4: // mirrored vertically
+			return x, h - 1 - y
+		case 5: // transposed
+			return y, x
+		case 6: // rotated 90° clockwise
+			return y, h - 1 - x
+		case 7: // transversed
+			return w - 1 - y, h - 1 - x
+		default: // 8: rotated 90° counter-clockwise
+			return w - 1 - y, x
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			sx, sy := source(x, y)
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
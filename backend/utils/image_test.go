@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// halves is a w×h picture whose left half is red and right half is blue
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an APP1 Exif segment holding only the orientation tag right after the JPEG SOI marker
+func withOrientation(t *testing.T, data []byte, order binary.ByteOrder, orientation uint16) []byte {
+	t.Helper()
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.BigEndian {
+		copy(tiff, "MM")
+	} else {
+		copy(tiff, "II")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(2+len(segment)))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := encodeJPEG(t, halves(16, 8))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", plain, 1},
+		{"big endian", withOrientation(t, plain, binary.BigEndian, 6), 6},
+		{"little endian", withOrientation(t, plain, binary.LittleEndian, 8), 8},
+		{"out of range", withOrientation(t, plain, binary.BigEndian, 9), 1},
+		{"not a jpeg", []byte("GIF89a"), 1},
+		{"truncated", plain[:3], 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Fatalf("orientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// isRed reports whether c is clearly red rather than blue, allowing for JPEG artifacts
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 2*b
+}
+
+// Re-encoding applies the EXIF orientation, so the stored picture, which has no EXIF left, displays the right way up
+func TestProcessImageAppliesOrientation(t *testing.T) {
+	tests := []struct {
+		orientation uint16
+		width       int
+		height      int
+		// redAt is a point that must show the red half
+		redAt image.Point
+	}{
+		{1, 16, 8, image.Pt(2, 4)},
+		{3, 16, 8, image.Pt(13, 4)},
+		{6, 8, 16, image.Pt(4, 2)},
+		{8, 8, 16, image.Pt(4, 13)},
+	}
+	for _, tt := range tests {
+		data := withOrientation(t, encodeJPEG(t, halves(16, 8)), binary.BigEndian, tt.orientation)
+		processed, err := ProcessImage(data, "image/jpeg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if processed.Width != tt.width || processed.Height != tt.height {
+			t.Fatalf("orientation %d: size = %dx%d, want %dx%d", tt.orientation, processed.Width, processed.Height, tt.width, tt.height)
+		}
+		if got := jpegOrientation(processed.Data); got != 1 {
+			t.Fatalf("orientation %d: stored image keeps orientation %d", tt.orientation, got)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(processed.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isRed(img.At(tt.redAt.X, tt.redAt.Y)) {
+			t.Fatalf("orientation %d: %v is not red", tt.orientation, tt.redAt)
+		}
+		if bytes.Contains(processed.Data, []byte("Exif")) {
+			t.Fatalf("orientation %d: EXIF is stored", tt.orientation)
+		}
+	}
+}
@@ -17,6 +17,14 @@ const (
 	AccessToken TokenType = "access"
 	// RefreshToken represents a refresh token
 	RefreshToken TokenType = "refresh"
+	// EmailVerificationToken is mailed to confirm that the user owns their email address
+	EmailVerificationToken TokenType = "email_verification"
+	// PasswordResetToken is mailed to let the user choose a new password
+	PasswordResetToken TokenType = "password_reset"
+	// CampusEmailToken is mailed to a campus address to prove enrolment for student verification
+	CampusEmailToken TokenType = "campus_email"
+	// TwoFactorToken is handed out by login when a second step is needed, and exchanged with a code for a session
+	TwoFactorToken TokenType = "two_factor"
 )
 
 // JWTClaims defines the claims in JWT tokens
@@ -25,6 +33,10 @@ type JWTClaims struct {
 	Email  string `json:"email"`
 	Type   string `json:"token_type"`
 	Role   string `json:"role,omitempty"`
+	// SessionID identifies the models.Session the token was issued for
+	SessionID string `json:"sid,omitempty"`
+	// Stamp ties a one-time token to the state it changes, so it stops working once that state changes
+	Stamp string `json:"stamp,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -33,44 +45,42 @@ func GenerateAccessToken(userID uint) (string, error) {
 	return GenerateToken(userID, "", AccessToken, "")
 }
 
-// GenerateRefreshToken 为用户生成刷新令牌
-func GenerateRefreshToken(userID uint) (string, error) {
-	return GenerateToken(userID, "", RefreshToken, "")
-}
-
-// ValidateRefreshToken 验证刷新令牌并返回用户ID
-func ValidateRefreshToken(tokenString string) (uint, error) {
-	claims, err := ValidateToken(tokenString)
-	if err != nil {
-		return 0, err
-	}
-
-	if claims.Type != string(RefreshToken) {
-		return 0, errors.New("token is not a refresh token")
+// TokenLifetime returns how long tokens of the given type stay valid
+func TokenLifetime(tokenType TokenType) time.Duration {
+	switch tokenType {
+	case AccessToken:
+		// Access tokens are short-lived so that revoking a session takes effect quickly
+		return time.Duration(config.AppConfig.AccessTokenExpiresIn) * time.Minute
+	case EmailVerificationToken, CampusEmailToken:
+		return 24 * time.Hour
+	case PasswordResetToken:
+		return 30 * time.Minute
+	case TwoFactorToken:
+		return 5 * time.Minute
+	default:
+		return time.Duration(config.AppConfig.TokenExpiresIn) * time.Minute
 	}
-
-	return claims.UserID, nil
 }
 
 // GenerateToken creates a new JWT token for a user
 func GenerateToken(userID uint, email string, tokenType TokenType, role string) (string, error) {
-	// Create token expiry time
-	var expiry time.Time
+	return GenerateSessionToken(userID, email, tokenType, role, "", "")
+}
 
-	if tokenType == AccessToken {
-		expiry = time.Now().Add(time.Duration(config.AppConfig.TokenExpiresIn) * time.Minute)
-	} else {
-		// Refresh tokens last longer
-		expiry = time.Now().Add(time.Duration(config.AppConfig.TokenExpiresIn*2) * time.Minute)
-	}
+// GenerateSessionToken creates a new JWT token bound to a session; tokenID becomes the jti claim
+func GenerateSessionToken(userID uint, email string, tokenType TokenType, role, sessionID, tokenID string) (string, error) {
+	// Create token expiry time
+	expiry := time.Now().Add(TokenLifetime(tokenType))
 
 	// Create the claims
 	claims := &JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Type:   string(tokenType),
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Type:      string(tokenType),
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(expiry),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -90,6 +100,38 @@ func GenerateToken(userID uint, email string, tokenType TokenType, role string)
 	return tokenString, nil
 }
 
+// GenerateAccountToken creates a signed token for an email verification or password reset link
+func GenerateAccountToken(userID uint, email string, tokenType TokenType, stamp string) (string, error) {
+	now := time.Now()
+	claims := &JWTClaims{
+		UserID: userID,
+		Email:  email,
+		Type:   string(tokenType),
+		Stamp:  stamp,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(TokenLifetime(tokenType))),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "nhcommunity",
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+}
+
+// ValidateAccessToken validates a JWT token and makes sure it is an access token,
+// so that refresh, verification and reset tokens cannot be used to call the API
+func ValidateAccessToken(tokenString string) (*JWTClaims, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != string(AccessToken) {
+		return nil, errors.New("token is not an access token")
+	}
+	return claims, nil
+}
+
 // ValidateToken validates the JWT token and returns claims
 func ValidateToken(tokenString string) (*JWTClaims, error) {
 	// Parse the token
@@ -114,20 +156,3 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 
 	return nil, errors.New("invalid token")
 }
-
-// GenerateTokenPair generates both access and refresh tokens
-func GenerateTokenPair(userID uint, email string) (accessToken string, refreshToken string, err error) {
-	// Generate access token
-	accessToken, err = GenerateToken(userID, email, AccessToken, "")
-	if err != nil {
-		return "", "", err
-	}
-
-	// Generate refresh token
-	refreshToken, err = GenerateToken(userID, email, RefreshToken, "")
-	if err != nil {
-		return "", "", err
-	}
-
-	return accessToken, refreshToken, nil
-}